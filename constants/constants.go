@@ -21,6 +21,26 @@ package constants
 // that defines a cluster monitored by rotor.
 const DefaultClusterLabelName = "tbn_cluster"
 
+// DrainingMetadataKey is the Instance metadata key used to mark
+// Instances that have been removed from service discovery but remain
+// available to in-flight requests until their drain period expires. It is
+// namespaced so that it cannot collide with metadata collected from
+// service discovery labels and tags.
+const DrainingMetadataKey = "rotor.draining"
+
+// HealthMetadataKey is the Instance metadata key used to record the
+// health of Instances actively checked by rotor. Its value is
+// HealthyMetadataValue or UnhealthyMetadataValue. Like
+// DrainingMetadataKey, it is namespaced.
+const HealthMetadataKey = "rotor.health"
+
+// HealthyMetadataValue and UnhealthyMetadataValue are the values of the
+// HealthMetadataKey metadata key.
+const (
+	HealthyMetadataValue   = "healthy"
+	UnhealthyMetadataValue = "unhealthy"
+)
+
 // TbnPublicVersion is the current version of all Turbine Labs open-source
 // software and artifacts.
 const TbnPublicVersion = "0.19.0"
@@ -0,0 +1,35 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+// Auditor records batches of Diffs, for example to reconstruct the changes
+// made to a Zone after the fact.
+type Auditor interface {
+	// Audit records a batch of Diffs. If dryRun is true, the Diffs were
+	// only logged. Otherwise, err is the result of applying them.
+	Audit(diffs []Diff, dryRun bool, err error)
+}
+
+// audit records a non-empty batch of Diffs with the Auditor in the given
+// DiffOpts, if any.
+func audit(opts DiffOpts, diffs []Diff, dryRun bool, err error) {
+	if opts.Auditor == nil || len(diffs) == 0 {
+		return
+	}
+
+	opts.Auditor.Audit(diffs, dryRun, err)
+}
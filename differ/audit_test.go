@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+type auditCall struct {
+	diffs  []Diff
+	dryRun bool
+	err    error
+}
+
+type fakeAuditor struct {
+	calls []auditCall
+}
+
+func (a *fakeAuditor) Audit(diffs []Diff, dryRun bool, err error) {
+	a.calls = append(a.calls, auditCall{diffs, dryRun, err})
+}
+
+func TestDiffAndPatchAudits(t *testing.T) {
+	differ, finishFn := mkMockSvcDiffer(t)
+	defer finishFn()
+
+	auditor := &fakeAuditor{}
+	opts := DiffOpts{Auditor: auditor}
+
+	proposed := mkClusters(zoneKey1, 1)
+	diffs := []Diff{NewDiffCreate(proposed[0])}
+	err := errors.New("foo bar")
+
+	gomock.InOrder(
+		differ.EXPECT().Diff(proposed, opts).Return(diffs, nil),
+		differ.EXPECT().Patch(diffs).Return(nil),
+		differ.EXPECT().Diff(proposed, opts).Return(diffs, nil),
+		differ.EXPECT().Patch(diffs).Return(err),
+		differ.EXPECT().Diff(proposed, opts).Return(nil, nil),
+		differ.EXPECT().Patch(nil).Return(nil),
+	)
+
+	DiffAndPatch(differ, proposed, opts)
+	DiffAndPatch(differ, proposed, opts)
+	DiffAndPatch(differ, proposed, opts)
+
+	assert.DeepEqual(t, auditor.calls, []auditCall{
+		{diffs: diffs},
+		{diffs: diffs, err: err},
+	})
+}
+
+func TestDiffAndPatchInstancesAudits(t *testing.T) {
+	differ, finishFn := mkMockSvcDiffer(t)
+	defer finishFn()
+
+	auditor := &fakeAuditor{}
+	opts := DiffOpts{Auditor: auditor}
+
+	proposed := mkClusters(zoneKey1, 1)
+	diffs := []Diff{NewDiffCreate(proposed[0])}
+	changes := InstanceChanges{}
+
+	gomock.InOrder(
+		differ.EXPECT().DiffInstances(changes, opts).Return(diffs, nil),
+		differ.EXPECT().Patch(diffs).Return(nil),
+	)
+
+	DiffAndPatchInstances(differ, changes, opts)
+
+	assert.DeepEqual(t, auditor.calls, []auditCall{{diffs: diffs}})
+}
+
+func TestLogDiffsAuditsDryRun(t *testing.T) {
+	auditor := &fakeAuditor{}
+
+	proposed := mkClusters(zoneKey1, 1)
+	diffs := []Diff{NewDiffCreate(proposed[0])}
+
+	assert.DeepEqual(t, logDiffs(diffs, DiffOpts{Auditor: auditor}), diffs)
+	assert.Equal(t, len(auditor.calls), 0)
+
+	assert.Nil(t, logDiffs(nil, DiffOpts{Auditor: auditor, DryRun: true}))
+	assert.Equal(t, len(auditor.calls), 0)
+
+	assert.Nil(t, logDiffs(diffs, DiffOpts{Auditor: auditor, DryRun: true}))
+	assert.DeepEqual(t, auditor.calls, []auditCall{{diffs: diffs, dryRun: true}})
+}
@@ -59,7 +59,13 @@ func NewDiffModify(cluster api.Cluster) Diff {
 // corresponding to the given ClusterKey. The given Cluster Checksum must
 // match the existing Checksum.
 func NewDiffDelete(clusterKey api.ClusterKey, checksum api.Checksum) Diff {
-	diff := diffDelete{clusterKey, checksum}
+	return newDiffDelete("", clusterKey, checksum)
+}
+
+// newDiffDelete is NewDiffDelete, recording the name of the Cluster for
+// display.
+func newDiffDelete(name string, clusterKey api.ClusterKey, checksum api.Checksum) Diff {
+	diff := diffDelete{clusterKey, checksum, name}
 	return &diff
 }
 
@@ -71,7 +77,18 @@ func NewDiffAddInstance(
 	checksum api.Checksum,
 	instance api.Instance,
 ) Diff {
-	diff := diffAddInstance{clusterKey, checksum, instance}
+	return newDiffAddInstance("", clusterKey, checksum, instance)
+}
+
+// newDiffAddInstance is NewDiffAddInstance, recording the name of the
+// Cluster for display.
+func newDiffAddInstance(
+	name string,
+	clusterKey api.ClusterKey,
+	checksum api.Checksum,
+	instance api.Instance,
+) Diff {
+	diff := diffAddInstance{clusterKey, checksum, instance, name}
 	return &diff
 }
 
@@ -83,7 +100,18 @@ func NewDiffRemoveInstance(
 	checksum api.Checksum,
 	instance api.Instance,
 ) Diff {
-	diff := diffRemoveInstance{clusterKey, checksum, instance}
+	return newDiffRemoveInstance("", clusterKey, checksum, instance)
+}
+
+// newDiffRemoveInstance is NewDiffRemoveInstance, recording the name of the
+// Cluster for display.
+func newDiffRemoveInstance(
+	name string,
+	clusterKey api.ClusterKey,
+	checksum api.Checksum,
+	instance api.Instance,
+) Diff {
+	diff := diffRemoveInstance{clusterKey, checksum, instance, name}
 	return &diff
 }
 
@@ -136,10 +164,25 @@ func diff(
 		console.Debug().Printf("Current Cluster %s Size: %d", cCluster.Name, len(cCluster.Instances))
 		console.Debug().Printf("Proposed Cluster %s Size: %d", pCluster.Name, len(pCluster.Instances))
 
-		// TODO: is it worth breaking this down into Add/RemoveInstance calls?
-		// Or is there some heuristic to determine how many differences there
-		// should be before we just wipe the Cluster?
 		if !cCluster.Instances.Equals(pCluster.Instances) {
+			// Small changes are applied instance by instance, large
+			// ones by replacing the Cluster's Instances wholesale. Any
+			// other change to the Cluster requires a modification.
+			if opts.MaxInstanceDiffs > 0 && onlyInstancesDiffer(cCluster, pCluster) {
+				instanceDiffs := replacementInstanceDiffs(cCluster, pCluster)
+				if len(instanceDiffs) <= opts.MaxInstanceDiffs {
+					diffs = append(diffs, instanceDiffs...)
+					continue
+				}
+
+				console.Debug().Printf(
+					"Cluster %s requires %d Instance changes (max %d), modifying",
+					pCluster.Name,
+					len(instanceDiffs),
+					opts.MaxInstanceDiffs,
+				)
+			}
+
 			patched := pCluster
 			patched.ClusterKey = cCluster.ClusterKey
 			patched.Checksum = cCluster.Checksum
@@ -157,7 +200,7 @@ func diff(
 	for _, cCluster := range current {
 		if !proposedSeen[cCluster.Name] {
 			if opts.IncludeDelete {
-				diffs = append(diffs, NewDiffDelete(cCluster.ClusterKey, cCluster.Checksum))
+				diffs = append(diffs, newDiffDelete(cCluster.Name, cCluster.ClusterKey, cCluster.Checksum))
 				console.Debug().Printf("Deleting Cluster %s", cCluster.Name)
 			} else {
 				console.Debug().Printf("IncludeDelete=false, not deleting Cluster %s", cCluster.Name)
@@ -165,6 +208,24 @@ func diff(
 		}
 	}
 
+	return logDiffs(diffs, opts)
+}
+
+// onlyInstancesDiffer reports whether the proposed Cluster matches the
+// current one in everything but its Instances and API-assigned fields.
+func onlyInstancesDiffer(cCluster, pCluster api.Cluster) bool {
+	pCluster.ClusterKey = cCluster.ClusterKey
+	pCluster.ZoneKey = cCluster.ZoneKey
+	pCluster.OrgKey = cCluster.OrgKey
+	pCluster.Checksum = cCluster.Checksum
+	pCluster.Instances = cCluster.Instances
+	return pCluster.Equals(cCluster)
+}
+
+// logDiffs logs the given diffs, at the info level if opts.DryRun is set and
+// at the debug level otherwise. It returns the diffs to apply, which are nil
+// for a dry run.
+func logDiffs(diffs []Diff, opts DiffOpts) []Diff {
 	var logger *log.Logger
 	if opts.DryRun {
 		logger = console.Info()
@@ -192,6 +253,7 @@ func diff(
 	}
 
 	if opts.DryRun {
+		audit(opts, diffs, true, nil)
 		return nil
 	}
 
@@ -300,6 +362,7 @@ func (d diffModify) DisplayMap() map[string]interface{} {
 type diffDelete struct {
 	clusterKey api.ClusterKey
 	checksum   api.Checksum
+	name       string
 }
 
 func (d diffDelete) Checksum() api.Checksum     { return d.checksum }
@@ -315,17 +378,18 @@ func (d diffDelete) String() string {
 	return fmt.Sprintf("DiffDelete{%s,%s}", d.clusterKey, d.checksum)
 }
 func (d diffDelete) DisplayMap() map[string]interface{} {
-	return map[string]interface{}{
+	return withName(map[string]interface{}{
 		"action":      "delete",
 		"cluster_key": d.clusterKey,
 		"checksum":    d.checksum.Checksum,
-	}
+	}, d.name)
 }
 
 type diffAddInstance struct {
 	clusterKey api.ClusterKey
 	checksum   api.Checksum
 	instance   api.Instance
+	name       string
 }
 
 func (d diffAddInstance) Checksum() api.Checksum     { return d.checksum }
@@ -338,21 +402,22 @@ func (d diffAddInstance) Patch(svc service.Cluster, checksum api.Checksum) (Diff
 	return nil, err
 }
 func (d diffAddInstance) String() string {
-	return fmt.Sprintf("DiffDelete{%s,%s,{%v}}", d.clusterKey, d.checksum, d.instance)
+	return fmt.Sprintf("DiffAddInstance{%s,%s,{%v}}", d.clusterKey, d.checksum, d.instance)
 }
 func (d diffAddInstance) DisplayMap() map[string]interface{} {
-	return map[string]interface{}{
+	return withName(map[string]interface{}{
 		"action":      "add_instance",
 		"cluster_key": d.clusterKey,
 		"checksum":    d.checksum.Checksum,
 		"instance":    d.instance,
-	}
+	}, d.name)
 }
 
 type diffRemoveInstance struct {
 	clusterKey api.ClusterKey
 	checksum   api.Checksum
 	instance   api.Instance
+	name       string
 }
 
 func (d diffRemoveInstance) Checksum() api.Checksum     { return d.checksum }
@@ -365,13 +430,21 @@ func (d diffRemoveInstance) Patch(svc service.Cluster, checksum api.Checksum) (D
 	return nil, err
 }
 func (d diffRemoveInstance) String() string {
-	return fmt.Sprintf("DiffDelete{%s,%s,{%v}}", d.clusterKey, d.checksum, d.instance)
+	return fmt.Sprintf("DiffRemoveInstance{%s,%s,{%v}}", d.clusterKey, d.checksum, d.instance)
 }
 func (d diffRemoveInstance) DisplayMap() map[string]interface{} {
-	return map[string]interface{}{
+	return withName(map[string]interface{}{
 		"action":      "remove_instance",
 		"cluster_key": d.clusterKey,
 		"checksum":    d.checksum.Checksum,
 		"instance":    d.instance,
+	}, d.name)
+}
+
+// withName adds the given Cluster name, if known, to a DisplayMap.
+func withName(m map[string]interface{}, name string) map[string]interface{} {
+	if name != "" {
+		m["name"] = name
 	}
+	return m
 }
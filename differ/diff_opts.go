@@ -23,6 +23,19 @@ type DiffOpts struct {
 	IgnoreCreate  bool // If true, don't include cluster creation in the []Diff
 	IncludeDelete bool // If true, include cluster deletion in the []Diff
 	DryRun        bool // If true, don't apply destructive operations
+
+	// MaxInstanceDiffs is the largest number of Instance additions and
+	// removals used to change an existing Cluster. Changes requiring more
+	// are applied by modifying the entire Cluster. If zero, Clusters are
+	// always modified in their entirety.
+	MaxInstanceDiffs int
+
+	// Guard, if non-nil, may refuse Diffs that remove too many Instances.
+	Guard Guard
+
+	// Auditor, if non-nil, records each batch of Diffs applied, or logged
+	// during a dry run.
+	Auditor Auditor
 }
 
 // DiffOptsFromFlags install flags necessary to configure a DiffOpts into the
@@ -51,5 +64,12 @@ func DiffOptsFromFlags(flagset tbnflag.FlagSet) *DiffOpts {
 		"Log changes at the info level rather than submitting them to the API",
 	)
 
+	flagset.IntVar(
+		&opts.MaxInstanceDiffs,
+		"max-instance-diffs",
+		0,
+		"The maximum number of instance additions and removals used to change an existing Cluster. Clusters requiring more changes are replaced in their entirety. If 0, Clusters are always replaced in their entirety.",
+	)
+
 	return opts
 }
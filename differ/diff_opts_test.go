@@ -62,3 +62,12 @@ func TestDiffOptsFromFlagsDryRun(t *testing.T) {
 	assert.False(t, diffOpts.IgnoreCreate)
 	assert.True(t, diffOpts.DryRun)
 }
+
+func TestDiffOptsFromFlagsMaxInstanceDiffs(t *testing.T) {
+	flagSet := tbnflag.NewTestFlagSet()
+	diffOpts := DiffOptsFromFlags(flagSet)
+	assert.Equal(t, diffOpts.MaxInstanceDiffs, 0)
+
+	flagSet.Parse([]string{"-max-instance-diffs=10"})
+	assert.Equal(t, diffOpts.MaxInstanceDiffs, 10)
+}
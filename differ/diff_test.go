@@ -191,3 +191,40 @@ func TestDiffDelete(t *testing.T) {
 			map[string]interface{}{"action": "delete"}
 	})
 }
+
+func TestNamedDiffDisplayMap(t *testing.T) {
+	instance := api.Instance{Host: "foo", Port: 1234}
+
+	assert.EqualJson(
+		t,
+		newDiffAddInstance("foo", key("ID-1"), csum("CS-1"), instance).DisplayMap(),
+		map[string]interface{}{
+			"action":      "add_instance",
+			"cluster_key": "ID-1",
+			"checksum":    "CS-1",
+			"instance":    instance,
+			"name":        "foo",
+		},
+	)
+	assert.EqualJson(
+		t,
+		newDiffRemoveInstance("foo", key("ID-1"), csum("CS-1"), instance).DisplayMap(),
+		map[string]interface{}{
+			"action":      "remove_instance",
+			"cluster_key": "ID-1",
+			"checksum":    "CS-1",
+			"instance":    instance,
+			"name":        "foo",
+		},
+	)
+	assert.EqualJson(
+		t,
+		newDiffDelete("foo", key("ID-1"), csum("CS-1")).DisplayMap(),
+		map[string]interface{}{
+			"action":      "delete",
+			"cluster_key": "ID-1",
+			"checksum":    "CS-1",
+			"name":        "foo",
+		},
+	)
+}
@@ -38,8 +38,15 @@ import (
 type Differ interface {
 	// Diff returns a slice of Diffs representing the changes necessary to make
 	// the Clusters in the Cluster service match the proposed slice of Clusters.
+	// If the DiffOpts include a Guard that refuses the Diffs, a *GuardError
+	// is returned.
 	Diff(proposed []api.Cluster, opts DiffOpts) ([]Diff, error)
 
+	// DiffInstances returns a slice of Diffs representing the changes
+	// necessary to add and remove the given Instances to and from the
+	// Clusters in the Cluster service.
+	DiffInstances(changes InstanceChanges, opts DiffOpts) ([]Diff, error)
+
 	// Patch will apply a slice of Diffs to the Cluster service.
 	Patch(diffs []Diff) error
 }
@@ -51,7 +58,8 @@ func New(svc service.Cluster, zoneKey api.ZoneKey) Differ {
 
 // DiffAndPatch uses the given Differ to add, modify, and remove Clusters in a
 // given ZoneKey to match the given slice of Clusters. The slice of Diffs
-// applied is returned.
+// applied is returned. The Diffs, and the result of applying them, are
+// recorded with the DiffOpts' Auditor, if any.
 func DiffAndPatch(
 	d Differ,
 	proposed []api.Cluster,
@@ -63,9 +71,11 @@ func DiffAndPatch(
 	}
 
 	err = d.Patch(diffs)
+	audit(opts, diffs, false, err)
 	if err != nil {
 		return nil, err
 	}
+	guardApplied(opts)
 
 	return diffs, nil
 }
@@ -81,7 +91,26 @@ func (s svcDiffer) Diff(proposed []api.Cluster, opts DiffOpts) ([]Diff, error) {
 	if err != nil {
 		return nil, err
 	}
-	return diff(s.zoneKey, current, proposed, opts), nil
+	diffs := diff(s.zoneKey, current, proposed, opts)
+	removed := func() map[string]api.Instances { return removedByDiffs(current, diffs) }
+	if err := checkGuard(opts, current, removed); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+func (s svcDiffer) DiffInstances(changes InstanceChanges, opts DiffOpts) ([]Diff, error) {
+	filter := service.ClusterFilter{ZoneKey: s.zoneKey}
+	current, err := s.svc.Index(filter)
+	if err != nil {
+		return nil, err
+	}
+	diffs := diffInstances(s.zoneKey, current, changes, opts)
+	removed := func() map[string]api.Instances { return removedByDiffs(current, diffs) }
+	if err := checkGuard(opts, current, removed); err != nil {
+		return nil, err
+	}
+	return diffs, nil
 }
 
 func (s svcDiffer) Patch(diffs []Diff) error {
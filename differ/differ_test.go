@@ -158,7 +158,7 @@ func TestDiffNonEmpty(t *testing.T) {
 	want := []Diff{
 		NewDiffModify(wantModify),
 		NewDiffCreate(wantCreate),
-		NewDiffDelete(z1Clusters[0].ClusterKey, z1Clusters[0].Checksum),
+		newDiffDelete(z1Clusters[0].Name, z1Clusters[0].ClusterKey, z1Clusters[0].Checksum),
 	}
 
 	got, err := differ.Diff(clusters, DiffOpts{IncludeDelete: true})
@@ -310,3 +310,101 @@ func TestDiffAndPatchPatchErr(t *testing.T) {
 	assert.Nil(t, gotDiffs)
 	assert.Equal(t, gotErr, err)
 }
+
+func TestDiffMaxInstanceDiffs(t *testing.T) {
+	differ, svc, finishFn := mkSvcDiffer(t)
+	defer finishFn()
+
+	storedClusters := mkClusters(zoneKey1, 1)
+
+	svc.EXPECT().
+		Index(service.ClusterFilter{ZoneKey: zoneKey1}).
+		Return(storedClusters, nil).
+		Times(3)
+
+	// replace Bar-0 with Baz-0 and change Foo-0's metadata: four
+	// instance diffs
+	clusters := mkClusters("", 1)
+	clusters[0].Instances[0].Metadata = api.Metadata{{Key: "foo", Value: "bar"}}
+	clusters[0].Instances[1] = api.Instance{Host: "Baz-0", Port: 9000}
+
+	ck := storedClusters[0].ClusterKey
+	cs := storedClusters[0].Checksum
+	wantInstanceDiffs := []Diff{
+		newDiffRemoveInstance("Cluster-0", ck, cs, storedClusters[0].Instances[1]),
+		newDiffAddInstance("Cluster-0", ck, cs, clusters[0].Instances[1]),
+		newDiffRemoveInstance("Cluster-0", ck, cs, storedClusters[0].Instances[0]),
+		newDiffAddInstance("Cluster-0", ck, cs, clusters[0].Instances[0]),
+	}
+
+	got, err := differ.Diff(clusters, DiffOpts{MaxInstanceDiffs: 4})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, wantInstanceDiffs)
+
+	wantModify := clusters[0]
+	wantModify.ClusterKey = ck
+	wantModify.Checksum = cs
+	wantModify.ZoneKey = zoneKey1
+
+	got, err = differ.Diff(clusters, DiffOpts{MaxInstanceDiffs: 3})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []Diff{NewDiffModify(wantModify)})
+
+	got, err = differ.Diff(clusters, DiffOpts{})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []Diff{NewDiffModify(wantModify)})
+}
+
+func TestDiffMaxInstanceDiffsWithOtherChanges(t *testing.T) {
+	differ, svc, finishFn := mkSvcDiffer(t)
+	defer finishFn()
+
+	storedClusters := mkClusters(zoneKey1, 1)
+
+	svc.EXPECT().
+		Index(service.ClusterFilter{ZoneKey: zoneKey1}).
+		Return(storedClusters, nil)
+
+	// a single instance change alongside a RequireTLS change
+	clusters := mkClusters("", 1)
+	clusters[0].Instances[1] = api.Instance{Host: "Baz-0", Port: 9000}
+	clusters[0].RequireTLS = true
+
+	wantModify := clusters[0]
+	wantModify.ClusterKey = storedClusters[0].ClusterKey
+	wantModify.Checksum = storedClusters[0].Checksum
+	wantModify.ZoneKey = zoneKey1
+
+	got, err := differ.Diff(clusters, DiffOpts{MaxInstanceDiffs: 10})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []Diff{NewDiffModify(wantModify)})
+}
+
+func TestDiffAndPatchInstanceDiffsChainChecksums(t *testing.T) {
+	differ, svc, finishFn := mkSvcDiffer(t)
+	defer finishFn()
+
+	storedClusters := mkClusters(zoneKey1, 1)
+	svc.EXPECT().
+		Index(service.ClusterFilter{ZoneKey: zoneKey1}).
+		Return(storedClusters, nil)
+
+	clusters := mkClusters("", 1)
+	removed := clusters[0].Instances[1]
+	added := api.Instance{Host: "Baz-0", Port: 9000}
+	clusters[0].Instances[1] = added
+
+	ck := storedClusters[0].ClusterKey
+	gomock.InOrder(
+		svc.EXPECT().
+			RemoveInstance(ck, csum("CS-1"), removed).
+			Return(api.Cluster{ClusterKey: ck, Checksum: csum("CS-2")}, nil),
+		svc.EXPECT().
+			AddInstance(ck, csum("CS-2"), added).
+			Return(api.Cluster{ClusterKey: ck, Checksum: csum("CS-3")}, nil),
+	)
+
+	diffs, err := DiffAndPatch(differ, clusters, DiffOpts{MaxInstanceDiffs: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, len(diffs), 2)
+}
@@ -0,0 +1,544 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turbinelabs/api"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+)
+
+const (
+	guardRefusedStat          = "guard.refused"
+	guardRefusedInstancesStat = "guard.refused_instances"
+	guardOverriddenStat       = "guard.overridden"
+	guardConfirmedStat        = "guard.confirmed"
+)
+
+// GuardOpts describe the limits enforced by a Guard. A zero value disables
+// the corresponding limit.
+type GuardOpts struct {
+	// MaxClusterRemovals is the largest number of Instances that may be
+	// removed from any one Cluster within the Window.
+	MaxClusterRemovals int
+
+	// MaxClusterRemovalPercent is the largest percentage of a Cluster's
+	// Instances that may be removed within the Window.
+	MaxClusterRemovalPercent float64
+
+	// MaxTotalRemovals is the largest number of Instances that may be
+	// removed from all Clusters within the Window.
+	MaxTotalRemovals int
+
+	// MaxTotalRemovalPercent is the largest percentage of all Instances
+	// that may be removed within the Window.
+	MaxTotalRemovalPercent float64
+
+	// Window is the period over which removals are accumulated. If zero,
+	// each set of Diffs is considered in isolation.
+	Window time.Duration
+
+	// Confirmations is the number of additional consecutive times a
+	// refused set of removals must be proposed before it is applied. If
+	// zero, refused removals are only applied after an override.
+	Confirmations int
+}
+
+// IsEmpty returns true if no limits are configured.
+func (o GuardOpts) IsEmpty() bool {
+	return o.MaxClusterRemovals <= 0 &&
+		o.MaxClusterRemovalPercent <= 0 &&
+		o.MaxTotalRemovals <= 0 &&
+		o.MaxTotalRemovalPercent <= 0
+}
+
+// GuardOptsFromFlags install flags necessary to configure a GuardOpts into
+// the provided FlagSet. Returns a pointer to the configured GuardOpts.
+func GuardOptsFromFlags(flagset tbnflag.FlagSet) *GuardOpts {
+	opts := &GuardOpts{}
+
+	flagset.IntVar(
+		&opts.MaxClusterRemovals,
+		"max-cluster-removals",
+		0,
+		"The maximum number of instances that may be removed from a single Cluster within the window. If 0, there is no limit.",
+	)
+
+	flagset.Float64Var(
+		&opts.MaxClusterRemovalPercent,
+		"max-cluster-removal-percent",
+		0,
+		"The maximum percentage of a Cluster's instances that may be removed within the window. If 0, there is no limit.",
+	)
+
+	flagset.IntVar(
+		&opts.MaxTotalRemovals,
+		"max-total-removals",
+		0,
+		"The maximum number of instances that may be removed from all Clusters within the window. If 0, there is no limit.",
+	)
+
+	flagset.Float64Var(
+		&opts.MaxTotalRemovalPercent,
+		"max-total-removal-percent",
+		0,
+		"The maximum percentage of all instances that may be removed within the window. If 0, there is no limit.",
+	)
+
+	flagset.DurationVar(
+		&opts.Window,
+		"window",
+		0,
+		"The period over which instance removals are accumulated when applying limits. If 0, each update is considered in isolation.",
+	)
+
+	flagset.IntVar(
+		&opts.Confirmations,
+		"confirmations",
+		0,
+		"The number of additional consecutive times refused instance removals must be observed before they are applied. If 0, refused removals are applied only after an override.",
+	)
+
+	return opts
+}
+
+// GuardError is returned when a Guard refuses a set of Diffs.
+type GuardError struct {
+	// Removed contains the refused Instance removals, keyed by Cluster
+	// name.
+	Removed map[string]api.Instances
+
+	// Reasons describes each exceeded limit.
+	Reasons []string
+}
+
+func (e *GuardError) Error() string {
+	return fmt.Sprintf(
+		"refusing to remove %d instances: %s",
+		countInstances(e.Removed),
+		strings.Join(e.Reasons, "; "),
+	)
+}
+
+// IsGuardError returns true if the given error was produced by a Guard.
+func IsGuardError(err error) bool {
+	_, ok := err.(*GuardError)
+	return ok
+}
+
+// Guard protects against the mass removal of Instances, as may result from
+// a truncated or empty response from a service discovery backend.
+type Guard interface {
+	// Check returns a *GuardError if removing the given Instances, keyed
+	// by Cluster name, from the current Clusters exceeds the Guard's
+	// limits.
+	Check(current []api.Cluster, removed map[string]api.Instances) error
+
+	// Applied indicates that the removals most recently allowed by Check
+	// were applied, counting them against future checks.
+	Applied()
+
+	// Override causes the next refused set of removals to be applied.
+	Override()
+
+	// Notify registers a function to be called each time Override is
+	// invoked.
+	Notify(func())
+}
+
+// NewGuard returns a Guard that enforces the given GuardOpts. Refusals,
+// overrides, and confirmations are counted in the given stats.Stats, which
+// may be nil.
+func NewGuard(opts GuardOpts, s stats.Stats) Guard {
+	if s == nil {
+		s = stats.NewNoopStats()
+	}
+
+	return &guard{
+		opts:  opts,
+		stats: s,
+		time:  tbntime.NewSource(),
+		mutex: &sync.Mutex{},
+	}
+}
+
+type guardRemoval struct {
+	at      time.Time
+	cluster string
+	count   int
+}
+
+type guard struct {
+	opts  GuardOpts
+	stats stats.Stats
+	time  tbntime.Source
+
+	mutex    *sync.Mutex
+	history  []guardRemoval
+	refused  string
+	seen     int
+	override bool
+	notify   []func()
+
+	// removals allowed by Check, awaiting Applied
+	pending           map[string]api.Instances
+	pendingOverridden bool
+}
+
+var _ Guard = &guard{}
+
+func (g *guard) Override() {
+	g.mutex.Lock()
+	console.Info().Println("deregistration guard: next refused update will be applied")
+	g.override = true
+	notify := g.notify
+	g.mutex.Unlock()
+
+	for _, f := range notify {
+		f()
+	}
+}
+
+func (g *guard) Notify(f func()) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.notify = append(g.notify, f)
+}
+
+func (g *guard) Applied() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.pending == nil {
+		return
+	}
+
+	if g.pendingOverridden {
+		g.override = false
+	}
+
+	if g.opts.Window > 0 {
+		now := g.time.Now()
+		for name, is := range g.pending {
+			if len(is) > 0 {
+				g.history = append(g.history, guardRemoval{now, name, len(is)})
+			}
+		}
+	}
+
+	g.pending = nil
+	g.pendingOverridden = false
+}
+
+func (g *guard) Check(current []api.Cluster, removed map[string]api.Instances) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.expire(g.time.Now())
+	g.pending = nil
+	g.pendingOverridden = false
+
+	if countInstances(removed) == 0 {
+		return nil
+	}
+
+	reasons := g.violations(current, removed)
+	if len(reasons) == 0 {
+		g.accept(removed, false)
+		return nil
+	}
+
+	fingerprint := removalFingerprint(removed)
+	if fingerprint == g.refused {
+		g.seen++
+	} else {
+		g.refused = fingerprint
+		g.seen = 0
+	}
+
+	err := &GuardError{Removed: removed, Reasons: reasons}
+
+	switch {
+	case g.override:
+		console.Info().Printf("deregistration guard: overridden: %s", err)
+		g.stats.Count(guardOverriddenStat, 1.0)
+		g.accept(removed, true)
+		return nil
+
+	case g.opts.Confirmations > 0 && g.seen >= g.opts.Confirmations:
+		console.Info().Printf(
+			"deregistration guard: confirmed %d times: %s",
+			g.seen,
+			err,
+		)
+		g.stats.Count(guardConfirmedStat, 1.0)
+		g.accept(removed, false)
+		return nil
+	}
+
+	console.Error().Printf("deregistration guard: %s", err)
+	for _, name := range sortedClusterNames(removed) {
+		for _, i := range removed[name] {
+			console.Error().Printf(
+				"deregistration guard: refused removal of %s from cluster %s",
+				i.Key(),
+				name,
+			)
+		}
+	}
+	g.stats.Count(guardRefusedStat, 1.0)
+	g.stats.Count(guardRefusedInstancesStat, float64(countInstances(removed)))
+
+	return err
+}
+
+// accept holds the given removals until they are applied and resets any
+// refused removals awaiting confirmation. An override is consumed only once
+// the removals it allowed are applied, so that a failed update may be
+// retried. Assumes mutex is locked.
+func (g *guard) accept(removed map[string]api.Instances, overridden bool) {
+	g.refused = ""
+	g.seen = 0
+	g.pending = removed
+	g.pendingOverridden = overridden
+}
+
+// expire discards removals older than the window. Assumes mutex is locked.
+func (g *guard) expire(now time.Time) {
+	cutoff := now.Add(-g.opts.Window)
+
+	i := 0
+	for ; i < len(g.history); i++ {
+		if g.history[i].at.After(cutoff) {
+			break
+		}
+	}
+	g.history = g.history[i:]
+}
+
+// violations returns a description of each limit exceeded by the given
+// removals, in addition to those already made within the window. Percentages
+// are relative to the number of Instances present at the start of the
+// window. Assumes mutex is locked.
+func (g *guard) violations(
+	current []api.Cluster,
+	removed map[string]api.Instances,
+) []string {
+	previous := map[string]int{}
+	previousTotal := 0
+	for _, r := range g.history {
+		previous[r.cluster] += r.count
+		previousTotal += r.count
+	}
+
+	sizes := map[string]int{}
+	total := 0
+	for _, c := range current {
+		sizes[c.Name] = len(c.Instances)
+		total += len(c.Instances)
+	}
+
+	reasons := []string{}
+	removedTotal := 0
+	for _, name := range sortedClusterNames(removed) {
+		count := len(removed[name]) + previous[name]
+		removedTotal += len(removed[name])
+
+		reasons = appendViolations(
+			reasons,
+			fmt.Sprintf("cluster %s", name),
+			count,
+			sizes[name]+previous[name],
+			g.opts.MaxClusterRemovals,
+			g.opts.MaxClusterRemovalPercent,
+		)
+	}
+
+	return appendViolations(
+		reasons,
+		"all clusters",
+		removedTotal+previousTotal,
+		total+previousTotal,
+		g.opts.MaxTotalRemovals,
+		g.opts.MaxTotalRemovalPercent,
+	)
+}
+
+func appendViolations(
+	reasons []string,
+	what string,
+	count int,
+	size int,
+	maxCount int,
+	maxPercent float64,
+) []string {
+	if maxCount > 0 && count > maxCount {
+		reasons = append(
+			reasons,
+			fmt.Sprintf("%s: %d removals exceeds limit of %d", what, count, maxCount),
+		)
+	}
+
+	if maxPercent > 0 && size > 0 {
+		percent := 100.0 * float64(count) / float64(size)
+		if percent > maxPercent {
+			reasons = append(
+				reasons,
+				fmt.Sprintf(
+					"%s: %.1f%% of instances removed exceeds limit of %.1f%%",
+					what,
+					percent,
+					maxPercent,
+				),
+			)
+		}
+	}
+
+	return reasons
+}
+
+// removedByDiffs returns the Instances in the current Clusters that would be
+// removed by applying the given Diffs, keyed by Cluster name.
+func removedByDiffs(current []api.Cluster, diffs []Diff) map[string]api.Instances {
+	currentMap := make(map[api.ClusterKey]api.Cluster, len(current))
+	for _, c := range current {
+		currentMap[c.ClusterKey] = c
+	}
+
+	remaining := map[api.ClusterKey]map[string]bool{}
+	keys := func(ck api.ClusterKey) map[string]bool {
+		if _, ok := remaining[ck]; !ok {
+			remaining[ck] = instanceKeys(currentMap[ck].Instances)
+		}
+		return remaining[ck]
+	}
+
+	for _, d := range diffs {
+		switch t := d.(type) {
+		case *diffModify:
+			remaining[t.cluster.ClusterKey] = instanceKeys(t.cluster.Instances)
+		case *diffDelete:
+			remaining[t.clusterKey] = map[string]bool{}
+		case *diffAddInstance:
+			keys(t.clusterKey)[t.instance.Key()] = true
+		case *diffRemoveInstance:
+			delete(keys(t.clusterKey), t.instance.Key())
+		}
+	}
+
+	removed := map[string]api.Instances{}
+	for ck, keys := range remaining {
+		c, ok := currentMap[ck]
+		if !ok {
+			continue
+		}
+		for _, i := range c.Instances {
+			if !keys[i.Key()] {
+				removed[c.Name] = append(removed[c.Name], i)
+			}
+		}
+	}
+	return removed
+}
+
+// removedByReplace returns the Instances in the current Clusters that are
+// not present in the proposed Clusters, keyed by Cluster name.
+func removedByReplace(current, proposed []api.Cluster) map[string]api.Instances {
+	proposedKeys := make(map[string]map[string]bool, len(proposed))
+	for _, c := range proposed {
+		proposedKeys[c.Name] = instanceKeys(c.Instances)
+	}
+
+	removed := map[string]api.Instances{}
+	for _, c := range current {
+		keys := proposedKeys[c.Name]
+		for _, i := range c.Instances {
+			if !keys[i.Key()] {
+				removed[c.Name] = append(removed[c.Name], i)
+			}
+		}
+	}
+	return removed
+}
+
+// checkGuard checks the given removals against opts.Guard, if any.
+func checkGuard(
+	opts DiffOpts,
+	current []api.Cluster,
+	removed func() map[string]api.Instances,
+) error {
+	if opts.Guard == nil || opts.DryRun {
+		return nil
+	}
+	return opts.Guard.Check(current, removed())
+}
+
+// guardApplied notifies opts.Guard, if any, that the Diffs it last allowed
+// were applied.
+func guardApplied(opts DiffOpts) {
+	if opts.Guard == nil || opts.DryRun {
+		return
+	}
+	opts.Guard.Applied()
+}
+
+func instanceKeys(instances api.Instances) map[string]bool {
+	keys := make(map[string]bool, len(instances))
+	for _, i := range instances {
+		keys[i.Key()] = true
+	}
+	return keys
+}
+
+func countInstances(m map[string]api.Instances) int {
+	n := 0
+	for _, is := range m {
+		n += len(is)
+	}
+	return n
+}
+
+func sortedClusterNames(m map[string]api.Instances) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// removalFingerprint produces a string identifying the given removals,
+// independent of order.
+func removalFingerprint(removed map[string]api.Instances) string {
+	keys := []string{}
+	for name, is := range removed {
+		for _, i := range is {
+			keys = append(keys, name+"/"+i.Key())
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,345 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/api/service"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkGuard(opts GuardOpts, s stats.Stats, src tbntime.Source) *guard {
+	g := NewGuard(opts, s).(*guard)
+	g.time = src
+	return g
+}
+
+func removals(cluster string, instances ...api.Instance) map[string]api.Instances {
+	return map[string]api.Instances{cluster: instances}
+}
+
+func TestGuardOptsIsEmpty(t *testing.T) {
+	assert.True(t, GuardOpts{}.IsEmpty())
+	assert.True(t, GuardOpts{Window: time.Minute, Confirmations: 2}.IsEmpty())
+	assert.False(t, GuardOpts{MaxClusterRemovals: 1}.IsEmpty())
+	assert.False(t, GuardOpts{MaxClusterRemovalPercent: 50}.IsEmpty())
+	assert.False(t, GuardOpts{MaxTotalRemovals: 1}.IsEmpty())
+	assert.False(t, GuardOpts{MaxTotalRemovalPercent: 50}.IsEmpty())
+}
+
+func TestGuardOptsFromFlags(t *testing.T) {
+	flagSet := tbnflag.NewTestFlagSet()
+	opts := GuardOptsFromFlags(flagSet.Scope("guard", ""))
+	assert.True(t, opts.IsEmpty())
+
+	flagSet.Parse([]string{
+		"-guard.max-cluster-removals=3",
+		"-guard.max-cluster-removal-percent=25",
+		"-guard.max-total-removals=10",
+		"-guard.max-total-removal-percent=12.5",
+		"-guard.window=5m",
+		"-guard.confirmations=2",
+	})
+	assert.Equal(t, *opts, GuardOpts{
+		MaxClusterRemovals:       3,
+		MaxClusterRemovalPercent: 25,
+		MaxTotalRemovals:         10,
+		MaxTotalRemovalPercent:   12.5,
+		Window:                   5 * time.Minute,
+		Confirmations:            2,
+	})
+}
+
+func TestRemovedByDiffs(t *testing.T) {
+	current := mkClusters(zoneKey1, 3)
+
+	modified := current[0]
+	modified.Instances = api.Instances{current[0].Instances[0]}
+
+	changed := current[2].Instances[0]
+	changed.Metadata = api.Metadata{{Key: "k", Value: "v"}}
+
+	diffs := []Diff{
+		NewDiffModify(modified),
+		NewDiffDelete(key("ID-1"), csum("CS-1")),
+		NewDiffRemoveInstance(key("ID-2"), csum("CS-1"), current[2].Instances[0]),
+		NewDiffAddInstance(key("ID-2"), csum("CS-1"), changed),
+		NewDiffCreate(api.Cluster{Name: "New"}),
+	}
+
+	assert.DeepEqual(t, removedByDiffs(current, diffs), map[string]api.Instances{
+		"Cluster-0": {current[0].Instances[1]},
+		"Cluster-1": current[1].Instances,
+	})
+	assert.DeepEqual(t, removedByDiffs(current, nil), map[string]api.Instances{})
+}
+
+func TestRemovedByReplace(t *testing.T) {
+	current := mkClusters(zoneKey1, 2)
+	proposed := []api.Cluster{
+		{Name: "Cluster-0", Instances: api.Instances{current[0].Instances[1]}},
+		{Name: "New", Instances: api.Instances{{Host: "h", Port: 1}}},
+	}
+
+	assert.DeepEqual(t, removedByReplace(current, proposed), map[string]api.Instances{
+		"Cluster-0": {current[0].Instances[0]},
+		"Cluster-1": current[1].Instances,
+	})
+}
+
+func TestGuardCheckClusterLimits(t *testing.T) {
+	current := mkClusters(zoneKey1, 2)
+	foo0 := current[0].Instances[0]
+	bar0 := current[0].Instances[1]
+
+	g := mkGuard(GuardOpts{MaxClusterRemovals: 1}, nil, tbntime.NewSource())
+	assert.Nil(t, g.Check(current, removals("Cluster-0", foo0)))
+	err := g.Check(current, removals("Cluster-0", foo0, bar0))
+	assert.ErrorContains(t, err, "cluster Cluster-0: 2 removals exceeds limit of 1")
+	assert.True(t, IsGuardError(err))
+
+	g = mkGuard(GuardOpts{MaxClusterRemovalPercent: 50}, nil, tbntime.NewSource())
+	assert.Nil(t, g.Check(current, removals("Cluster-0", foo0)))
+	assert.ErrorContains(
+		t,
+		g.Check(current, removals("Cluster-0", foo0, bar0)),
+		"cluster Cluster-0: 100.0% of instances removed exceeds limit of 50.0%",
+	)
+
+	assert.Nil(t, g.Check(current, nil))
+}
+
+func TestGuardCheckTotalLimits(t *testing.T) {
+	current := mkClusters(zoneKey1, 2)
+	removed := map[string]api.Instances{
+		"Cluster-0": current[0].Instances[:1],
+		"Cluster-1": current[1].Instances[:1],
+	}
+
+	g := mkGuard(GuardOpts{MaxTotalRemovals: 1}, nil, tbntime.NewSource())
+	assert.Nil(t, g.Check(current, removals("Cluster-1", current[1].Instances[0])))
+	assert.ErrorContains(
+		t,
+		g.Check(current, removed),
+		"all clusters: 2 removals exceeds limit of 1",
+	)
+
+	g = mkGuard(GuardOpts{MaxTotalRemovalPercent: 25}, nil, tbntime.NewSource())
+	assert.Nil(t, g.Check(current, removals("Cluster-1", current[1].Instances[0])))
+	assert.ErrorContains(
+		t,
+		g.Check(current, removed),
+		"all clusters: 50.0% of instances removed exceeds limit of 25.0%",
+	)
+}
+
+func TestGuardCheckWindow(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		current := mkClusters(zoneKey1, 1)
+		foo0 := current[0].Instances[0]
+		bar0 := current[0].Instances[1]
+
+		g := mkGuard(GuardOpts{MaxClusterRemovals: 1, Window: time.Minute}, nil, cs)
+		assert.Nil(t, g.Check(current, removals("Cluster-0", foo0)))
+
+		// a failed update is not counted, so retrying it is allowed
+		assert.Nil(t, g.Check(current, removals("Cluster-0", foo0)))
+		g.Applied()
+		g.Applied()
+
+		// foo0 is gone, but still counts against the window
+		current[0].Instances = api.Instances{bar0}
+		cs.Advance(30 * time.Second)
+		assert.ErrorContains(
+			t,
+			g.Check(current, removals("Cluster-0", bar0)),
+			"cluster Cluster-0: 2 removals exceeds limit of 1",
+		)
+
+		cs.Advance(31 * time.Second)
+		assert.Nil(t, g.Check(current, removals("Cluster-0", bar0)))
+	})
+}
+
+func TestGuardCheckConfirmations(t *testing.T) {
+	current := mkClusters(zoneKey1, 1)
+	all := removals("Cluster-0", current[0].Instances...)
+	other := removals("Cluster-0", current[0].Instances[0], api.Instance{Host: "x", Port: 1})
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	s := stats.NewMockStats(ctrl)
+	gomock.InOrder(
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardConfirmedStat, 1.0),
+	)
+
+	g := mkGuard(GuardOpts{MaxTotalRemovals: 1, Confirmations: 2}, s, tbntime.NewSource())
+	assert.NonNil(t, g.Check(current, all))
+	assert.NonNil(t, g.Check(current, all))
+
+	// different removals start over
+	assert.NonNil(t, g.Check(current, other))
+	assert.NonNil(t, g.Check(current, all))
+	assert.NonNil(t, g.Check(current, all))
+	assert.Nil(t, g.Check(current, all))
+
+	// but an accepted change resets the confirmations
+	g = mkGuard(GuardOpts{MaxTotalRemovals: 1, Confirmations: 1}, nil, tbntime.NewSource())
+	assert.NonNil(t, g.Check(current, all))
+	assert.Nil(t, g.Check(current, removals("Cluster-0", current[0].Instances[0])))
+	assert.NonNil(t, g.Check(current, all))
+	assert.Nil(t, g.Check(current, all))
+}
+
+func TestGuardCheckOverride(t *testing.T) {
+	current := mkClusters(zoneKey1, 1)
+	all := removals("Cluster-0", current[0].Instances...)
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	s := stats.NewMockStats(ctrl)
+	gomock.InOrder(
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+		s.EXPECT().Count(guardOverriddenStat, 1.0),
+		s.EXPECT().Count(guardOverriddenStat, 1.0),
+		s.EXPECT().Count(guardRefusedStat, 1.0),
+		s.EXPECT().Count(guardRefusedInstancesStat, 2.0),
+	)
+
+	g := mkGuard(GuardOpts{MaxTotalRemovals: 1}, s, tbntime.NewSource())
+	notified := 0
+	g.Notify(func() { notified++ })
+
+	assert.NonNil(t, g.Check(current, all))
+	g.Override()
+	assert.Equal(t, notified, 1)
+	assert.Nil(t, g.Check(current, all))
+
+	// the override is only consumed once the removals are applied
+	assert.Nil(t, g.Check(current, all))
+	g.Applied()
+	assert.NonNil(t, g.Check(current, all))
+}
+
+func TestSvcDifferGuard(t *testing.T) {
+	differ, svc, finishFn := mkSvcDiffer(t)
+	defer finishFn()
+
+	current := mkClusters(zoneKey1, 2)
+	proposed := mkClusters(zoneKey1, 2)
+	proposed[0].Instances = nil
+
+	opts := DiffOpts{
+		IncludeDelete: true,
+		Guard:         NewGuard(GuardOpts{MaxTotalRemovals: 1}, nil),
+	}
+
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: zoneKey1}).Return(current, nil).Times(4)
+
+	got, err := differ.Diff(proposed, opts)
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "refusing to remove 2 instances")
+
+	got, err = differ.DiffInstances(
+		InstanceChanges{Remove: removals("Cluster-1", current[1].Instances...)},
+		opts,
+	)
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "refusing to remove 2 instances")
+
+	got, err = differ.DiffInstances(
+		InstanceChanges{Remove: removals("Cluster-1", current[1].Instances[0])},
+		opts,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, len(got), 1)
+
+	opts.DryRun = true
+	got, err = differ.Diff(proposed, opts)
+	assert.Nil(t, got)
+	assert.Nil(t, err)
+}
+
+func TestDiffAndPatchGuardApplied(t *testing.T) {
+	differ, svc, finishFn := mkSvcDiffer(t)
+	defer finishFn()
+
+	current := mkClusters(zoneKey1, 1)
+	proposed := mkClusters(zoneKey1, 1)
+	proposed[0].Instances = proposed[0].Instances[:1]
+
+	opts := DiffOpts{
+		Guard: NewGuard(GuardOpts{MaxTotalRemovals: 1, Window: time.Minute}, nil),
+	}
+
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: zoneKey1}).Return(current, nil).Times(3)
+	gomock.InOrder(
+		svc.EXPECT().Modify(gomock.Any()).Return(api.Cluster{}, errors.New("boom")),
+		svc.EXPECT().Modify(gomock.Any()).Return(proposed[0], nil),
+	)
+
+	// the failed patch does not count against the window
+	_, err := DiffAndPatch(differ, proposed, opts)
+	assert.ErrorContains(t, err, "boom")
+
+	_, err = DiffAndPatch(differ, proposed, opts)
+	assert.Nil(t, err)
+
+	_, err = DiffAndPatch(differ, proposed, opts)
+	assert.ErrorContains(t, err, "refusing to remove 1 instances")
+}
+
+func TestStandaloneDifferGuard(t *testing.T) {
+	current := mkClusters(zoneKey1, 1)
+	sd := standaloneDiffer{
+		state: &standaloneState{
+			clusters: map[api.ClusterKey]api.Cluster{"Cluster-0": current[0]},
+		},
+	}
+
+	opts := DiffOpts{Guard: NewGuard(GuardOpts{MaxClusterRemovals: 1}, nil)}
+
+	got, err := sd.Diff(nil, opts)
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "cluster Cluster-0: 2 removals exceeds limit of 1")
+
+	got, err = sd.Diff([]api.Cluster{{Name: "Cluster-0", Instances: current[0].Instances[:1]}}, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, len(got), 1)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"sort"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// InstanceChanges describes Instances to be added to and removed from
+// Clusters, keyed by Cluster name. Instances are identified by host and port.
+type InstanceChanges struct {
+	Add    map[string]api.Instances
+	Remove map[string]api.Instances
+}
+
+// IsEmpty returns true if there are no Instances to add or remove.
+func (c InstanceChanges) IsEmpty() bool {
+	for _, is := range c.Add {
+		if len(is) > 0 {
+			return false
+		}
+	}
+	for _, is := range c.Remove {
+		if len(is) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterNames returns the sorted names of all Clusters with changes.
+func (c InstanceChanges) clusterNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, m := range []map[string]api.Instances{c.Add, c.Remove} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DiffAndPatchInstances uses the given Differ to add and remove Instances
+// from Clusters in a given ZoneKey. The slice of Diffs applied is returned.
+// Patch is not invoked if there are no Diffs to apply. The Diffs, and the
+// result of applying them, are recorded with the DiffOpts' Auditor, if any.
+func DiffAndPatchInstances(
+	d Differ,
+	changes InstanceChanges,
+	opts DiffOpts,
+) ([]Diff, error) {
+	diffs, err := d.DiffInstances(changes, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+
+	err = d.Patch(diffs)
+	audit(opts, diffs, false, err)
+	if err != nil {
+		return nil, err
+	}
+	guardApplied(opts)
+
+	return diffs, nil
+}
+
+// diffInstances produces a []Diff that applies the given InstanceChanges to
+// the current Clusters. Instances added to a Cluster that does not exist
+// produce a Create, unless opts.IgnoreCreate is set. Removing an Instance
+// that is not present in the current Cluster is ignored. Adding an Instance
+// whose host and port match an existing Instance with different metadata
+// replaces it.
+func diffInstances(
+	zoneKey api.ZoneKey,
+	current []api.Cluster,
+	changes InstanceChanges,
+	opts DiffOpts,
+) []Diff {
+	currentMap := make(map[string]api.Cluster, len(current))
+	for _, cluster := range current {
+		currentMap[cluster.Name] = cluster
+	}
+
+	diffs := make([]Diff, 0)
+	for _, name := range changes.clusterNames() {
+		adds := changes.Add[name]
+		removes := changes.Remove[name]
+
+		cCluster, ok := currentMap[name]
+		if !ok {
+			if len(adds) == 0 {
+				continue
+			}
+
+			if opts.IgnoreCreate {
+				console.Debug().Printf(
+					"IgnoreCreate=true, not creating Cluster %s, (%d Instances)",
+					name,
+					len(adds),
+				)
+				continue
+			}
+
+			instances := make(api.Instances, len(adds))
+			copy(instances, adds)
+			sort.Sort(api.InstancesByHostPort(instances))
+			diffs = append(
+				diffs,
+				NewDiffCreate(api.Cluster{Name: name, ZoneKey: zoneKey, Instances: instances}),
+			)
+			console.Debug().Printf("Creating Cluster %s, (%d Instances)", name, len(instances))
+			continue
+		}
+
+		diffs = append(diffs, clusterInstanceDiffs(cCluster, adds, removes)...)
+	}
+
+	return logDiffs(diffs, opts)
+}
+
+// clusterInstanceDiffs produces AddInstance and RemoveInstance diffs that
+// apply the given additions and removals to the current Cluster. Removals
+// precede additions. An added Instance matching the host and port of an
+// existing Instance with different metadata is removed and re-added.
+func clusterInstanceDiffs(cCluster api.Cluster, adds, removes api.Instances) []Diff {
+	existing := make(map[string]api.Instance, len(cCluster.Instances))
+	for _, i := range cCluster.Instances {
+		existing[i.Key()] = i
+	}
+
+	ck := cCluster.ClusterKey
+	cs := cCluster.Checksum
+
+	diffs := []Diff{}
+	for _, i := range sortedInstances(removes) {
+		if e, ok := existing[i.Key()]; ok {
+			diffs = append(diffs, newDiffRemoveInstance(cCluster.Name, ck, cs, e))
+			delete(existing, i.Key())
+			console.Debug().Printf("Removing Instance %s from Cluster %s", i.Key(), cCluster.Name)
+		}
+	}
+
+	for _, i := range sortedInstances(adds) {
+		if e, ok := existing[i.Key()]; ok {
+			if e.Equals(i) {
+				continue
+			}
+			diffs = append(diffs, newDiffRemoveInstance(cCluster.Name, ck, cs, e))
+		}
+
+		diffs = append(diffs, newDiffAddInstance(cCluster.Name, ck, cs, i))
+		existing[i.Key()] = i
+		console.Debug().Printf("Adding Instance %s to Cluster %s", i.Key(), cCluster.Name)
+	}
+
+	return diffs
+}
+
+// replacementInstanceDiffs produces AddInstance and RemoveInstance diffs
+// that change the Instances of the current Cluster to match the proposed
+// Cluster.
+func replacementInstanceDiffs(cCluster, pCluster api.Cluster) []Diff {
+	proposed := make(map[string]bool, len(pCluster.Instances))
+	for _, i := range pCluster.Instances {
+		proposed[i.Key()] = true
+	}
+
+	removes := api.Instances{}
+	for _, i := range cCluster.Instances {
+		if !proposed[i.Key()] {
+			removes = append(removes, i)
+		}
+	}
+
+	return clusterInstanceDiffs(cCluster, pCluster.Instances, removes)
+}
+
+func sortedInstances(is api.Instances) api.Instances {
+	sorted := make(api.Instances, len(is))
+	copy(sorted, is)
+	sort.Sort(api.InstancesByHostPort(sorted))
+	return sorted
+}
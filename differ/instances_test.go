@@ -0,0 +1,222 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/api/service"
+	"github.com/turbinelabs/rotor/xds/poller"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestInstanceChangesIsEmpty(t *testing.T) {
+	assert.True(t, InstanceChanges{}.IsEmpty())
+	assert.True(t, InstanceChanges{Add: map[string]api.Instances{"c": nil}}.IsEmpty())
+	assert.False(t, InstanceChanges{
+		Remove: map[string]api.Instances{"c": {{Host: "h", Port: 1}}},
+	}.IsEmpty())
+}
+
+func TestDiffInstances(t *testing.T) {
+	current := mkClusters(zoneKey1, 2)
+	changed := api.Instance{
+		Host:     "Bar-1",
+		Port:     8002,
+		Metadata: api.Metadata{{Key: "k", Value: "v"}},
+	}
+
+	changes := InstanceChanges{
+		Add: map[string]api.Instances{
+			"Cluster-0": {
+				{Host: "Baz-0", Port: 9000},
+				{Host: "Foo-0", Port: 8000},
+			},
+			"Cluster-1": {changed},
+			"New":       {{Host: "b", Port: 2}, {Host: "a", Port: 1}},
+		},
+		Remove: map[string]api.Instances{
+			"Cluster-0": {{Host: "Bar-0", Port: 8001}, {Host: "Nope", Port: 1}},
+			"Missing":   {{Host: "x", Port: 1}},
+		},
+	}
+
+	got := diffInstances(zoneKey1, current, changes, DiffOpts{})
+	want := []Diff{
+		newDiffRemoveInstance("Cluster-0", key("ID-0"), csum("CS-1"), current[0].Instances[1]),
+		newDiffAddInstance(
+			"Cluster-0",
+			key("ID-0"),
+			csum("CS-1"),
+			api.Instance{Host: "Baz-0", Port: 9000},
+		),
+		newDiffRemoveInstance("Cluster-1", key("ID-1"), csum("CS-1"), current[1].Instances[1]),
+		newDiffAddInstance("Cluster-1", key("ID-1"), csum("CS-1"), changed),
+		NewDiffCreate(api.Cluster{
+			Name:      "New",
+			ZoneKey:   zoneKey1,
+			Instances: api.Instances{{Host: "a", Port: 1}, {Host: "b", Port: 2}},
+		}),
+	}
+	assert.DeepEqual(t, got, want)
+
+	got = diffInstances(zoneKey1, current, changes, DiffOpts{IgnoreCreate: true})
+	assert.DeepEqual(t, got, want[:4])
+
+	assert.Nil(t, diffInstances(zoneKey1, current, changes, DiffOpts{DryRun: true}))
+	assert.Nil(t, diffInstances(zoneKey1, current, InstanceChanges{}, DiffOpts{}))
+}
+
+func TestSvcDifferDiffInstances(t *testing.T) {
+	d, svc, finish := mkSvcDiffer(t)
+	defer finish()
+
+	current := mkClusters(zoneKey1, 1)
+	changes := InstanceChanges{
+		Remove: map[string]api.Instances{"Cluster-0": {{Host: "Foo-0", Port: 8000}}},
+	}
+
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: zoneKey1}).Return(current, nil)
+	got, err := d.DiffInstances(changes, DiffOpts{})
+	assert.Nil(t, err)
+	assert.DeepEqual(
+		t,
+		got,
+		[]Diff{
+			newDiffRemoveInstance("Cluster-0", key("ID-0"), csum("CS-1"), current[0].Instances[0]),
+		},
+	)
+
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: zoneKey1}).Return(nil, errors.New("boom"))
+	got, err = d.DiffInstances(changes, DiffOpts{})
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestDiffAndPatchInstances(t *testing.T) {
+	d, svc, finish := mkSvcDiffer(t)
+	defer finish()
+
+	current := mkClusters(zoneKey1, 1)
+	added := api.Instance{Host: "a", Port: 1}
+	removed := current[0].Instances[0]
+	changes := InstanceChanges{
+		Add:    map[string]api.Instances{"Cluster-0": {added}},
+		Remove: map[string]api.Instances{"Cluster-0": {removed}},
+	}
+
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: zoneKey1}).Return(current, nil)
+	gomock.InOrder(
+		svc.EXPECT().
+			RemoveInstance(key("ID-0"), csum("CS-1"), removed).
+			Return(api.Cluster{ClusterKey: "ID-0", Checksum: csum("CS-2")}, nil),
+		svc.EXPECT().
+			AddInstance(key("ID-0"), csum("CS-2"), added).
+			Return(api.Cluster{ClusterKey: "ID-0", Checksum: csum("CS-3")}, nil),
+	)
+
+	diffs, err := DiffAndPatchInstances(d, changes, DiffOpts{})
+	assert.Nil(t, err)
+	assert.Equal(t, len(diffs), 2)
+}
+
+func TestDiffAndPatchInstancesNoDiffs(t *testing.T) {
+	d, finish := mkMockSvcDiffer(t)
+	defer finish()
+
+	d.EXPECT().DiffInstances(InstanceChanges{}, DiffOpts{}).Return(nil, nil)
+
+	diffs, err := DiffAndPatchInstances(d, InstanceChanges{}, DiffOpts{})
+	assert.Nil(t, diffs)
+	assert.Nil(t, err)
+}
+
+func TestDiffAndPatchInstancesErrors(t *testing.T) {
+	d, finish := mkMockSvcDiffer(t)
+	defer finish()
+
+	diffs := []Diff{NewDiffAddInstance(key("k"), csum("c"), api.Instance{Host: "h", Port: 1})}
+
+	d.EXPECT().DiffInstances(InstanceChanges{}, DiffOpts{}).Return(nil, errors.New("diff"))
+	_, err := DiffAndPatchInstances(d, InstanceChanges{}, DiffOpts{})
+	assert.ErrorContains(t, err, "diff")
+
+	d.EXPECT().DiffInstances(InstanceChanges{}, DiffOpts{}).Return(diffs, nil)
+	d.EXPECT().Patch(diffs).Return(errors.New("patch"))
+	_, err = DiffAndPatchInstances(d, InstanceChanges{}, DiffOpts{})
+	assert.ErrorContains(t, err, "patch")
+}
+
+func TestStandaloneDifferInstances(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	consumer := poller.NewMockConsumer(ctrl)
+	mkDiffer, _ := NewStandalone(1234, "proxy", "zone")
+	d := mkDiffer(consumer)
+
+	var published []*poller.Objects
+	consumer.EXPECT().Consume(gomock.Any()).Do(func(objs *poller.Objects) {
+		published = append(published, objs)
+	}).AnyTimes()
+
+	diffs, err := d.Diff(api.Clusters{
+		{Name: "c1", Instances: api.Instances{{Host: "a", Port: 1}}},
+	}, DiffOpts{})
+	assert.Nil(t, err)
+	assert.Nil(t, d.Patch(diffs))
+
+	_, err = DiffAndPatchInstances(
+		d,
+		InstanceChanges{
+			Add: map[string]api.Instances{
+				"c1": {{Host: "b", Port: 2}},
+				"c2": {{Host: "c", Port: 3}},
+			},
+			Remove: map[string]api.Instances{"c1": {{Host: "a", Port: 1}}},
+		},
+		DiffOpts{},
+	)
+	assert.Nil(t, err)
+
+	assert.Equal(t, len(published), 2)
+	assert.ArrayEqual(t, published[1].Clusters, api.Clusters{
+		{ClusterKey: "c1", Name: "c1", Instances: api.Instances{{Host: "b", Port: 2}}},
+		{ClusterKey: "c2", Name: "c2", ZoneKey: "zone", Instances: api.Instances{{Host: "c", Port: 3}}},
+	})
+	assert.Equal(t, len(published[1].Domains), 2)
+
+	// a replacement discards previous state
+	diffs, err = d.Diff(api.Clusters{{Name: "c3"}}, DiffOpts{})
+	assert.Nil(t, err)
+	assert.Nil(t, d.Patch(diffs))
+	assert.Equal(t, len(published[2].Clusters), 1)
+}
+
+func TestStandaloneDifferPatchUnknownCluster(t *testing.T) {
+	sd := standaloneDiffer{state: &standaloneState{}}
+
+	err := sd.Patch([]Diff{NewDiffAddInstance(key("x"), csum(""), api.Instance{})})
+	assert.ErrorContains(t, err, "unknown cluster x")
+
+	err = sd.Patch([]Diff{NewDiffRemoveInstance(key("x"), csum(""), api.Instance{})})
+	assert.ErrorContains(t, err, "unknown cluster x")
+}
@@ -45,6 +45,19 @@ func (mr *MockDifferMockRecorder) Diff(proposed, opts interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Diff", reflect.TypeOf((*MockDiffer)(nil).Diff), proposed, opts)
 }
 
+// DiffInstances mocks base method
+func (m *MockDiffer) DiffInstances(changes InstanceChanges, opts DiffOpts) ([]Diff, error) {
+	ret := m.ctrl.Call(m, "DiffInstances", changes, opts)
+	ret0, _ := ret[0].([]Diff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiffInstances indicates an expected call of DiffInstances
+func (mr *MockDifferMockRecorder) DiffInstances(changes, opts interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiffInstances", reflect.TypeOf((*MockDiffer)(nil).DiffInstances), changes, opts)
+}
+
 // Patch mocks base method
 func (m *MockDiffer) Patch(diffs []Diff) error {
 	ret := m.ctrl.Call(m, "Patch", diffs)
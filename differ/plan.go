@@ -0,0 +1,415 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/api/service"
+)
+
+// PlanAction describes how a Cluster is changed by a Plan.
+type PlanAction string
+
+const (
+	// PlanCreate indicates the Cluster is created.
+	PlanCreate PlanAction = "create"
+
+	// PlanModify indicates an existing Cluster is changed.
+	PlanModify PlanAction = "modify"
+
+	// PlanDelete indicates an existing Cluster is deleted.
+	PlanDelete PlanAction = "delete"
+)
+
+// InstanceChange describes an Instance whose metadata is changed.
+type InstanceChange struct {
+	Before api.Instance
+	After  api.Instance
+}
+
+// ClusterPlan describes the changes made to a single Cluster.
+type ClusterPlan struct {
+	Name   string
+	Action PlanAction
+
+	// Added and Removed are the Instances added to and removed from the
+	// Cluster, sorted by host and port.
+	Added   api.Instances
+	Removed api.Instances
+
+	// Changed are the Instances whose metadata is changed, sorted by host
+	// and port.
+	Changed []InstanceChange
+
+	// AttributesChanged is true if properties of an existing Cluster other
+	// than its Instances, such as its circuit breakers or health checks,
+	// are changed.
+	AttributesChanged bool
+}
+
+// Plan describes the changes a slice of Diffs would make to the Clusters
+// in a Zone, by Cluster, sorted by Cluster name. Clusters that would not
+// change are omitted.
+type Plan []ClusterPlan
+
+// HasChanges returns true if the Plan changes any Cluster.
+func (p Plan) HasChanges() bool {
+	return len(p) > 0
+}
+
+// NewPlan returns the Plan for applying the given Diffs to the current
+// Clusters. If replace is true and every Diff is a Create, the Diffs
+// replace the current Clusters entirely, as they do for a standalone
+// Differ.
+func NewPlan(current []api.Cluster, diffs []Diff, replace bool) Plan {
+	before := make(map[string]api.Cluster, len(current))
+	names := make(map[api.ClusterKey]string, len(current))
+	for _, c := range current {
+		before[c.Name] = c
+		names[c.ClusterKey] = c.Name
+	}
+
+	if replace {
+		for _, d := range diffs {
+			if _, ok := d.(*diffCreate); !ok {
+				replace = false
+				break
+			}
+		}
+	}
+
+	// after holds the resulting Cluster, by name, for each Cluster touched
+	// by the Diffs; nil indicates the Cluster is deleted.
+	after := map[string]*api.Cluster{}
+	if replace {
+		for name := range before {
+			after[name] = nil
+		}
+	}
+
+	nameOf := func(ck api.ClusterKey) string {
+		if name, ok := names[ck]; ok {
+			return name
+		}
+		return string(ck)
+	}
+
+	resulting := func(name string) *api.Cluster {
+		if c, ok := after[name]; ok {
+			return c
+		}
+		if c, ok := before[name]; ok {
+			after[name] = &c
+			return &c
+		}
+		return nil
+	}
+
+	for _, d := range diffs {
+		switch t := d.(type) {
+		case *diffCreate:
+			c := t.cluster
+			after[c.Name] = &c
+
+		case *diffModify:
+			c := t.cluster
+			after[c.Name] = &c
+
+		case *diffDelete:
+			after[nameOf(t.clusterKey)] = nil
+
+		case *diffAddInstance:
+			if c := resulting(nameOf(t.clusterKey)); c != nil {
+				c.Instances = append(withoutInstance(c.Instances, t.instance), t.instance)
+			}
+
+		case *diffRemoveInstance:
+			if c := resulting(nameOf(t.clusterKey)); c != nil {
+				c.Instances = withoutInstance(c.Instances, t.instance)
+			}
+		}
+	}
+
+	plan := Plan{}
+	for name, a := range after {
+		b, existed := before[name]
+		switch {
+		case a == nil && existed:
+			plan = append(
+				plan,
+				ClusterPlan{Name: name, Action: PlanDelete, Removed: sortedInstances(b.Instances)},
+			)
+
+		case a == nil:
+			continue
+
+		case !existed:
+			plan = append(
+				plan,
+				ClusterPlan{Name: name, Action: PlanCreate, Added: sortedInstances(a.Instances)},
+			)
+
+		default:
+			if cp, changed := modifyPlan(b, *a); changed {
+				plan = append(plan, cp)
+			}
+		}
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Name < plan[j].Name })
+	return plan
+}
+
+// modifyPlan returns the ClusterPlan changing the before Cluster into the
+// after Cluster, and whether there are any changes.
+func modifyPlan(before, after api.Cluster) (ClusterPlan, bool) {
+	cp := ClusterPlan{Name: before.Name, Action: PlanModify}
+
+	afterInstances := make(map[string]api.Instance, len(after.Instances))
+	for _, i := range after.Instances {
+		afterInstances[i.Key()] = i
+	}
+
+	beforeKeys := make(map[string]bool, len(before.Instances))
+	for _, i := range sortedInstances(before.Instances) {
+		beforeKeys[i.Key()] = true
+		a, ok := afterInstances[i.Key()]
+		switch {
+		case !ok:
+			cp.Removed = append(cp.Removed, i)
+		case !a.Metadata.Equals(i.Metadata):
+			cp.Changed = append(cp.Changed, InstanceChange{Before: i, After: a})
+		}
+	}
+
+	for _, i := range sortedInstances(after.Instances) {
+		if !beforeKeys[i.Key()] {
+			cp.Added = append(cp.Added, i)
+		}
+	}
+
+	cp.AttributesChanged = !clusterAttributes(before).Equals(clusterAttributes(after))
+
+	changed := cp.AttributesChanged ||
+		len(cp.Added) > 0 ||
+		len(cp.Removed) > 0 ||
+		len(cp.Changed) > 0
+
+	return cp, changed
+}
+
+// clusterAttributes returns a copy of the Cluster without its Instances or
+// the fields assigned by the API.
+func clusterAttributes(c api.Cluster) api.Cluster {
+	c.ClusterKey = ""
+	c.ZoneKey = ""
+	c.OrgKey = ""
+	c.Checksum = api.Checksum{}
+	c.Instances = nil
+	return c
+}
+
+func withoutInstance(instances api.Instances, instance api.Instance) api.Instances {
+	result := make(api.Instances, 0, len(instances))
+	for _, i := range instances {
+		if i.Key() != instance.Key() {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Write renders the Plan to the given io.Writer in a form resembling a
+// unified diff, followed by a summary line. Added Instances and metadata
+// are prefixed with "+", removed ones with "-", and changed Instances with
+// "~".
+func (p Plan) Write(w io.Writer) error {
+	pw := &planWriter{w: w}
+
+	var creates, modifies, deletes, adds, removes, changes int
+	for _, cp := range p {
+		switch cp.Action {
+		case PlanCreate:
+			creates++
+			pw.printf("+ cluster %s (create)\n", cp.Name)
+		case PlanModify:
+			modifies++
+			pw.printf("~ cluster %s (modify)\n", cp.Name)
+			if cp.AttributesChanged {
+				pw.printf("    attributes changed\n")
+			}
+		case PlanDelete:
+			deletes++
+			pw.printf("- cluster %s (delete)\n", cp.Name)
+		}
+
+		for _, i := range cp.Removed {
+			pw.instance("-", i)
+		}
+		for _, i := range cp.Added {
+			pw.instance("+", i)
+		}
+		for _, c := range cp.Changed {
+			pw.change(c)
+		}
+
+		adds += len(cp.Added)
+		removes += len(cp.Removed)
+		changes += len(cp.Changed)
+	}
+
+	if !p.HasChanges() {
+		pw.printf("No changes.\n")
+	} else {
+		pw.printf(
+			"\nPlan: %d to create, %d to modify, %d to delete; "+
+				"%d instances to add, %d to remove, %d to change.\n",
+			creates,
+			modifies,
+			deletes,
+			adds,
+			removes,
+			changes,
+		)
+	}
+
+	return pw.err
+}
+
+// planWriter writes to an io.Writer, retaining the first error.
+type planWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *planWriter) printf(format string, args ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+func (pw *planWriter) instance(prefix string, i api.Instance) {
+	pw.printf("%s   %s\n", prefix, i.Key())
+	for _, md := range sortedMetadata(i.Metadata) {
+		pw.printf("%s     %s=%s\n", prefix, md.Key, md.Value)
+	}
+}
+
+func (pw *planWriter) change(c InstanceChange) {
+	pw.printf("~   %s\n", c.Before.Key())
+
+	before := c.Before.Metadata.Map()
+	after := c.After.Metadata.Map()
+	for _, md := range sortedMetadata(c.Before.Metadata) {
+		if v, ok := after[md.Key]; !ok || v != md.Value {
+			pw.printf("-     %s=%s\n", md.Key, md.Value)
+		}
+	}
+	for _, md := range sortedMetadata(c.After.Metadata) {
+		if v, ok := before[md.Key]; !ok || v != md.Value {
+			pw.printf("+     %s=%s\n", md.Key, md.Value)
+		}
+	}
+}
+
+func sortedMetadata(md api.Metadata) api.Metadata {
+	sorted := make(api.Metadata, len(md))
+	copy(sorted, md)
+	sort.Sort(api.MetadataByKey(sorted))
+	return sorted
+}
+
+// planState is implemented by Differs that can report the current Clusters
+// against which Diffs are computed.
+type planState interface {
+	// planState returns the current Clusters, and whether Diffs consisting
+	// only of Creates replace them entirely.
+	planState() (api.Clusters, bool, error)
+}
+
+func (s svcDiffer) planState() (api.Clusters, bool, error) {
+	current, err := s.svc.Index(service.ClusterFilter{ZoneKey: s.zoneKey})
+	return current, false, err
+}
+
+func (d standaloneDiffer) planState() (api.Clusters, bool, error) {
+	return d.state.current(), true, nil
+}
+
+// NewPlanner returns a Differ that computes Diffs with the given Differ,
+// but never applies them. Instead, Patch computes the Plan for the Diffs
+// and passes it to fn. Diffs are computed without the DiffOpts' Guard,
+// Auditor or DryRun setting, so that the Plan reflects every change that
+// would be made. If the Diffs cannot be computed, fn is passed the error.
+// The given Differ must be one created by New or NewStandalone.
+func NewPlanner(d Differ, fn func(Plan, error)) Differ {
+	return planner{d, fn}
+}
+
+type planner struct {
+	underlying Differ
+	fn         func(Plan, error)
+}
+
+func planOpts(opts DiffOpts) DiffOpts {
+	opts.Guard = nil
+	opts.Auditor = nil
+	opts.DryRun = false
+	return opts
+}
+
+func (p planner) Diff(proposed []api.Cluster, opts DiffOpts) ([]Diff, error) {
+	diffs, err := p.underlying.Diff(proposed, planOpts(opts))
+	if err != nil {
+		p.fn(nil, err)
+	}
+	return diffs, err
+}
+
+func (p planner) DiffInstances(changes InstanceChanges, opts DiffOpts) ([]Diff, error) {
+	diffs, err := p.underlying.DiffInstances(changes, planOpts(opts))
+	switch {
+	case err != nil:
+		p.fn(nil, err)
+	case len(diffs) == 0:
+		// DiffAndPatchInstances does not Patch an empty slice of Diffs.
+		p.Patch(diffs)
+	}
+	return diffs, err
+}
+
+func (p planner) Patch(diffs []Diff) error {
+	ps, ok := p.underlying.(planState)
+	if !ok {
+		err := fmt.Errorf("cannot plan changes with Differ of type %T", p.underlying)
+		p.fn(nil, err)
+		return err
+	}
+
+	current, replace, err := ps.planState()
+	if err != nil {
+		p.fn(nil, err)
+		return err
+	}
+
+	p.fn(NewPlan(current, diffs, replace), nil)
+	return nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package differ
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/api/service"
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkPlanInstance(host string, md ...string) api.Instance {
+	i := api.Instance{Host: host, Port: 8080}
+	for j := 0; j+1 < len(md); j += 2 {
+		i.Metadata = append(i.Metadata, api.Metadatum{Key: md[j], Value: md[j+1]})
+	}
+	return i
+}
+
+func TestNewPlan(t *testing.T) {
+	current := []api.Cluster{
+		{
+			ClusterKey: "ck-foo",
+			Name:       "foo",
+			Instances: api.Instances{
+				mkPlanInstance("a", "v", "1"),
+				mkPlanInstance("b"),
+			},
+		},
+		{
+			ClusterKey: "ck-baz",
+			Name:       "baz",
+			Instances:  api.Instances{mkPlanInstance("c")},
+		},
+		{
+			ClusterKey: "ck-same",
+			Name:       "same",
+			Instances:  api.Instances{mkPlanInstance("d")},
+		},
+	}
+
+	diffs := []Diff{
+		NewDiffCreate(api.Cluster{Name: "bar", Instances: api.Instances{mkPlanInstance("e")}}),
+		NewDiffRemoveInstance("ck-foo", api.Checksum{}, mkPlanInstance("a", "v", "1")),
+		NewDiffAddInstance("ck-foo", api.Checksum{}, mkPlanInstance("a", "v", "2")),
+		NewDiffRemoveInstance("ck-foo", api.Checksum{}, mkPlanInstance("b")),
+		NewDiffAddInstance("ck-foo", api.Checksum{}, mkPlanInstance("f")),
+		NewDiffDelete("ck-baz", api.Checksum{}),
+		NewDiffModify(current[2]),
+	}
+
+	plan := NewPlan(current, diffs, false)
+	assert.True(t, plan.HasChanges())
+	assert.DeepEqual(t, plan, Plan{
+		{
+			Name:   "bar",
+			Action: PlanCreate,
+			Added:  api.Instances{mkPlanInstance("e")},
+		},
+		{
+			Name:    "baz",
+			Action:  PlanDelete,
+			Removed: api.Instances{mkPlanInstance("c")},
+		},
+		{
+			Name:    "foo",
+			Action:  PlanModify,
+			Added:   api.Instances{mkPlanInstance("f")},
+			Removed: api.Instances{mkPlanInstance("b")},
+			Changed: []InstanceChange{
+				{Before: mkPlanInstance("a", "v", "1"), After: mkPlanInstance("a", "v", "2")},
+			},
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, plan.Write(buf))
+	assert.Equal(t, buf.String(), `+ cluster bar (create)
++   e:8080
+- cluster baz (delete)
+-   c:8080
+~ cluster foo (modify)
+-   b:8080
++   f:8080
+~   a:8080
+-     v=1
++     v=2
+
+Plan: 1 to create, 1 to modify, 1 to delete; 2 instances to add, 2 to remove, 1 to change.
+`)
+}
+
+func TestNewPlanAttributesChanged(t *testing.T) {
+	current := []api.Cluster{{ClusterKey: "ck", Name: "foo", Checksum: api.Checksum{Checksum: "x"}}}
+	modified := api.Cluster{ClusterKey: "ck", Name: "foo", RequireTLS: true}
+
+	plan := NewPlan(current, []Diff{NewDiffModify(modified)}, false)
+	assert.DeepEqual(t, plan, Plan{{Name: "foo", Action: PlanModify, AttributesChanged: true}})
+}
+
+func TestNewPlanReplace(t *testing.T) {
+	current := []api.Cluster{
+		{ClusterKey: "foo", Name: "foo", Instances: api.Instances{mkPlanInstance("a")}},
+		{ClusterKey: "bar", Name: "bar", Instances: api.Instances{mkPlanInstance("b")}},
+	}
+
+	diffs := []Diff{
+		NewDiffCreate(api.Cluster{Name: "foo", Instances: api.Instances{mkPlanInstance("a")}}),
+	}
+
+	assert.DeepEqual(t, NewPlan(current, diffs, false), Plan{})
+	assert.DeepEqual(t, NewPlan(current, diffs, true), Plan{
+		{Name: "bar", Action: PlanDelete, Removed: api.Instances{mkPlanInstance("b")}},
+	})
+}
+
+func TestNewPlanNoChanges(t *testing.T) {
+	plan := NewPlan(nil, nil, false)
+	assert.False(t, plan.HasChanges())
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, plan.Write(buf))
+	assert.Equal(t, buf.String(), "No changes.\n")
+}
+
+type refusingGuard struct{}
+
+func (refusingGuard) Check(current []api.Cluster, removed map[string]api.Instances) error {
+	return errors.New("refused")
+}
+
+func (refusingGuard) Applied() {}
+
+func (refusingGuard) Override() {}
+
+func (refusingGuard) Notify(func()) {}
+
+func TestPlanner(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	svc := service.NewMockCluster(ctrl)
+	current := api.Clusters{{ClusterKey: "ck", Name: "foo", ZoneKey: "zk"}}
+	svc.EXPECT().Index(service.ClusterFilter{ZoneKey: "zk"}).Return(current, nil).Times(2)
+
+	var (
+		gotPlan Plan
+		gotErr  error
+	)
+	p := NewPlanner(New(svc, "zk"), func(plan Plan, err error) {
+		gotPlan = plan
+		gotErr = err
+	})
+
+	opts := DiffOpts{IncludeDelete: true, Guard: refusingGuard{}}
+
+	diffs, err := DiffAndPatch(p, nil, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, len(diffs), 1)
+	assert.Nil(t, gotErr)
+	assert.DeepEqual(t, gotPlan, Plan{{Name: "foo", Action: PlanDelete, Removed: api.Instances{}}})
+}
+
+func TestPlannerDiffError(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	svc := service.NewMockCluster(ctrl)
+	wantErr := errors.New("boom")
+	svc.EXPECT().Index(gomock.Any()).Return(nil, wantErr)
+
+	var gotErr error
+	p := NewPlanner(New(svc, "zk"), func(_ Plan, err error) { gotErr = err })
+
+	_, err := DiffAndPatch(p, nil, DiffOpts{})
+	assert.Equal(t, err, wantErr)
+	assert.Equal(t, gotErr, wantErr)
+}
+
+func TestPlannerEmptyInstanceChanges(t *testing.T) {
+	newDiffer, _ := NewStandalone(80, "proxy", "zone")
+	sd := newDiffer(nil)
+
+	called := false
+	p := NewPlanner(sd, func(plan Plan, err error) {
+		called = true
+		assert.False(t, plan.HasChanges())
+		assert.Nil(t, err)
+	})
+
+	diffs, err := DiffAndPatchInstances(p, InstanceChanges{}, DiffOpts{})
+	assert.Nil(t, err)
+	assert.Equal(t, len(diffs), 0)
+	assert.True(t, called)
+}
+
+func TestPlannerUnsupportedDiffer(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	d := NewMockDiffer(ctrl)
+	d.EXPECT().Patch(gomock.Any()).Times(0)
+
+	var gotErr error
+	p := NewPlanner(d, func(_ Plan, err error) { gotErr = err })
+	assert.NonNil(t, p.Patch(nil))
+	assert.NonNil(t, gotErr)
+}
@@ -19,6 +19,7 @@ package differ
 import (
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/rotor/xds/poller"
@@ -27,12 +28,131 @@ import (
 // standaloneDiffer produces always produces Create diffs, and the Patch call
 // takes those create diffs and creates a simple poller.Objects serving "/"
 // on a specified port for each cluster, with the cluster host/port as the
-// domain name.
+// domain name. The most recently patched clusters are retained, so that
+// AddInstance and RemoveInstance diffs may be applied to them.
 type standaloneDiffer struct {
 	port      int
 	consumer  poller.Consumer
 	proxyName string
 	zoneName  string
+	state     *standaloneState
+}
+
+// standaloneState holds the clusters most recently patched by a
+// standaloneDiffer, keyed by ClusterKey.
+type standaloneState struct {
+	mutex    sync.Mutex
+	clusters map[api.ClusterKey]api.Cluster
+}
+
+func (s *standaloneState) current() api.Clusters {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	clusters := make(api.Clusters, 0, len(s.clusters))
+	for _, c := range s.clusters {
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+// apply applies the given diffs and returns the resulting clusters. If every
+// diff is a Create, the diffs replace the current clusters entirely.
+// Otherwise, they are applied to the current clusters.
+func (s *standaloneState) apply(diffs []Diff) (api.Clusters, error) {
+	if s == nil {
+		s = &standaloneState{}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	replace := true
+	for _, diff := range diffs {
+		if _, ok := diff.(*diffCreate); !ok {
+			replace = false
+			break
+		}
+	}
+
+	clusters := make(map[api.ClusterKey]api.Cluster, len(s.clusters))
+	if !replace {
+		for ck, c := range s.clusters {
+			clusters[ck] = c
+		}
+	}
+
+	for _, diff := range diffs {
+		switch t := diff.(type) {
+		case *diffCreate:
+			c := t.cluster
+
+			// protect against randomness in collection (this isn't a problem when
+			// storing/retrieving clusters in the Houston API, because the metadata
+			// comes back from the API in a reliable order, but here we don't have the
+			// API to sanitize for us.)
+			sort.Sort(api.InstancesByHostPort(c.Instances))
+			for j := range c.Instances {
+				sort.Sort(api.MetadataByKey(c.Instances[j].Metadata))
+			}
+
+			ck := api.ClusterKey(c.Name)
+			c.ClusterKey = ck
+			clusters[ck] = c
+
+		case *diffAddInstance:
+			c, ok := clusters[t.clusterKey]
+			if !ok {
+				return nil, fmt.Errorf("cannot add instance to unknown cluster %s", t.clusterKey)
+			}
+
+			instance := t.instance
+			sort.Sort(api.MetadataByKey(instance.Metadata))
+
+			instances := make(api.Instances, 0, len(c.Instances)+1)
+			for _, i := range c.Instances {
+				if i.Key() != instance.Key() {
+					instances = append(instances, i)
+				}
+			}
+			instances = append(instances, instance)
+			sort.Sort(api.InstancesByHostPort(instances))
+
+			c.Instances = instances
+			clusters[t.clusterKey] = c
+
+		case *diffRemoveInstance:
+			c, ok := clusters[t.clusterKey]
+			if !ok {
+				return nil, fmt.Errorf("cannot remove instance from unknown cluster %s", t.clusterKey)
+			}
+
+			instances := make(api.Instances, 0, len(c.Instances))
+			for _, i := range c.Instances {
+				if i.Key() != t.instance.Key() {
+					instances = append(instances, i)
+				}
+			}
+
+			c.Instances = instances
+			clusters[t.clusterKey] = c
+
+		default:
+			return nil, fmt.Errorf("unexpected Diff type: %T", t)
+		}
+	}
+
+	s.clusters = clusters
+
+	result := make(api.Clusters, 0, len(clusters))
+	for _, c := range clusters {
+		result = append(result, c)
+	}
+	return result, nil
 }
 
 // NewStandalone produces a function that will create a Differ from a
@@ -48,11 +168,18 @@ func NewStandalone(
 			consumer:  consumer,
 			proxyName: proxyName,
 			zoneName:  zoneName,
+			state:     &standaloneState{},
 		}
 	}, poller.NewNopRegistrar()
 }
 
-func (d standaloneDiffer) Diff(proposed []api.Cluster, _ DiffOpts) ([]Diff, error) {
+func (d standaloneDiffer) Diff(proposed []api.Cluster, opts DiffOpts) ([]Diff, error) {
+	current := d.state.current()
+	removed := func() map[string]api.Instances { return removedByReplace(current, proposed) }
+	if err := checkGuard(opts, current, removed); err != nil {
+		return nil, err
+	}
+
 	diffs := make([]Diff, len(proposed), len(proposed))
 	for i, c := range proposed {
 		diffs[i] = NewDiffCreate(c)
@@ -60,39 +187,31 @@ func (d standaloneDiffer) Diff(proposed []api.Cluster, _ DiffOpts) ([]Diff, erro
 	return diffs, nil
 }
 
-func (d standaloneDiffer) Patch(diffs []Diff) error {
-	objs := &poller.Objects{
-		Clusters:    make(api.Clusters, len(diffs), len(diffs)),
-		Domains:     make(api.Domains, len(diffs), len(diffs)),
-		Routes:      make(api.Routes, len(diffs), len(diffs)),
-		SharedRules: make(api.SharedRulesSlice, len(diffs), len(diffs)),
+func (d standaloneDiffer) DiffInstances(changes InstanceChanges, opts DiffOpts) ([]Diff, error) {
+	current := d.state.current()
+	diffs := diffInstances(api.ZoneKey(d.zoneName), current, changes, opts)
+	removed := func() map[string]api.Instances { return removedByDiffs(current, diffs) }
+	if err := checkGuard(opts, current, removed); err != nil {
+		return nil, err
 	}
+	return diffs, nil
+}
 
-	dks := make([]api.DomainKey, len(diffs), len(diffs))
-
-	for i, diff := range diffs {
-		switch t := diff.(type) {
-		case *diffCreate:
-			c := t.cluster
-
-			// protect against randomness in collection (this isn't a problem when
-			// storing/retrieving clusters in the Houston API, because the metadata
-			// comes back from the API in a reliable order, but here we don't have the
-			// API to sanitize for us.)
-			sort.Sort(api.InstancesByHostPort(c.Instances))
-			for j := range c.Instances {
-				sort.Sort(api.MetadataByKey(c.Instances[j].Metadata))
-			}
-
-			ck := api.ClusterKey(c.Name)
-			c.ClusterKey = ck
-			objs.Clusters[i] = c
+func (d standaloneDiffer) Patch(diffs []Diff) error {
+	clusters, err := d.state.apply(diffs)
+	if err != nil {
+		return err
+	}
 
-		default:
-			return fmt.Errorf("unexpected Diff type: %T", t)
-		}
+	objs := &poller.Objects{
+		Clusters:    clusters,
+		Domains:     make(api.Domains, len(clusters), len(clusters)),
+		Routes:      make(api.Routes, len(clusters), len(clusters)),
+		SharedRules: make(api.SharedRulesSlice, len(clusters), len(clusters)),
 	}
 
+	dks := make([]api.DomainKey, len(clusters), len(clusters))
+
 	// And again with the stable ordering. The various other objects take their
 	// order from the cluster order, so sort by name.
 	sort.Sort(api.ClusterByName(objs.Clusters))
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/turbinelabs/cli/command"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/nonstdlib/flag/usage"
+	"github.com/turbinelabs/rotor/pkg/audit"
+)
+
+const (
+	auditSummary = "Query the audit file of changes applied by rotor."
+	auditDesc    = auditSummary + `
+
+Prints the records written to the file at --path (as configured by the
+--audit.file flag of a running rotor), including any rotated files, oldest
+first, as lines of JSON. Records may be limited to those changing a cluster
+or made within a time range.
+
+Times may be given in RFC 3339 format (e.g. 2018-10-25T16:27:20Z), or as a
+duration (e.g. 90m), meaning that long ago.`
+)
+
+func auditCmd() *command.Cmd {
+	cmd := &command.Cmd{
+		Name:        "audit",
+		Summary:     auditSummary,
+		Usage:       "[OPTIONS]",
+		Description: auditDesc,
+	}
+
+	flags := tbnflag.Wrap(&cmd.Flags)
+
+	r := &auditRunner{out: os.Stdout, now: time.Now}
+
+	flags.StringVar(
+		&r.path,
+		"path",
+		"",
+		usage.Required("The path of the audit file to query."),
+	)
+
+	flags.StringVar(
+		&r.cluster,
+		"cluster",
+		"",
+		"If set, only records changing the cluster with this name or key are printed.",
+	)
+
+	flags.StringVar(
+		&r.since,
+		"since",
+		"",
+		"If set, only records made at or after this time are printed.",
+	)
+
+	flags.StringVar(
+		&r.until,
+		"until",
+		"",
+		"If set, only records made before this time are printed.",
+	)
+
+	cmd.Runner = r
+
+	return cmd
+}
+
+type auditRunner struct {
+	path    string
+	cluster string
+	since   string
+	until   string
+
+	out io.Writer
+	now func() time.Time
+}
+
+func (r *auditRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
+	filter := audit.Filter{Cluster: r.cluster}
+
+	var err error
+	if filter.Since, err = r.parseTime(r.since); err != nil {
+		return cmd.BadInputf("invalid --since: %s", err)
+	}
+
+	if filter.Until, err = r.parseTime(r.until); err != nil {
+		return cmd.BadInputf("invalid --until: %s", err)
+	}
+
+	enc := json.NewEncoder(r.out)
+	err = audit.Query(r.path, filter, func(record audit.Record) error {
+		return enc.Encode(record)
+	})
+	if err != nil {
+		return cmd.Error(err)
+	}
+
+	return command.NoError()
+}
+
+// parseTime parses an RFC 3339 time, or a duration before the current
+// time. The empty string produces the zero time.
+func (r *auditRunner) parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", s)
+	}
+
+	return r.now().Add(-d), nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/rotor/pkg/audit"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestAuditRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	sink, err := audit.NewFileSink(path, 0, 0)
+	assert.Nil(t, err)
+
+	base := time.Date(2018, 10, 25, 16, 0, 0, 0, time.UTC)
+	for i, cluster := range []string{"a", "b", "a"} {
+		record := audit.Record{
+			Time:     base.Add(time.Duration(i) * time.Hour),
+			Clusters: []string{cluster},
+		}
+		assert.Nil(t, sink.Write(record))
+	}
+	assert.Nil(t, sink.Close())
+
+	out := &bytes.Buffer{}
+	cmd := auditCmd()
+	r := cmd.Runner.(*auditRunner)
+	r.out = out
+	r.now = func() time.Time { return base.Add(3 * time.Hour) }
+
+	cmd.Flags.Parse([]string{"-path", path, "-cluster", "a", "-since", "2h"})
+	assert.Equal(t, cmd.Run(), command.NoError())
+	assert.Equal(
+		t,
+		out.String(),
+		`{"time":"2018-10-25T18:00:00Z","zone":"","collector":"","result":"","clusters":["a"],"diffs":null}`+"\n",
+	)
+
+	out.Reset()
+	cmd.Flags.Parse([]string{"-cluster", "", "-since", "", "-until", "2018-10-25T17:00:00Z"})
+	assert.Equal(t, cmd.Run(), command.NoError())
+	assert.Equal(
+		t,
+		out.String(),
+		`{"time":"2018-10-25T16:00:00Z","zone":"","collector":"","result":"","clusters":["a"],"diffs":null}`+"\n",
+	)
+}
+
+func TestAuditRunnerErrors(t *testing.T) {
+	cmd := auditCmd()
+
+	cmd.Flags.Parse([]string{"-path", "/nonexistent/audit.log", "-since", "yesterday"})
+	err := cmd.Run()
+	assert.Equal(t, err.Code, command.CmdErrCode(command.CmdErrCodeBadInput))
+	assert.StringContains(t, err.Message, "invalid --since")
+
+	cmd.Flags.Parse([]string{"-since", "", "-until", "1h"})
+	err = cmd.Run()
+	assert.True(t, err.IsError())
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/turbinelabs/rotor/plugins/multi"
 
 	"github.com/turbinelabs/cli"
+	"github.com/turbinelabs/cli/command"
 	"github.com/turbinelabs/rotor"
 
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
@@ -56,9 +57,8 @@ func mkCLI() cli.CLI {
 	console.Init(globalFlags)
 	updaterFlags := rotor.NewUpdaterFromFlags(globalFlags)
 
-	c := cli.NewWithSubCmds(
-		desc,
-		constants.TbnPublicVersion,
+	collectorCmds := withCollectorNames(
+		updaterFlags,
 		aws.AWSCmd(updaterFlags),
 		consul.Cmd(updaterFlags),
 		aws.ECSCmd(updaterFlags),
@@ -69,7 +69,16 @@ func mkCLI() cli.CLI {
 		kubernetes.Cmd(updaterFlags),
 		marathon.Cmd(updaterFlags),
 		multi.MultiCMD(updaterFlags),
-		nopCmd(updaterFlags),
+	)
+
+	c := cli.NewWithSubCmds(
+		desc,
+		constants.TbnPublicVersion,
+		auditCmd(),
+		append(
+			[]*command.Cmd{planCmd(updaterFlags, collectorCmds)},
+			append(collectorCmds, nopCmd(updaterFlags))...,
+		)...,
 	)
 
 	c.SetFlags(globalFlags.Unwrap())
@@ -77,6 +86,25 @@ func mkCLI() cli.CLI {
 	return c
 }
 
+// withCollectorNames wraps the Runner of each of the given Cmds so that
+// changes are attributed to the Cmd's name in audit records.
+func withCollectorNames(updaterFlags rotor.UpdaterFromFlags, cmds ...*command.Cmd) []*command.Cmd {
+	for _, cmd := range cmds {
+		cmd.Runner = collectorNameRunner{updaterFlags, cmd.Runner}
+	}
+	return cmds
+}
+
+type collectorNameRunner struct {
+	updaterFlags rotor.UpdaterFromFlags
+	underlying   command.Runner
+}
+
+func (r collectorNameRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
+	r.updaterFlags.SetCollectorName(cmd.Name)
+	return r.underlying.Run(cmd, args)
+}
+
 func main() {
 	mkCLI().Main()
 }
@@ -19,9 +19,32 @@ package main
 import (
 	"testing"
 
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/rotor"
 	"github.com/turbinelabs/test/assert"
 )
 
 func TestCLI(t *testing.T) {
 	assert.Nil(t, mkCLI().Validate())
 }
+
+func TestWithCollectorNames(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockUpdaterFromFlags := rotor.NewMockUpdaterFromFlags(ctrl)
+
+	mockRunner := command.NewMockRunner(ctrl)
+	cmd := &command.Cmd{Name: "collector", Runner: mockRunner}
+
+	cmds := withCollectorNames(mockUpdaterFromFlags, cmd)
+	assert.Equal(t, len(cmds), 1)
+
+	gomock.InOrder(
+		mockUpdaterFromFlags.EXPECT().SetCollectorName("collector"),
+		mockRunner.EXPECT().Run(cmd, gomock.Any()).Return(command.NoError()),
+	)
+	assert.Equal(t, cmds[0].Run(), command.NoError())
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/turbinelabs/cli/command"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/rotor"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/updater"
+)
+
+const (
+	planSummary = "Report the changes a collector would make, without making them."
+	planDesc    = planSummary + `
+
+Runs the named collector, configured by the flags following its name, until
+it has collected clusters once. The changes required to make the clusters in
+the API zone (or, in standalone mode, those recorded in --state-file) match
+the collected clusters are printed in a form resembling a unified diff, and
+rotor exits. Neither the API nor the xDS server is updated.
+
+The exit status is 0 if there are no changes, 3 if there are changes, and 1
+if the changes could not be computed, so that plan may be used to gate
+configuration changes in CI.`
+
+	// planChangesCode is the exit code used when the plan contains changes.
+	planChangesCode command.CmdErrCode = 3
+
+	defaultPlanTimeout = time.Minute
+)
+
+func planCmd(updaterFlags rotor.UpdaterFromFlags, collectors []*command.Cmd) *command.Cmd {
+	cmd := &command.Cmd{
+		Name:        "plan",
+		Summary:     planSummary,
+		Usage:       "[OPTIONS] <collector> [COLLECTOR OPTIONS]",
+		Description: planDesc,
+	}
+
+	flags := tbnflag.Wrap(&cmd.Flags)
+
+	r := &planRunner{
+		updaterFlags: updaterFlags,
+		collectors:   collectors,
+		out:          os.Stdout,
+		interrupt:    updater.Interrupt,
+	}
+
+	flags.DurationVar(
+		&r.timeout,
+		"timeout",
+		defaultPlanTimeout,
+		"The maximum time to wait for the collector to collect clusters.",
+	)
+
+	cmd.Runner = r
+
+	return cmd
+}
+
+type planRunner struct {
+	updaterFlags rotor.UpdaterFromFlags
+	collectors   []*command.Cmd
+	timeout      time.Duration
+
+	out       io.Writer
+	interrupt func()
+
+	mutex sync.Mutex
+	done  bool
+	plan  differ.Plan
+	err   error
+}
+
+func (r *planRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
+	if len(args) == 0 {
+		return cmd.BadInput("a collector must be specified")
+	}
+
+	collector := r.collector(args[0])
+	if collector == nil {
+		return cmd.BadInputf("unknown collector %q", args[0])
+	}
+
+	if err := collector.Flags.Parse(args[1:]); err != nil {
+		return collector.BadInput(err)
+	}
+
+	fromEnv := tbnflag.NewFromEnv(&collector.Flags, path.Base(os.Args[0]), collector.Name)
+	if err := fromEnv.Fill(); err != nil {
+		return collector.BadInput(err)
+	}
+
+	r.updaterFlags.SetPlanFunc(r.finish)
+
+	timer := time.AfterFunc(r.timeout, func() {
+		r.finish(nil, fmt.Errorf("%s did not collect clusters within %s", collector.Name, r.timeout))
+	})
+	defer timer.Stop()
+
+	cmdErr := collector.Runner.Run(collector, collector.Flags.Args())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case cmdErr.IsError():
+		return cmdErr
+	case !r.done:
+		return cmd.Errorf("%s exited without collecting clusters", collector.Name)
+	case r.err != nil:
+		return cmd.Error(r.err)
+	}
+
+	if err := r.plan.Write(r.out); err != nil {
+		return cmd.Error(err)
+	}
+
+	if r.plan.HasChanges() {
+		return command.CmdErr{Cmd: cmd, Code: planChangesCode, Message: "plan: changes pending"}
+	}
+
+	return command.NoError()
+}
+
+func (r *planRunner) collector(name string) *command.Cmd {
+	for _, c := range r.collectors {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// finish records the first plan computed, or error, and stops the
+// collector.
+func (r *planRunner) finish(plan differ.Plan, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.done {
+		return
+	}
+
+	r.done = true
+	r.plan = plan
+	r.err = err
+	r.interrupt()
+}
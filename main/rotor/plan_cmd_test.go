@@ -0,0 +1,177 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/cli/command"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/rotor"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/test/assert"
+)
+
+type planTestCase struct {
+	plan       differ.Plan
+	planErr    error
+	noPlan     bool
+	runnerErr  bool
+	wantCode   command.CmdErrCode
+	wantOutput string
+}
+
+func (tc planTestCase) run(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	updaterFlags := rotor.NewMockUpdaterFromFlags(ctrl)
+
+	var planFn func(differ.Plan, error)
+	updaterFlags.EXPECT().SetPlanFunc(gomock.Any()).Do(func(fn func(differ.Plan, error)) {
+		planFn = fn
+	})
+
+	var format string
+	collector := &command.Cmd{Name: "test"}
+	tbnflag.Wrap(&collector.Flags).StringVar(&format, "format", "", "format")
+
+	runner := command.NewMockRunner(ctrl)
+	collector.Runner = runner
+	runner.EXPECT().Run(collector, []string{"path"}).DoAndReturn(
+		func(cmd *command.Cmd, args []string) command.CmdErr {
+			assert.Equal(t, format, "yaml")
+			if tc.runnerErr {
+				return cmd.Error("boom")
+			}
+			if !tc.noPlan {
+				planFn(tc.plan, tc.planErr)
+				planFn(nil, errors.New("ignored"))
+			}
+			return command.NoError()
+		},
+	)
+
+	interrupts := 0
+	out := &bytes.Buffer{}
+	cmd := planCmd(updaterFlags, []*command.Cmd{collector})
+	r := cmd.Runner.(*planRunner)
+	r.out = out
+	r.interrupt = func() { interrupts++ }
+
+	cmdErr := r.Run(cmd, []string{"test", "--format=yaml", "path"})
+	assert.Equal(t, cmdErr.Code, tc.wantCode)
+	assert.Equal(t, out.String(), tc.wantOutput)
+	if !tc.noPlan && !tc.runnerErr {
+		assert.Equal(t, interrupts, 1)
+	}
+}
+
+func TestPlanRunnerNoChanges(t *testing.T) {
+	planTestCase{
+		plan:       differ.Plan{},
+		wantCode:   command.CmdErrCodeNoError,
+		wantOutput: "No changes.\n",
+	}.run(t)
+}
+
+func TestPlanRunnerChanges(t *testing.T) {
+	planTestCase{
+		plan: differ.Plan{
+			{
+				Name:   "foo",
+				Action: differ.PlanCreate,
+				Added:  api.Instances{{Host: "a", Port: 80}},
+			},
+		},
+		wantCode: planChangesCode,
+		wantOutput: `+ cluster foo (create)
++   a:80
+
+Plan: 1 to create, 0 to modify, 0 to delete; 1 instances to add, 0 to remove, 0 to change.
+`,
+	}.run(t)
+}
+
+func TestPlanRunnerPlanError(t *testing.T) {
+	planTestCase{
+		planErr:  errors.New("boom"),
+		wantCode: command.CmdErrCodeError,
+	}.run(t)
+}
+
+func TestPlanRunnerNoPlan(t *testing.T) {
+	planTestCase{
+		noPlan:   true,
+		wantCode: command.CmdErrCodeError,
+	}.run(t)
+}
+
+func TestPlanRunnerCollectorError(t *testing.T) {
+	planTestCase{
+		runnerErr: true,
+		wantCode:  command.CmdErrCodeError,
+	}.run(t)
+}
+
+func TestPlanRunnerTimeout(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	updaterFlags := rotor.NewMockUpdaterFromFlags(ctrl)
+	updaterFlags.EXPECT().SetPlanFunc(gomock.Any())
+
+	interrupted := make(chan struct{})
+
+	collector := &command.Cmd{Name: "test"}
+	runner := command.NewMockRunner(ctrl)
+	collector.Runner = runner
+	runner.EXPECT().Run(collector, gomock.Any()).DoAndReturn(
+		func(*command.Cmd, []string) command.CmdErr {
+			<-interrupted
+			return command.NoError()
+		},
+	)
+
+	cmd := planCmd(updaterFlags, []*command.Cmd{collector})
+	r := cmd.Runner.(*planRunner)
+	r.timeout = time.Millisecond
+	r.interrupt = func() { close(interrupted) }
+
+	cmdErr := r.Run(cmd, []string{"test"})
+	assert.Equal(t, cmdErr.Code, command.CmdErrCode(command.CmdErrCodeError))
+	assert.StringContains(t, cmdErr.Message, "did not collect clusters within 1ms")
+}
+
+func TestPlanRunnerBadInput(t *testing.T) {
+	cmd := planCmd(nil, []*command.Cmd{{Name: "test"}})
+
+	cmdErr := cmd.Runner.Run(cmd, nil)
+	assert.Equal(t, cmdErr.Code, command.CmdErrCode(command.CmdErrCodeBadInput))
+
+	cmdErr = cmd.Runner.Run(cmd, []string{"nope"})
+	assert.Equal(t, cmdErr.Code, command.CmdErrCode(command.CmdErrCodeBadInput))
+
+	cmdErr = cmd.Runner.Run(cmd, []string{"test", "--nope"})
+	assert.Equal(t, cmdErr.Code, command.CmdErrCode(command.CmdErrCodeBadInput))
+}
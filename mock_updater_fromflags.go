@@ -5,8 +5,11 @@ package rotor
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	differ "github.com/turbinelabs/rotor/differ"
+	transform "github.com/turbinelabs/rotor/pkg/transform"
 	updater "github.com/turbinelabs/rotor/updater"
 	adapter "github.com/turbinelabs/rotor/xds/adapter"
+	stats "github.com/turbinelabs/stats"
 	reflect "reflect"
 )
 
@@ -82,3 +85,48 @@ func (m *MockUpdaterFromFlags) MakeXDS() (adapter.XDS, error) {
 func (mr *MockUpdaterFromFlagsMockRecorder) MakeXDS() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeXDS", reflect.TypeOf((*MockUpdaterFromFlags)(nil).MakeXDS))
 }
+
+// MakeStats mocks base method
+func (m *MockUpdaterFromFlags) MakeStats() (stats.Stats, error) {
+	ret := m.ctrl.Call(m, "MakeStats")
+	ret0, _ := ret[0].(stats.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MakeStats indicates an expected call of MakeStats
+func (mr *MockUpdaterFromFlagsMockRecorder) MakeStats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeStats", reflect.TypeOf((*MockUpdaterFromFlags)(nil).MakeStats))
+}
+
+// DeferMetadataFilter mocks base method
+func (m *MockUpdaterFromFlags) DeferMetadataFilter() transform.MetadataFilterConfig {
+	ret := m.ctrl.Call(m, "DeferMetadataFilter")
+	ret0, _ := ret[0].(transform.MetadataFilterConfig)
+	return ret0
+}
+
+// DeferMetadataFilter indicates an expected call of DeferMetadataFilter
+func (mr *MockUpdaterFromFlagsMockRecorder) DeferMetadataFilter() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeferMetadataFilter", reflect.TypeOf((*MockUpdaterFromFlags)(nil).DeferMetadataFilter))
+}
+
+// SetCollectorName mocks base method
+func (m *MockUpdaterFromFlags) SetCollectorName(arg0 string) {
+	m.ctrl.Call(m, "SetCollectorName", arg0)
+}
+
+// SetCollectorName indicates an expected call of SetCollectorName
+func (mr *MockUpdaterFromFlagsMockRecorder) SetCollectorName(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCollectorName", reflect.TypeOf((*MockUpdaterFromFlags)(nil).SetCollectorName), arg0)
+}
+
+// SetPlanFunc mocks base method
+func (m *MockUpdaterFromFlags) SetPlanFunc(fn func(differ.Plan, error)) {
+	m.ctrl.Call(m, "SetPlanFunc", fn)
+}
+
+// SetPlanFunc indicates an expected call of SetPlanFunc
+func (mr *MockUpdaterFromFlagsMockRecorder) SetPlanFunc(fn interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPlanFunc", reflect.TypeOf((*MockUpdaterFromFlags)(nil).SetPlanFunc), fn)
+}
@@ -0,0 +1,112 @@
+// Package audit records the batches of Diffs applied to a Zone, so that
+// changes can be reconstructed after the fact, and queries those records.
+package audit
+
+import (
+	"sort"
+	"time"
+
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/differ"
+)
+
+// Result describes the outcome of a batch of Diffs.
+type Result string
+
+const (
+	// Success indicates the Diffs were applied.
+	Success Result = "success"
+
+	// Failure indicates the Diffs could not be applied. Some Diffs may
+	// have been applied before the failure.
+	Failure Result = "failure"
+
+	// DryRun indicates the Diffs were logged but not applied.
+	DryRun Result = "dry_run"
+)
+
+// Record describes a batch of Diffs.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Zone      string    `json:"zone"`
+	Collector string    `json:"collector"`
+	Result    Result    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+
+	// Clusters lists the names, or keys if the name is not known, of the
+	// Clusters changed by the Diffs.
+	Clusters []string `json:"clusters"`
+
+	// Diffs contains the DisplayMap of each Diff.
+	Diffs []map[string]interface{} `json:"diffs"`
+}
+
+// NewAuditor returns a differ.Auditor that writes a Record of each batch of
+// Diffs, attributed to the given zone and collector, to each of the given
+// Sinks. Errors writing Records are logged.
+func NewAuditor(zone, collector string, sinks ...Sink) differ.Auditor {
+	return &auditor{
+		zone:      zone,
+		collector: collector,
+		sinks:     sinks,
+		time:      tbntime.NewSource(),
+	}
+}
+
+type auditor struct {
+	zone      string
+	collector string
+	sinks     []Sink
+	time      tbntime.Source
+}
+
+var _ differ.Auditor = &auditor{}
+
+func (a *auditor) Audit(diffs []differ.Diff, dryRun bool, err error) {
+	record := a.mkRecord(diffs, dryRun, err)
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(record); err != nil {
+			console.Error().Printf("could not write audit record: %s", err)
+		}
+	}
+}
+
+func (a *auditor) mkRecord(diffs []differ.Diff, dryRun bool, err error) Record {
+	record := Record{
+		Time:      a.time.Now().UTC(),
+		Zone:      a.zone,
+		Collector: a.collector,
+		Result:    Success,
+		Diffs:     make([]map[string]interface{}, len(diffs)),
+	}
+
+	switch {
+	case dryRun:
+		record.Result = DryRun
+	case err != nil:
+		record.Result = Failure
+		record.Error = err.Error()
+	}
+
+	clusters := map[string]bool{}
+	for i, d := range diffs {
+		display := d.DisplayMap()
+		record.Diffs[i] = display
+
+		if name, ok := display["name"].(string); ok && name != "" {
+			clusters[name] = true
+		} else {
+			clusters[string(d.ClusterKey())] = true
+		}
+	}
+
+	record.Clusters = make([]string, 0, len(clusters))
+	for name := range clusters {
+		record.Clusters = append(record.Clusters, name)
+	}
+	sort.Strings(record.Clusters)
+
+	return record
+}
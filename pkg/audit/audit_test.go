@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/api/service"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/test/assert"
+)
+
+type recordingSink struct {
+	records []Record
+	err     error
+}
+
+func (s *recordingSink) Write(r Record) error {
+	s.records = append(s.records, r)
+	return s.err
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestAuditor(t *testing.T) {
+	sink1 := &recordingSink{}
+	sink2 := &recordingSink{err: errors.New("boom")}
+
+	diffs := []differ.Diff{
+		differ.NewDiffCreate(api.Cluster{Name: "b"}),
+		differ.NewDiffDelete("a-key", api.Checksum{Checksum: "cs"}),
+		differ.NewDiffCreate(api.Cluster{Name: "b"}),
+	}
+
+	tbntime.WithTimeAt(time.Unix(1540484840, 0), func(cs tbntime.ControlledSource) {
+		a := NewAuditor("zone", "consul", sink1, sink2).(*auditor)
+		a.time = cs
+
+		a.Audit(diffs, false, nil)
+		a.Audit(diffs[1:2], false, errors.New("conflict"))
+		a.Audit(diffs[:1], true, nil)
+	})
+
+	assert.DeepEqual(t, sink1.records, sink2.records)
+	assert.Equal(t, len(sink1.records), 3)
+
+	r := sink1.records[0]
+	assert.Equal(t, r.Time, time.Unix(1540484840, 0).UTC())
+	assert.Equal(t, r.Zone, "zone")
+	assert.Equal(t, r.Collector, "consul")
+	assert.Equal(t, r.Result, Success)
+	assert.Equal(t, r.Error, "")
+	assert.ArrayEqual(t, r.Clusters, []string{"a-key", "b"})
+	assert.Equal(t, len(r.Diffs), 3)
+	assert.Equal(t, r.Diffs[1]["action"], "delete")
+
+	r = sink1.records[1]
+	assert.Equal(t, r.Result, Failure)
+	assert.Equal(t, r.Error, "conflict")
+	assert.ArrayEqual(t, r.Clusters, []string{"a-key"})
+
+	r = sink1.records[2]
+	assert.Equal(t, r.Result, DryRun)
+	assert.ArrayEqual(t, r.Clusters, []string{"b"})
+}
+
+func TestAuditorRecordsInstanceChangesByName(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	current := api.Cluster{
+		ClusterKey: "foo-key",
+		ZoneKey:    "zone-key",
+		Name:       "foo",
+		Checksum:   api.Checksum{Checksum: "cs"},
+		Instances:  api.Instances{{Host: "a", Port: 1}},
+	}
+
+	svc := service.NewMockCluster(ctrl)
+	svc.EXPECT().
+		Index(service.ClusterFilter{ZoneKey: "zone-key"}).
+		Return([]api.Cluster{current}, nil)
+
+	diffs, err := differ.New(svc, "zone-key").DiffInstances(
+		differ.InstanceChanges{
+			Add:    map[string]api.Instances{"foo": {{Host: "b", Port: 1}}},
+			Remove: map[string]api.Instances{"foo": {{Host: "a", Port: 1}}},
+		},
+		differ.DiffOpts{},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, len(diffs), 2)
+
+	sink := &recordingSink{}
+	NewAuditor("zone", "consul", sink).Audit(diffs, false, nil)
+	assert.Equal(t, len(sink.records), 1)
+
+	r := sink.records[0]
+	assert.ArrayEqual(t, r.Clusters, []string{"foo"})
+	assert.True(t, Filter{Cluster: "foo"}.Matches(r))
+	assert.True(t, Filter{Cluster: "foo-key"}.Matches(r))
+	assert.False(t, Filter{Cluster: "bar"}.Matches(r))
+}
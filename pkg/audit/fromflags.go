@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"errors"
+	"os"
+
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/rotor/differ"
+)
+
+const (
+	defaultMaxSizeMB = 100
+	defaultMaxFiles  = 5
+)
+
+// FromFlags produces a differ.Auditor from command-line flags.
+type FromFlags interface {
+	// Validate validates the flags.
+	Validate() error
+
+	// Make produces a differ.Auditor that attributes Records to the given
+	// zone and collector. If no Sinks are configured, Make returns a nil
+	// differ.Auditor and no error.
+	Make(zone, collector string) (differ.Auditor, error)
+}
+
+// NewFromFlags installs a FromFlags in the given FlagSet.
+func NewFromFlags(flagset tbnflag.FlagSet) FromFlags {
+	ff := &fromFlags{}
+
+	flagset.StringVar(
+		&ff.file,
+		"file",
+		"",
+		"If set, each batch of changes applied is recorded in this file as a line of JSON. Use the audit command to query the file.",
+	)
+
+	flagset.IntVar(
+		&ff.maxSizeMB,
+		"max-size",
+		defaultMaxSizeMB,
+		"The size, in megabytes, at which the audit file is rotated. If 0, the file is never rotated.",
+	)
+
+	flagset.IntVar(
+		&ff.maxFiles,
+		"max-files",
+		defaultMaxFiles,
+		"The number of rotated audit files to retain.",
+	)
+
+	flagset.BoolVar(
+		&ff.stdout,
+		"stdout",
+		false,
+		"If true, each batch of changes applied is written to stdout as a line of JSON.",
+	)
+
+	return ff
+}
+
+type fromFlags struct {
+	file      string
+	maxSizeMB int
+	maxFiles  int
+	stdout    bool
+}
+
+func (ff *fromFlags) Validate() error {
+	if ff.maxSizeMB < 0 {
+		return errors.New("--audit.max-size may not be negative")
+	}
+
+	if ff.maxFiles < 0 {
+		return errors.New("--audit.max-files may not be negative")
+	}
+
+	return nil
+}
+
+func (ff *fromFlags) Make(zone, collector string) (differ.Auditor, error) {
+	sinks := []Sink{}
+
+	if ff.file != "" {
+		sink, err := NewFileSink(ff.file, int64(ff.maxSizeMB)<<20, ff.maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if ff.stdout {
+		sinks = append(sinks, NewWriterSink(os.Stdout))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	return NewAuditor(zone, collector, sinks...), nil
+}
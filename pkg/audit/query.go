@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Filter selects Records.
+type Filter struct {
+	// Cluster, if non-empty, selects Records changing the Cluster with
+	// this name or key.
+	Cluster string
+
+	// Since, if non-zero, selects Records made at or after this time.
+	Since time.Time
+
+	// Until, if non-zero, selects Records made before this time.
+	Until time.Time
+}
+
+// Matches returns true if the given Record is selected by the Filter.
+func (f Filter) Matches(r Record) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+
+	if f.Cluster == "" {
+		return true
+	}
+
+	for _, c := range r.Clusters {
+		if c == f.Cluster {
+			return true
+		}
+	}
+
+	// Clusters lists names in preference to keys.
+	for _, d := range r.Diffs {
+		if key, ok := d["cluster_key"]; ok && fmt.Sprint(key) == f.Cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// Files returns the path of a file written by a file Sink, preceded by
+// those of any of its rotated files that exist, oldest first.
+func Files(path string) []string {
+	rotated := []string{}
+	for i := 1; ; i++ {
+		name := rotatedName(path, i)
+		if _, err := os.Stat(name); err != nil {
+			break
+		}
+		rotated = append(rotated, name)
+	}
+
+	files := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		files = append(files, rotated[i])
+	}
+	return append(files, path)
+}
+
+// Query reads the Records written by a file Sink to the file at the given
+// path and its rotated files, oldest first, and invokes fn for each Record
+// selected by the given Filter. Query stops at the first error returned by
+// fn.
+func Query(path string, filter Filter, fn func(Record) error) error {
+	for _, name := range Files(path) {
+		if err := queryFile(name, filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryFile(name string, filter Filter, fn func(Record) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return queryReader(name, f, filter, fn)
+}
+
+func queryReader(name string, r io.Reader, filter Filter, fn func(Record) error) error {
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record Record
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				return fmt.Errorf("%s:%d: %s", name, lineNum, jsonErr)
+			}
+
+			if filter.Matches(record) {
+				if fnErr := fn(record); fnErr != nil {
+					return fnErr
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestFilterMatches(t *testing.T) {
+	r := mkRecord(100, "a", "b")
+
+	assert.True(t, Filter{}.Matches(r))
+	assert.True(t, Filter{Cluster: "b"}.Matches(r))
+	assert.False(t, Filter{Cluster: "c"}.Matches(r))
+
+	assert.True(t, Filter{Since: time.Unix(100, 0)}.Matches(r))
+	assert.False(t, Filter{Since: time.Unix(101, 0)}.Matches(r))
+	assert.True(t, Filter{Until: time.Unix(101, 0)}.Matches(r))
+	assert.False(t, Filter{Until: time.Unix(100, 0)}.Matches(r))
+
+	assert.True(t, Filter{Cluster: "a", Since: time.Unix(99, 0), Until: time.Unix(101, 0)}.Matches(r))
+	assert.False(t, Filter{Cluster: "c", Since: time.Unix(99, 0), Until: time.Unix(101, 0)}.Matches(r))
+}
+
+func TestQueryReaderFilters(t *testing.T) {
+	input := strings.Join(
+		[]string{
+			`{"time":"2018-10-25T16:00:00Z","clusters":["a"]}`,
+			`{"time":"2018-10-25T17:00:00Z","clusters":["b"]}`,
+			`{"time":"2018-10-25T18:00:00Z","clusters":["a","b"]}`,
+		},
+		"\n",
+	)
+
+	got := []string{}
+	err := queryReader(
+		"input",
+		strings.NewReader(input),
+		Filter{Cluster: "a"},
+		func(r Record) error {
+			got = append(got, r.Time.Format(time.Kitchen))
+			return nil
+		},
+	)
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, []string{"4:00PM", "6:00PM"})
+}
+
+func TestQueryReaderErrors(t *testing.T) {
+	err := queryReader(
+		"input",
+		strings.NewReader("{}\n{"),
+		Filter{},
+		func(Record) error { return nil },
+	)
+	assert.ErrorContains(t, err, "input:2:")
+
+	boom := errors.New("boom")
+	err = queryReader(
+		"input",
+		strings.NewReader("{}\n{}\n"),
+		Filter{},
+		func(Record) error { return boom },
+	)
+	assert.Equal(t, err, boom)
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink writes Records.
+type Sink interface {
+	// Write writes the given Record.
+	Write(Record) error
+
+	// Close releases any resources held by the Sink.
+	Close() error
+}
+
+// NewWriterSink returns a Sink that writes each Record to the given
+// io.Writer as a line of JSON. Closing the Sink does not close the
+// io.Writer.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *writerSink) Write(r Record) error {
+	line, err := marshalRecord(r)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+func marshalRecord(r Record) ([]byte, error) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// NewFileSink returns a Sink that appends each Record to the file at the
+// given path as a line of JSON. Before a write would grow the file beyond
+// maxSize bytes, the file is rotated: it is renamed with the suffix ".1",
+// previously rotated files are renamed with the next higher suffix, and
+// files with suffixes greater than maxFiles are removed. If maxSize is
+// zero, the file is never rotated.
+func NewFileSink(path string, maxSize int64, maxFiles int) (Sink, error) {
+	s := &fileSink{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type fileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) Write(r Record) error {
+	line, err := marshalRecord(r)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate closes the current file, renames it and any previously rotated
+// files, and opens a new file. Assumes mutex is locked.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if err := os.Remove(rotatedName(s.path, s.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := s.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(rotatedName(s.path, i), rotatedName(s.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if s.maxFiles > 0 {
+		if err := os.Rename(s.path, rotatedName(s.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func rotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkRecord(sec int64, clusters ...string) Record {
+	return Record{
+		Time:     time.Unix(sec, 0).UTC(),
+		Zone:     "zone",
+		Result:   Success,
+		Clusters: clusters,
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+
+	assert.Nil(t, sink.Write(mkRecord(0, "a")))
+	assert.Nil(t, sink.Write(mkRecord(1, "b")))
+	assert.Nil(t, sink.Close())
+
+	got := []Record{}
+	err := queryReader("buf", buf, Filter{}, func(r Record) error {
+		got = append(got, r)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []Record{mkRecord(0, "a"), mkRecord(1, "b")})
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+
+	line, err := marshalRecord(mkRecord(0, "a"))
+	assert.Nil(t, err)
+
+	// Each file holds two records.
+	sink, err := NewFileSink(path, int64(2*len(line)), 2)
+	assert.Nil(t, err)
+
+	for i := int64(0); i < 7; i++ {
+		assert.Nil(t, sink.Write(mkRecord(i, "a")))
+	}
+	assert.Nil(t, sink.Close())
+
+	assert.ArrayEqual(t, Files(path), []string{path + ".2", path + ".1", path})
+
+	times := []int64{}
+	err = Query(path, Filter{}, func(r Record) error {
+		times = append(times, r.Time.Unix())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, times, []int64{2, 3, 4, 5, 6})
+
+	// Reopening appends to the existing file.
+	sink, err = NewFileSink(path, int64(2*len(line)), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(mkRecord(7, "a")))
+	assert.Nil(t, sink.Close())
+
+	times = []int64{}
+	err = Query(path, Filter{}, func(r Record) error {
+		times = append(times, r.Time.Unix())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, times, []int64{2, 3, 4, 5, 6, 7})
+}
+
+func TestFileSinkWithoutRotatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+
+	line, err := marshalRecord(mkRecord(0, "a"))
+	assert.Nil(t, err)
+
+	sink, err := NewFileSink(path, int64(len(line)), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(mkRecord(0, "a")))
+	assert.Nil(t, sink.Write(mkRecord(1, "a")))
+	assert.Nil(t, sink.Close())
+
+	assert.ArrayEqual(t, Files(path), []string{path})
+}
+
+func TestNewFileSinkError(t *testing.T) {
+	sink, err := NewFileSink("/nonexistent/dir/audit.log", 0, 0)
+	assert.Nil(t, sink)
+	assert.NonNil(t, err)
+}
@@ -0,0 +1,19 @@
+// Package backoff provides helpers for delaying retries of failed
+// operations.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Jitter returns a random duration between d and 1.5*d, to prevent
+// retries from multiple processes occurring in lockstep. The result is
+// never less than d, so jittered retries respect a minimum delay.
+func Jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(half+1))
+}
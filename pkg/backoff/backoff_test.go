@@ -0,0 +1,18 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := Jitter(10 * time.Second)
+		assert.GreaterThanEqual(t, d, 10*time.Second)
+		assert.LessThanEqual(t, d, 15*time.Second)
+	}
+	assert.Equal(t, Jitter(1), time.Duration(1))
+	assert.Equal(t, Jitter(0), time.Duration(0))
+}
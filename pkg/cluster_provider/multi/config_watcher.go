@@ -0,0 +1,84 @@
+package multi
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// watch reloads the config whenever the given file is created or written,
+// until the returned io.Closer is closed. The file's directory is watched,
+// rather than the file itself, so that files replaced by renaming are
+// picked up.
+func (m *multiClustersProvider) watch(file string) (io.Closer, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watch error: %s", err)
+	}
+
+	file = filepath.Clean(file)
+	parent := filepath.Dir(file)
+	console.Info().Printf("watching %s", parent)
+	if err := watcher.Add(parent); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch dir error: %s", err)
+	}
+
+	go m.watchLoop(file, watcher.Events, watcher.Errors)
+
+	return watcher, nil
+}
+
+func (m *multiClustersProvider) watchLoop(
+	file string,
+	events <-chan fsnotify.Event,
+	errors <-chan error,
+) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if filepath.Clean(event.Name) != file {
+				continue
+			}
+
+			console.Info().Printf(
+				"%s changed %s (%x)",
+				event.Name,
+				event.Op.String(),
+				uint32(event.Op),
+			)
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				m.reloadFile(file)
+			}
+
+		case err, ok := <-errors:
+			if !ok {
+				return
+			}
+			console.Error().Printf("watch error: %s", err)
+		}
+	}
+}
+
+func (m *multiClustersProvider) reloadFile(file string) {
+	bts, err := ioutil.ReadFile(file)
+	if err != nil {
+		console.Error().Printf("unable to read %s, keeping current config: %s", file, err)
+		return
+	}
+
+	if err := m.reload(bts); err != nil {
+		console.Error().Printf("invalid config in %s, keeping current config: %s", file, err)
+		return
+	}
+
+	console.Info().Printf("reloaded %s", file)
+}
@@ -0,0 +1,252 @@
+package multi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+// testRegistry constructs testClusterProviders, returning a single cluster
+// named by the config's "cluster" field.
+type testRegistry struct {
+	cluster_provider.Registry
+	made []string
+}
+
+func newTestRegistry() *testRegistry {
+	r := &testRegistry{Registry: cluster_provider.NewRegistry()}
+	r.Register("Test", func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := struct {
+			Cluster string `json:"cluster"`
+		}{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		if c.Cluster == "" {
+			return nil, errors.New("cluster is required")
+		}
+		r.made = append(r.made, c.Cluster)
+		return &testClusterProvider{clusters: []api.Cluster{{Name: c.Cluster}}}, nil
+	})
+	return r
+}
+
+func mkTestConfig(conflictPolicy string, providers ...string) []byte {
+	config := fmt.Sprintf(`{"conflict_policy": %q, "clusters_providers": [`, conflictPolicy)
+	for idx, p := range providers {
+		if idx > 0 {
+			config += ","
+		}
+		config += p
+	}
+	return []byte(config + "]}")
+}
+
+func TestMultiClustersProviderReload(t *testing.T) {
+	r := newTestRegistry()
+	m := &multiClustersProvider{registry: r}
+
+	assert.Nil(t, m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+		`{"name": "b", "type": "Test", "config": {"cluster": "b"}}`,
+		`{"name": "c", "type": "Test", "config": {"cluster": "c"}}`,
+	)))
+	assert.ArrayEqual(t, r.made, []string{"a", "b", "c"})
+
+	got, err := m.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, []api.Cluster{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+
+	a := m.clusterProviders[0].ClusterProvider
+	b := m.clusterProviders[1]
+	b.ClusterProvider.(*testClusterProvider).err = errors.New("boom")
+
+	r.made = nil
+	assert.Nil(t, m.reload(mkTestConfig(
+		"prefix_by_provider",
+		`{"name": "a", "type": "Test", "config": {"cluster" : "a"}}`,
+		`{"name": "b", "type": "Test", "max_staleness": "1h", "config": {"cluster": "b"}}`,
+		`{"name": "d", "type": "Test", "config": {"cluster": "d"}}`,
+	)))
+	assert.ArrayEqual(t, r.made, []string{"d"})
+	assert.Equal(t, m.conflictPolicy, PrefixByProviderConflictPolicy)
+	assert.Equal(t, len(m.clusterProviders), 3)
+
+	// unchanged providers are reused, with their snapshots
+	assert.SameInstance(t, m.clusterProviders[0].ClusterProvider, a)
+	assert.SameInstance(t, m.clusterProviders[1].ClusterProvider, b.ClusterProvider)
+	assert.ArrayEqual(t, m.clusterProviders[1].lastSnapshot, []api.Cluster{{Name: "b"}})
+	assert.Equal(t, m.clusterProviders[1].lastSuccess, b.lastSuccess)
+	assert.Equal(t, m.clusterProviders[1].maxStaleness, time.Hour)
+	assert.Nil(t, m.clusterProviders[2].lastSnapshot)
+
+	got, err = m.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, []api.Cluster{{Name: "a-a"}, {Name: "b-b"}, {Name: "d-d"}})
+}
+
+func TestMultiClustersProviderReloadRebuildsChanged(t *testing.T) {
+	r := newTestRegistry()
+	m := &multiClustersProvider{registry: r}
+
+	assert.Nil(t, m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+	)))
+	_, err := m.GetClusters()
+	assert.Nil(t, err)
+	old := m.clusterProviders[0]
+
+	r.made = nil
+	assert.Nil(t, m.reload(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "x"}}`,
+	)))
+	assert.ArrayEqual(t, r.made, []string{"x"})
+	assert.NotSameInstance(t, m.clusterProviders[0].ClusterProvider, old.ClusterProvider)
+
+	// the snapshot is kept until the rebuilt provider succeeds
+	assert.ArrayEqual(t, m.clusterProviders[0].lastSnapshot, []api.Cluster{{Name: "a"}})
+}
+
+func TestMultiClustersProviderReloadInvalid(t *testing.T) {
+	r := newTestRegistry()
+	m := &multiClustersProvider{registry: r}
+
+	assert.Nil(t, m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+	)))
+	providers := m.clusterProviders
+
+	for _, config := range [][]byte{
+		[]byte(`{`),
+		mkTestConfig("nope"),
+		mkTestConfig("first_wins", `{"name": "a", "type": "Test", "config": {}}`),
+		mkTestConfig("first_wins", `{"name": "a", "type": "Nope"}`),
+	} {
+		assert.NonNil(t, m.reload(config))
+		assert.Equal(t, m.conflictPolicy, FirstWinsConflictPolicy)
+		assert.SameInstance(t, m.clusterProviders[0], providers[0])
+	}
+}
+
+func TestMultiClustersProviderReloadClosesReplaced(t *testing.T) {
+	m := &multiClustersProvider{registry: newTestRegistry()}
+
+	assert.Nil(t, m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+		`{"name": "b", "type": "Test", "config": {"cluster": "b"}}`,
+		`{"name": "c", "type": "Test", "config": {"cluster": "c"}}`,
+	)))
+	a := m.clusterProviders[0].ClusterProvider.(*testClusterProvider)
+	b := m.clusterProviders[1].ClusterProvider.(*testClusterProvider)
+	c := m.clusterProviders[2].ClusterProvider.(*testClusterProvider)
+
+	assert.Nil(t, m.reload(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+		`{"name": "b", "type": "Test", "config": {"cluster": "x"}}`,
+	)))
+	assert.False(t, a.closed)
+	assert.True(t, b.closed)
+	assert.True(t, c.closed)
+	assert.False(t, m.clusterProviders[1].ClusterProvider.(*testClusterProvider).closed)
+}
+
+type testCloser struct {
+	closed bool
+}
+
+func (c *testCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestMultiClustersProviderClose(t *testing.T) {
+	r := newTestRegistry()
+	watcher := &testCloser{}
+	m := &multiClustersProvider{registry: r, watcher: watcher}
+
+	assert.Nil(t, m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+	)))
+	a := m.clusterProviders[0].ClusterProvider.(*testClusterProvider)
+
+	assert.Nil(t, m.Close())
+	assert.True(t, watcher.closed)
+	assert.True(t, a.closed)
+
+	got, err := m.GetClusters()
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "closed")
+
+	// a reload racing with Close closes whatever it built
+	r.made = nil
+	assert.ErrorContains(t, m.reload(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "x"}}`,
+	)), "closed")
+	assert.ArrayEqual(t, r.made, []string{"x"})
+	assert.Equal(t, len(m.clusterProviders), 0)
+}
+
+func TestSnapshottedClustersProviderSameConfig(t *testing.T) {
+	sp := &snapshottedClustersProvider{typ: "T", config: json.RawMessage(`{"a": 1, "b": [2]}`)}
+	assert.True(t, sp.sameConfig("T", json.RawMessage(`{ "b": [2], "a": 1 }`)))
+	assert.False(t, sp.sameConfig("U", json.RawMessage(`{"a": 1, "b": [2]}`)))
+	assert.False(t, sp.sameConfig("T", json.RawMessage(`{"a": 2, "b": [2]}`)))
+	assert.False(t, sp.sameConfig("T", nil))
+
+	sp = &snapshottedClustersProvider{typ: "T"}
+	assert.True(t, sp.sameConfig("T", nil))
+}
+
+func TestMultiClustersProviderWatch(t *testing.T) {
+	dir := tempfile.TempDir(t, "multi-watch")
+	defer dir.Cleanup()
+
+	file := dir.Write(
+		t,
+		string(mkTestConfig("first_wins", `{"type": "Test", "config": {"cluster": "a"}}`)),
+		"multi-config",
+	)
+
+	m := &multiClustersProvider{registry: newTestRegistry()}
+	m.reloadFile(file)
+	assert.Equal(t, len(m.clusterProviders), 1)
+
+	closer, err := m.watch(file)
+	assert.Nil(t, err)
+	defer closer.Close()
+
+	assert.Nil(t, ioutil.WriteFile(
+		file,
+		mkTestConfig("first_wins", `{"type": "Test", "config": {"cluster": "b"}}`),
+		0644,
+	))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := m.GetClusters()
+		assert.Nil(t, err)
+		if len(got) == 1 && got[0].Name == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("config not reloaded, got %v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,176 @@
+package multi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// ConflictPolicy determines how clusters with the same name, returned by
+// different cluster providers, are combined.
+type ConflictPolicy string
+
+const (
+	// FirstWinsConflictPolicy keeps the cluster from the provider listed
+	// first in the config file and discards the others.
+	FirstWinsConflictPolicy ConflictPolicy = "first_wins"
+
+	// MergeInstancesConflictPolicy combines the instances of same-named
+	// clusters, keeping the first instance seen for each host:port. Every
+	// instance is tagged with the name of its provider under
+	// ProviderMetadataKey. Other cluster fields are taken from the first
+	// provider.
+	MergeInstancesConflictPolicy ConflictPolicy = "merge_instances"
+
+	// PrefixByProviderConflictPolicy renames every cluster to
+	// "<provider name>-<cluster name>", so that clusters never conflict.
+	PrefixByProviderConflictPolicy ConflictPolicy = "prefix_by_provider"
+
+	// ProviderMetadataKey is the instance metadata key holding the name of
+	// the provider an instance was collected from, when using
+	// MergeInstancesConflictPolicy.
+	ProviderMetadataKey = "cluster_provider"
+
+	prefixDelimiter = "-"
+)
+
+var conflictPolicies = []ConflictPolicy{
+	FirstWinsConflictPolicy,
+	MergeInstancesConflictPolicy,
+	PrefixByProviderConflictPolicy,
+}
+
+func (p ConflictPolicy) validate() error {
+	for _, valid := range conflictPolicies {
+		if p == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown conflict policy: %s, expected: one of %v", p, conflictPolicies)
+}
+
+// providerClusters pairs a provider's name and description with the
+// clusters it returned.
+type providerClusters struct {
+	name        string
+	description string
+	clusters    []api.Cluster
+}
+
+// merge combines the clusters from each provider, in order, according to
+// the policy.
+func (p ConflictPolicy) merge(results []providerClusters) []api.Cluster {
+	switch p {
+	case MergeInstancesConflictPolicy:
+		return mergeInstances(results)
+	case PrefixByProviderConflictPolicy:
+		return prefixByProvider(results)
+	default:
+		return firstWins(results)
+	}
+}
+
+func firstWins(results []providerClusters) []api.Cluster {
+	var clusters []api.Cluster
+	set := map[string]string{}
+	for _, r := range results {
+		for _, c := range r.clusters {
+			if first, ok := set[c.Name]; ok {
+				console.Error().Printf(
+					"duplicate cluster from clusters provider, %s exists in both cluster providers \n"+
+						"cluster_provider 1: %s\n"+
+						"cluster_provider 2: %s\n",
+					c.Name,
+					first,
+					r.description,
+				)
+				continue
+			}
+			set[c.Name] = r.description
+			clusters = append(clusters, c)
+		}
+	}
+	return clusters
+}
+
+func hostPort(i api.Instance) string {
+	return i.Host + ":" + strconv.Itoa(i.Port)
+}
+
+// tagInstance returns a copy of the instance with ProviderMetadataKey set to
+// the given provider name, replacing any existing value.
+func tagInstance(i api.Instance, provider string) api.Instance {
+	metadata := make(api.Metadata, 0, len(i.Metadata)+1)
+	for _, md := range i.Metadata {
+		if md.Key != ProviderMetadataKey {
+			metadata = append(metadata, md)
+		}
+	}
+	i.Metadata = append(metadata, api.Metadatum{Key: ProviderMetadataKey, Value: provider})
+	return i
+}
+
+func mergeInstances(results []providerClusters) []api.Cluster {
+	var order []string
+	merged := map[string]*api.Cluster{}
+	seen := map[string]map[string]string{}
+
+	for _, r := range results {
+		for _, c := range r.clusters {
+			cluster, ok := merged[c.Name]
+			if !ok {
+				copied := c
+				cluster = &copied
+				cluster.Instances = make(api.Instances, 0, len(c.Instances))
+				merged[c.Name] = cluster
+				seen[c.Name] = map[string]string{}
+				order = append(order, c.Name)
+			}
+
+			for _, i := range c.Instances {
+				hp := hostPort(i)
+				if first, dup := seen[c.Name][hp]; dup {
+					if first != r.name {
+						console.Debug().Printf(
+							"cluster %s: instance %s from %s already provided by %s",
+							c.Name,
+							hp,
+							r.name,
+							first,
+						)
+					}
+					continue
+				}
+				seen[c.Name][hp] = r.name
+				cluster.Instances = append(cluster.Instances, tagInstance(i, r.name))
+			}
+		}
+	}
+
+	clusters := make([]api.Cluster, 0, len(order))
+	for _, name := range order {
+		clusters = append(clusters, *merged[name])
+	}
+	return clusters
+}
+
+func prefixByProvider(results []providerClusters) []api.Cluster {
+	prefixed := make([]providerClusters, len(results))
+	for idx, r := range results {
+		prefixed[idx] = providerClusters{
+			name:        r.name,
+			description: r.description,
+			clusters:    make([]api.Cluster, len(r.clusters)),
+		}
+		for cidx, c := range r.clusters {
+			c.Name = r.name + prefixDelimiter + c.Name
+			prefixed[idx].clusters[cidx] = c
+		}
+	}
+
+	// provider names are unique, but a single provider may still return
+	// duplicate clusters
+	return firstWins(prefixed)
+}
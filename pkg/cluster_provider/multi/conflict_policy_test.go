@@ -0,0 +1,157 @@
+package multi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/test/assert"
+)
+
+func testProviderClusters() []providerClusters {
+	return []providerClusters{
+		{
+			name: "vm",
+			clusters: []api.Cluster{
+				{
+					Name: "c1",
+					Instances: api.Instances{
+						{Host: "h1", Port: 80},
+						{Host: "h2", Port: 80},
+					},
+				},
+				{Name: "c2", Instances: api.Instances{{Host: "h3", Port: 80}}},
+			},
+		},
+		{
+			name: "k8s",
+			clusters: []api.Cluster{
+				{
+					Name: "c1",
+					Instances: api.Instances{
+						{Host: "h2", Port: 80},
+						{
+							Host:     "h4",
+							Port:     80,
+							Metadata: api.Metadata{{Key: ProviderMetadataKey, Value: "x"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestConflictPolicyValidate(t *testing.T) {
+	for _, p := range conflictPolicies {
+		assert.Nil(t, p.validate())
+	}
+	assert.ErrorContains(t, ConflictPolicy("nope").validate(), "unknown conflict policy: nope")
+}
+
+func TestConflictPolicyFirstWins(t *testing.T) {
+	got := FirstWinsConflictPolicy.merge(testProviderClusters())
+	assert.ArrayEqual(t, got, []api.Cluster{
+		{
+			Name: "c1",
+			Instances: api.Instances{
+				{Host: "h1", Port: 80},
+				{Host: "h2", Port: 80},
+			},
+		},
+		{Name: "c2", Instances: api.Instances{{Host: "h3", Port: 80}}},
+	})
+}
+
+func TestConflictPolicyMergeInstances(t *testing.T) {
+	vm := api.Metadata{{Key: ProviderMetadataKey, Value: "vm"}}
+	k8s := api.Metadata{{Key: ProviderMetadataKey, Value: "k8s"}}
+
+	got := MergeInstancesConflictPolicy.merge(testProviderClusters())
+	assert.ArrayEqual(t, got, []api.Cluster{
+		{
+			Name: "c1",
+			Instances: api.Instances{
+				{Host: "h1", Port: 80, Metadata: vm},
+				{Host: "h2", Port: 80, Metadata: vm},
+				{Host: "h4", Port: 80, Metadata: k8s},
+			},
+		},
+		{Name: "c2", Instances: api.Instances{{Host: "h3", Port: 80, Metadata: vm}}},
+	})
+}
+
+func TestConflictPolicyMergeInstancesDoesNotModifyInput(t *testing.T) {
+	results := testProviderClusters()
+	MergeInstancesConflictPolicy.merge(results)
+	assert.ArrayEqual(t, results, testProviderClusters())
+}
+
+func TestConflictPolicyPrefixByProvider(t *testing.T) {
+	got := PrefixByProviderConflictPolicy.merge(testProviderClusters())
+	assert.ArrayEqual(t, got, []api.Cluster{
+		{
+			Name: "vm-c1",
+			Instances: api.Instances{
+				{Host: "h1", Port: 80},
+				{Host: "h2", Port: 80},
+			},
+		},
+		{Name: "vm-c2", Instances: api.Instances{{Host: "h3", Port: 80}}},
+		{
+			Name: "k8s-c1",
+			Instances: api.Instances{
+				{Host: "h2", Port: 80},
+				{
+					Host:     "h4",
+					Port:     80,
+					Metadata: api.Metadata{{Key: ProviderMetadataKey, Value: "x"}},
+				},
+			},
+		},
+	})
+}
+
+func TestMultiClustersProviderConflictPolicyConfig(t *testing.T) {
+	p := &multiClustersProvider{}
+	assert.Nil(t, json.Unmarshal(
+		[]byte(`{
+			"conflict_policy": "merge_instances",
+			"clusters_providers": [
+				{"name": "a", "type": "FileClustersProvider", "config": {"filename": "x"}},
+				{"type": "FileClustersProvider", "config": {"filename": "y"}}
+			]
+		}`),
+		p,
+	))
+	assert.Equal(t, p.conflictPolicy, MergeInstancesConflictPolicy)
+	assert.Equal(t, len(p.clusterProviders), 2)
+	assert.Equal(t, p.clusterProviders[0].name, "a")
+	assert.Equal(t, p.clusterProviders[1].name, "FileClustersProvider-1")
+}
+
+func TestMultiClustersProviderConflictPolicyDefault(t *testing.T) {
+	p := &multiClustersProvider{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"clusters_providers": []}`), p))
+	assert.Equal(t, p.conflictPolicy, FirstWinsConflictPolicy)
+}
+
+func TestMultiClustersProviderConflictPolicyInvalid(t *testing.T) {
+	p := &multiClustersProvider{}
+	err := json.Unmarshal([]byte(`{"conflict_policy": "nope", "clusters_providers": []}`), p)
+	assert.ErrorContains(t, err, "unknown conflict policy: nope")
+}
+
+func TestMultiClustersProviderDuplicateName(t *testing.T) {
+	p := &multiClustersProvider{}
+	err := json.Unmarshal(
+		[]byte(`{
+			"clusters_providers": [
+				{"name": "a", "type": "FileClustersProvider", "config": {"filename": "x"}},
+				{"name": "a", "type": "FileClustersProvider", "config": {"filename": "y"}}
+			]
+		}`),
+		p,
+	)
+	assert.ErrorContains(t, err, "duplicate cluster provider name: a")
+}
@@ -4,129 +4,356 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
 	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
 	"github.com/turbinelabs/rotor/pkg/cluster_provider"
-	"github.com/turbinelabs/rotor/plugins/aws"
-	"io/ioutil"
-	"os"
+	"github.com/turbinelabs/rotor/pkg/transform"
+	"github.com/turbinelabs/stats"
 )
 
-
 type ConfigType string
 
 const EC2ClustersProviderConfigType ConfigType = "EC2ClustersProvider"
 const ECSClustersProviderConfigType ConfigType = "ECSClustersProvider"
-
-// preserve the last known snapshot in case of an error
-type snapshottedClustersProvider struct {
-	cluster_provider.ClusterProvider
-	lastSnapshot []api.Cluster
-}
+const KubernetesClustersProviderConfigType ConfigType = "KubernetesClustersProvider"
+const ConsulClustersProviderConfigType ConfigType = "ConsulClustersProvider"
+const MarathonClustersProviderConfigType ConfigType = "MarathonClustersProvider"
+const FileClustersProviderConfigType ConfigType = "FileClustersProvider"
+const EnvoyCDSV1ClustersProviderConfigType ConfigType = "EnvoyCDSV1ClustersProvider"
+const EnvoyCDSV2ClustersProviderConfigType ConfigType = "EnvoyCDSV2ClustersProvider"
 
 type multiClustersProvider struct {
+	// guards clusterProviders and conflictPolicy, which are replaced when
+	// the config file is reloaded, the providers' snapshots, watcher and
+	// closed
+	mutex            sync.Mutex
 	clusterProviders []*snapshottedClustersProvider
+	conflictPolicy   ConflictPolicy
+	watcher          io.Closer
+	closed           bool
+	registry         cluster_provider.Registry
+	metadataFilter   transform.MetadataFilterConfig
+	stats            stats.Stats
+	time             tbntime.Source
 }
 
-
 type ClustersProviderConfig struct {
 	ConfigFileLocation string
+
+	// Stats receives per-provider health metrics. Optional.
+	Stats stats.Stats
+
+	// Watch causes the config file to be reloaded when it changes.
+	Watch bool
+
+	// MetadataFilter is applied to the clusters of providers that do not
+	// specify their own metadata_allow or metadata_deny.
+	MetadataFilter transform.MetadataFilterConfig
 }
 
+type clustersProviderConfig struct {
+	Name          string           `json:"name"`
+	Type          string           `json:"type"`
+	MaxStaleness  string           `json:"max_staleness"`
+	StalePolicy   StalePolicy      `json:"stale_policy"`
+	MetadataAllow *[]string        `json:"metadata_allow"`
+	MetadataDeny  *[]string        `json:"metadata_deny"`
+	Config        *json.RawMessage `json:"config"`
+}
+
+type multiClustersProviderConfig struct {
+	ConflictPolicy    ConflictPolicy           `json:"conflict_policy"`
+	ClustersProviders []clustersProviderConfig `json:"clusters_providers"`
+}
 
 func (m *multiClustersProvider) UnmarshalJSON(data []byte) error {
-	type temp struct {
-		ClustersProviders []struct{
-			Type   string      `json:"type"`
-			Config *json.RawMessage `json:"config"`
-		}  `json:"clusters_providers"`
+	providers, conflictPolicy, err := m.build(data, nil)
+	if err != nil {
+		return err
 	}
 
-	t := &temp{}
+	m.clusterProviders = providers
+	m.conflictPolicy = conflictPolicy
+	return nil
+}
+
+// build parses the given config and constructs its cluster providers. A
+// provider whose name, type and config match one of the current providers
+// reuses that provider's ClusterProvider rather than constructing a new
+// one.
+func (m *multiClustersProvider) build(
+	data []byte,
+	current []*snapshottedClustersProvider,
+) ([]*snapshottedClustersProvider, ConflictPolicy, error) {
+	t := &multiClustersProviderConfig{}
 
 	err := json.Unmarshal(data, t)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	m.clusterProviders = []*snapshottedClustersProvider{}
+	conflictPolicy := t.ConflictPolicy
+	if conflictPolicy == "" {
+		conflictPolicy = FirstWinsConflictPolicy
+	}
+	if err := conflictPolicy.validate(); err != nil {
+		return nil, "", fmt.Errorf("ClustersProviderConfig: %v", err)
+	}
 
-	for _, v := range t.ClustersProviders {
-		switch v.Type {
-		case string(ECSClustersProviderConfigType):
-			c := aws.ECSClustersProviderConfig{
-				Clusters:   []string{},
-				Aws:        aws.ECSAWSConfig{},
-			}
-			err = json.Unmarshal(*v.Config, &c)
+	registry := m.registry
+	if registry == nil {
+		registry = DefaultRegistry()
+	}
+
+	existing := map[string]*snapshottedClustersProvider{}
+	for _, sp := range current {
+		existing[sp.name] = sp
+	}
+
+	providers := []*snapshottedClustersProvider{}
+	names := map[string]bool{}
+	for idx, v := range t.ClustersProviders {
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", v.Type, idx)
+		}
+		if names[name] {
+			return nil, "", fmt.Errorf("ClustersProviderConfig: duplicate cluster provider name: %s", name)
+		}
+		names[name] = true
+
+		var maxStaleness time.Duration
+		if v.MaxStaleness != "" {
+			maxStaleness, err = time.ParseDuration(v.MaxStaleness)
 			if err != nil {
-				return err
+				return nil, "", fmt.Errorf("ClustersProviderConfig: %s: invalid max_staleness: %v", name, err)
 			}
-			cp, err := aws.NewECSClusterProvider(c)
-			if err != nil {
-				return err
+			if maxStaleness < 0 {
+				return nil, "", fmt.Errorf("ClustersProviderConfig: %s: max_staleness must not be negative", name)
 			}
-			m.clusterProviders = append(m.clusterProviders, &snapshottedClustersProvider{
-				ClusterProvider: cp,
-				lastSnapshot:    nil,
-			})
-		case string(EC2ClustersProviderConfigType):
-			c := aws.EC2ClustersProviderConfig{
-				Filters:   map[string][]string {},
-				Aws:       aws.EC2AWSConfig{},
+		}
+
+		stalePolicy := v.StalePolicy
+		if stalePolicy == "" {
+			stalePolicy = DropStalePolicy
+		}
+		if err := stalePolicy.validate(); err != nil {
+			return nil, "", fmt.Errorf("ClustersProviderConfig: %s: %v", name, err)
+		}
+
+		metadataFilter := m.metadataFilter
+		if v.MetadataAllow != nil || v.MetadataDeny != nil {
+			metadataFilter = transform.MetadataFilterConfig{}
+			if v.MetadataAllow != nil {
+				metadataFilter.Allow = *v.MetadataAllow
 			}
-			err = json.Unmarshal(*v.Config, &c)
-			if err != nil {
-				return err
+			if v.MetadataDeny != nil {
+				metadataFilter.Deny = *v.MetadataDeny
 			}
-			cp, err := aws.NewEC2ClusterProvider(c)
+		}
+		if err := metadataFilter.Validate(); err != nil {
+			return nil, "", fmt.Errorf("ClustersProviderConfig: %s: %v", name, err)
+		}
+
+		var config json.RawMessage
+		if v.Config != nil {
+			config = *v.Config
+		}
+
+		var cp cluster_provider.ClusterProvider
+		if sp, ok := existing[name]; ok && sp.sameConfig(v.Type, config) {
+			cp = sp.ClusterProvider
+		} else {
+			cp, err = registry.Make(v.Type, config)
 			if err != nil {
-				return err
+				return nil, "", fmt.Errorf("ClustersProviderConfig: %s: %v", name, err)
 			}
-			m.clusterProviders = append(m.clusterProviders, &snapshottedClustersProvider{
-				ClusterProvider: cp,
-				lastSnapshot:    nil,
-			})
-		default:
-			return errors.New(fmt.Sprintf(
-				"ClustersProviderConfig: unknown cluster provider type: %s, expected: one of %v",
-				v.Type,
-				[]ConfigType{ECSClustersProviderConfigType, EC2ClustersProviderConfigType},
-			))
 		}
+
+		providers = append(providers, &snapshottedClustersProvider{
+			ClusterProvider: cp,
+			name:            name,
+			typ:             v.Type,
+			config:          config,
+			maxStaleness:    maxStaleness,
+			stalePolicy:     stalePolicy,
+			metadataFilter: transform.NewMetadataFilter(
+				metadataFilter,
+				m.stats,
+				stats.NewKVTag(providerTag, name),
+			),
+		})
+	}
+
+	return providers, conflictPolicy, nil
+}
+
+// reload replaces the current cluster providers with those in the given
+// config. Providers whose config is unchanged are not reconstructed, and
+// providers that keep their name keep their last known snapshot. Replaced
+// providers are closed. If the config is invalid, the current providers
+// are left in place.
+func (m *multiClustersProvider) reload(data []byte) error {
+	m.mutex.Lock()
+	current := m.clusterProviders
+	m.mutex.Unlock()
+
+	providers, conflictPolicy, err := m.build(data, current)
+	if err != nil {
+		return err
 	}
 
+	// waits for any in-progress GetClusters, so that no snapshots are lost
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		closeReplaced(providers, current)
+		return errors.New("cluster provider closed")
+	}
+
+	replaced := m.swap(providers, conflictPolicy)
+	m.mutex.Unlock()
+
+	closeReplaced(replaced, providers)
 	return nil
 }
 
+// swap installs the given providers and conflict policy, returning the
+// previous providers. Assumes mutex is locked.
+func (m *multiClustersProvider) swap(
+	providers []*snapshottedClustersProvider,
+	conflictPolicy ConflictPolicy,
+) []*snapshottedClustersProvider {
+	previous := m.clusterProviders
+
+	existing := map[string]*snapshottedClustersProvider{}
+	for _, sp := range m.clusterProviders {
+		existing[sp.name] = sp
+	}
+
+	for _, sp := range providers {
+		old, ok := existing[sp.name]
+		switch {
+		case !ok:
+			console.Info().Printf("cluster provider %s added", sp.name)
+		case old.ClusterProvider == sp.ClusterProvider:
+			console.Debug().Printf("cluster provider %s unchanged", sp.name)
+		default:
+			console.Info().Printf("cluster provider %s rebuilt", sp.name)
+		}
+
+		if ok {
+			sp.lastSnapshot = old.lastSnapshot
+			sp.lastSuccess = old.lastSuccess
+			sp.failures = old.failures
+			delete(existing, sp.name)
+		}
+	}
+	for name := range existing {
+		console.Info().Printf("cluster provider %s removed", name)
+	}
+
+	if conflictPolicy != m.conflictPolicy {
+		console.Info().Printf(
+			"conflict policy changed from %s to %s",
+			m.conflictPolicy,
+			conflictPolicy,
+		)
+	}
+
+	m.clusterProviders = providers
+	m.conflictPolicy = conflictPolicy
+	return previous
+}
+
+// closeReplaced closes the ClusterProviders of the given providers that
+// implement io.Closer and are not used by any of the replacements.
+func closeReplaced(providers, replacements []*snapshottedClustersProvider) {
+	kept := map[cluster_provider.ClusterProvider]bool{}
+	for _, sp := range replacements {
+		kept[sp.ClusterProvider] = true
+	}
+
+	for _, sp := range providers {
+		if kept[sp.ClusterProvider] {
+			continue
+		}
+		if c, ok := sp.ClusterProvider.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				console.Error().Printf("cluster provider %s: close error: %s", sp.name, err)
+			}
+		}
+	}
+}
+
+// Close stops watching the config file and closes the cluster providers
+// that implement io.Closer.
+func (m *multiClustersProvider) Close() error {
+	m.mutex.Lock()
+	watcher := m.watcher
+	providers := m.clusterProviders
+	m.watcher = nil
+	m.clusterProviders = nil
+	m.closed = true
+	m.mutex.Unlock()
+
+	var err error
+	if watcher != nil {
+		err = watcher.Close()
+	}
+	closeReplaced(providers, nil)
+	return err
+}
+
+// NewMultiClustersProvider produces a ClusterProvider from the given
+// config. The returned ClusterProvider implements io.Closer.
 func NewMultiClustersProvider(config ClustersProviderConfig) (cluster_provider.ClusterProvider, error) {
-	fp, err := os.Open(config.ConfigFileLocation)
+	bts, err := ioutil.ReadFile(config.ConfigFileLocation)
 	if err != nil {
 		return nil, err
 	}
-	bts, err := ioutil.ReadAll(fp)
-	if err != nil {
-		return nil, err
+	p := &multiClustersProvider{
+		registry:       DefaultRegistry(),
+		metadataFilter: config.MetadataFilter,
+	}
+	if config.Stats != nil {
+		p.stats = config.Stats.Scope("multi")
 	}
-	p := &multiClustersProvider{}
 	err = json.Unmarshal(bts, p)
 	if err != nil {
 		return nil, err
 	}
+	if config.Watch {
+		watcher, err := p.watch(config.ConfigFileLocation)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.mutex.Lock()
+		p.watcher = watcher
+		p.mutex.Unlock()
+	}
 	return p, nil
 }
 
 type pairClustersError struct {
-	provider *snapshottedClustersProvider
+	index    int
 	clusters []api.Cluster
 	err      error
 }
 
-func getClustersFromProvider(sp *snapshottedClustersProvider, ch chan pairClustersError) {
+func getClustersFromProvider(idx int, sp *snapshottedClustersProvider, ch chan pairClustersError) {
 	defer func() {
 		if r := recover(); r != nil {
 			err := errors.New(fmt.Sprintf("%v", r))
 			ch <- pairClustersError{
+				index:    idx,
 				clusters: nil,
 				err:      err,
 			}
@@ -136,64 +363,81 @@ func getClustersFromProvider(sp *snapshottedClustersProvider, ch chan pairCluste
 	cs, err := sp.GetClusters()
 	console.Debug().Println("ClusterProvider.GetClusters", sp.String(), cs)
 	ch <- pairClustersError{
-		provider: sp,
+		index:    idx,
 		clusters: cs,
 		err:      err,
 	}
 }
 
 func (m *multiClustersProvider) String() string {
-	return fmt.Sprintf("MultiClustersProvider{providers=%v}", m.clusterProviders)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return fmt.Sprintf(
+		"MultiClustersProvider{conflict_policy=%s, providers=%v}",
+		m.conflictPolicy,
+		m.clusterProviders,
+	)
 }
 
 func (m *multiClustersProvider) GetClusters() ([]api.Cluster, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil, errors.New("cluster provider closed")
+	}
+
 	console.Debug().Println("MultiClustersProvider.GetClusters:start", m.clusterProviders)
-	var clusters []api.Cluster
 
-	ch := make(chan pairClustersError)
+	if m.time == nil {
+		m.time = tbntime.NewSource()
+	}
+	if m.stats == nil {
+		m.stats = stats.NewNoopStats()
+	}
+
+	ch := make(chan pairClustersError, len(m.clusterProviders))
 
-	for _, cp := range m.clusterProviders {
-		go getClustersFromProvider(cp, ch)
+	for idx, cp := range m.clusterProviders {
+		go getClustersFromProvider(idx, cp, ch)
 	}
 
-	set := map[string]cluster_provider.ClusterProvider{}
-	var errs []error
+	// results are merged in config order, regardless of the order in
+	// which providers respond
+	results := make([]providerClusters, len(m.clusterProviders))
+	var (
+		errs    []error
+		expired bool
+	)
 	for i := 0; i < len(m.clusterProviders); i++ {
-		p := <- ch
-		cs, err := p.clusters, p.err
-		if err != nil {
-			console.Error().Printf(
-				"unable to fetch clusters from cluster provider(%s), error: %v",
-				p.provider.String(), err,
-			)
-			// incase of an error use the last known snapshot
-			if p.provider.lastSnapshot == nil {
-				return nil, err  // first failure will always be a fatal error
-			}
-			cs = p.provider.lastSnapshot
-			errs = append(errs, err)
-		} else {
-			p.provider.lastSnapshot = cs
-		}
-		for _, c := range cs {
-			if _, ok := set[c.Name]; ok {
-				console.Error().Printf(
-					"duplicate cluster from clusters provider, %s exists in both cluster providers \n" +
-						"cluster_provider 1: %s\n" +
-						"cluster_provider 2: %s\n",
-					c.Name,
-					p.provider.String(),
-					set[c.Name].String(),
-				)
-				continue
+		p := <-ch
+		now := m.time.Now()
+		provider := m.clusterProviders[p.index]
+
+		cs, ok := provider.update(p.clusters, p.err, now)
+		provider.report(m.stats, now)
+		if p.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", provider.name, p.err))
+			if !ok && provider.lastSnapshot != nil {
+				expired = true
 			}
-			set[c.Name] = p.provider
-			clusters = append(clusters, c)
 		}
- 	}
- 	if len(errs) == len(m.clusterProviders) {
- 		return nil, errors.New(fmt.Sprintf("%v", errs))
+
+		results[p.index] = providerClusters{
+			name:        provider.name,
+			description: provider.String(),
+			clusters:    provider.filterMetadata(cs),
+		}
 	}
+
+	// if every provider failed, leave the current clusters in place,
+	// unless a snapshot has expired and must be removed
+	if len(errs) == len(m.clusterProviders) && len(errs) > 0 && !expired {
+		return nil, errors.New(fmt.Sprintf("%v", errs))
+	}
+
+	clusters := m.conflictPolicy.merge(results)
 	console.Debug().Println("MultiClustersProvider.GetClusters:end", clusters)
- 	return clusters, nil
+	return clusters, nil
 }
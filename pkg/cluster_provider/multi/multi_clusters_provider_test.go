@@ -0,0 +1,78 @@
+package multi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+const clustersFile = `[
+  { "cluster": "c1", "instances": [ { "host": "h1", "port": 8000 } ] }
+]`
+
+func TestDefaultRegistryTypes(t *testing.T) {
+	assert.HasSameElements(
+		t,
+		DefaultRegistry().Types(),
+		[]string{
+			string(EC2ClustersProviderConfigType),
+			string(ECSClustersProviderConfigType),
+			string(KubernetesClustersProviderConfigType),
+			string(ConsulClustersProviderConfigType),
+			string(MarathonClustersProviderConfigType),
+			string(FileClustersProviderConfigType),
+			string(EnvoyCDSV1ClustersProviderConfigType),
+			string(EnvoyCDSV2ClustersProviderConfigType),
+		},
+	)
+}
+
+func TestNewMultiClustersProviderFile(t *testing.T) {
+	clusters, cleanupClusters := tempfile.Write(t, clustersFile, "multi-clusters")
+	defer cleanupClusters()
+
+	config := fmt.Sprintf(
+		`{"clusters_providers": [{"type": "FileClustersProvider", "config": {"filename": %q}}]}`,
+		clusters,
+	)
+	configFile, cleanupConfig := tempfile.Write(t, config, "multi-config")
+	defer cleanupConfig()
+
+	p, err := NewMultiClustersProvider(ClustersProviderConfig{ConfigFileLocation: configFile})
+	assert.Nil(t, err)
+
+	got, err := p.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, []api.Cluster{
+		{Name: "c1", Instances: api.Instances{{Host: "h1", Port: 8000}}},
+	})
+}
+
+func TestNewMultiClustersProviderUnknownType(t *testing.T) {
+	configFile, cleanup := tempfile.Write(
+		t,
+		`{"clusters_providers": [{"type": "Nope"}]}`,
+		"multi-config",
+	)
+	defer cleanup()
+
+	p, err := NewMultiClustersProvider(ClustersProviderConfig{ConfigFileLocation: configFile})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, `Nope-0: unknown cluster provider type "Nope", expected one of`)
+}
+
+func TestNewMultiClustersProviderInvalidConfig(t *testing.T) {
+	configFile, cleanup := tempfile.Write(
+		t,
+		`{"clusters_providers": [{"type": "FileClustersProvider", "config": {}}]}`,
+		"multi-config",
+	)
+	defer cleanup()
+
+	p, err := NewMultiClustersProvider(ClustersProviderConfig{ConfigFileLocation: configFile})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "filename must be specified")
+}
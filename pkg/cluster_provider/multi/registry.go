@@ -0,0 +1,92 @@
+package multi
+
+import (
+	"encoding/json"
+
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/rotor/plugins/aws"
+	"github.com/turbinelabs/rotor/plugins/consul"
+	envoyv1 "github.com/turbinelabs/rotor/plugins/envoy/v1"
+	envoyv2 "github.com/turbinelabs/rotor/plugins/envoy/v2"
+	"github.com/turbinelabs/rotor/plugins/file"
+	"github.com/turbinelabs/rotor/plugins/kubernetes"
+	"github.com/turbinelabs/rotor/plugins/marathon"
+)
+
+// DefaultRegistry returns a Registry containing every cluster provider type
+// that may be used in a multi provider config file.
+func DefaultRegistry() cluster_provider.Registry {
+	r := cluster_provider.NewRegistry()
+
+	r.Register(string(ECSClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := aws.ECSClustersProviderConfig{
+			Clusters: []string{},
+			Aws:      aws.ECSAWSConfig{},
+		}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return aws.NewECSClusterProvider(c)
+	})
+
+	r.Register(string(EC2ClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := aws.EC2ClustersProviderConfig{
+			Filters: map[string][]string{},
+			Aws:     aws.EC2AWSConfig{},
+		}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return aws.NewEC2ClusterProvider(c)
+	})
+
+	r.Register(string(KubernetesClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := kubernetes.KubernetesClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return kubernetes.NewKubernetesClusterProvider(c)
+	})
+
+	r.Register(string(ConsulClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := consul.ConsulClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return consul.NewConsulClusterProvider(c)
+	})
+
+	r.Register(string(MarathonClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := marathon.MarathonClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return marathon.NewMarathonClusterProvider(c)
+	})
+
+	r.Register(string(FileClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := file.FileClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return file.NewFileClusterProvider(c)
+	})
+
+	r.Register(string(EnvoyCDSV1ClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := envoyv1.EnvoyCDSV1ClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return envoyv1.NewEnvoyCDSV1ClusterProvider(c)
+	})
+
+	r.Register(string(EnvoyCDSV2ClustersProviderConfigType), func(config json.RawMessage) (cluster_provider.ClusterProvider, error) {
+		c := envoyv2.EnvoyCDSV2ClustersProviderConfig{}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		return envoyv2.NewEnvoyCDSV2ClusterProvider(c)
+	})
+
+	return r
+}
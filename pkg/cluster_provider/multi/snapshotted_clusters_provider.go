@@ -0,0 +1,178 @@
+package multi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/rotor/pkg/transform"
+	"github.com/turbinelabs/stats"
+)
+
+// StalePolicy determines what happens to a failing provider's last known
+// clusters once they are older than its max_staleness.
+type StalePolicy string
+
+const (
+	// DropStalePolicy removes the provider's clusters from the result.
+	DropStalePolicy StalePolicy = "drop"
+
+	// EmptyStalePolicy keeps the provider's clusters, but without any
+	// instances.
+	EmptyStalePolicy StalePolicy = "empty"
+
+	providerTag = "cluster_provider"
+)
+
+var stalePolicies = []StalePolicy{DropStalePolicy, EmptyStalePolicy}
+
+func (p StalePolicy) validate() error {
+	for _, valid := range stalePolicies {
+		if p == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown stale policy: %s, expected: one of %v", p, stalePolicies)
+}
+
+// preserve the last known snapshot in case of an error, for at most
+// maxStaleness, if set
+type snapshottedClustersProvider struct {
+	cluster_provider.ClusterProvider
+	name           string
+	typ            string
+	config         json.RawMessage
+	maxStaleness   time.Duration
+	stalePolicy    StalePolicy
+	metadataFilter transform.Pipeline
+
+	lastSnapshot []api.Cluster
+	lastSuccess  time.Time
+	failures     int
+}
+
+// sameConfig returns true if the provider was constructed from the given
+// type and config. Configs are compared as JSON values, so formatting and
+// key order do not matter.
+func (sp *snapshottedClustersProvider) sameConfig(typ string, config json.RawMessage) bool {
+	if sp.typ != typ {
+		return false
+	}
+
+	if len(sp.config) == 0 || len(config) == 0 {
+		return len(sp.config) == len(config)
+	}
+
+	var a, b interface{}
+	if json.Unmarshal(sp.config, &a) != nil || json.Unmarshal(config, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// update records the result of a call to GetClusters made at the given
+// time, and returns the clusters to be used for this provider. The returned
+// bool is false if the provider has failed and its last known snapshot is
+// missing or has expired.
+func (sp *snapshottedClustersProvider) update(
+	cs []api.Cluster,
+	err error,
+	now time.Time,
+) ([]api.Cluster, bool) {
+	if err == nil {
+		if sp.failures > 0 {
+			console.Info().Printf(
+				"cluster provider %s recovered after %d failure(s)",
+				sp.name,
+				sp.failures,
+			)
+		}
+		sp.lastSnapshot = cs
+		sp.lastSuccess = now
+		sp.failures = 0
+		return cs, true
+	}
+
+	sp.failures++
+	console.Error().Printf(
+		"unable to fetch clusters from cluster provider %s (%d consecutive failure(s)), error: %v",
+		sp.name,
+		sp.failures,
+		err,
+	)
+
+	if sp.lastSnapshot == nil {
+		console.Error().Printf(
+			"cluster provider %s has no last known snapshot, ignoring its clusters",
+			sp.name,
+		)
+		return nil, false
+	}
+
+	if sp.expired(now) {
+		console.Error().Printf(
+			"last known snapshot for cluster provider %s is older than max_staleness (%s), applying stale policy %s",
+			sp.name,
+			sp.maxStaleness,
+			sp.stalePolicy,
+		)
+		if sp.stalePolicy == EmptyStalePolicy {
+			return emptyClusters(sp.lastSnapshot), false
+		}
+		return nil, false
+	}
+
+	// incase of an error use the last known snapshot
+	return sp.lastSnapshot, true
+}
+
+// filterMetadata applies the provider's metadata filter, if any.
+func (sp *snapshottedClustersProvider) filterMetadata(cs []api.Cluster) []api.Cluster {
+	if sp.metadataFilter == nil {
+		return cs
+	}
+	return sp.metadataFilter.Apply(cs)
+}
+
+func (sp *snapshottedClustersProvider) expired(now time.Time) bool {
+	return sp.maxStaleness > 0 && now.Sub(sp.lastSuccess) > sp.maxStaleness
+}
+
+// report records the provider's current health.
+func (sp *snapshottedClustersProvider) report(s stats.Stats, now time.Time) {
+	tag := stats.NewKVTag(providerTag, sp.name)
+
+	result := "success"
+	healthy := 1.0
+	if sp.failures > 0 {
+		result = "error"
+		healthy = 0.0
+	}
+	s.Count("collect", 1.0, tag, stats.NewKVTag("result", result))
+	s.Gauge("healthy", healthy, tag)
+	s.Gauge("consecutive_failures", float64(sp.failures), tag)
+
+	if sp.lastSnapshot != nil {
+		s.Gauge("snapshot_age", now.Sub(sp.lastSuccess).Seconds(), tag)
+		s.Gauge("clusters", float64(len(sp.lastSnapshot)), tag)
+	}
+
+	stale := 0.0
+	if sp.failures > 0 && sp.expired(now) {
+		stale = 1.0
+	}
+	s.Gauge("stale", stale, tag)
+}
+
+func emptyClusters(clusters []api.Cluster) []api.Cluster {
+	emptied := make([]api.Cluster, len(clusters))
+	for idx, c := range clusters {
+		c.Instances = api.Instances{}
+		emptied[idx] = c
+	}
+	return emptied
+}
@@ -0,0 +1,265 @@
+package multi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/pkg/transform"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+type testClusterProvider struct {
+	clusters []api.Cluster
+	err      error
+	closed   bool
+}
+
+func (p *testClusterProvider) String() string { return "testClusterProvider" }
+
+func (p *testClusterProvider) GetClusters() ([]api.Cluster, error) {
+	return p.clusters, p.err
+}
+
+func (p *testClusterProvider) Close() error {
+	p.closed = true
+	return nil
+}
+
+var testClusters = []api.Cluster{
+	{Name: "c1", Instances: api.Instances{{Host: "h1", Port: 80}}},
+}
+
+func TestStalePolicyValidate(t *testing.T) {
+	for _, p := range stalePolicies {
+		assert.Nil(t, p.validate())
+	}
+	assert.ErrorContains(t, StalePolicy("nope").validate(), "unknown stale policy: nope")
+}
+
+func TestSnapshottedClustersProviderUpdate(t *testing.T) {
+	start := time.Now()
+	sp := &snapshottedClustersProvider{name: "p", stalePolicy: DropStalePolicy}
+
+	got, ok := sp.update(nil, errors.New("boom"), start)
+	assert.Nil(t, got)
+	assert.False(t, ok)
+	assert.Equal(t, sp.failures, 1)
+
+	got, ok = sp.update(testClusters, nil, start)
+	assert.ArrayEqual(t, got, testClusters)
+	assert.True(t, ok)
+	assert.Equal(t, sp.failures, 0)
+	assert.Equal(t, sp.lastSuccess, start)
+
+	// no max staleness: the snapshot is used forever
+	got, ok = sp.update(nil, errors.New("boom"), start.Add(24*time.Hour))
+	assert.ArrayEqual(t, got, testClusters)
+	assert.True(t, ok)
+	assert.Equal(t, sp.failures, 1)
+}
+
+func TestSnapshottedClustersProviderUpdateDrop(t *testing.T) {
+	start := time.Now()
+	sp := &snapshottedClustersProvider{
+		name:         "p",
+		maxStaleness: time.Minute,
+		stalePolicy:  DropStalePolicy,
+	}
+	sp.update(testClusters, nil, start)
+
+	got, ok := sp.update(nil, errors.New("boom"), start.Add(time.Minute))
+	assert.ArrayEqual(t, got, testClusters)
+	assert.True(t, ok)
+
+	got, ok = sp.update(nil, errors.New("boom"), start.Add(time.Minute+time.Second))
+	assert.Nil(t, got)
+	assert.False(t, ok)
+
+	// the snapshot is retained, should the provider recover
+	assert.ArrayEqual(t, sp.lastSnapshot, testClusters)
+}
+
+func TestSnapshottedClustersProviderUpdateEmpty(t *testing.T) {
+	start := time.Now()
+	sp := &snapshottedClustersProvider{
+		name:         "p",
+		maxStaleness: time.Minute,
+		stalePolicy:  EmptyStalePolicy,
+	}
+	sp.update(testClusters, nil, start)
+
+	got, ok := sp.update(nil, errors.New("boom"), start.Add(time.Hour))
+	assert.ArrayEqual(t, got, []api.Cluster{{Name: "c1", Instances: api.Instances{}}})
+	assert.False(t, ok)
+	assert.ArrayEqual(t, sp.lastSnapshot, testClusters)
+}
+
+func TestSnapshottedClustersProviderReport(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	start := time.Now()
+	sp := &snapshottedClustersProvider{
+		name:         "p",
+		maxStaleness: time.Minute,
+		stalePolicy:  DropStalePolicy,
+	}
+	sp.update(testClusters, nil, start)
+	now := start.Add(2 * time.Minute)
+	sp.update(nil, errors.New("boom"), now)
+
+	tag := stats.NewKVTag(providerTag, "p")
+	s := stats.NewMockStats(ctrl)
+	gomock.InOrder(
+		s.EXPECT().Count("collect", 1.0, tag, stats.NewKVTag("result", "error")),
+		s.EXPECT().Gauge("healthy", 0.0, tag),
+		s.EXPECT().Gauge("consecutive_failures", 1.0, tag),
+		s.EXPECT().Gauge("snapshot_age", 120.0, tag),
+		s.EXPECT().Gauge("clusters", 1.0, tag),
+		s.EXPECT().Gauge("stale", 1.0, tag),
+	)
+	sp.report(s, now)
+}
+
+func mkTestMultiClustersProvider(
+	source tbntime.Source,
+	providers ...*snapshottedClustersProvider,
+) *multiClustersProvider {
+	return &multiClustersProvider{
+		clusterProviders: providers,
+		conflictPolicy:   FirstWinsConflictPolicy,
+		time:             source,
+	}
+}
+
+func TestMultiClustersProviderFirstFailureNotFatal(t *testing.T) {
+	good := &testClusterProvider{clusters: testClusters}
+	bad := &testClusterProvider{err: errors.New("boom")}
+
+	m := mkTestMultiClustersProvider(
+		tbntime.NewSource(),
+		&snapshottedClustersProvider{ClusterProvider: bad, name: "bad"},
+		&snapshottedClustersProvider{ClusterProvider: good, name: "good"},
+	)
+
+	got, err := m.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, testClusters)
+}
+
+func TestMultiClustersProviderAllFailed(t *testing.T) {
+	p := &testClusterProvider{clusters: testClusters}
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		m := mkTestMultiClustersProvider(
+			cs,
+			&snapshottedClustersProvider{
+				ClusterProvider: p,
+				name:            "p",
+				maxStaleness:    time.Minute,
+				stalePolicy:     DropStalePolicy,
+			},
+		)
+
+		got, err := m.GetClusters()
+		assert.Nil(t, err)
+		assert.ArrayEqual(t, got, testClusters)
+
+		// not yet expired: the failure is returned, so the current
+		// clusters remain in place
+		p.err = errors.New("boom")
+		cs.Advance(time.Minute)
+		got, err = m.GetClusters()
+		assert.ErrorContains(t, err, "p: boom")
+		assert.Nil(t, got)
+
+		// expired: the stale clusters are dropped
+		cs.Advance(time.Second)
+		got, err = m.GetClusters()
+		assert.Nil(t, err)
+		assert.Equal(t, len(got), 0)
+	})
+}
+
+func TestMultiClustersProviderStaleConfig(t *testing.T) {
+	m := &multiClustersProvider{}
+	err := m.UnmarshalJSON([]byte(`{
+		"clusters_providers": [
+			{"name": "a", "type": "FileClustersProvider", "config": {"filename": "x"}},
+			{
+				"name": "b",
+				"type": "FileClustersProvider",
+				"max_staleness": "5m",
+				"stale_policy": "empty",
+				"config": {"filename": "y"}
+			}
+		]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, m.clusterProviders[0].maxStaleness, time.Duration(0))
+	assert.Equal(t, m.clusterProviders[0].stalePolicy, DropStalePolicy)
+	assert.Equal(t, m.clusterProviders[1].maxStaleness, 5*time.Minute)
+	assert.Equal(t, m.clusterProviders[1].stalePolicy, EmptyStalePolicy)
+}
+
+func TestMultiClustersProviderStaleConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		want     string
+	}{
+		{`"max_staleness": "nope"`, "a: invalid max_staleness"},
+		{`"max_staleness": "-1m"`, "a: max_staleness must not be negative"},
+		{`"stale_policy": "nope"`, "a: unknown stale policy: nope"},
+	} {
+		m := &multiClustersProvider{}
+		err := m.UnmarshalJSON([]byte(`{
+			"clusters_providers": [
+				{"name": "a", "type": "FileClustersProvider", ` + tc.provider + `}
+			]
+		}`))
+		assert.ErrorContains(t, err, tc.want)
+	}
+}
+
+func TestMultiClustersProviderMetadataFilter(t *testing.T) {
+	m := &multiClustersProvider{
+		registry:       newTestRegistry(),
+		metadataFilter: transform.MetadataFilterConfig{Deny: []string{"hash"}},
+	}
+	err := m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "config": {"cluster": "a"}}`,
+		`{"name": "b", "type": "Test", "metadata_deny": [], "config": {"cluster": "b"}}`,
+		`{"name": "c", "type": "Test", "metadata_allow": ["app"], "config": {"cluster": "c"}}`,
+	))
+	assert.Nil(t, err)
+
+	instances := api.Instances{
+		{Host: "h", Port: 1, Metadata: api.Metadata{{Key: "app", Value: "x"}, {Key: "hash", Value: "y"}}},
+	}
+	for _, sp := range m.clusterProviders {
+		tcp := sp.ClusterProvider.(*testClusterProvider)
+		tcp.clusters[0].Instances = instances
+	}
+
+	got, err := m.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, got, []api.Cluster{
+		{Name: "a", Instances: api.Instances{{Host: "h", Port: 1, Metadata: api.Metadata{{Key: "app", Value: "x"}}}}},
+		{Name: "b", Instances: instances},
+		{Name: "c", Instances: api.Instances{{Host: "h", Port: 1, Metadata: api.Metadata{{Key: "app", Value: "x"}}}}},
+	})
+
+	m = &multiClustersProvider{registry: newTestRegistry()}
+	err = m.UnmarshalJSON(mkTestConfig(
+		"first_wins",
+		`{"name": "a", "type": "Test", "metadata_allow": [""], "config": {"cluster": "a"}}`,
+	))
+	assert.ErrorContains(t, err, "a: metadata key globs may not be empty")
+}
@@ -0,0 +1,59 @@
+package cluster_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Constructor produces a ClusterProvider from its JSON configuration.
+type Constructor func(config json.RawMessage) (ClusterProvider, error)
+
+// Registry maps cluster provider type names to the Constructors that
+// produce them.
+type Registry interface {
+	// Register associates the given type name with a Constructor,
+	// replacing any existing Constructor for that name.
+	Register(providerType string, ctor Constructor)
+
+	// Make produces a ClusterProvider of the given type from its JSON
+	// configuration. An empty configuration is treated as an empty
+	// JSON object.
+	Make(providerType string, config json.RawMessage) (ClusterProvider, error)
+
+	// Types returns the registered type names, sorted.
+	Types() []string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() Registry {
+	return registry{}
+}
+
+type registry map[string]Constructor
+
+func (r registry) Register(providerType string, ctor Constructor) {
+	r[providerType] = ctor
+}
+
+func (r registry) Make(providerType string, config json.RawMessage) (ClusterProvider, error) {
+	ctor, ok := r[providerType]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster provider type %q, expected one of %v", providerType, r.Types())
+	}
+
+	if len(config) == 0 {
+		config = json.RawMessage("{}")
+	}
+
+	return ctor(config)
+}
+
+func (r registry) Types() []string {
+	types := make([]string, 0, len(r))
+	for t := range r {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
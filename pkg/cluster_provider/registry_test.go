@@ -0,0 +1,45 @@
+package cluster_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/test/assert"
+)
+
+type testProvider struct {
+	config string
+}
+
+func (p testProvider) String() string                      { return "testProvider" }
+func (p testProvider) GetClusters() ([]api.Cluster, error) { return nil, nil }
+
+func TestRegistryMake(t *testing.T) {
+	r := NewRegistry()
+	r.Register("b", func(config json.RawMessage) (ClusterProvider, error) {
+		return testProvider{string(config)}, nil
+	})
+	r.Register("a", func(config json.RawMessage) (ClusterProvider, error) {
+		return nil, errors.New("boom")
+	})
+
+	assert.ArrayEqual(t, r.Types(), []string{"a", "b"})
+
+	p, err := r.Make("b", json.RawMessage(`{"x":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, p, testProvider{`{"x":1}`})
+
+	p, err = r.Make("b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, p, testProvider{`{}`})
+
+	p, err = r.Make("a", nil)
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "boom")
+
+	p, err = r.Make("c", nil)
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, `unknown cluster provider type "c", expected one of [a b]`)
+}
@@ -0,0 +1,169 @@
+package health
+
+import (
+	"errors"
+
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/stats"
+)
+
+const (
+	tcpType  = "tcp"
+	httpType = "http"
+	grpcType = "grpc"
+)
+
+// FromFlags produces a Checker from command-line flags.
+type FromFlags interface {
+	// Validate validates the flags.
+	Validate() error
+
+	// Filter returns true if unhealthy Instances should be removed from
+	// their Clusters, rather than marked unhealthy.
+	Filter() bool
+
+	// Make produces a Checker recording health in the given stats.Stats.
+	// If health checking is not enabled, Make returns nil.
+	Make(stats.Stats) Checker
+}
+
+// NewFromFlags installs a FromFlags in the given FlagSet.
+func NewFromFlags(flagset tbnflag.FlagSet) FromFlags {
+	ff := &fromFlags{
+		probeType: tbnflag.NewChoice(tcpType, httpType, grpcType).WithDefault(tcpType),
+	}
+
+	flagset.BoolVar(
+		&ff.enabled,
+		"enabled",
+		false,
+		"If true, rotor probes each collected instance, and marks instances healthy or unhealthy for Envoy. Clusters with a health check are probed with its HTTP or TCP health checker, interval, timeout and thresholds. Other clusters are probed as configured by the remaining health flags.",
+	)
+
+	flagset.Var(
+		&ff.probeType,
+		"type",
+		"The type of probe used for clusters without a health check: tcp connects to each instance, http requests --health.http-path and expects a 200 response, and grpc invokes the standard gRPC health checking service.",
+	)
+
+	flagset.StringVar(
+		&ff.httpPath,
+		"http-path",
+		"/",
+		"With the http probe type, the path requested.",
+	)
+
+	flagset.StringVar(
+		&ff.httpHost,
+		"http-host",
+		"",
+		"With the http probe type, the Host header sent. Defaults to the cluster name.",
+	)
+
+	flagset.StringVar(
+		&ff.grpcService,
+		"grpc-service",
+		"",
+		"With the grpc probe type, the service name checked. Defaults to the server's overall health.",
+	)
+
+	flagset.DurationVar(
+		&ff.opts.Interval,
+		"interval",
+		DefaultInterval,
+		"The interval between probes of each instance, for clusters without a health check.",
+	)
+
+	flagset.DurationVar(
+		&ff.opts.Timeout,
+		"timeout",
+		DefaultTimeout,
+		"The time allowed for each probe, for clusters without a health check.",
+	)
+
+	flagset.IntVar(
+		&ff.opts.Concurrency,
+		"concurrency",
+		DefaultConcurrency,
+		"The maximum number of probes in flight at once.",
+	)
+
+	flagset.IntVar(
+		&ff.opts.HealthyThreshold,
+		"healthy-threshold",
+		DefaultHealthyThreshold,
+		"The number of consecutive successful probes required to mark an unhealthy instance healthy, for clusters without a health check.",
+	)
+
+	flagset.IntVar(
+		&ff.opts.UnhealthyThreshold,
+		"unhealthy-threshold",
+		DefaultUnhealthyThreshold,
+		"The number of consecutive failed probes required to mark an instance unhealthy, for clusters without a health check.",
+	)
+
+	flagset.BoolVar(
+		&ff.filter,
+		"filter",
+		false,
+		"If true, unhealthy instances are removed from their clusters, rather than marked unhealthy.",
+	)
+
+	return ff
+}
+
+type fromFlags struct {
+	enabled     bool
+	filter      bool
+	probeType   tbnflag.Choice
+	httpPath    string
+	httpHost    string
+	grpcService string
+	opts        Options
+}
+
+func (ff *fromFlags) Validate() error {
+	if !ff.enabled {
+		return nil
+	}
+
+	if ff.opts.Interval <= 0 {
+		return errors.New("--health.interval must be greater than 0")
+	}
+
+	if ff.opts.Timeout <= 0 {
+		return errors.New("--health.timeout must be greater than 0")
+	}
+
+	if ff.opts.Concurrency < 1 {
+		return errors.New("--health.concurrency must be at least 1")
+	}
+
+	if ff.opts.HealthyThreshold < 1 || ff.opts.UnhealthyThreshold < 1 {
+		return errors.New("--health.healthy-threshold and --health.unhealthy-threshold must be at least 1")
+	}
+
+	return nil
+}
+
+func (ff *fromFlags) Filter() bool {
+	return ff.filter
+}
+
+func (ff *fromFlags) Make(s stats.Stats) Checker {
+	if !ff.enabled {
+		return nil
+	}
+
+	opts := ff.opts
+	switch ff.probeType.String() {
+	case httpType:
+		opts.Prober = NewHTTPProber(ff.httpHost, ff.httpPath, nil)
+	case grpcType:
+		opts.Prober = NewGRPCProber(ff.grpcService)
+	default:
+		opts.Prober = NewTCPProber(nil, nil)
+	}
+
+	return NewChecker(opts, s)
+}
@@ -0,0 +1,491 @@
+// Package health actively checks the health of collected Instances, so that
+// a single rotor, rather than every Envoy, probes each Instance.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+)
+
+const (
+	healthyStat = "health.healthy"
+	probesStat  = "health.probes"
+	latencyStat = "health.probe_latency"
+
+	clusterTag  = "cluster"
+	instanceTag = "instance"
+	resultTag   = "result"
+)
+
+// Defaults for zero-valued Options.
+const (
+	DefaultInterval           = 10 * time.Second
+	DefaultTimeout            = time.Second
+	DefaultConcurrency        = 16
+	DefaultHealthyThreshold   = 2
+	DefaultUnhealthyThreshold = 3
+)
+
+// Status is the health of an Instance.
+type Status int
+
+const (
+	// Unknown indicates the Instance has not yet been found healthy or
+	// unhealthy.
+	Unknown Status = iota
+
+	// Healthy indicates the Instance passed its most recent probes.
+	Healthy
+
+	// Unhealthy indicates the Instance failed its most recent probes.
+	Unhealthy
+)
+
+func (s Status) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
+// Options configure a Checker. Zero values are replaced with the
+// corresponding defaults.
+type Options struct {
+	// Prober probes Instances of Clusters without an api.HealthCheck. If
+	// nil, Instances are probed by connecting to them.
+	Prober Prober
+
+	// Interval is the time between probes of each Instance, for Clusters
+	// without an api.HealthCheck.
+	Interval time.Duration
+
+	// Timeout is the time allowed for each probe, for Clusters without an
+	// api.HealthCheck.
+	Timeout time.Duration
+
+	// Concurrency is the largest number of probes in flight at once.
+	Concurrency int
+
+	// HealthyThreshold is the number of consecutive successful probes
+	// required to mark an unhealthy Instance healthy. An Instance whose
+	// health is unknown is marked healthy after a single successful probe.
+	HealthyThreshold int
+
+	// UnhealthyThreshold is the number of consecutive failed probes
+	// required to mark an Instance unhealthy.
+	UnhealthyThreshold int
+}
+
+// Checker periodically probes the Instances of a set of Clusters. Clusters
+// with an api.HealthCheck are probed with its HTTP or TCP health checker,
+// interval, timeout and thresholds. Others are probed according to the
+// Checker's Options.
+type Checker interface {
+	// SetClusters replaces the Clusters whose Instances are probed. The
+	// health of Instances that remain is retained. New Instances are
+	// probed promptly.
+	SetClusters([]api.Cluster)
+
+	// Status returns the health of the given Instance of the named
+	// Cluster.
+	Status(cluster string, instance api.Instance) Status
+
+	// Notify registers a function to be called each time the health of
+	// one or more Instances changes.
+	Notify(func())
+
+	// Close stops probing.
+	Close() error
+}
+
+// NewChecker returns a Checker that probes Instances according to the
+// given Options until it is closed. The health of each Instance is recorded
+// in the given stats.Stats: health.healthy is a gauge, tagged with the
+// cluster and instance, that is 1 while the Instance is healthy and 0 while
+// it is unhealthy; health.probes counts probes, tagged with the cluster and
+// a result of success or failure; and health.probe_latency times them. The
+// stats.Stats may be nil.
+func NewChecker(opts Options, s stats.Stats) Checker {
+	c := newChecker(opts, s, tbntime.NewSource())
+	go c.run()
+	return c
+}
+
+func newChecker(opts Options, s stats.Stats, source tbntime.Source) *checker {
+	if s == nil {
+		s = stats.NewNoopStats()
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.HealthyThreshold < 1 {
+		opts.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if opts.UnhealthyThreshold < 1 {
+		opts.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	if opts.Prober == nil {
+		opts.Prober = NewTCPProber(nil, nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &checker{
+		opts:    opts,
+		stats:   s,
+		time:    source,
+		targets: map[string]*target{},
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// target is an Instance of a Cluster, along with its probe configuration
+// and health.
+type target struct {
+	cluster  string
+	instance api.Instance
+
+	prober             Prober
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+
+	next      time.Time
+	successes int
+	failures  int
+	status    Status
+}
+
+func targetKey(cluster string, instance api.Instance) string {
+	return cluster + "/" + instance.Key()
+}
+
+type checker struct {
+	opts  Options
+	stats stats.Stats
+	time  tbntime.Source
+
+	mutex    sync.Mutex
+	targets  map[string]*target
+	notifyFn []func()
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Checker = &checker{}
+
+func (c *checker) SetClusters(clusters []api.Cluster) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.time.Now()
+	targets := map[string]*target{}
+	for _, cluster := range clusters {
+		config := c.config(cluster)
+		for _, i := range cluster.Instances {
+			key := targetKey(cluster.Name, i)
+
+			t := config
+			t.instance = i
+			t.next = now
+			if existing, ok := c.targets[key]; ok {
+				t.next = existing.next
+				t.successes = existing.successes
+				t.failures = existing.failures
+				t.status = existing.status
+			}
+			targets[key] = &t
+		}
+	}
+	c.targets = targets
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// config returns a target holding the probe configuration for the
+// Instances of the given Cluster.
+func (c *checker) config(cluster api.Cluster) target {
+	t := target{
+		cluster:            cluster.Name,
+		prober:             c.opts.Prober,
+		interval:           c.opts.Interval,
+		timeout:            c.opts.Timeout,
+		healthyThreshold:   c.opts.HealthyThreshold,
+		unhealthyThreshold: c.opts.UnhealthyThreshold,
+	}
+
+	if len(cluster.HealthChecks) == 0 {
+		return t
+	}
+
+	hc := cluster.HealthChecks[0]
+	prober, err := ProberFromHealthCheck(hc)
+	if err != nil {
+		console.Error().Printf(
+			"cluster %s: using default health check: %s",
+			cluster.Name,
+			err,
+		)
+		return t
+	}
+
+	t.prober = prober
+	if hc.IntervalMsec > 0 {
+		t.interval = time.Duration(hc.IntervalMsec) * time.Millisecond
+	}
+	if hc.TimeoutMsec > 0 {
+		t.timeout = time.Duration(hc.TimeoutMsec) * time.Millisecond
+	}
+	if hc.HealthyThreshold > 0 {
+		t.healthyThreshold = hc.HealthyThreshold
+	}
+	if hc.UnhealthyThreshold > 0 {
+		t.unhealthyThreshold = hc.UnhealthyThreshold
+	}
+	return t
+}
+
+func (c *checker) Status(cluster string, instance api.Instance) Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t, ok := c.targets[targetKey(cluster, instance)]; ok {
+		return t.status
+	}
+	return Unknown
+}
+
+func (c *checker) Notify(f func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.notifyFn = append(c.notifyFn, f)
+}
+
+func (c *checker) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		close(c.stop)
+	})
+	<-c.done
+	return nil
+}
+
+func (c *checker) run() {
+	defer close(c.done)
+
+	for {
+		due, wait := c.due()
+		if len(due) > 0 {
+			c.probeAll(due)
+			continue
+		}
+
+		var (
+			timer   tbntime.Timer
+			timerCh <-chan time.Time
+		)
+		if wait > 0 {
+			timer = c.time.NewTimer(wait)
+			timerCh = timer.C()
+		}
+
+		select {
+		case <-timerCh:
+		case <-c.wake:
+		case <-c.stop:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+	}
+}
+
+// due returns copies of the targets due to be probed, and schedules their
+// next probes. If none are due, it returns the time until the next target
+// is due, or zero if there are no targets.
+func (c *checker) due() ([]target, time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.time.Now()
+
+	var (
+		due  []target
+		next time.Time
+	)
+	for _, t := range c.targets {
+		if !t.next.After(now) {
+			due = append(due, *t)
+			t.next = now.Add(t.interval)
+		}
+		if next.IsZero() || t.next.Before(next) {
+			next = t.next
+		}
+	}
+
+	if len(due) > 0 || next.IsZero() {
+		return due, 0
+	}
+	return nil, next.Sub(now)
+}
+
+// probeAll probes the given targets, at most opts.Concurrency at a time,
+// and notifies registered functions if the health of any changed.
+func (c *checker) probeAll(targets []target) {
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, c.opts.Concurrency)
+		changed = make(chan bool, len(targets))
+	)
+
+	for _, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			changed <- c.probe(t)
+		}(t)
+	}
+
+	wg.Wait()
+	close(changed)
+
+	anyChanged := false
+	for ch := range changed {
+		anyChanged = anyChanged || ch
+	}
+
+	if anyChanged {
+		c.mutex.Lock()
+		fns := c.notifyFn
+		c.mutex.Unlock()
+
+		for _, f := range fns {
+			f()
+		}
+	}
+}
+
+// probe probes the given target and records the result, returning true if
+// its health changed.
+func (c *checker) probe(t target) bool {
+	ctx := c.ctx
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	start := c.time.Now()
+	err := t.prober.Probe(ctx, t.cluster, t.instance)
+	c.stats.Timing(latencyStat, c.time.Now().Sub(start), stats.NewKVTag(clusterTag, t.cluster))
+
+	if c.ctx.Err() != nil {
+		// Closed while probing.
+		return false
+	}
+
+	return c.record(t.cluster, t.instance, err)
+}
+
+// record records the result of probing the given Instance, returning true
+// if its health changed.
+func (c *checker) record(cluster string, instance api.Instance, err error) bool {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.stats.Count(
+		probesStat,
+		1.0,
+		stats.NewKVTag(clusterTag, cluster),
+		stats.NewKVTag(resultTag, result),
+	)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t, ok := c.targets[targetKey(cluster, instance)]
+	if !ok {
+		return false
+	}
+
+	prev := t.status
+	if err == nil {
+		t.successes++
+		t.failures = 0
+		if t.status == Unknown || t.successes >= t.healthyThreshold {
+			t.status = Healthy
+		}
+	} else {
+		t.failures++
+		t.successes = 0
+		if t.failures >= t.unhealthyThreshold {
+			t.status = Unhealthy
+		}
+	}
+
+	if t.status == prev {
+		return false
+	}
+
+	if t.status == Unhealthy {
+		console.Info().Printf("cluster %s: instance %s is unhealthy: %s", cluster, instance.Key(), err)
+	} else {
+		console.Info().Printf("cluster %s: instance %s is healthy", cluster, instance.Key())
+	}
+
+	value := 0.0
+	if t.status == Healthy {
+		value = 1.0
+	}
+	c.stats.Gauge(
+		healthyStat,
+		value,
+		stats.NewKVTag(clusterTag, cluster),
+		stats.NewKVTag(instanceTag, instance.Key()),
+	)
+
+	return true
+}
@@ -0,0 +1,234 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+var (
+	instance1 = api.Instance{Host: "1.2.3.4", Port: 80}
+	instance2 = api.Instance{Host: "1.2.3.5", Port: 80}
+)
+
+// fakeProber fails probes of Instances whose keys are marked down.
+type fakeProber struct {
+	mutex  sync.Mutex
+	down   map[string]bool
+	probes int
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{down: map[string]bool{}}
+}
+
+func (p *fakeProber) setDown(i api.Instance, down bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.down[i.Key()] = down
+}
+
+func (p *fakeProber) Probe(ctx context.Context, cluster string, instance api.Instance) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.probes++
+	if p.down[instance.Key()] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func TestStatusString(t *testing.T) {
+	assert.Equal(t, Unknown.String(), "unknown")
+	assert.Equal(t, Healthy.String(), "healthy")
+	assert.Equal(t, Unhealthy.String(), "unhealthy")
+}
+
+func TestNewCheckerDefaults(t *testing.T) {
+	c := newChecker(Options{}, nil, tbntime.NewSource())
+	assert.Equal(t, c.opts.Interval, DefaultInterval)
+	assert.Equal(t, c.opts.Timeout, DefaultTimeout)
+	assert.Equal(t, c.opts.Concurrency, DefaultConcurrency)
+	assert.Equal(t, c.opts.HealthyThreshold, DefaultHealthyThreshold)
+	assert.Equal(t, c.opts.UnhealthyThreshold, DefaultUnhealthyThreshold)
+	assert.DeepEqual(t, c.opts.Prober, NewTCPProber(nil, nil))
+}
+
+func TestCheckerRecordThresholds(t *testing.T) {
+	c := newChecker(
+		Options{HealthyThreshold: 2, UnhealthyThreshold: 2},
+		nil,
+		tbntime.NewSource(),
+	)
+	c.SetClusters([]api.Cluster{{Name: "c", Instances: api.Instances{instance1}}})
+
+	assert.Equal(t, c.Status("c", instance1), Unknown)
+	assert.Equal(t, c.Status("c", instance2), Unknown)
+	assert.Equal(t, c.Status("other", instance1), Unknown)
+
+	// unknown instances become healthy after a single success
+	assert.True(t, c.record("c", instance1, nil))
+	assert.Equal(t, c.Status("c", instance1), Healthy)
+
+	assert.False(t, c.record("c", instance1, errors.New("boom")))
+	assert.Equal(t, c.Status("c", instance1), Healthy)
+	assert.True(t, c.record("c", instance1, errors.New("boom")))
+	assert.Equal(t, c.Status("c", instance1), Unhealthy)
+
+	assert.False(t, c.record("c", instance1, nil))
+	assert.Equal(t, c.Status("c", instance1), Unhealthy)
+	assert.False(t, c.record("c", instance1, errors.New("boom")))
+	assert.False(t, c.record("c", instance1, nil))
+	assert.True(t, c.record("c", instance1, nil))
+	assert.Equal(t, c.Status("c", instance1), Healthy)
+
+	// results for instances no longer checked are ignored
+	assert.False(t, c.record("c", instance2, nil))
+}
+
+func TestCheckerRecordStats(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	s := stats.NewMockStats(ctrl)
+	c := newChecker(Options{UnhealthyThreshold: 1}, s, tbntime.NewSource())
+	c.SetClusters([]api.Cluster{{Name: "c", Instances: api.Instances{instance1}}})
+
+	clusterTag := stats.NewKVTag(clusterTag, "c")
+	instanceTag := stats.NewKVTag(instanceTag, instance1.Key())
+
+	gomock.InOrder(
+		s.EXPECT().Count(probesStat, 1.0, clusterTag, stats.NewKVTag(resultTag, "success")),
+		s.EXPECT().Gauge(healthyStat, 1.0, clusterTag, instanceTag),
+		s.EXPECT().Count(probesStat, 1.0, clusterTag, stats.NewKVTag(resultTag, "success")),
+		s.EXPECT().Count(probesStat, 1.0, clusterTag, stats.NewKVTag(resultTag, "failure")),
+		s.EXPECT().Gauge(healthyStat, 0.0, clusterTag, instanceTag),
+	)
+
+	c.record("c", instance1, nil)
+	c.record("c", instance1, nil)
+	c.record("c", instance1, errors.New("boom"))
+}
+
+func TestCheckerSetClustersRetainsHealth(t *testing.T) {
+	source := tbntime.NewIncrementingControlledSource(time.Now(), 0)
+	c := newChecker(Options{Interval: time.Minute}, nil, source)
+
+	c.SetClusters([]api.Cluster{{Name: "c", Instances: api.Instances{instance1}}})
+	due, _ := c.due()
+	assert.Equal(t, len(due), 1)
+	c.record("c", instance1, nil)
+
+	c.SetClusters([]api.Cluster{{Name: "c", Instances: api.Instances{instance1, instance2}}})
+	assert.Equal(t, c.Status("c", instance1), Healthy)
+	assert.Equal(t, c.Status("c", instance2), Unknown)
+
+	// only the new instance is due
+	due, wait := c.due()
+	assert.Equal(t, len(due), 1)
+	assert.DeepEqual(t, due[0].instance, instance2)
+	assert.Equal(t, wait, time.Duration(0))
+
+	due, wait = c.due()
+	assert.Equal(t, len(due), 0)
+	assert.Equal(t, wait, time.Minute)
+
+	source.Advance(time.Minute)
+	due, _ = c.due()
+	assert.Equal(t, len(due), 2)
+
+	c.SetClusters(nil)
+	assert.Equal(t, c.Status("c", instance1), Unknown)
+	due, wait = c.due()
+	assert.Equal(t, len(due), 0)
+	assert.Equal(t, wait, time.Duration(0))
+}
+
+func TestCheckerConfigFromHealthCheck(t *testing.T) {
+	defaultProber := newFakeProber()
+	c := newChecker(Options{Prober: defaultProber}, nil, tbntime.NewSource())
+
+	cfg := c.config(api.Cluster{Name: "c"})
+	assert.Equal(t, cfg.cluster, "c")
+	assert.SameInstance(t, cfg.prober, defaultProber)
+	assert.Equal(t, cfg.interval, DefaultInterval)
+
+	cfg = c.config(api.Cluster{
+		Name: "c",
+		HealthChecks: api.HealthChecks{
+			{
+				TimeoutMsec:        100,
+				IntervalMsec:       2000,
+				HealthyThreshold:   4,
+				UnhealthyThreshold: 5,
+				HealthChecker: api.HealthChecker{
+					HTTPHealthCheck: &api.HTTPHealthCheck{Path: "/health"},
+				},
+			},
+		},
+	})
+	_, isHTTP := cfg.prober.(httpProber)
+	assert.True(t, isHTTP)
+	assert.Equal(t, cfg.timeout, 100*time.Millisecond)
+	assert.Equal(t, cfg.interval, 2*time.Second)
+	assert.Equal(t, cfg.healthyThreshold, 4)
+	assert.Equal(t, cfg.unhealthyThreshold, 5)
+
+	// invalid health checks fall back to the defaults
+	cfg = c.config(api.Cluster{
+		Name:         "c",
+		HealthChecks: api.HealthChecks{{IntervalMsec: 2000}},
+	})
+	assert.SameInstance(t, cfg.prober, defaultProber)
+	assert.Equal(t, cfg.interval, DefaultInterval)
+}
+
+func TestCheckerNotify(t *testing.T) {
+	prober := newFakeProber()
+	prober.setDown(instance2, true)
+
+	c := NewChecker(
+		Options{
+			Prober:             prober,
+			Interval:           10 * time.Millisecond,
+			UnhealthyThreshold: 1,
+		},
+		nil,
+	)
+	defer c.Close()
+
+	notified := make(chan struct{}, 10)
+	c.Notify(func() { notified <- struct{}{} })
+
+	c.SetClusters([]api.Cluster{{Name: "c", Instances: api.Instances{instance1, instance2}}})
+
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not notified")
+	}
+	assert.Equal(t, c.Status("c", instance1), Healthy)
+	assert.Equal(t, c.Status("c", instance2), Unhealthy)
+
+	prober.setDown(instance1, true)
+	deadline := time.After(5 * time.Second)
+	for c.Status("c", instance1) != Unhealthy {
+		select {
+		case <-notified:
+		case <-deadline:
+			t.Fatal("instance1 never became unhealthy")
+		}
+	}
+
+	assert.Nil(t, c.Close())
+	assert.Nil(t, c.Close())
+}
@@ -0,0 +1,213 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/turbinelabs/api"
+)
+
+// Prober probes a single Instance of a Cluster.
+type Prober interface {
+	// Probe returns nil if the given Instance of the named Cluster is
+	// healthy, and an error describing the failure otherwise. The probe
+	// is abandoned when the Context is done.
+	Probe(ctx context.Context, cluster string, instance api.Instance) error
+}
+
+func addr(instance api.Instance) string {
+	return net.JoinHostPort(instance.Host, strconv.Itoa(instance.Port))
+}
+
+// NewTCPProber returns a Prober that connects to each Instance. If send is
+// non-empty, it is written to the connection, and the response must
+// contain each of the receive blocks, in order but not necessarily
+// contiguously. Otherwise, the Instance is healthy if the connection
+// succeeds.
+func NewTCPProber(send []byte, receive [][]byte) Prober {
+	return tcpProber{send: send, receive: receive}
+}
+
+type tcpProber struct {
+	send    []byte
+	receive [][]byte
+}
+
+func (p tcpProber) Probe(ctx context.Context, cluster string, instance api.Instance) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr(instance))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if len(p.send) > 0 {
+		if _, err := conn.Write(p.send); err != nil {
+			return err
+		}
+	}
+
+	return p.awaitReceive(conn)
+}
+
+// awaitReceive reads from r until each receive block has been seen, in
+// order.
+func (p tcpProber) awaitReceive(r io.Reader) error {
+	if len(p.receive) == 0 {
+		return nil
+	}
+
+	var (
+		received []byte
+		buf      = make([]byte, 4096)
+		next     = 0
+	)
+	for {
+		n, err := r.Read(buf)
+		received = append(received, buf[:n]...)
+
+		for next < len(p.receive) {
+			idx := bytes.Index(received, p.receive[next])
+			if idx < 0 {
+				break
+			}
+			received = received[idx+len(p.receive[next]):]
+			next++
+		}
+
+		if next == len(p.receive) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("expected response not received: %s", err)
+		}
+	}
+}
+
+// NewHTTPProber returns a Prober that issues a GET request for the given
+// path to each Instance, with the given Host header, or the Cluster name if
+// host is empty, and the given headers. The Instance is healthy if the
+// response status is 200.
+func NewHTTPProber(host, path string, headers api.Metadata) Prober {
+	if path == "" {
+		path = "/"
+	}
+
+	return httpProber{
+		host:    host,
+		path:    path,
+		headers: headers,
+		client:  &http.Client{},
+	}
+}
+
+type httpProber struct {
+	host    string
+	path    string
+	headers api.Metadata
+	client  *http.Client
+}
+
+func (p httpProber) Probe(ctx context.Context, cluster string, instance api.Instance) error {
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr(instance)+p.path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Host = p.host
+	if req.Host == "" {
+		req.Host = cluster
+	}
+	for _, h := range p.headers {
+		req.Header.Add(h.Key, h.Value)
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// NewGRPCProber returns a Prober that invokes the standard gRPC health
+// checking service on each Instance, for the given service name. The
+// Instance is healthy if the service is SERVING.
+func NewGRPCProber(service string) Prober {
+	return grpcProber{service: service}
+}
+
+type grpcProber struct {
+	service string
+}
+
+func (p grpcProber) Probe(ctx context.Context, cluster string, instance api.Instance) error {
+	conn, err := grpc.DialContext(ctx, addr(instance), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(
+		ctx,
+		&healthpb.HealthCheckRequest{Service: p.service},
+	)
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// ProberFromHealthCheck returns a Prober implementing the given
+// api.HealthCheck's HTTP or TCP health checker.
+func ProberFromHealthCheck(hc api.HealthCheck) (Prober, error) {
+	switch {
+	case hc.HealthChecker.HTTPHealthCheck != nil:
+		hhc := hc.HealthChecker.HTTPHealthCheck
+		return NewHTTPProber(hhc.Host, hhc.Path, hhc.RequestHeadersToAdd), nil
+
+	case hc.HealthChecker.TCPHealthCheck != nil:
+		thc := hc.HealthChecker.TCPHealthCheck
+
+		send, err := base64.StdEncoding.DecodeString(thc.Send)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tcp health check send payload: %s", err)
+		}
+
+		receive := make([][]byte, len(thc.Receive))
+		for i, r := range thc.Receive {
+			if receive[i], err = base64.StdEncoding.DecodeString(r); err != nil {
+				return nil, fmt.Errorf("invalid tcp health check receive payload: %s", err)
+			}
+		}
+
+		return NewTCPProber(send, receive), nil
+	}
+
+	return nil, errors.New("health check has no health checker")
+}
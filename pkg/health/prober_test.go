@@ -0,0 +1,207 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/test/assert"
+)
+
+func instanceFor(t *testing.T, address string) api.Instance {
+	host, portStr, err := net.SplitHostPort(address)
+	assert.Nil(t, err)
+	port, err := strconv.Atoi(portStr)
+	assert.Nil(t, err)
+	return api.Instance{Host: host, Port: port}
+}
+
+func testContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+// echoServer accepts connections, replying to each with the given response
+// after reading a request, if expectRequest is true.
+func echoServer(t *testing.T, expectRequest bool, response []byte) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if expectRequest {
+					buf := make([]byte, 64)
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+				}
+				conn.Write(response)
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestTCPProberConnect(t *testing.T) {
+	l := echoServer(t, false, nil)
+	i := instanceFor(t, l.Addr().String())
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	assert.Nil(t, NewTCPProber(nil, nil).Probe(ctx, "c", i))
+
+	l.Close()
+	assert.NonNil(t, NewTCPProber(nil, nil).Probe(ctx, "c", i))
+}
+
+func TestTCPProberSendReceive(t *testing.T) {
+	l := echoServer(t, true, []byte("xxPONGxxOKxx"))
+	defer l.Close()
+	i := instanceFor(t, l.Addr().String())
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	p := NewTCPProber([]byte("PING"), [][]byte{[]byte("PONG"), []byte("OK")})
+	assert.Nil(t, p.Probe(ctx, "c", i))
+
+	p = NewTCPProber([]byte("PING"), [][]byte{[]byte("OK"), []byte("PONG")})
+	assert.ErrorContains(t, p.Probe(ctx, "c", i), "expected response not received")
+}
+
+func TestTCPProberAwaitReceiveSplit(t *testing.T) {
+	p := tcpProber{receive: [][]byte{[]byte("abc"), []byte("def")}}
+
+	r := &chunkedReader{chunks: [][]byte{[]byte("xa"), []byte("bcd"), []byte("ef")}}
+	assert.Nil(t, p.awaitReceive(r))
+
+	r = &chunkedReader{chunks: [][]byte{[]byte("abc"), []byte("de")}}
+	assert.ErrorContains(t, p.awaitReceive(r), "expected response not received")
+}
+
+// chunkedReader returns its chunks from successive calls to Read.
+type chunkedReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkedReader) Read(b []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, errors.New("EOF")
+	}
+	n := copy(b, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestHTTPProber(t *testing.T) {
+	var (
+		gotHost   string
+		gotHeader string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		gotHeader = r.Header.Get("X-Check")
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	i := instanceFor(t, server.Listener.Addr().String())
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	p := NewHTTPProber("", "/healthz", api.Metadata{{Key: "X-Check", Value: "yes"}})
+	assert.Nil(t, p.Probe(ctx, "cluster", i))
+	assert.Equal(t, gotHost, "cluster")
+	assert.Equal(t, gotHeader, "yes")
+
+	p = NewHTTPProber("example.com", "/healthz", nil)
+	assert.Nil(t, p.Probe(ctx, "cluster", i))
+	assert.Equal(t, gotHost, "example.com")
+
+	p = NewHTTPProber("", "", nil)
+	assert.ErrorContains(t, p.Probe(ctx, "cluster", i), "unexpected status")
+}
+
+func TestGRPCProber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	healthServer := grpchealth.NewServer()
+	healthServer.SetServingStatus("svc", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("down", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(l)
+	defer server.Stop()
+
+	i := instanceFor(t, l.Addr().String())
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	assert.Nil(t, NewGRPCProber("").Probe(ctx, "c", i))
+	assert.Nil(t, NewGRPCProber("svc").Probe(ctx, "c", i))
+	assert.ErrorContains(t, NewGRPCProber("down").Probe(ctx, "c", i), "NOT_SERVING")
+	assert.NonNil(t, NewGRPCProber("missing").Probe(ctx, "c", i))
+}
+
+func TestProberFromHealthCheck(t *testing.T) {
+	p, err := ProberFromHealthCheck(api.HealthCheck{
+		HealthChecker: api.HealthChecker{
+			HTTPHealthCheck: &api.HTTPHealthCheck{Host: "h", Path: "/p"},
+		},
+	})
+	assert.Nil(t, err)
+	hp, ok := p.(httpProber)
+	assert.True(t, ok)
+	assert.Equal(t, hp.host, "h")
+	assert.Equal(t, hp.path, "/p")
+
+	p, err = ProberFromHealthCheck(api.HealthCheck{
+		HealthChecker: api.HealthChecker{
+			TCPHealthCheck: &api.TCPHealthCheck{
+				Send:    base64.StdEncoding.EncodeToString([]byte("PING")),
+				Receive: []string{base64.StdEncoding.EncodeToString([]byte("PONG"))},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	tp, ok := p.(tcpProber)
+	assert.True(t, ok)
+	assert.True(t, bytes.Equal(tp.send, []byte("PING")))
+	assert.Equal(t, len(tp.receive), 1)
+	assert.True(t, bytes.Equal(tp.receive[0], []byte("PONG")))
+
+	_, err = ProberFromHealthCheck(api.HealthCheck{
+		HealthChecker: api.HealthChecker{
+			TCPHealthCheck: &api.TCPHealthCheck{Send: "!!"},
+		},
+	})
+	assert.ErrorContains(t, err, "invalid tcp health check send payload")
+
+	_, err = ProberFromHealthCheck(api.HealthCheck{})
+	assert.ErrorContains(t, err, "no health checker")
+}
@@ -0,0 +1,43 @@
+package leader
+
+import (
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+const consulSessionName = "rotor leader"
+
+// NewConsulLock returns a Lock backed by a Consul session holding the given
+// KV key. The key's value is set to the given id, identifying the leader.
+// If the session is not renewed within the given TTL (for example,
+// because the leader has exited or is partitioned from Consul), the
+// lock is lost.
+func NewConsulLock(client *consulapi.Client, key, id, ttl string) (Lock, error) {
+	lock, err := client.LockOpts(&consulapi.LockOptions{
+		Key:         key,
+		Value:       []byte(id),
+		SessionName: consulSessionName,
+		SessionTTL:  ttl,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &consulLock{lock}, nil
+}
+
+type consulLock struct {
+	lock *consulapi.Lock
+}
+
+var _ Lock = &consulLock{}
+
+func (l *consulLock) Acquire(stop <-chan struct{}) (<-chan struct{}, error) {
+	return l.lock.Lock(stop)
+}
+
+func (l *consulLock) Release() error {
+	if err := l.lock.Unlock(); err != consulapi.ErrLockNotHeld {
+		return err
+	}
+	return nil
+}
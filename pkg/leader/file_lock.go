@@ -0,0 +1,88 @@
+package leader
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+// DefaultFileLockInterval is the default interval at which a file Lock
+// held by another process is retried.
+const DefaultFileLockInterval = time.Second
+
+// NewFileLock returns a Lock backed by an exclusive advisory lock (see
+// flock(2)) on the file at the given path, which is created if necessary.
+// It is suitable for replicas sharing a host or a file system that
+// supports advisory locks. An unavailable lock is retried at the given
+// interval. Once acquired, the lock is held until released or the process
+// exits.
+func NewFileLock(path string, interval time.Duration) Lock {
+	return &fileLock{
+		path:     path,
+		interval: interval,
+		time:     tbntime.NewSource(),
+	}
+}
+
+type fileLock struct {
+	path     string
+	interval time.Duration
+	time     tbntime.Source
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+var _ Lock = &fileLock{}
+
+func (l *fileLock) Acquire(stop <-chan struct{}) (<-chan struct{}, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, err
+		}
+
+		timer := l.time.NewTimer(l.interval)
+		select {
+		case <-timer.C():
+		case <-stop:
+			timer.Stop()
+			f.Close()
+			return nil, nil
+		}
+	}
+
+	l.mutex.Lock()
+	l.file = f
+	l.mutex.Unlock()
+
+	// An advisory lock is only lost when the process exits.
+	return make(chan struct{}), nil
+}
+
+func (l *fileLock) Release() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	// Closing the file releases the lock.
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
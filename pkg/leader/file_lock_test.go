@@ -0,0 +1,47 @@
+package leader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "lock")
+
+	first := NewFileLock(path, time.Millisecond)
+	second := NewFileLock(path, time.Millisecond)
+
+	lost, err := first.Acquire(nil)
+	assert.Nil(t, err)
+	assert.NonNil(t, lost)
+
+	stop := make(chan struct{})
+	close(stop)
+	lost2, err := second.Acquire(stop)
+	assert.Nil(t, err)
+	assert.Nil(t, lost2)
+
+	assert.Nil(t, first.Release())
+	assert.Nil(t, first.Release())
+
+	lost2, err = second.Acquire(nil)
+	assert.Nil(t, err)
+	assert.NonNil(t, lost2)
+	assert.Nil(t, second.Release())
+}
+
+func TestFileLockError(t *testing.T) {
+	lock := NewFileLock("/nonexistent/dir/lock", time.Millisecond)
+	lost, err := lock.Acquire(nil)
+	assert.NonNil(t, err)
+	assert.Nil(t, lost)
+}
@@ -0,0 +1,172 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/stats"
+)
+
+const (
+	noBackend     = "none"
+	fileBackend   = "file"
+	consulBackend = "consul"
+
+	defaultConsulHostPort = "127.0.0.1:8500"
+	defaultConsulKey      = "rotor/leader"
+	defaultConsulTTL      = "15s"
+)
+
+// FromFlags produces an Elector from command-line flags.
+type FromFlags interface {
+	// Validate validates the flags.
+	Validate() error
+
+	// Enabled returns true if a leader election backend is configured.
+	Enabled() bool
+
+	// Make produces an Elector using the configured backend, recording
+	// leadership in the given stats.Stats. If no backend is configured,
+	// Make returns a nil Elector and no error.
+	Make(stats.Stats) (Elector, error)
+}
+
+// NewFromFlags installs a FromFlags in the given FlagSet.
+func NewFromFlags(flagset tbnflag.FlagSet) FromFlags {
+	ff := &fromFlags{
+		backend: tbnflag.NewChoice(noBackend, fileBackend, consulBackend).
+			WithDefault(noBackend),
+	}
+
+	hostname, _ := os.Hostname()
+
+	flagset.Var(
+		&ff.backend,
+		"backend",
+		"The backend used to elect a leader among replicas. Only the leader applies changes to the API; all replicas continue to serve xDS. Leader election is not used in standalone mode.",
+	)
+
+	flagset.StringVar(
+		&ff.id,
+		"consul-id",
+		hostname,
+		"With the consul backend, identifies this replica as the leader in the value of the locked key. Defaults to the hostname.",
+	)
+
+	flagset.StringVar(
+		&ff.file,
+		"file",
+		"",
+		"With the file backend, the path of the file to lock. The file is created if necessary.",
+	)
+
+	flagset.DurationVar(
+		&ff.fileInterval,
+		"file-interval",
+		DefaultFileLockInterval,
+		"With the file backend, the interval at which a file locked by another replica is retried.",
+	)
+
+	flagset.StringVar(
+		&ff.consulHostPort,
+		"consul-hostport",
+		defaultConsulHostPort,
+		"With the consul backend, the `[host]:port` for the Consul API.",
+	)
+
+	flagset.BoolVar(
+		&ff.consulUseSSL,
+		"consul-use-ssl",
+		false,
+		"With the consul backend, if set, communicates with the Consul API via SSL.",
+	)
+
+	flagset.StringVar(
+		&ff.consulKey,
+		"consul-key",
+		defaultConsulKey,
+		"With the consul backend, the KV key locked by the leader.",
+	)
+
+	flagset.StringVar(
+		&ff.consulTTL,
+		"consul-session-ttl",
+		defaultConsulTTL,
+		"With the consul backend, the TTL of the leader's session. Leadership is lost if the session is not renewed within the TTL.",
+	)
+
+	return ff
+}
+
+type fromFlags struct {
+	backend        tbnflag.Choice
+	id             string
+	file           string
+	fileInterval   time.Duration
+	consulHostPort string
+	consulUseSSL   bool
+	consulKey      string
+	consulTTL      string
+}
+
+func (ff *fromFlags) Validate() error {
+	switch ff.backend.String() {
+	case fileBackend:
+		if ff.file == "" {
+			return errors.New("--leader.file must be specified for the file backend")
+		}
+		if ff.fileInterval <= 0 {
+			return errors.New("--leader.file-interval must be greater than zero")
+		}
+
+	case consulBackend:
+		if ff.consulKey == "" {
+			return errors.New("--leader.consul-key must be specified for the consul backend")
+		}
+		if _, err := time.ParseDuration(ff.consulTTL); err != nil {
+			return fmt.Errorf("invalid --leader.consul-session-ttl: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (ff *fromFlags) Enabled() bool {
+	return ff.backend.String() != noBackend
+}
+
+func (ff *fromFlags) Make(s stats.Stats) (Elector, error) {
+	var lock Lock
+
+	switch ff.backend.String() {
+	case fileBackend:
+		lock = NewFileLock(ff.file, ff.fileInterval)
+
+	case consulBackend:
+		scheme := "http"
+		if ff.consulUseSSL {
+			scheme = "https"
+		}
+
+		client, err := consulapi.NewClient(
+			&consulapi.Config{Address: ff.consulHostPort, Scheme: scheme},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lock, err = NewConsulLock(client, ff.consulKey, ff.id, ff.consulTTL)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, nil
+	}
+
+	return NewElector(lock, s), nil
+}
@@ -0,0 +1,187 @@
+// Package leader provides leader election among replicas of rotor, so that
+// only one replica at a time applies changes to the Turbine Labs API.
+package leader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/turbinelabs/nonstdlib/executor"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+)
+
+const (
+	leaderStat   = "leader.is_leader"
+	acquiredStat = "leader.acquired"
+	lostStat     = "leader.lost"
+	errorsStat   = "leader.errors"
+
+	initialRetryDelay = time.Second
+	maxRetryDelay     = 30 * time.Second
+)
+
+// Lock is a lock shared among replicas. The replica holding the Lock is
+// the leader.
+type Lock interface {
+	// Acquire blocks until the Lock is held or stop is closed. If the
+	// Lock is acquired, it returns a channel that is closed if the Lock is
+	// subsequently lost. If stop is closed first, it returns a nil channel
+	// and no error.
+	Acquire(stop <-chan struct{}) (<-chan struct{}, error)
+
+	// Release releases the Lock. It must be called after the Lock is lost,
+	// before it is acquired again.
+	Release() error
+}
+
+// Elector campaigns for leadership using a Lock.
+type Elector interface {
+	// IsLeader returns true if this replica currently holds the Lock.
+	IsLeader() bool
+
+	// Notify registers a function to be called, with the new state, each
+	// time this replica gains or loses leadership.
+	Notify(func(isLeader bool))
+
+	// Close stops campaigning and releases leadership, if held.
+	Close() error
+}
+
+// NewElector returns an Elector that campaigns for leadership with the
+// given Lock until it is closed. Failures to acquire the Lock are retried
+// with exponential backoff. Changes in leadership are logged and recorded
+// in the given stats.Stats: leader.is_leader is a gauge that is 1 while
+// leading and 0 otherwise, leader.acquired and leader.lost count
+// transitions, and leader.errors counts failures to acquire the Lock. The
+// stats.Stats may be nil.
+func NewElector(lock Lock, s stats.Stats) Elector {
+	e := newElector(lock, s, tbntime.NewSource())
+	go e.run()
+	return e
+}
+
+func newElector(lock Lock, s stats.Stats, source tbntime.Source) *elector {
+	if s == nil {
+		s = stats.NewNoopStats()
+	}
+
+	s.Gauge(leaderStat, 0)
+
+	return &elector{
+		lock:    lock,
+		stats:   s,
+		time:    source,
+		backoff: executor.NewExponentialDelayFunc(initialRetryDelay, maxRetryDelay),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+type elector struct {
+	lock    Lock
+	stats   stats.Stats
+	time    tbntime.Source
+	backoff executor.DelayFunc
+
+	mutex    sync.Mutex
+	leader   bool
+	notifyFn []func(bool)
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Elector = &elector{}
+
+func (e *elector) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.leader
+}
+
+func (e *elector) Notify(f func(bool)) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.notifyFn = append(e.notifyFn, f)
+}
+
+func (e *elector) Close() error {
+	e.closeOnce.Do(func() { close(e.stop) })
+	<-e.done
+	return nil
+}
+
+func (e *elector) run() {
+	defer close(e.done)
+
+	attempt := 0
+	for {
+		lost, err := e.lock.Acquire(e.stop)
+		if err != nil {
+			attempt++
+			e.stats.Count(errorsStat, 1.0)
+
+			delay := e.backoff(attempt)
+			console.Error().Printf("leader election failed, retrying in %s: %s", delay, err)
+
+			timer := e.time.NewTimer(delay)
+			select {
+			case <-timer.C():
+				continue
+			case <-e.stop:
+				timer.Stop()
+				return
+			}
+		}
+
+		if lost == nil {
+			return
+		}
+
+		attempt = 0
+		e.setLeader(true)
+
+		select {
+		case <-lost:
+			e.setLeader(false)
+			e.release()
+
+		case <-e.stop:
+			e.setLeader(false)
+			e.release()
+			return
+		}
+	}
+}
+
+func (e *elector) release() {
+	if err := e.lock.Release(); err != nil {
+		console.Debug().Printf("leader election: error releasing lock: %s", err)
+	}
+}
+
+func (e *elector) setLeader(leader bool) {
+	e.mutex.Lock()
+	e.leader = leader
+	notifyFn := e.notifyFn
+	e.mutex.Unlock()
+
+	if leader {
+		console.Info().Println("acquired leadership: applying changes")
+		e.stats.Count(acquiredStat, 1.0)
+		e.stats.Gauge(leaderStat, 1)
+	} else {
+		console.Info().Println("lost leadership: no longer applying changes")
+		e.stats.Count(lostStat, 1.0)
+		e.stats.Gauge(leaderStat, 0)
+	}
+
+	for _, f := range notifyFn {
+		f(leader)
+	}
+}
@@ -0,0 +1,127 @@
+package leader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+type acquireResult struct {
+	lost chan struct{}
+	err  error
+}
+
+// fakeLock returns the results sent on its results channel from Acquire,
+// and notifies its released channel on Release.
+type fakeLock struct {
+	results  chan acquireResult
+	released chan struct{}
+}
+
+func newFakeLock() *fakeLock {
+	return &fakeLock{
+		results:  make(chan acquireResult),
+		released: make(chan struct{}),
+	}
+}
+
+func (l *fakeLock) Acquire(stop <-chan struct{}) (<-chan struct{}, error) {
+	select {
+	case r := <-l.results:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.lost, nil
+	case <-stop:
+		return nil, nil
+	}
+}
+
+func (l *fakeLock) Release() error {
+	l.released <- struct{}{}
+	return nil
+}
+
+// notifyingSource notifies its channel after each new Timer is created.
+type notifyingSource struct {
+	tbntime.ControlledSource
+	timers chan struct{}
+}
+
+func (s *notifyingSource) NewTimer(d time.Duration) tbntime.Timer {
+	t := s.ControlledSource.NewTimer(d)
+	s.timers <- struct{}{}
+	return t
+}
+
+func TestElector(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockStats := stats.NewMockStats(ctrl)
+	gomock.InOrder(
+		mockStats.EXPECT().Gauge(leaderStat, 0.0),
+		mockStats.EXPECT().Count(acquiredStat, 1.0),
+		mockStats.EXPECT().Gauge(leaderStat, 1.0),
+		mockStats.EXPECT().Count(lostStat, 1.0),
+		mockStats.EXPECT().Gauge(leaderStat, 0.0),
+		mockStats.EXPECT().Count(errorsStat, 1.0),
+		mockStats.EXPECT().Count(acquiredStat, 1.0),
+		mockStats.EXPECT().Gauge(leaderStat, 1.0),
+		mockStats.EXPECT().Count(lostStat, 1.0),
+		mockStats.EXPECT().Gauge(leaderStat, 0.0),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		lock := newFakeLock()
+		source := &notifyingSource{cs, make(chan struct{})}
+		e := newElector(lock, mockStats, source)
+
+		notified := make(chan bool, 1)
+		e.Notify(func(isLeader bool) { notified <- isLeader })
+
+		go e.run()
+		assert.False(t, e.IsLeader())
+
+		lost := make(chan struct{})
+		lock.results <- acquireResult{lost: lost}
+		assert.True(t, <-notified)
+		assert.True(t, e.IsLeader())
+
+		close(lost)
+		assert.False(t, <-notified)
+		<-lock.released
+		assert.False(t, e.IsLeader())
+
+		lock.results <- acquireResult{err: errors.New("boom")}
+		<-source.timers
+		cs.Advance(initialRetryDelay)
+
+		lock.results <- acquireResult{lost: make(chan struct{})}
+		assert.True(t, <-notified)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			assert.Nil(t, e.Close())
+		}()
+
+		assert.False(t, <-notified)
+		<-lock.released
+		<-closed
+		assert.False(t, e.IsLeader())
+	})
+}
+
+func TestElectorCloseWhileFollowing(t *testing.T) {
+	lock := newFakeLock()
+	e := NewElector(lock, nil)
+	assert.Nil(t, e.Close())
+	assert.False(t, e.IsLeader())
+}
@@ -0,0 +1,241 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"github.com/turbinelabs/api"
+)
+
+// Config is the YAML (or JSON) representation of a Pipeline.
+type Config struct {
+	// Transforms are applied in order.
+	Transforms []StepConfig `json:"transforms"`
+}
+
+// StepConfig configures a single transform. Exactly one of Include,
+// Exclude, Rename, Metadata, StaticInstances or FilterInstances must be
+// set.
+type StepConfig struct {
+	// Clusters is a regular expression selecting the clusters, by name, to
+	// which Rename, Metadata or FilterInstances apply. If empty, they apply
+	// to all clusters.
+	Clusters string `json:"clusters"`
+
+	// Include is a regular expression. Clusters whose names do not match
+	// are removed.
+	Include string `json:"include"`
+
+	// Exclude is a regular expression. Clusters whose names match are
+	// removed.
+	Exclude string `json:"exclude"`
+
+	// Rename is a text/template producing a new name for each cluster. The
+	// template is executed with .Name, the cluster's current name, and
+	// .Metadata, a map of the metadata shared by all of the cluster's
+	// instances.
+	Rename string `json:"rename"`
+
+	// Metadata modifies instance metadata.
+	Metadata *MetadataConfig `json:"metadata"`
+
+	// StaticInstances adds instances to a cluster.
+	StaticInstances *StaticInstancesConfig `json:"static_instances"`
+
+	// FilterInstances removes instances that do not match every predicate.
+	FilterInstances []PredicateConfig `json:"filter_instances"`
+}
+
+// MetadataConfig modifies instance metadata. Keys are dropped, then
+// renamed, then added.
+type MetadataConfig struct {
+	// Drop lists metadata keys to remove.
+	Drop []string `json:"drop"`
+
+	// Rename maps existing metadata keys to new keys, replacing any
+	// existing value for the new key.
+	Rename map[string]string `json:"rename"`
+
+	// Add maps metadata keys to values, replacing any existing value.
+	Add map[string]string `json:"add"`
+}
+
+// StaticInstancesConfig adds instances to the named cluster, creating it
+// if necessary. Instances whose host and port are already present are
+// ignored.
+type StaticInstancesConfig struct {
+	Cluster   string        `json:"cluster"`
+	Instances api.Instances `json:"instances"`
+}
+
+// PredicateConfig matches instances by metadata. If Absent is true, the
+// instance matches if it has no metadata with the given key. Otherwise the
+// instance matches if it has metadata with the given key whose value
+// matches the Value regular expression. An empty Value matches any value.
+type PredicateConfig struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Absent bool   `json:"absent"`
+}
+
+func (c StepConfig) actions() []string {
+	actions := []string{}
+	if c.Include != "" {
+		actions = append(actions, "include")
+	}
+	if c.Exclude != "" {
+		actions = append(actions, "exclude")
+	}
+	if c.Rename != "" {
+		actions = append(actions, "rename")
+	}
+	if c.Metadata != nil {
+		actions = append(actions, "metadata")
+	}
+	if c.StaticInstances != nil {
+		actions = append(actions, "static_instances")
+	}
+	if c.FilterInstances != nil {
+		actions = append(actions, "filter_instances")
+	}
+	return actions
+}
+
+func compile(expr, field string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", field, err)
+	}
+	return re, nil
+}
+
+// mkStep validates the StepConfig and produces the corresponding step.
+func (c StepConfig) mkStep() (step, error) {
+	actions := c.actions()
+	if len(actions) != 1 {
+		return nil, fmt.Errorf(
+			"exactly one of include, exclude, rename, metadata, static_instances or filter_instances is required, got %v",
+			actions,
+		)
+	}
+
+	var (
+		selector *regexp.Regexp
+		err      error
+	)
+	if c.Clusters != "" {
+		switch actions[0] {
+		case "include", "exclude", "static_instances":
+			return nil, fmt.Errorf("clusters may not be used with %s", actions[0])
+		}
+
+		if selector, err = compile(c.Clusters, "clusters"); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case c.Include != "":
+		re, err := compile(c.Include, "include")
+		if err != nil {
+			return nil, err
+		}
+		return &selectStep{re: re, keep: true}, nil
+
+	case c.Exclude != "":
+		re, err := compile(c.Exclude, "exclude")
+		if err != nil {
+			return nil, err
+		}
+		return &selectStep{re: re, keep: false}, nil
+
+	case c.Rename != "":
+		tmpl, err := template.New("rename").Option("missingkey=zero").Parse(c.Rename)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename: %s", err)
+		}
+		return &renameStep{selector: selector, tmpl: tmpl}, nil
+
+	case c.Metadata != nil:
+		return c.Metadata.mkStep(selector)
+
+	case c.StaticInstances != nil:
+		return c.StaticInstances.mkStep()
+
+	default:
+		return mkFilterInstancesStep(selector, c.FilterInstances)
+	}
+}
+
+func (c *MetadataConfig) mkStep(selector *regexp.Regexp) (step, error) {
+	if len(c.Drop) == 0 && len(c.Rename) == 0 && len(c.Add) == 0 {
+		return nil, errors.New("metadata requires at least one of drop, rename or add")
+	}
+
+	for _, k := range c.Drop {
+		if k == "" {
+			return nil, errors.New("metadata drop keys may not be empty")
+		}
+	}
+	for from, to := range c.Rename {
+		if from == "" || to == "" {
+			return nil, errors.New("metadata rename keys may not be empty")
+		}
+	}
+	for k := range c.Add {
+		if k == "" {
+			return nil, errors.New("metadata add keys may not be empty")
+		}
+	}
+
+	return &metadataStep{selector: selector, config: *c}, nil
+}
+
+func (c *StaticInstancesConfig) mkStep() (step, error) {
+	if c.Cluster == "" {
+		return nil, errors.New("static_instances requires a cluster")
+	}
+	if len(c.Instances) == 0 {
+		return nil, errors.New("static_instances requires at least one instance")
+	}
+	for idx, i := range c.Instances {
+		if i.Host == "" {
+			return nil, fmt.Errorf("static_instances instance %d: host is required", idx)
+		}
+		if i.Port <= 0 || i.Port > 65535 {
+			return nil, fmt.Errorf("static_instances instance %d: invalid port %d", idx, i.Port)
+		}
+	}
+
+	return &staticInstancesStep{cluster: c.Cluster, instances: c.Instances}, nil
+}
+
+func mkFilterInstancesStep(selector *regexp.Regexp, configs []PredicateConfig) (step, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("filter_instances requires at least one predicate")
+	}
+
+	predicates := make([]predicate, len(configs))
+	for idx, c := range configs {
+		if c.Key == "" {
+			return nil, fmt.Errorf("filter_instances predicate %d: key is required", idx)
+		}
+		if c.Absent && c.Value != "" {
+			return nil, fmt.Errorf("filter_instances predicate %d: value may not be used with absent", idx)
+		}
+
+		p := predicate{key: c.Key, absent: c.Absent}
+		if c.Value != "" {
+			re, err := compile(c.Value, fmt.Sprintf("filter_instances predicate %d value", idx))
+			if err != nil {
+				return nil, err
+			}
+			p.value = re
+		}
+		predicates[idx] = p
+	}
+
+	return &filterInstancesStep{selector: selector, predicates: predicates}, nil
+}
@@ -0,0 +1,79 @@
+package transform
+
+import (
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+)
+
+// FromFlags produces a Pipeline from command-line flags.
+type FromFlags interface {
+	// Validate validates the flags.
+	Validate() error
+
+	// Make produces a Pipeline from the configured file. If no file is
+	// configured, Make returns a nil Pipeline and no error.
+	Make() (Pipeline, error)
+
+	// MetadataFilterConfig returns the configured metadata key globs.
+	MetadataFilterConfig() MetadataFilterConfig
+}
+
+// NewFromFlags installs a FromFlags in the given FlagSet.
+func NewFromFlags(flagset tbnflag.FlagSet) FromFlags {
+	ff := &fromFlags{
+		metadataAllow: tbnflag.NewStrings(),
+		metadataDeny:  tbnflag.NewStrings(),
+	}
+
+	flagset.StringVar(
+		&ff.configFile,
+		"config-file",
+		"",
+		"If set, the YAML file describing transformations to apply to collected clusters before they are updated. See the README for the file format.",
+	)
+
+	flagset.Var(
+		&ff.metadataAllow,
+		"metadata-allow",
+		"If set, a comma-separated list of globs. Only instance metadata with keys matching at least one glob is kept. In globs, * matches any sequence of characters, and ? matches any single character.",
+	)
+
+	flagset.Var(
+		&ff.metadataDeny,
+		"metadata-deny",
+		"A comma-separated list of globs. Instance metadata with keys matching any glob is removed. In globs, * matches any sequence of characters, and ? matches any single character.",
+	)
+
+	return ff
+}
+
+type fromFlags struct {
+	configFile    string
+	metadataAllow tbnflag.Strings
+	metadataDeny  tbnflag.Strings
+}
+
+func (ff *fromFlags) Validate() error {
+	if err := ff.MetadataFilterConfig().Validate(); err != nil {
+		return err
+	}
+
+	if ff.configFile == "" {
+		return nil
+	}
+	_, err := Load(ff.configFile)
+	return err
+}
+
+func (ff *fromFlags) MetadataFilterConfig() MetadataFilterConfig {
+	return MetadataFilterConfig{
+		Allow: ff.metadataAllow.Strings,
+		Deny:  ff.metadataDeny.Strings,
+	}
+}
+
+func (ff *fromFlags) Make() (Pipeline, error) {
+	if ff.configFile == "" {
+		return nil, nil
+	}
+	return Load(ff.configFile)
+}
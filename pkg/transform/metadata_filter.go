@@ -0,0 +1,159 @@
+package transform
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	"github.com/turbinelabs/stats"
+)
+
+const droppedKeysStat = "metadata.dropped_keys"
+
+// MetadataFilterConfig lists globs matching instance metadata keys. A key
+// is kept if Allow is empty or the key matches at least one Allow glob, and
+// the key matches no Deny glob. In globs, "*" matches any sequence of
+// characters (including "/") and "?" matches any single character.
+type MetadataFilterConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// IsEmpty returns true if the config neither allows nor denies any keys,
+// in which case all keys are kept.
+func (c MetadataFilterConfig) IsEmpty() bool {
+	return len(c.Allow) == 0 && len(c.Deny) == 0
+}
+
+// Validate checks that no glob is empty.
+func (c MetadataFilterConfig) Validate() error {
+	for _, g := range append(append([]string{}, c.Allow...), c.Deny...) {
+		if g == "" {
+			return errors.New("metadata key globs may not be empty")
+		}
+	}
+	return nil
+}
+
+// NewMetadataFilter produces a Pipeline that removes instance metadata
+// whose keys are not allowed by the given config. The number of keys
+// dropped is logged at debug level and counted, per key, as
+// metadata.dropped_keys in the given stats.Stats. Any tags are added to
+// each stat. The stats.Stats may be nil.
+func NewMetadataFilter(
+	config MetadataFilterConfig,
+	s stats.Stats,
+	tags ...stats.Tag,
+) Pipeline {
+	if s == nil {
+		s = stats.NewNoopStats()
+	}
+
+	return &metadataFilter{
+		allow: globsToRegexps(config.Allow),
+		deny:  globsToRegexps(config.Deny),
+		stats: s,
+		tags:  tags,
+	}
+}
+
+func globsToRegexps(globs []string) []*regexp.Regexp {
+	result := make([]*regexp.Regexp, len(globs))
+	for idx, g := range globs {
+		expr := regexp.QuoteMeta(g)
+		expr = strings.Replace(expr, `\*`, ".*", -1)
+		expr = strings.Replace(expr, `\?`, ".", -1)
+		result[idx] = regexp.MustCompile("^" + expr + "$")
+	}
+	return result
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type metadataFilter struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+	stats stats.Stats
+	tags  []stats.Tag
+}
+
+func (f *metadataFilter) keep(key string) bool {
+	if len(f.allow) > 0 && !matchesAny(f.allow, key) {
+		return false
+	}
+	return !matchesAny(f.deny, key)
+}
+
+func (f *metadataFilter) Apply(clusters []api.Cluster) []api.Cluster {
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return clusters
+	}
+
+	// the same keys recur across instances, so decisions are cached
+	kept := map[string]bool{}
+	dropped := map[string]int{}
+
+	result := make([]api.Cluster, len(clusters))
+	for idx, c := range clusters {
+		instances := make(api.Instances, len(c.Instances))
+		for iidx, i := range c.Instances {
+			metadata := make(api.Metadata, 0, len(i.Metadata))
+			for _, md := range i.Metadata {
+				keep, ok := kept[md.Key]
+				if !ok {
+					keep = f.keep(md.Key)
+					kept[md.Key] = keep
+				}
+
+				if keep {
+					metadata = append(metadata, md)
+				} else {
+					dropped[md.Key]++
+				}
+			}
+			i.Metadata = metadata
+			instances[iidx] = i
+		}
+		c.Instances = instances
+		result[idx] = c
+	}
+
+	f.report(dropped)
+	return result
+}
+
+func (f *metadataFilter) report(dropped map[string]int) {
+	if len(dropped) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(dropped))
+	total := 0
+	for k, n := range dropped {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		tags := append([]stats.Tag{stats.NewKVTag("metadata_key", k)}, f.tags...)
+		f.stats.Count(droppedKeysStat, float64(dropped[k]), tags...)
+	}
+
+	console.Debug().Printf(
+		"metadata filter dropped %d metadata entries with %d distinct keys: %v",
+		total,
+		len(keys),
+		dropped,
+	)
+}
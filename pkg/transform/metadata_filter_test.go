@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestMetadataFilterConfig(t *testing.T) {
+	assert.True(t, MetadataFilterConfig{}.IsEmpty())
+	assert.False(t, MetadataFilterConfig{Deny: []string{"x"}}.IsEmpty())
+
+	assert.Nil(t, MetadataFilterConfig{Allow: []string{"a*"}, Deny: []string{"?"}}.Validate())
+	assert.ErrorContains(
+		t,
+		MetadataFilterConfig{Deny: []string{"x", ""}}.Validate(),
+		"globs may not be empty",
+	)
+}
+
+func TestMetadataFilterEmpty(t *testing.T) {
+	f := NewMetadataFilter(MetadataFilterConfig{}, nil)
+	assert.ArrayEqual(t, f.Apply(testClusters()), testClusters())
+}
+
+func TestMetadataFilter(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	tag := stats.NewKVTag("cluster_provider", "p")
+	s := stats.NewMockStats(ctrl)
+	gomock.InOrder(
+		s.EXPECT().Count(droppedKeysStat, 2.0, stats.NewKVTag("metadata_key", "hash"), tag),
+		s.EXPECT().Count(droppedKeysStat, 1.0, stats.NewKVTag("metadata_key", "other"), tag),
+	)
+
+	f := NewMetadataFilter(
+		MetadataFilterConfig{Allow: []string{"app", "h*", "stage"}, Deny: []string{"ha?h"}},
+		s,
+		tag,
+	)
+
+	input := []api.Cluster{
+		{
+			Name: "c",
+			Instances: api.Instances{
+				{Host: "h1", Port: 80, Metadata: md("app", "a", "hash", "1", "helm.sh/chart", "x")},
+				{Host: "h2", Port: 80, Metadata: md("hash", "2", "stage", "prod", "other", "y")},
+			},
+		},
+	}
+	got := f.Apply(input)
+	assert.ArrayEqual(t, got[0].Instances, api.Instances{
+		{Host: "h1", Port: 80, Metadata: md("app", "a", "helm.sh/chart", "x")},
+		{Host: "h2", Port: 80, Metadata: md("stage", "prod")},
+	})
+
+	// the input is not modified
+	assert.Equal(t, len(input[0].Instances[0].Metadata), 3)
+}
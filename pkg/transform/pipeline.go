@@ -0,0 +1,308 @@
+// Package transform provides a configurable pipeline of transformations
+// applied to collected clusters before they reach the updater, so that the
+// same naming and metadata policy applies regardless of the discovery
+// backend.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/template"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/codec"
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// Pipeline transforms a set of clusters.
+type Pipeline interface {
+	// Apply returns the transformed clusters. The given clusters are not
+	// modified.
+	Apply(clusters []api.Cluster) []api.Cluster
+}
+
+// NewPipeline produces a Pipeline from the given Config.
+func NewPipeline(config Config) (Pipeline, error) {
+	p := pipeline{}
+	for idx, c := range config.Transforms {
+		s, err := c.mkStep()
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %s", idx, err)
+		}
+		p = append(p, s)
+	}
+	return p, nil
+}
+
+// Load produces a Pipeline from the YAML (or JSON) Config in the given file.
+func Load(filename string) (Pipeline, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := Config{}
+	if err := codec.NewYaml().Decode(f, &config); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	p, err := NewPipeline(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return p, nil
+}
+
+type step interface {
+	apply(clusters []api.Cluster) []api.Cluster
+}
+
+type pipeline []step
+
+func (p pipeline) Apply(clusters []api.Cluster) []api.Cluster {
+	for idx, s := range p {
+		before := len(clusters)
+		clusters = s.apply(clusters)
+		console.Debug().Printf(
+			"transform %d (%T): %d clusters in, %d clusters out",
+			idx,
+			s,
+			before,
+			len(clusters),
+		)
+	}
+	return clusters
+}
+
+func selected(selector *regexp.Regexp, c api.Cluster) bool {
+	return selector == nil || selector.MatchString(c.Name)
+}
+
+// selectStep keeps clusters matching re if keep is true, and removes them
+// otherwise.
+type selectStep struct {
+	re   *regexp.Regexp
+	keep bool
+}
+
+func (s *selectStep) apply(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		if s.re.MatchString(c.Name) == s.keep {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+type renameStep struct {
+	selector *regexp.Regexp
+	tmpl     *template.Template
+}
+
+type renameData struct {
+	Name     string
+	Metadata map[string]string
+}
+
+func (s *renameStep) apply(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, 0, len(clusters))
+	names := map[string]bool{}
+	for _, c := range clusters {
+		if selected(s.selector, c) {
+			buf := &bytes.Buffer{}
+			data := renameData{Name: c.Name, Metadata: sharedMetadata(c.Instances)}
+			if err := s.tmpl.Execute(buf, data); err != nil {
+				console.Error().Printf("cannot rename cluster %s: %s", c.Name, err)
+			} else if buf.Len() == 0 {
+				console.Error().Printf("cannot rename cluster %s: empty name", c.Name)
+			} else {
+				c.Name = buf.String()
+			}
+		}
+
+		if names[c.Name] {
+			console.Error().Printf("duplicate cluster %s after rename, ignoring", c.Name)
+			continue
+		}
+		names[c.Name] = true
+		result = append(result, c)
+	}
+	return result
+}
+
+// sharedMetadata returns the metadata with the same value on every
+// instance.
+func sharedMetadata(instances api.Instances) map[string]string {
+	shared := map[string]string{}
+	for idx, i := range instances {
+		md := i.Metadata.Map()
+		if idx == 0 {
+			shared = md
+			continue
+		}
+		for k, v := range shared {
+			if other, ok := md[k]; !ok || other != v {
+				delete(shared, k)
+			}
+		}
+	}
+	return shared
+}
+
+type metadataStep struct {
+	selector *regexp.Regexp
+	config   MetadataConfig
+}
+
+func (s *metadataStep) apply(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, len(clusters))
+	for idx, c := range clusters {
+		if selected(s.selector, c) {
+			instances := make(api.Instances, len(c.Instances))
+			for iidx, i := range c.Instances {
+				i.Metadata = s.transform(i.Metadata)
+				instances[iidx] = i
+			}
+			c.Instances = instances
+		}
+		result[idx] = c
+	}
+	return result
+}
+
+func (s *metadataStep) transform(metadata api.Metadata) api.Metadata {
+	drop := map[string]bool{}
+	for _, k := range s.config.Drop {
+		drop[k] = true
+	}
+
+	values := map[string]string{}
+	keys := []string{}
+	set := func(k, v string) {
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = v
+	}
+
+	for _, md := range metadata {
+		if drop[md.Key] {
+			continue
+		}
+		if to, ok := s.config.Rename[md.Key]; ok {
+			set(to, md.Value)
+		} else if _, ok := values[md.Key]; !ok {
+			// an explicitly renamed key takes precedence
+			set(md.Key, md.Value)
+		}
+	}
+
+	added := make([]string, 0, len(s.config.Add))
+	for k := range s.config.Add {
+		added = append(added, k)
+	}
+	sort.Strings(added)
+	for _, k := range added {
+		set(k, s.config.Add[k])
+	}
+
+	result := make(api.Metadata, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, api.Metadatum{Key: k, Value: values[k]})
+	}
+	return result
+}
+
+type staticInstancesStep struct {
+	cluster   string
+	instances api.Instances
+}
+
+func hostPort(i api.Instance) string {
+	return i.Host + ":" + strconv.Itoa(i.Port)
+}
+
+func (s *staticInstancesStep) apply(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, 0, len(clusters)+1)
+	found := false
+	for _, c := range clusters {
+		if c.Name == s.cluster {
+			found = true
+			c.Instances = s.merge(c.Instances)
+		}
+		result = append(result, c)
+	}
+
+	if !found {
+		result = append(result, api.Cluster{Name: s.cluster, Instances: s.merge(nil)})
+	}
+	return result
+}
+
+func (s *staticInstancesStep) merge(instances api.Instances) api.Instances {
+	seen := map[string]bool{}
+	merged := make(api.Instances, 0, len(instances)+len(s.instances))
+	for _, i := range instances {
+		seen[hostPort(i)] = true
+		merged = append(merged, i)
+	}
+	for _, i := range s.instances {
+		if !seen[hostPort(i)] {
+			seen[hostPort(i)] = true
+			merged = append(merged, i)
+		}
+	}
+	return merged
+}
+
+type predicate struct {
+	key    string
+	value  *regexp.Regexp
+	absent bool
+}
+
+func (p predicate) matches(i api.Instance) bool {
+	for _, md := range i.Metadata {
+		if md.Key == p.key {
+			return !p.absent && (p.value == nil || p.value.MatchString(md.Value))
+		}
+	}
+	return p.absent
+}
+
+type filterInstancesStep struct {
+	selector   *regexp.Regexp
+	predicates []predicate
+}
+
+func (s *filterInstancesStep) apply(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, len(clusters))
+	for idx, c := range clusters {
+		if selected(s.selector, c) {
+			instances := make(api.Instances, 0, len(c.Instances))
+			for _, i := range c.Instances {
+				if s.matches(i) {
+					instances = append(instances, i)
+				}
+			}
+			c.Instances = instances
+		}
+		result[idx] = c
+	}
+	return result
+}
+
+func (s *filterInstancesStep) matches(i api.Instance) bool {
+	for _, p := range s.predicates {
+		if !p.matches(i) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,406 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/updater"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func md(kvs ...string) api.Metadata {
+	m := api.Metadata{}
+	for i := 0; i < len(kvs); i += 2 {
+		m = append(m, api.Metadatum{Key: kvs[i], Value: kvs[i+1]})
+	}
+	return m
+}
+
+func testClusters() []api.Cluster {
+	return []api.Cluster{
+		{
+			Name: "svc-a",
+			Instances: api.Instances{
+				{Host: "h1", Port: 80, Metadata: md("app", "a", "stage", "prod", "hash", "1")},
+				{Host: "h2", Port: 80, Metadata: md("app", "a", "stage", "canary", "hash", "2")},
+			},
+		},
+		{
+			Name:      "svc-b-canary",
+			Instances: api.Instances{{Host: "h3", Port: 80, Metadata: md("app", "b")}},
+		},
+		{
+			Name:      "other",
+			Instances: api.Instances{{Host: "h4", Port: 80}},
+		},
+	}
+}
+
+func mustPipeline(t *testing.T, steps ...StepConfig) Pipeline {
+	p, err := NewPipeline(Config{Transforms: steps})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return p
+}
+
+func names(clusters []api.Cluster) []string {
+	result := make([]string, len(clusters))
+	for idx, c := range clusters {
+		result[idx] = c.Name
+	}
+	return result
+}
+
+func TestPipelineEmpty(t *testing.T) {
+	p := mustPipeline(t)
+	assert.ArrayEqual(t, p.Apply(testClusters()), testClusters())
+}
+
+func TestPipelineIncludeExclude(t *testing.T) {
+	p := mustPipeline(t, StepConfig{Include: "^svc-"}, StepConfig{Exclude: "-canary$"})
+	assert.ArrayEqual(t, names(p.Apply(testClusters())), []string{"svc-a"})
+}
+
+func TestPipelineRename(t *testing.T) {
+	p := mustPipeline(
+		t,
+		StepConfig{Clusters: "^svc-", Rename: "{{.Metadata.app}}.{{.Name}}"},
+	)
+	assert.ArrayEqual(
+		t,
+		names(p.Apply(testClusters())),
+		[]string{"a.svc-a", "b.svc-b-canary", "other"},
+	)
+}
+
+func TestPipelineRenameDuplicate(t *testing.T) {
+	p := mustPipeline(t, StepConfig{Rename: "{{.Metadata.stage}}x"})
+	// svc-a's instances do not share a stage and the others have none,
+	// so all three become "x" and only the first is kept
+	assert.ArrayEqual(t, names(p.Apply(testClusters())), []string{"x"})
+}
+
+func TestPipelineRenameEmpty(t *testing.T) {
+	p := mustPipeline(t, StepConfig{Rename: "{{.Metadata.nope}}"})
+	assert.ArrayEqual(t, p.Apply(testClusters()), testClusters())
+}
+
+func TestPipelineMetadata(t *testing.T) {
+	p := mustPipeline(t, StepConfig{
+		Clusters: "^svc-a$",
+		Metadata: &MetadataConfig{
+			Drop:   []string{"hash"},
+			Rename: map[string]string{"app": "service"},
+			Add:    map[string]string{"stage": "x", "env": "prod"},
+		},
+	})
+
+	input := testClusters()
+	got := p.Apply(input)
+	assert.ArrayEqual(t, got[0].Instances, api.Instances{
+		{Host: "h1", Port: 80, Metadata: md("service", "a", "stage", "x", "env", "prod")},
+		{Host: "h2", Port: 80, Metadata: md("service", "a", "stage", "x", "env", "prod")},
+	})
+	assert.ArrayEqual(t, got[1:], testClusters()[1:])
+
+	// the input is not modified
+	assert.ArrayEqual(t, input, testClusters())
+}
+
+func TestPipelineMetadataRenameTakesPrecedence(t *testing.T) {
+	p := mustPipeline(t, StepConfig{
+		Metadata: &MetadataConfig{Rename: map[string]string{"a": "b"}},
+	})
+
+	got := p.Apply([]api.Cluster{
+		{Name: "c", Instances: api.Instances{
+			{Host: "h1", Port: 1, Metadata: md("b", "old", "a", "new")},
+			{Host: "h2", Port: 1, Metadata: md("a", "new", "b", "old")},
+		}},
+	})
+	assert.ArrayEqual(t, got[0].Instances, api.Instances{
+		{Host: "h1", Port: 1, Metadata: md("b", "new")},
+		{Host: "h2", Port: 1, Metadata: md("b", "new")},
+	})
+}
+
+func TestPipelineStaticInstances(t *testing.T) {
+	p := mustPipeline(
+		t,
+		StepConfig{StaticInstances: &StaticInstancesConfig{
+			Cluster: "other",
+			Instances: api.Instances{
+				{Host: "h4", Port: 80, Metadata: md("ignored", "true")},
+				{Host: "h5", Port: 80},
+			},
+		}},
+		StepConfig{StaticInstances: &StaticInstancesConfig{
+			Cluster:   "new",
+			Instances: api.Instances{{Host: "h6", Port: 80}},
+		}},
+	)
+
+	got := p.Apply(testClusters())
+	assert.ArrayEqual(t, names(got), []string{"svc-a", "svc-b-canary", "other", "new"})
+	assert.ArrayEqual(t, got[2].Instances, api.Instances{
+		{Host: "h4", Port: 80},
+		{Host: "h5", Port: 80},
+	})
+	assert.ArrayEqual(t, got[3].Instances, api.Instances{{Host: "h6", Port: 80}})
+}
+
+func TestPipelineFilterInstances(t *testing.T) {
+	p := mustPipeline(t, StepConfig{
+		FilterInstances: []PredicateConfig{
+			{Key: "app"},
+			{Key: "stage", Value: "^prod$"},
+		},
+	})
+
+	got := p.Apply(testClusters())
+	assert.ArrayEqual(t, got[0].Instances, testClusters()[0].Instances[:1])
+	assert.Equal(t, len(got[1].Instances), 0)
+	assert.Equal(t, len(got[2].Instances), 0)
+
+	p = mustPipeline(t, StepConfig{
+		Clusters:        "^svc-",
+		FilterInstances: []PredicateConfig{{Key: "hash", Absent: true}},
+	})
+
+	got = p.Apply(testClusters())
+	assert.Equal(t, len(got[0].Instances), 0)
+	assert.ArrayEqual(t, got[1:], testClusters()[1:])
+}
+
+func TestNewPipelineErrors(t *testing.T) {
+	for _, tc := range []struct {
+		step StepConfig
+		want string
+	}{
+		{StepConfig{}, "exactly one of"},
+		{StepConfig{Include: "a", Exclude: "b"}, "exactly one of"},
+		{StepConfig{Include: "("}, "invalid include"},
+		{StepConfig{Exclude: "("}, "invalid exclude"},
+		{StepConfig{Clusters: "a", Include: "b"}, "clusters may not be used with include"},
+		{StepConfig{Clusters: "(", Rename: "x"}, "invalid clusters"},
+		{StepConfig{Rename: "{{"}, "invalid rename"},
+		{StepConfig{Metadata: &MetadataConfig{}}, "metadata requires"},
+		{StepConfig{Metadata: &MetadataConfig{Drop: []string{""}}}, "drop keys may not be empty"},
+		{
+			StepConfig{Metadata: &MetadataConfig{Rename: map[string]string{"a": ""}}},
+			"rename keys may not be empty",
+		},
+		{
+			StepConfig{Metadata: &MetadataConfig{Add: map[string]string{"": "a"}}},
+			"add keys may not be empty",
+		},
+		{StepConfig{StaticInstances: &StaticInstancesConfig{}}, "requires a cluster"},
+		{
+			StepConfig{StaticInstances: &StaticInstancesConfig{Cluster: "c"}},
+			"requires at least one instance",
+		},
+		{
+			StepConfig{StaticInstances: &StaticInstancesConfig{
+				Cluster:   "c",
+				Instances: api.Instances{{Port: 80}},
+			}},
+			"instance 0: host is required",
+		},
+		{
+			StepConfig{StaticInstances: &StaticInstancesConfig{
+				Cluster:   "c",
+				Instances: api.Instances{{Host: "h", Port: 0}},
+			}},
+			"instance 0: invalid port 0",
+		},
+		{StepConfig{FilterInstances: []PredicateConfig{}}, "requires at least one predicate"},
+		{StepConfig{FilterInstances: []PredicateConfig{{}}}, "predicate 0: key is required"},
+		{
+			StepConfig{FilterInstances: []PredicateConfig{{Key: "k", Value: "v", Absent: true}}},
+			"value may not be used with absent",
+		},
+		{
+			StepConfig{FilterInstances: []PredicateConfig{{Key: "k", Value: "("}}},
+			"invalid filter_instances predicate 0 value",
+		},
+	} {
+		_, err := NewPipeline(Config{Transforms: []StepConfig{{Include: "."}, tc.step}})
+		assert.ErrorContains(t, err, "transform 1: ")
+		assert.ErrorContains(t, err, tc.want)
+	}
+}
+
+const testConfig = `
+transforms:
+  - exclude: -canary$
+  - clusters: ^svc-
+    rename: "{{.Name}}.prod"
+  - metadata:
+      drop: [hash]
+  - static_instances:
+      cluster: other
+      instances:
+        - host: h5
+          port: 80
+          metadata:
+            - key: static
+              value: "true"
+  - filter_instances:
+      - key: stage
+        value: prod
+`
+
+func TestLoad(t *testing.T) {
+	file, cleanup := tempfile.Write(t, testConfig, "transform")
+	defer cleanup()
+
+	p, err := Load(file)
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, p.Apply(testClusters()), []api.Cluster{
+		{
+			Name:      "svc-a.prod",
+			Instances: api.Instances{{Host: "h1", Port: 80, Metadata: md("app", "a", "stage", "prod")}},
+		},
+		{
+			Name:      "other",
+			Instances: api.Instances{},
+		},
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load("/nonexistent/transform.yaml")
+	assert.ErrorContains(t, err, "no such file or directory")
+
+	file, cleanup := tempfile.Write(t, "transforms: [{include: '('}]", "transform")
+	defer cleanup()
+
+	_, err = Load(file)
+	assert.ErrorContains(t, err, file+": transform 0: invalid include")
+
+	file2, cleanup2 := tempfile.Write(t, "transforms: {", "transform")
+	defer cleanup2()
+
+	_, err = Load(file2)
+	assert.ErrorContains(t, err, file2+": ")
+}
+
+type testClusterProvider struct {
+	clusters []api.Cluster
+	err      error
+}
+
+func (p *testClusterProvider) String() string { return "test" }
+
+func (p *testClusterProvider) GetClusters() ([]api.Cluster, error) {
+	return p.clusters, p.err
+}
+
+func TestWrapClusterProvider(t *testing.T) {
+	p := mustPipeline(t, StepConfig{Include: "^svc-a$"})
+	cp := &testClusterProvider{clusters: testClusters()}
+
+	wrapped := WrapClusterProvider(p, cp)
+	assert.Equal(t, wrapped.String(), "Transforming(test)")
+
+	got, err := wrapped.GetClusters()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, names(got), []string{"svc-a"})
+
+	cp.err = errors.New("boom")
+	got, err = wrapped.GetClusters()
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestWrapUpdater(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	p := mustPipeline(t, StepConfig{Include: "^svc-a$"})
+	u := updater.NewMockUpdater(ctrl)
+	u.EXPECT().Replace(testClusters()[:1])
+	u.EXPECT().ZoneName().Return("z")
+
+	wrapped := WrapUpdater(p, u)
+	wrapped.Replace(testClusters())
+	assert.Equal(t, wrapped.ZoneName(), "z")
+}
+
+func TestWrapUpdaterInstances(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	static := api.Instance{Host: "static", Port: 1}
+	p := mustPipeline(
+		t,
+		StepConfig{Rename: "renamed-{{.Name}}"},
+		StepConfig{
+			StaticInstances: &StaticInstancesConfig{
+				Cluster:   "renamed-svc-a",
+				Instances: api.Instances{static},
+			},
+		},
+		StepConfig{Include: "^renamed-svc-a$"},
+	)
+
+	i := api.Instance{Host: "h", Port: 2}
+	keys := func(is []api.Instance) []string {
+		result := []string{}
+		for _, i := range is {
+			result = append(result, i.Key())
+		}
+		return result
+	}
+
+	u := updater.NewMockUpdater(ctrl)
+	u.EXPECT().AddInstances("renamed-svc-a", gomock.Any()).Do(
+		func(_ string, is []api.Instance) {
+			assert.ArrayEqual(t, keys(is), []string{"h:2", "static:1"})
+		},
+	)
+	u.EXPECT().RemoveInstances("renamed-svc-a", gomock.Any()).Do(
+		func(_ string, is []api.Instance) {
+			assert.ArrayEqual(t, keys(is), []string{"h:2"})
+		},
+	)
+
+	wrapped := WrapUpdater(p, u)
+	wrapped.AddInstances("svc-a", api.Instances{i})
+	wrapped.RemoveInstances("svc-a", api.Instances{i, static})
+
+	// excluded clusters are dropped, though static instances are still
+	// injected into their clusters
+	u.EXPECT().AddInstances("renamed-svc-a", gomock.Any()).Do(
+		func(_ string, is []api.Instance) {
+			assert.ArrayEqual(t, keys(is), []string{"static:1"})
+		},
+	)
+	wrapped.AddInstances("svc-b", api.Instances{i})
+	wrapped.RemoveInstances("svc-b", api.Instances{i})
+}
+
+func TestWrapUpdaterRemoveInstancesIgnoresInstanceSteps(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	p := mustPipeline(
+		t,
+		StepConfig{Rename: "renamed-{{.Name}}"},
+		StepConfig{Metadata: &MetadataConfig{Rename: map[string]string{"stage": "env"}}},
+		StepConfig{FilterInstances: []PredicateConfig{{Key: "env", Value: "^prod$"}}},
+	)
+
+	// the removed instance no longer carries the metadata it was added with
+	i := api.Instance{Host: "h", Port: 2}
+
+	u := updater.NewMockUpdater(ctrl)
+	u.EXPECT().RemoveInstances("renamed-svc-a", []api.Instance{i})
+
+	WrapUpdater(p, u).RemoveInstances("svc-a", api.Instances{i})
+}
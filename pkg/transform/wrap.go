@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/rotor/updater"
+)
+
+// WrapClusterProvider returns a ClusterProvider that applies the Pipeline to
+// the clusters returned by the given ClusterProvider.
+func WrapClusterProvider(
+	p Pipeline,
+	cp cluster_provider.ClusterProvider,
+) cluster_provider.ClusterProvider {
+	return &transformingClusterProvider{pipeline: p, underlying: cp}
+}
+
+type transformingClusterProvider struct {
+	pipeline   Pipeline
+	underlying cluster_provider.ClusterProvider
+}
+
+var _ cluster_provider.ClusterProvider = &transformingClusterProvider{}
+
+func (t *transformingClusterProvider) String() string {
+	return fmt.Sprintf("Transforming(%s)", t.underlying.String())
+}
+
+func (t *transformingClusterProvider) GetClusters() ([]api.Cluster, error) {
+	return WrapGet(t.pipeline, t.underlying.GetClusters)()
+}
+
+// WrapGet returns a function, suitable for use with updater.Loop, that
+// applies the Pipeline to the clusters returned by the given function.
+func WrapGet(
+	p Pipeline,
+	get func() ([]api.Cluster, error),
+) func() ([]api.Cluster, error) {
+	return func() ([]api.Cluster, error) {
+		clusters, err := get()
+		if err != nil {
+			return nil, err
+		}
+		return p.Apply(clusters), nil
+	}
+}
+
+// WrapUpdater returns an Updater that applies the Pipeline to clusters
+// passed to Replace before passing them on to the given Updater. Instances
+// passed to AddInstances are transformed as if they were the only instances
+// of the named cluster. Instances passed to RemoveInstances are left as is:
+// only the Pipeline's include, exclude and rename steps apply, to the named
+// cluster.
+func WrapUpdater(p Pipeline, u updater.Updater) updater.Updater {
+	return &transformingUpdater{Updater: u, pipeline: p, naming: namingSteps(p)}
+}
+
+type transformingUpdater struct {
+	updater.Updater
+	pipeline Pipeline
+	naming   Pipeline
+}
+
+// namingSteps returns the steps of the Pipeline that select and rename
+// clusters without regard to their instances' metadata. Pipelines not
+// produced by NewPipeline are returned unchanged.
+func namingSteps(p Pipeline) Pipeline {
+	steps, ok := p.(pipeline)
+	if !ok {
+		return p
+	}
+
+	result := pipeline{}
+	for _, s := range steps {
+		switch s.(type) {
+		case *selectStep, *renameStep:
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (t *transformingUpdater) Replace(clusters []api.Cluster) {
+	t.Updater.Replace(t.pipeline.Apply(clusters))
+}
+
+func (t *transformingUpdater) AddInstances(cluster string, instances []api.Instance) {
+	for _, c := range t.pipeline.Apply([]api.Cluster{{Name: cluster, Instances: instances}}) {
+		if len(c.Instances) > 0 {
+			t.Updater.AddInstances(c.Name, c.Instances)
+		}
+	}
+}
+
+// RemoveInstances never removes instances injected by the Pipeline. The
+// removed instances are not filtered or transformed, since their metadata
+// need not match what was added.
+func (t *transformingUpdater) RemoveInstances(cluster string, instances []api.Instance) {
+	injected := map[string]map[string]bool{}
+	for _, c := range t.pipeline.Apply([]api.Cluster{{Name: cluster}}) {
+		injected[c.Name] = map[string]bool{}
+		for _, i := range c.Instances {
+			injected[c.Name][i.Key()] = true
+		}
+	}
+
+	for _, c := range t.naming.Apply([]api.Cluster{{Name: cluster, Instances: instances}}) {
+		removed := make([]api.Instance, 0, len(c.Instances))
+		for _, i := range c.Instances {
+			if !injected[c.Name][i.Key()] {
+				removed = append(removed, i)
+			}
+		}
+
+		if len(removed) > 0 {
+			t.Updater.RemoveInstances(c.Name, removed)
+		}
+	}
+}
@@ -231,41 +231,12 @@ func (cr *consulRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.Error(err)
 	}
 
-	client, err := cr.endpoint.getClient()
+	provider, err := newConsulClusterProvider(cr.consulSettings, cr.tagDelimiter)
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	dcs, err := getConsulDatacenters(client.Catalog())
-	if err != nil {
-		return cmd.Error(err)
-	}
-
-	if indexof.String(dcs, cr.consulDC) == -1 {
-		return cmd.Errorf("Datacenter %s was not found", cr.consulDC)
-	}
-
-	var parseTag tagParser
-	if cr.tagDelimiter == "" {
-		parseTag = passThroughTagParser
-	} else {
-		parseTag = delimiterTagParser(cr.tagDelimiter)
-	}
-
-	updater.Loop(
-		u,
-		func() ([]api.Cluster, error) {
-			return consulGetClusters(
-				client,
-				cr.tbnServiceTag,
-				cr.consulDC,
-				getConsulServices,
-				getConsulServiceDetail,
-				getConsulNodeHealth,
-				getMkClusterFn(parseTag),
-			)
-		},
-	)
+	updater.Loop(u, provider.GetClusters)
 
 	return command.NoError()
 }
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consul
+
+import (
+	"fmt"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/arrays/indexof"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+)
+
+// ConsulClustersProviderConfig is the JSON configuration of a Consul
+// ClusterProvider. Unset fields take the defaults of the equivalent
+// "rotor consul" flags.
+type ConsulClustersProviderConfig struct {
+	DC           string `json:"dc"`
+	ClusterTag   string `json:"cluster_tag"`
+	TagDelimiter string `json:"tag_delimiter"`
+	HostPort     string `json:"hostport"`
+	UseSSL       bool   `json:"use_ssl"`
+}
+
+type consulClusterProvider struct {
+	client     consulClient
+	svcTag     string
+	dc         string
+	mkClusters mkClusterFn
+}
+
+var _ cluster_provider.ClusterProvider = &consulClusterProvider{}
+
+// settings returns the consulSettings and tag delimiter equivalent to the
+// config.
+func (c ConsulClustersProviderConfig) settings() (consulSettings, string) {
+	if c.HostPort == "" {
+		c.HostPort = defaultConsulHost
+	}
+	if c.ClusterTag == "" {
+		c.ClusterTag = defaultClusterTag
+	}
+
+	return consulSettings{
+		tbnServiceTag: c.ClusterTag,
+		consulDC:      c.DC,
+		endpoint:      &consulEndpointConfig{useSSL: c.UseSSL, host: c.HostPort},
+	}, c.TagDelimiter
+}
+
+// NewConsulClusterProvider produces a ClusterProvider that collects
+// services from the configured Consul datacenter.
+func NewConsulClusterProvider(
+	config ConsulClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	settings, tagDelimiter := config.settings()
+	return newConsulClusterProvider(settings, tagDelimiter)
+}
+
+func newConsulClusterProvider(
+	settings consulSettings,
+	tagDelimiter string,
+) (*consulClusterProvider, error) {
+	if settings.consulDC == "" {
+		return nil, fmt.Errorf("Target datacenter must be specified.")
+	}
+
+	client, err := settings.endpoint.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	dcs, err := getConsulDatacenters(client.Catalog())
+	if err != nil {
+		return nil, err
+	}
+
+	if indexof.String(dcs, settings.consulDC) == -1 {
+		return nil, fmt.Errorf("Datacenter %s was not found", settings.consulDC)
+	}
+
+	var parseTag tagParser
+	if tagDelimiter == "" {
+		parseTag = passThroughTagParser
+	} else {
+		parseTag = delimiterTagParser(tagDelimiter)
+	}
+
+	return &consulClusterProvider{
+		client:     client,
+		svcTag:     settings.tbnServiceTag,
+		dc:         settings.consulDC,
+		mkClusters: getMkClusterFn(parseTag),
+	}, nil
+}
+
+func (p *consulClusterProvider) String() string {
+	return fmt.Sprintf("ConsulClustersProvider{dc=%s, cluster_tag=%s}", p.dc, p.svcTag)
+}
+
+func (p *consulClusterProvider) GetClusters() ([]api.Cluster, error) {
+	return consulGetClusters(
+		p.client,
+		p.svcTag,
+		p.dc,
+		getConsulServices,
+		getConsulServiceDetail,
+		getConsulNodeHealth,
+		p.mkClusters,
+	)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consul
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestConsulClustersProviderConfigDefaultsMatchFlags(t *testing.T) {
+	cmd := Cmd(nil)
+	cmd.Flags.Parse([]string{"-dc=dc1"})
+	runner := cmd.Runner.(*consulRunner)
+
+	settings, tagDelimiter := ConsulClustersProviderConfig{DC: "dc1"}.settings()
+	assert.DeepEqual(t, settings, runner.consulSettings)
+	assert.Equal(t, tagDelimiter, runner.tagDelimiter)
+}
+
+func TestConsulClustersProviderConfigMatchesFlags(t *testing.T) {
+	cmd := Cmd(nil)
+	cmd.Flags.Parse([]string{
+		"-dc=dc1",
+		"-cluster-tag=svc",
+		"-tag-delimiter=:",
+		"-hostport=consul:8501",
+		"-use-ssl",
+	})
+	runner := cmd.Runner.(*consulRunner)
+
+	var config ConsulClustersProviderConfig
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"dc": "dc1",
+		"cluster_tag": "svc",
+		"tag_delimiter": ":",
+		"hostport": "consul:8501",
+		"use_ssl": true
+	}`), &config))
+
+	settings, tagDelimiter := config.settings()
+	assert.DeepEqual(t, settings, runner.consulSettings)
+	assert.Equal(t, tagDelimiter, runner.tagDelimiter)
+}
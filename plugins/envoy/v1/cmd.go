@@ -34,6 +34,14 @@ startup and whenever the file changes.
 
 Uses the provided file to discover the configuration for the SDS cluster that
 will be used to resolve any cluster that is defined as 'sds'.
+
+If {{ul "resolve-dns"}} is true, the hosts of clusters defined as 'strict_dns'
+are resolved to every address returned by DNS, and the hosts of clusters
+defined as 'logical_dns' are resolved to the first address returned. In this
+mode the file is re-read and its hosts re-resolved at the minimum update
+interval rather than when the file changes. If a host of a cluster cannot be
+resolved, the error is logged and that cluster keeps the instances last
+resolved for it, while other clusters are updated.
 `
 
 	envoyV1RestDescription = `Connects to a running Envoy CDS server and
@@ -115,10 +123,21 @@ func FileCmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 		Description: envoyV1FileDescription,
 	}
 
-	cmd.Runner = &fileRunner{
-		codecFlags:   codec.NewFromFlags(tbnflag.Wrap(&cmd.Flags)),
+	flags := tbnflag.Wrap(&cmd.Flags)
+
+	runner := &fileRunner{
+		codecFlags:   codec.NewFromFlags(flags),
 		updaterFlags: updaterFlags,
 	}
 
+	flags.BoolVar(
+		&runner.resolveDNS,
+		"resolve-dns",
+		false,
+		"If true, resolve the hosts of strict_dns and logical_dns clusters via DNS.",
+	)
+
+	cmd.Runner = runner
+
 	return cmd
 }
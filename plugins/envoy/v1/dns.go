@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/turbinelabs/api"
+)
+
+const (
+	strictDNSType  = "strict_dns"
+	logicalDNSType = "logical_dns"
+)
+
+// dnsResolver resolves the hosts of a strict_dns or logical_dns cluster into
+// instances. Errors are collected per host and returned along with any
+// instances that were resolved.
+type dnsResolver = func(cluster) (api.Instances, []error)
+
+// newDNSResolver returns a dnsResolver that uses lookup to resolve host names.
+// Every address returned for a strict_dns host becomes an instance, while only
+// the first address returned for a logical_dns host is used. Hosts that are
+// already IP addresses are not looked up.
+func newDNSResolver(lookup func(string) ([]string, error)) dnsResolver {
+	return func(c cluster) (api.Instances, []error) {
+		errs := []error{}
+		instances := api.Instances{}
+		seen := map[string]bool{}
+
+		for _, h := range c.Hosts {
+			i, err := mkInstance(h.URL)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			addrs := []string{i.Host}
+			if net.ParseIP(i.Host) == nil {
+				addrs, err = lookup(i.Host)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("DNS lookup of %s failed: %s", i.Host, err))
+					continue
+				}
+
+				if len(addrs) == 0 {
+					errs = append(errs, fmt.Errorf("DNS lookup of %s returned no addresses", i.Host))
+					continue
+				}
+
+				if c.Type == logicalDNSType {
+					addrs = addrs[:1]
+				} else {
+					sort.Strings(addrs)
+				}
+			}
+
+			for _, addr := range addrs {
+				key := net.JoinHostPort(addr, fmt.Sprintf("%d", i.Port))
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				instances = append(instances, api.Instance{Host: addr, Port: i.Port})
+			}
+		}
+
+		return instances, errs
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/codec"
+	"github.com/turbinelabs/test/assert"
+)
+
+const jsonInputDNSClusters = `{
+  "cluster_manager": {
+    "clusters": [
+      {
+        "name": "strict",
+        "type": "strict_dns",
+        "hosts": [
+          {"url": "tcp://a.example.com:80"},
+          {"url": "tcp://b.example.com:80"}
+        ]
+      },
+      {
+        "name": "logical",
+        "type": "logical_dns",
+        "hosts": [{"url": "tcp://a.example.com:443"}]
+      },
+      {
+        "name": "broken",
+        "type": "strict_dns",
+        "hosts": [{"url": "tcp://missing.example.com:80"}]
+      },
+      {
+        "name": "partial",
+        "type": "strict_dns",
+        "hosts": [
+          {"url": "tcp://missing.example.com:80"},
+          {"url": "tcp://10.0.0.9:8080"}
+        ]
+      }
+    ]
+  }
+}`
+
+func testLookup(host string) ([]string, error) {
+	switch host {
+	case "a.example.com":
+		return []string{"10.0.0.2", "10.0.0.1", "::1"}, nil
+	case "b.example.com":
+		return []string{"10.0.0.1", "10.0.0.3"}, nil
+	case "empty.example.com":
+		return nil, nil
+	default:
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestDNSResolverStrictDNS(t *testing.T) {
+	resolve := newDNSResolver(testLookup)
+
+	is, errs := resolve(cluster{
+		Type: strictDNSType,
+		Hosts: []host{
+			{URL: "tcp://a.example.com:80"},
+			{URL: "tcp://b.example.com:80"},
+		},
+	})
+	assert.Equal(t, len(errs), 0)
+	assert.ArrayEqual(t, is, api.Instances{
+		{Host: "10.0.0.1", Port: 80},
+		{Host: "10.0.0.2", Port: 80},
+		{Host: "::1", Port: 80},
+		{Host: "10.0.0.3", Port: 80},
+	})
+}
+
+func TestDNSResolverLogicalDNS(t *testing.T) {
+	resolve := newDNSResolver(testLookup)
+
+	is, errs := resolve(cluster{
+		Type:  logicalDNSType,
+		Hosts: []host{{URL: "tcp://a.example.com:80"}},
+	})
+	assert.Equal(t, len(errs), 0)
+	assert.ArrayEqual(t, is, api.Instances{{Host: "10.0.0.2", Port: 80}})
+}
+
+func TestDNSResolverSkipsIPAddresses(t *testing.T) {
+	resolve := newDNSResolver(func(string) ([]string, error) {
+		return nil, errors.New("unexpected lookup")
+	})
+
+	is, errs := resolve(cluster{
+		Type:  strictDNSType,
+		Hosts: []host{{URL: "tcp://127.0.0.1:80"}},
+	})
+	assert.Equal(t, len(errs), 0)
+	assert.ArrayEqual(t, is, api.Instances{{Host: "127.0.0.1", Port: 80}})
+}
+
+func TestDNSResolverErrors(t *testing.T) {
+	resolve := newDNSResolver(testLookup)
+
+	is, errs := resolve(cluster{
+		Type: strictDNSType,
+		Hosts: []host{
+			{URL: "tcp://missing.example.com:80"},
+			{URL: "tcp://empty.example.com:80"},
+			{URL: "udp://a.example.com:80"},
+			{URL: "tcp://b.example.com:80"},
+		},
+	})
+	assert.Equal(t, len(errs), 3)
+	assert.ErrorContains(t, errs[0], "DNS lookup of missing.example.com failed: no such host")
+	assert.ErrorContains(t, errs[1], "DNS lookup of empty.example.com returned no addresses")
+	assert.ErrorContains(t, errs[2], "UDP not supported")
+	assert.ArrayEqual(t, is, api.Instances{
+		{Host: "10.0.0.1", Port: 80},
+		{Host: "10.0.0.3", Port: 80},
+	})
+}
+
+func TestFileParserResolvesDNSClusters(t *testing.T) {
+	mrf := &MockResolverFactory{}
+	p := newFileParser(codec.NewJson(), mrf.do).withDNSResolver(newDNSResolver(testLookup))
+
+	clusters, errMap, err := p.collect(bytes.NewBufferString(jsonInputDNSClusters))
+	assert.Nil(t, err)
+	assert.Equal(t, len(clusters), 3)
+
+	assert.Equal(t, clusters[0].Name, "strict")
+	assert.ArrayEqual(t, clusters[0].Instances, api.Instances{
+		{Host: "10.0.0.1", Port: 80},
+		{Host: "10.0.0.2", Port: 80},
+		{Host: "::1", Port: 80},
+		{Host: "10.0.0.3", Port: 80},
+	})
+
+	assert.Equal(t, clusters[1].Name, "logical")
+	assert.ArrayEqual(t, clusters[1].Instances, api.Instances{{Host: "10.0.0.2", Port: 443}})
+
+	assert.Equal(t, clusters[2].Name, "partial")
+	assert.ArrayEqual(t, clusters[2].Instances, api.Instances{{Host: "10.0.0.9", Port: 8080}})
+
+	assert.Equal(t, len(errMap), 2)
+	assert.Equal(t, len(errMap["broken"]), 1)
+	assert.ErrorContains(t, errMap["broken"][0], "DNS lookup of missing.example.com failed")
+	assert.Equal(t, len(errMap["partial"]), 1)
+
+	parsed, err := p.parse(bytes.NewBufferString(jsonInputDNSClusters))
+	assert.Nil(t, err)
+	assert.HasSameElements(t, parsed, clusters)
+}
+
+func TestFileParserKeepsLastDNSInstancesOnError(t *testing.T) {
+	const input = `{
+  "cluster_manager": {
+    "clusters": [
+      {
+        "name": "stable",
+        "type": "strict_dns",
+        "hosts": [{"url": "tcp://stable.example.com:80"}]
+      },
+      {
+        "name": "flaky",
+        "type": "strict_dns",
+        "hosts": [
+          {"url": "tcp://flaky.example.com:80"},
+          {"url": "tcp://10.0.1.9:80"}
+        ]
+      }
+    ]
+  }
+}`
+
+	addrs := map[string][]string{
+		"stable.example.com": {"10.0.0.1"},
+		"flaky.example.com":  {"10.0.1.1"},
+	}
+	lookup := func(host string) ([]string, error) {
+		if a, ok := addrs[host]; ok {
+			return a, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	mrf := &MockResolverFactory{}
+	p := newFileParser(codec.NewJson(), mrf.do).withDNSResolver(newDNSResolver(lookup))
+
+	parsed, err := p.parse(bytes.NewBufferString(input))
+	assert.Nil(t, err)
+	assert.Equal(t, len(parsed), 2)
+	assert.ArrayEqual(t, parsed[1].Instances, api.Instances{
+		{Host: "10.0.1.1", Port: 80},
+		{Host: "10.0.1.9", Port: 80},
+	})
+
+	// flaky fails: it keeps its last instances, while stable is updated
+	addrs["stable.example.com"] = []string{"10.0.0.2"}
+	delete(addrs, "flaky.example.com")
+
+	parsed, err = p.parse(bytes.NewBufferString(input))
+	assert.Nil(t, err)
+	assert.Equal(t, len(parsed), 2)
+	assert.Equal(t, parsed[0].Name, "stable")
+	assert.ArrayEqual(t, parsed[0].Instances, api.Instances{{Host: "10.0.0.2", Port: 80}})
+	assert.Equal(t, parsed[1].Name, "flaky")
+	assert.ArrayEqual(t, parsed[1].Instances, api.Instances{
+		{Host: "10.0.1.1", Port: 80},
+		{Host: "10.0.1.9", Port: 80},
+	})
+
+	// still failing: the same instances are kept
+	parsed, err = p.parse(bytes.NewBufferString(input))
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, parsed[1].Instances, api.Instances{
+		{Host: "10.0.1.1", Port: 80},
+		{Host: "10.0.1.9", Port: 80},
+	})
+
+	// recovered
+	addrs["flaky.example.com"] = []string{"10.0.1.2"}
+
+	parsed, err = p.parse(bytes.NewBufferString(input))
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, parsed[1].Instances, api.Instances{
+		{Host: "10.0.1.2", Port: 80},
+		{Host: "10.0.1.9", Port: 80},
+	})
+}
+
+func TestFileParserWithoutDNSResolverUsesHostNames(t *testing.T) {
+	mrf := &MockResolverFactory{}
+	p := newFileParser(codec.NewJson(), mrf.do)
+
+	clusters, errMap, err := p.collect(bytes.NewBufferString(jsonInputDNSClusters))
+	assert.Nil(t, err)
+	assert.Equal(t, len(errMap), 0)
+	assert.Equal(t, len(clusters), 4)
+	assert.ArrayEqual(t, clusters[0].Instances, api.Instances{
+		{Host: "a.example.com", Port: 80},
+		{Host: "b.example.com", Port: 80},
+	})
+}
+
+func TestFileParserCollectsSDSErrors(t *testing.T) {
+	mrf := &MockResolverFactory{
+		resolver: func(string) (api.Instances, []error) {
+			return nil, []error{errors.New("no bueno")}
+		},
+	}
+	p := newFileParser(codec.NewJson(), mrf.do)
+
+	_, errMap, err := p.collect(bytes.NewBufferString(jsonInputSdsClusterNoSdsDefined))
+	assert.Nil(t, err)
+	assert.Equal(t, len(errMap), 1)
+	assert.ErrorContains(t, errMap["sds_cluster"][0], "no bueno")
+}
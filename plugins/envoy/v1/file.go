@@ -17,17 +17,21 @@ limitations under the License.
 package v1
 
 import (
+	"os"
 	"path/filepath"
 
+	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/cli/command"
 	"github.com/turbinelabs/codec"
 	"github.com/turbinelabs/rotor"
 	"github.com/turbinelabs/rotor/plugins/file"
+	"github.com/turbinelabs/rotor/updater"
 )
 
 type fileRunner struct {
 	updaterFlags rotor.UpdaterFromFlags
 	codecFlags   codec.FromFlags
+	resolveDNS   bool
 }
 
 func (fr *fileRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
@@ -43,18 +47,32 @@ func (fr *fileRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.BadInput("takes a single file as an argument")
 	}
 
-	updater, err := fr.updaterFlags.Make()
+	u, err := fr.updaterFlags.Make()
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	parser := newFileParser(fr.codecFlags.Make(), defaultResolverFactory()).parse
-	collector := file.NewCollector(
-		filepath.Clean(args[0]),
-		updater,
-		parser,
-	)
+	filename := filepath.Clean(args[0])
+	p := newFileParser(fr.codecFlags.Make(), defaultResolverFactory())
 
+	if fr.resolveDNS {
+		// DNS records may change without the file changing, so the file is
+		// re-read and its hosts re-resolved on every update interval.
+		p.withDNSResolver(defaultDNSResolver())
+		updater.Loop(u, func() ([]api.Cluster, error) {
+			f, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+
+			return p.parse(f)
+		})
+
+		return command.NoError()
+	}
+
+	collector := file.NewCollector(filename, u, p.parse)
 	if err := collector.Run(); err != nil {
 		return cmd.Error(err)
 	}
@@ -19,7 +19,9 @@ package v1
 import (
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sort"
 
 	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/codec"
@@ -31,6 +33,10 @@ func defaultResolverFactory() resolverFactory {
 	return newResolverFactory(http.DefaultClient.Get, collector.RandomInstanceSelector)
 }
 
+func defaultDNSResolver() dnsResolver {
+	return newDNSResolver(net.LookupHost)
+}
+
 func newFileParser(codec codec.Codec, rf resolverFactory) *parser {
 	p := &parser{
 		mkEnvoyClusters: func(r io.Reader) ([]cluster, collector.ClusterResolver, error) {
@@ -73,18 +79,64 @@ func newCdsParser(cr collector.ClusterResolver) *parser {
 
 type parser struct {
 	mkEnvoyClusters func(io.Reader) ([]cluster, collector.ClusterResolver, error)
+
+	// resolveDNS, if non-nil, is used to resolve the hosts of strict_dns
+	// and logical_dns clusters. Otherwise, their host names are used as-is.
+	resolveDNS dnsResolver
+
+	// dnsInstances holds, by cluster name, the instances last resolved
+	// without error for each DNS cluster.
+	dnsInstances map[string]api.Instances
 }
 
+// withDNSResolver configures the parser to resolve the hosts of strict_dns
+// and logical_dns clusters with the given dnsResolver.
+func (p *parser) withDNSResolver(r dnsResolver) *parser {
+	p.resolveDNS = r
+	return p
+}
+
+// parse converts envoy clusters read from r into api.Clusters. Errors
+// resolving the instances of individual clusters are logged.
 func (p *parser) parse(r io.Reader) ([]api.Cluster, error) {
-	envoyClusters, resolve, err := p.mkEnvoyClusters(r)
+	clusters, errMap, err := p.collect(r)
 	if err != nil {
 		return nil, err
 	}
 
+	names := make([]string, 0, len(errMap))
+	for name := range errMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, e := range errMap[name] {
+			console.Error().Printf("Error resolving instances for cluster %q: %s", name, e)
+		}
+	}
+
+	return clusters, nil
+}
+
+// collect converts envoy clusters read from r into api.Clusters. Errors
+// encountered resolving SDS or DNS instances are returned in a map keyed by
+// cluster name, along with results to allow a best effort resolution of
+// clusters. An sds cluster with errors is omitted. A DNS cluster with errors
+// keeps the instances last resolved for it without error, if any, or else
+// the instances that could be resolved, and is omitted if there are none.
+func (p *parser) collect(r io.Reader) ([]api.Cluster, map[string][]error, error) {
+	envoyClusters, resolve, err := p.mkEnvoyClusters(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	errMap := map[string][]error{}
 	clusters := map[string]api.Cluster{}
+	dnsInstances := map[string]api.Instances{}
 	for _, c := range envoyClusters {
 		if _, exists := clusters[c.Name]; exists {
-			return nil, fmt.Errorf("duplicate cluster: %q", c.Name)
+			return nil, nil, fmt.Errorf("duplicate cluster: %q", c.Name)
 		}
 
 		instances := api.Instances{}
@@ -96,19 +148,28 @@ func (p *parser) parse(r io.Reader) ([]api.Cluster, error) {
 		case c.Type == "sds":
 			sdsInstances, errs := resolve(c.ServiceName)
 			if len(errs) > 0 {
-				for _, e := range errs {
-					console.Error().Printf(
-						"Error getting SDS instances for cluster %q: %s",
-						c.Name,
-						e,
-					)
-				}
-
+				errMap[c.Name] = append(errMap[c.Name], errs...)
 				continue
 			}
 
 			instances = append(instances, sdsInstances...)
 
+		case (c.Type == strictDNSType || c.Type == logicalDNSType) && p.resolveDNS != nil:
+			resolved, errs := p.resolveDNS(c)
+			if len(errs) > 0 {
+				errMap[c.Name] = append(errMap[c.Name], errs...)
+				if last, ok := p.dnsInstances[c.Name]; ok {
+					resolved = last
+					dnsInstances[c.Name] = last
+				} else if len(resolved) == 0 {
+					continue
+				}
+			} else {
+				dnsInstances[c.Name] = resolved
+			}
+
+			instances = append(instances, resolved...)
+
 		default:
 			for _, h := range c.Hosts {
 				i, err := mkInstance(h.URL)
@@ -144,11 +205,15 @@ func (p *parser) parse(r io.Reader) ([]api.Cluster, error) {
 		clusters[cluster.Name] = cluster
 	}
 
+	if p.resolveDNS != nil {
+		p.dnsInstances = dnsInstances
+	}
+
 	result := make(api.Clusters, 0, len(clusters))
 	for _, configCluster := range envoyClusters {
 		if tbnCluster, exists := clusters[configCluster.Name]; exists {
 			result = append(result, tbnCluster)
 		}
 	}
-	return result, nil
+	return result, errMap, nil
 }
@@ -57,19 +57,37 @@ func (r *restRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.Error(err)
 	}
 
-	cdsEndp, cdsErr := tbnhttp.NewEndpoint(tbnhttp.HTTP, r.addr.Addr())
-	if cdsErr != nil {
-		return cmd.BadInput(cdsErr)
+	collector, err := newRestCollector(r.addr, r.sdsAddr, r.clustersNodes.Strings)
+	if err != nil {
+		return cmd.BadInput(err)
 	}
 
-	sdsEndp, sdsErr := tbnhttp.NewEndpoint(tbnhttp.HTTP, r.sdsAddr.Addr())
-	if sdsErr != nil {
-		return cmd.BadInput(sdsErr)
+	updater.Loop(u, collector.getAllClusters)
+
+	return command.NoError()
+}
+
+// newRestCollector produces a restCollector that calls the CDS server at
+// addr for each of the given clusters-nodes, resolving sds clusters via the
+// server at sdsAddr.
+func newRestCollector(
+	addr tbnflag.HostPort,
+	sdsAddr tbnflag.HostPort,
+	clustersNodes []string,
+) (*restCollector, error) {
+	cdsEndp, err := tbnhttp.NewEndpoint(tbnhttp.HTTP, addr.Addr())
+	if err != nil {
+		return nil, err
 	}
 
-	cdsRoutes, rErr := mkCdsRoutes(r.clustersNodes.Strings)
-	if rErr != nil {
-		return cmd.BadInput(rErr)
+	sdsEndp, err := tbnhttp.NewEndpoint(tbnhttp.HTTP, sdsAddr.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	cdsRoutes, err := mkCdsRoutes(clustersNodes)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(cdsRoutes) == 0 {
@@ -77,22 +95,19 @@ func (r *restRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		cdsRoutes = append(cdsRoutes, cdsPathRoot)
 	}
 
-	host, port := r.sdsAddr.ParsedHostPort()
+	host, port := sdsAddr.ParsedHostPort()
 	parser := newCdsParser(v1.NewClusterResolver(host, port, sdsEndp.Client().Get)).parse
+
 	clientFn := func(path string) (*http.Response, error) {
 		fullURL := cdsEndp.URL(path, nil)
 		return cdsEndp.Client().Get(fullURL)
 	}
 
-	collector := &restCollector{
+	return &restCollector{
 		cdsRoutes: cdsRoutes,
 		clientFn:  clientFn,
 		parserFn:  parser,
-	}
-
-	updater.Loop(u, collector.getAllClusters)
-
-	return command.NoError()
+	}, nil
 }
 
 func mkCdsRoutes(pairs []string) ([]string, error) {
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/turbinelabs/api"
+	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+)
+
+// EnvoyCDSV1ClustersProviderConfig is the JSON configuration of an Envoy
+// v1 CDS ClusterProvider. The fields correspond to the flags of
+// "rotor exp-envoy-cds-v1". Both Addr and SDSAddr are required.
+type EnvoyCDSV1ClustersProviderConfig struct {
+	Addr          string   `json:"addr"`
+	SDSAddr       string   `json:"sds_addr"`
+	ClustersNodes []string `json:"clusters_nodes"`
+}
+
+// hostPorts validates and returns the config's CDS and SDS addresses.
+func (c EnvoyCDSV1ClustersProviderConfig) hostPorts() (tbnflag.HostPort, tbnflag.HostPort, error) {
+	if c.Addr == "" {
+		return tbnflag.HostPort{}, tbnflag.HostPort{}, errors.New("addr must be specified")
+	}
+
+	if c.SDSAddr == "" {
+		return tbnflag.HostPort{}, tbnflag.HostPort{}, errors.New("sds_addr must be specified")
+	}
+
+	addr := tbnflag.HostPort{}
+	if err := addr.Set(c.Addr); err != nil {
+		return tbnflag.HostPort{}, tbnflag.HostPort{}, fmt.Errorf("invalid addr %q: %s", c.Addr, err)
+	}
+
+	sdsAddr := tbnflag.HostPort{}
+	if err := sdsAddr.Set(c.SDSAddr); err != nil {
+		return tbnflag.HostPort{}, tbnflag.HostPort{}, fmt.Errorf("invalid sds_addr %q: %s", c.SDSAddr, err)
+	}
+
+	return addr, sdsAddr, nil
+}
+
+// NewEnvoyCDSV1ClusterProvider produces a ClusterProvider that polls an
+// Envoy v1 CDS server.
+func NewEnvoyCDSV1ClusterProvider(
+	config EnvoyCDSV1ClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	addr, sdsAddr, err := config.hostPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	collector, err := newRestCollector(addr, sdsAddr, config.ClustersNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restClusterProvider{collector: collector, addr: addr.Addr()}, nil
+}
+
+type restClusterProvider struct {
+	collector *restCollector
+	addr      string
+}
+
+var _ cluster_provider.ClusterProvider = &restClusterProvider{}
+
+func (p *restClusterProvider) String() string {
+	return fmt.Sprintf("EnvoyCDSV1ClustersProvider{addr=%s, routes=%v}", p.addr, p.collector.cdsRoutes)
+}
+
+func (p *restClusterProvider) GetClusters() ([]api.Cluster, error) {
+	return p.collector.getAllClusters()
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestEnvoyCDSV1ClustersProviderConfigMatchesFlags(t *testing.T) {
+	cmd := RESTCmd(nil)
+	assert.Nil(t, cmd.Flags.Parse([]string{
+		"-addr=cds.example.com:8080",
+		"-sds-addr=sds.example.com:8081",
+		"-clusters-nodes=a:n1,b",
+	}))
+	runner := cmd.Runner.(*restRunner)
+
+	var config EnvoyCDSV1ClustersProviderConfig
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"addr": "cds.example.com:8080",
+		"sds_addr": "sds.example.com:8081",
+		"clusters_nodes": ["a:n1", "b"]
+	}`), &config))
+
+	addr, sdsAddr, err := config.hostPorts()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, addr, runner.addr)
+	assert.DeepEqual(t, sdsAddr, runner.sdsAddr)
+	assert.ArrayEqual(t, config.ClustersNodes, runner.clustersNodes.Strings)
+}
+
+func TestEnvoyCDSV1ClustersProviderConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		config EnvoyCDSV1ClustersProviderConfig
+		want   string
+	}{
+		{EnvoyCDSV1ClustersProviderConfig{SDSAddr: "sds:80"}, "addr must be specified"},
+		{EnvoyCDSV1ClustersProviderConfig{Addr: "cds:80"}, "sds_addr must be specified"},
+		{EnvoyCDSV1ClustersProviderConfig{Addr: "cds", SDSAddr: "sds:80"}, `invalid addr "cds"`},
+		{EnvoyCDSV1ClustersProviderConfig{Addr: "cds:80", SDSAddr: "sds"}, `invalid sds_addr "sds"`},
+	} {
+		_, err := NewEnvoyCDSV1ClusterProvider(tc.config)
+		assert.ErrorContains(t, err, tc.want)
+	}
+}
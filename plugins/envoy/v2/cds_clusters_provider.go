@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/rotor/xds/adapter"
+	"github.com/turbinelabs/rotor/xds/collector"
+)
+
+// EnvoyCDSV2ClustersProviderConfig is the JSON configuration of an Envoy
+// v2 CDS ClusterProvider. Format is either "grpc" (the default) or
+// "json". ZoneName is the zone reported to the CDS server.
+type EnvoyCDSV2ClustersProviderConfig struct {
+	Addr     string `json:"addr"`
+	Format   string `json:"format"`
+	ZoneName string `json:"zone_name"`
+}
+
+// isJSON validates the config and reports whether it selects the JSON
+// format.
+func (c EnvoyCDSV2ClustersProviderConfig) isJSON() (bool, error) {
+	if c.Addr == "" {
+		return false, errors.New("addr must be specified")
+	}
+
+	switch c.Format {
+	case "", "grpc":
+		return false, nil
+	case "json":
+		return true, nil
+	default:
+		return false, fmt.Errorf("format must be grpc or json, was %q", c.Format)
+	}
+}
+
+// NewEnvoyCDSV2ClusterProvider produces a ClusterProvider that polls an
+// Envoy v2 CDS server. The ClusterProvider implements io.Closer, closing
+// its connection to the server.
+func NewEnvoyCDSV2ClusterProvider(
+	config EnvoyCDSV2ClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	isJSON, err := config.isJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := adapter.NewClusterCollector(config.Addr, config.ZoneName, isJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cdsClusterProvider{collector: c, addr: config.Addr}, nil
+}
+
+type cdsClusterProvider struct {
+	collector collector.ClusterCollector
+	addr      string
+}
+
+var (
+	_ cluster_provider.ClusterProvider = &cdsClusterProvider{}
+	_ io.Closer                        = &cdsClusterProvider{}
+)
+
+func (p *cdsClusterProvider) String() string {
+	return fmt.Sprintf("EnvoyCDSV2ClustersProvider{addr=%s}", p.addr)
+}
+
+func (p *cdsClusterProvider) GetClusters() ([]api.Cluster, error) {
+	tbnClusters, errMap := p.collector.Collect()
+	if len(errMap) > 0 {
+		return nil, mkError(errMap)
+	}
+
+	if len(tbnClusters) == 0 {
+		return nil, errors.New("no clusters found, skipping update")
+	}
+
+	return tbnClusters, nil
+}
+
+func (p *cdsClusterProvider) Close() error {
+	return p.collector.Close()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/rotor/xds/collector"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestEnvoyCDSV2ClustersProviderConfigMatchesFlags(t *testing.T) {
+	for _, format := range []string{"grpc", "json"} {
+		cmd := Cmd(nil)
+		assert.Nil(t, cmd.Flags.Parse([]string{"-addr=cds.example.com:8080", "-format=" + format}))
+		r := cmd.Runner.(*runner)
+
+		var config EnvoyCDSV2ClustersProviderConfig
+		assert.Nil(t, json.Unmarshal(
+			[]byte(`{"addr": "cds.example.com:8080", "format": "`+format+`"}`),
+			&config,
+		))
+
+		isJSON, err := config.isJSON()
+		assert.Nil(t, err)
+		assert.Equal(t, config.Addr, r.addr.Addr())
+		assert.Equal(t, isJSON, r.format.String() == "json")
+	}
+}
+
+func TestEnvoyCDSV2ClustersProviderConfigDefaultsMatchFlags(t *testing.T) {
+	cmd := Cmd(nil)
+	assert.Nil(t, cmd.Flags.Parse([]string{"-addr=cds.example.com:8080"}))
+	r := cmd.Runner.(*runner)
+
+	isJSON, err := EnvoyCDSV2ClustersProviderConfig{Addr: "cds.example.com:8080"}.isJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, isJSON, r.format.String() == "json")
+}
+
+func TestEnvoyCDSV2ClustersProviderConfigErrors(t *testing.T) {
+	_, err := NewEnvoyCDSV2ClusterProvider(EnvoyCDSV2ClustersProviderConfig{})
+	assert.ErrorContains(t, err, "addr must be specified")
+
+	_, err = NewEnvoyCDSV2ClusterProvider(
+		EnvoyCDSV2ClustersProviderConfig{Addr: "cds:80", Format: "xml"},
+	)
+	assert.ErrorContains(t, err, `format must be grpc or json, was "xml"`)
+}
+
+func TestCDSClusterProviderClose(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockCollector := collector.NewMockClusterCollector(ctrl)
+	err := errors.New("boom")
+	mockCollector.EXPECT().Close().Return(err)
+
+	p := &cdsClusterProvider{collector: mockCollector, addr: "cds:80"}
+	assert.Equal(t, p.Close(), err)
+}
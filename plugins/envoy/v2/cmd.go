@@ -24,6 +24,7 @@ import (
 	"github.com/turbinelabs/cli/command"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
 	"github.com/turbinelabs/nonstdlib/flag/usage"
+	"github.com/turbinelabs/nonstdlib/log/console"
 	"github.com/turbinelabs/rotor"
 	"github.com/turbinelabs/rotor/updater"
 	"github.com/turbinelabs/rotor/xds/adapter"
@@ -36,6 +37,14 @@ and periodically thereafter.
 Depending on parameters, uses JSON or GRPC to load clusters and will use
 results to resolve corresponding instances statically or via configured v2 EDS or
  v1 SDS servers that are provided in CDS results.
+
+With --stream, a long-lived gRPC stream is opened to the CDS server instead
+of polling. Clusters are updated as soon as the server pushes changes, and
+endpoints for EDS clusters are streamed from the same server. With --ads,
+clusters and endpoints are received over a single Aggregated Discovery Service
+stream. Failed streams are re-established with exponential backoff. Streamed
+changes are applied once no further changes arrive for --quiet-period, but
+never later than --max-latency after the first unapplied change.
 `
 
 // Cmd configures the parameters needed for running rotor against a V2
@@ -64,6 +73,34 @@ func Cmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 
 	flags.Var(&r.format, "format", "Format of CDS being called.")
 
+	flags.BoolVar(
+		&r.stream,
+		"stream",
+		false,
+		"If true, stream clusters and endpoints from the CDS server via gRPC instead of polling.",
+	)
+
+	flags.BoolVar(
+		&r.ads,
+		"ads",
+		false,
+		"If true, stream clusters and endpoints over a single Aggregated Discovery Service stream. Implies --stream.",
+	)
+
+	flags.DurationVar(
+		&r.watchOpts.QuietPeriod,
+		"quiet-period",
+		updater.DefaultQuietPeriod,
+		"With --stream or --ads, the time to wait for further changes before applying streamed clusters.",
+	)
+
+	flags.DurationVar(
+		&r.watchOpts.MaxLatency,
+		"max-latency",
+		updater.DefaultMaxLatency,
+		"With --stream or --ads, the longest time streamed clusters may wait for a quiet period before being applied. If zero, there is no limit.",
+	)
+
 	cmd.Runner = r
 
 	return cmd
@@ -73,6 +110,9 @@ type runner struct {
 	updaterFlags rotor.UpdaterFromFlags
 	addr         tbnflag.HostPort
 	format       tbnflag.Choice
+	stream       bool
+	ads          bool
+	watchOpts    updater.WatchOpts
 }
 
 func (r *runner) Run(cmd *command.Cmd, args []string) command.CmdErr {
@@ -80,33 +120,73 @@ func (r *runner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.BadInput(err)
 	}
 
+	streaming := r.stream || r.ads
+	isJSON := r.format.String() == "json"
+	if streaming && isJSON {
+		return cmd.BadInput("--stream and --ads require --format=grpc")
+	}
+
 	u, err := r.updaterFlags.Make()
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	isJSON := r.format.String() == "json"
+	if streaming {
+		return r.runStreaming(cmd, u)
+	}
+
 	collector, err := adapter.NewClusterCollector(r.addr.Addr(), u.ZoneName(), isJSON)
 	if err != nil {
 		return cmd.Error(err)
 	}
-	defer collector.Close()
 
-	updater.Loop(
-		u,
-		func() ([]api.Cluster, error) {
-			tbnClusters, errMap := collector.Collect()
+	provider := &cdsClusterProvider{collector: collector, addr: r.addr.Addr()}
+	defer provider.Close()
+
+	updater.Loop(u, provider.GetClusters)
+
+	return command.NoError()
+}
+
+func (r *runner) runStreaming(cmd *command.Cmd, u updater.Updater) command.CmdErr {
+	collector, err := adapter.NewStreamingClusterCollector(r.addr.Addr(), u.ZoneName(), r.ads)
+	if err != nil {
+		u.Close()
+		return cmd.Error(err)
+	}
+
+	snapshots := make(chan []api.Cluster)
+	done := make(chan struct{})
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(snapshots)
+		errCh <- collector.Run(func(clusters api.Clusters, errMap map[string][]error) {
 			if len(errMap) > 0 {
-				return nil, mkError(errMap)
+				console.Error().Printf("update error: %s", mkError(errMap))
+				return
 			}
 
-			if len(tbnClusters) == 0 {
-				return nil, errors.New("no clusters found, skipping update")
+			if len(clusters) == 0 {
+				console.Error().Println("update error: no clusters found, skipping update")
+				return
 			}
 
-			return tbnClusters, nil
-		},
-	)
+			select {
+			case snapshots <- clusters:
+			case <-done:
+			}
+		})
+	}()
+
+	updater.Watch(u, snapshots, r.watchOpts)
+
+	close(done)
+	collector.Close()
+
+	if err := <-errCh; err != nil {
+		return cmd.Error(err)
+	}
 
 	return command.NoError()
 }
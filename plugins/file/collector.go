@@ -20,8 +20,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
 	"path/filepath"
+	"sort"
 
 	fsnotify "github.com/fsnotify/fsnotify"
 
@@ -41,59 +41,215 @@ type Collector interface {
 // NewCollector is a factory for a file based collector.
 func NewCollector(
 	file string,
-	updater updater.Updater,
+	u updater.Updater,
 	parser clusterParser,
 ) Collector {
 	return &fileCollector{
-		file:    file,
-		updater: updater,
-		parser:  parser,
-		os:      tbnos.New(),
+		file:      file,
+		updater:   u,
+		parser:    parser,
+		os:        tbnos.New(),
+		watchOpts: updater.DefaultWatchOpts(),
 	}
 }
 
+// NewDirCollector is a factory for a file based collector that merges the
+// clusters from every file in dir whose name matches glob.
+func NewDirCollector(
+	dir string,
+	glob string,
+	u updater.Updater,
+	parser clusterParser,
+) Collector {
+	if glob == "" {
+		glob = defaultGlob
+	}
+
+	return &fileCollector{
+		file:      dir,
+		glob:      glob,
+		updater:   u,
+		parser:    parser,
+		os:        tbnos.New(),
+		watchOpts: updater.DefaultWatchOpts(),
+		fragments: map[string][]api.Cluster{},
+	}
+}
+
+// newCollector returns a Collector for file, which may name either a file
+// or a directory of fragments matching glob.
+func newCollector(
+	file string,
+	glob string,
+	u updater.Updater,
+	parser clusterParser,
+) *fileCollector {
+	if fi, err := os.Stat(file); err == nil && fi.IsDir() {
+		return NewDirCollector(file, glob, u, parser).(*fileCollector)
+	}
+	return NewCollector(file, u, parser).(*fileCollector)
+}
+
 type fileCollector struct {
 	file    string
 	updater updater.Updater
 	parser  clusterParser
 	os      tbnos.OS
+
+	// watchOpts control how quickly successive changes are applied.
+	watchOpts updater.WatchOpts
+
+	// glob is non-empty if file is a directory of fragments.
+	glob string
+
+	// fragments holds the clusters last successfully parsed from each
+	// fragment file, allowing a malformed fragment to fall back to its
+	// previous contents.
+	fragments map[string][]api.Cluster
 }
 
-func (c *fileCollector) Run() error {
-	defer c.updater.Close()
+func (c *fileCollector) isDir() bool {
+	return c.glob != ""
+}
+
+// matches returns true if the named file is the watched file or, in
+// directory mode, a fragment within the watched directory.
+func (c *fileCollector) matches(name string) bool {
+	if !c.isDir() {
+		return name == c.file
+	}
+
+	if filepath.Dir(name) != c.file {
+		return false
+	}
 
+	matched, err := filepath.Match(c.glob, filepath.Base(name))
+	return err == nil && matched
+}
+
+// Run parses the watched file or directory and passes the resulting
+// clusters, and those parsed after each subsequent change, to the Updater via
+// updater.Watch. It returns once Watch returns, or with an error if the
+// initial parse fails or the file cannot be watched.
+func (c *fileCollector) Run() error {
 	events, errors, closer, err := c.startWatcher()
 	if err != nil {
+		c.updater.Close()
 		return err
 	}
 	defer closer.Close()
 
-	if err := c.reload(); err != nil {
+	clusters, err := c.GetClusters()
+	if err != nil {
+		c.updater.Close()
 		return err
 	}
 
-	signals := updater.SignalNotifier()
-	defer signal.Stop(signals)
+	snapshots := make(chan []api.Cluster, 1)
+	snapshots <- clusters
 
-	return c.eventLoop(events, errors, signals)
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		defer close(snapshots)
+		result <- c.eventLoop(events, errors, snapshots, done)
+	}()
+
+	updater.Watch(c.updater, snapshots, c.watchOpts)
+	close(done)
+
+	return <-result
 }
 
-func (c *fileCollector) reload() error {
+// reload parses the watched file or directory and sends the resulting
+// clusters on snapshots. Parse errors are logged and nothing is sent. It
+// returns false if done is closed before the clusters could be sent.
+func (c *fileCollector) reload(
+	snapshots chan<- []api.Cluster,
+	done <-chan struct{},
+) bool {
 	console.Debug().Println("file: reload")
 
-	file, err := c.os.Open(c.file)
+	clusters, err := c.GetClusters()
 	if err != nil {
-		return err
+		console.Error().Printf("file: reload error: %s", err)
+		return true
+	}
+
+	select {
+	case snapshots <- clusters:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (c *fileCollector) parseFile(name string) ([]api.Cluster, error) {
+	file, err := c.os.Open(name)
+	if err != nil {
+		return nil, err
 	}
 	defer file.Close()
 
-	clusters, err := c.parser(file)
+	return c.parser(file)
+}
+
+// parseDir parses each fragment in the watched directory and merges the
+// results. Fragments are processed in lexical order. A fragment that cannot
+// be parsed is reported and its previously parsed clusters, if any, are used
+// in its place. A cluster defined by more than one fragment is reported and
+// the first definition is used.
+func (c *fileCollector) parseDir() ([]api.Cluster, error) {
+	names, err := filepath.Glob(filepath.Join(c.file, c.glob))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if c.fragments == nil {
+		c.fragments = map[string][]api.Cluster{}
+	}
+
+	fragments := make(map[string][]api.Cluster, len(names))
+	for _, name := range names {
+		if fi, err := c.os.Stat(name); err != nil || fi.IsDir() {
+			continue
+		}
+
+		fragment, err := c.parseFile(name)
+		if err != nil {
+			console.Error().Printf("file: skipping fragment %s: %s", name, err)
+			if previous, ok := c.fragments[name]; ok {
+				console.Error().Printf("file: using last known clusters for %s", name)
+				fragments[name] = previous
+			}
+			continue
+		}
+
+		fragments[name] = fragment
+	}
+	c.fragments = fragments
+
+	definedIn := map[string]string{}
+	clusters := []api.Cluster{}
+	for _, name := range names {
+		for _, cluster := range fragments[name] {
+			if first, exists := definedIn[cluster.Name]; exists {
+				console.Error().Printf(
+					"file: duplicate cluster %s in %s, using definition from %s",
+					cluster.Name,
+					name,
+					first,
+				)
+				continue
+			}
+
+			definedIn[cluster.Name] = name
+			clusters = append(clusters, cluster)
+		}
 	}
 
-	c.updater.Replace(clusters)
-	return nil
+	return clusters, nil
 }
 
 func (c *fileCollector) startWatcher() (chan fsnotify.Event, chan error, io.Closer, error) {
@@ -109,6 +265,10 @@ func (c *fileCollector) startWatcher() (chan fsnotify.Event, chan error, io.Clos
 		return nil, nil, nil, fmt.Errorf("watch file error: %s", err)
 	}
 
+	if c.isDir() {
+		return watcher.Events, watcher.Errors, watcher, nil
+	}
+
 	parent := filepath.Dir(c.file)
 	console.Info().Printf("watching %s", parent)
 	if err := watcher.Add(parent); err != nil {
@@ -122,30 +282,39 @@ func (c *fileCollector) startWatcher() (chan fsnotify.Event, chan error, io.Clos
 func (c *fileCollector) eventLoop(
 	events chan fsnotify.Event,
 	errors chan error,
-	signals chan os.Signal,
+	snapshots chan<- []api.Cluster,
+	done <-chan struct{},
 ) error {
 	for {
 		select {
 		case event := <-events:
-			if event.Name == c.file {
+			if c.matches(event.Name) {
 				console.Info().Printf(
 					"%s changed %s (%x)",
 					event.Name,
 					event.Op.String(),
 					uint32(event.Op),
 				)
+				reload := false
 				if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
-					c.reload()
+					reload = true
 				} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
-					console.Info().Printf("file %s disappeared", c.file)
+					if c.isDir() {
+						reload = true
+					} else {
+						console.Info().Printf("file %s disappeared", c.file)
+					}
+				}
+
+				if reload && !c.reload(snapshots, done) {
+					return nil
 				}
 			}
 
 		case err := <-errors:
 			return fmt.Errorf("watch error: %s", err)
 
-		case signal := <-signals:
-			console.Info().Printf("%s: exiting", signal.String())
+		case <-done:
 			return nil
 		}
 	}
@@ -19,7 +19,9 @@ package file
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -250,30 +252,42 @@ func TestFileCollectorParseError(t *testing.T) {
 	assert.NonNil(t, err)
 }
 
-func testReload(t *testing.T, collector *fileCollector, data string) error {
+func testReload(
+	t *testing.T,
+	collector *fileCollector,
+	data string,
+	snapshots chan []api.Cluster,
+	done chan struct{},
+) bool {
 	tempFile, cleanup := tempfile.Write(t, data, "filecollector-reload")
 	defer cleanup()
 	collector.file = tempFile
 
-	return collector.reload()
+	return collector.reload(snapshots, done)
 }
 
 func TestFileCollectorReload(t *testing.T) {
-	yamlCollector, ctrl, mockUpdater := makeFileCollectorAndMock(t)
-	defer ctrl.Finish()
+	yamlCollector := makeYamlFileCollector()
+
+	snapshots := make(chan []api.Cluster, 1)
+	assert.True(t, testReload(t, yamlCollector, SimpleYamlInput, snapshots, nil))
+	assert.ArrayEqual(t, <-snapshots, simpleTestClusters)
+}
 
-	mockUpdater.EXPECT().Replace(simpleTestClusters)
+func TestFileCollectorReloadDone(t *testing.T) {
+	yamlCollector := makeYamlFileCollector()
 
-	error := testReload(t, yamlCollector, SimpleYamlInput)
-	assert.Nil(t, error)
+	done := make(chan struct{})
+	close(done)
+	assert.False(t, testReload(t, yamlCollector, SimpleYamlInput, nil, done))
 }
 
 func TestFileCollectorReloadParseError(t *testing.T) {
-	yamlCollector, ctrl, _ := makeFileCollectorAndMock(t)
-	defer ctrl.Finish()
+	yamlCollector := makeYamlFileCollector()
 
-	error := testReload(t, yamlCollector, "nope nope nope")
-	assert.ErrorContains(t, error, "cannot unmarshal")
+	snapshots := make(chan []api.Cluster, 1)
+	assert.True(t, testReload(t, yamlCollector, "nope nope nope", snapshots, nil))
+	assert.ChannelEmpty(t, snapshots)
 }
 
 func TestFileCollectorReloadReadFileError(t *testing.T) {
@@ -284,7 +298,7 @@ func TestFileCollectorReloadReadFileError(t *testing.T) {
 
 	yamlCollector.file = tempFile
 
-	err := yamlCollector.reload()
+	_, err := yamlCollector.GetClusters()
 	assert.True(t, os.IsNotExist(err))
 }
 
@@ -313,15 +327,12 @@ func TestFileEventLoopErrorExit(t *testing.T) {
 	testFileEventLoop(t, true)
 }
 
-func TestFileEventLoopSignalExit(t *testing.T) {
+func TestFileEventLoopDoneExit(t *testing.T) {
 	testFileEventLoop(t, false)
 }
 
 func testFileEventLoop(t *testing.T, exitOnErr bool) {
-	yamlCollector, ctrl, mockUpdater := makeFileCollectorAndMock(t)
-	defer ctrl.Finish()
-
-	mockUpdater.EXPECT().Replace(simpleTestClusters)
+	yamlCollector := makeYamlFileCollector()
 
 	tempFile, cleanup := tempfile.Write(t, SimpleYamlInput, "filecollector-eventloop")
 	defer cleanup()
@@ -330,14 +341,15 @@ func testFileEventLoop(t *testing.T, exitOnErr bool) {
 
 	events := make(chan fsnotify.Event)
 	errs := make(chan error)
-	signals := make(chan os.Signal)
+	snapshots := make(chan []api.Cluster, 1)
+	done := make(chan struct{})
 
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(1)
 
 	var eventLoopResult error
 	go func() {
-		eventLoopResult = yamlCollector.eventLoop(events, errs, signals)
+		eventLoopResult = yamlCollector.eventLoop(events, errs, snapshots, done)
 		waitGroup.Done()
 	}()
 
@@ -353,10 +365,12 @@ func testFileEventLoop(t *testing.T, exitOnErr bool) {
 		Name: tempFile,
 		Op:   fsnotify.Create,
 	}
+	assert.ArrayEqual(t, <-snapshots, simpleTestClusters)
+
 	if exitOnErr {
 		errs <- errors.New("fail")
 	} else {
-		signals <- os.Interrupt
+		close(done)
 	}
 
 	waitGroup.Wait()
@@ -395,6 +409,7 @@ func testFileCollectorRun(
 	syncCh := make(chan struct{}, 1)
 	sync := func(_ []api.Cluster) { syncCh <- struct{}{} }
 
+	mockUpdater.EXPECT().Delay().Return(time.Duration(0)).AnyTimes()
 	gomock.InOrder(
 		mockUpdater.EXPECT().Replace(matcher.SameElements{simpleTestClusters}).Do(sync),
 		mockUpdater.EXPECT().Replace(matcher.SameElements{expectedClusters}).Do(sync).MinTimes(1),
@@ -453,3 +468,131 @@ func TestFileCollectorRunErrors(t *testing.T) {
 	collector.file = tempDir.Write(t, "this is not yaml, my dude")
 	assert.NonNil(t, collector.Run())
 }
+
+const (
+	SecondYamlFragment = `
+- cluster: c2
+  instances:
+  - host: c2h1
+    port: 8000
+    metadata:
+    - key: c2h1m1
+      value: c2h1v1
+`
+
+	DuplicateYamlFragment = `
+- cluster: c1
+  instances:
+  - host: other
+    port: 9000
+`
+)
+
+func makeYamlDirCollector(dir string) *fileCollector {
+	return NewDirCollector(dir, "frag-*", nil, mkParser(codec.NewYaml())).(*fileCollector)
+}
+
+func TestFileCollectorMatches(t *testing.T) {
+	collector := makeYamlDirCollector("/tmp/dir")
+	assert.True(t, collector.matches("/tmp/dir/frag-a.yaml"))
+	assert.False(t, collector.matches("/tmp/dir/other.yaml"))
+	assert.False(t, collector.matches("/tmp/dir/sub/frag-a.yaml"))
+	assert.False(t, collector.matches("/tmp/dir"))
+
+	collector = makeYamlFileCollector()
+	collector.file = "/tmp/dir/file.yaml"
+	assert.True(t, collector.matches("/tmp/dir/file.yaml"))
+	assert.False(t, collector.matches("/tmp/dir/frag-a.yaml"))
+}
+
+func TestFileCollectorParseDir(t *testing.T) {
+	tempDir := tempfile.TempDir(t, "filecollector-dir")
+	defer tempDir.Cleanup()
+
+	tempDir.Write(t, SimpleYamlInput, "frag-a")
+	tempDir.Write(t, SecondYamlFragment, "frag-b")
+	tempDir.Write(t, "nope nope nope", "ignored")
+
+	collector := makeYamlDirCollector(tempDir.Path())
+
+	clusters, err := collector.parseDir()
+	assert.Nil(t, err)
+	assert.HasSameElements(t, clusters, []api.Cluster{simpleTestClusters[0], expectedClusters[1]})
+}
+
+func TestFileCollectorParseDirDuplicateClusters(t *testing.T) {
+	tempDir := tempfile.TempDir(t, "filecollector-dir")
+	defer tempDir.Cleanup()
+
+	tempDir.Write(t, SimpleYamlInput, "frag-a")
+	tempDir.Write(t, DuplicateYamlFragment, "frag-b")
+
+	collector := makeYamlDirCollector(tempDir.Path())
+
+	clusters, err := collector.parseDir()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, clusters, simpleTestClusters)
+}
+
+func TestFileCollectorParseDirMalformedFragment(t *testing.T) {
+	tempDir := tempfile.TempDir(t, "filecollector-dir")
+	defer tempDir.Cleanup()
+
+	tempDir.Write(t, SimpleYamlInput, "frag-a")
+	second := tempDir.Write(t, SecondYamlFragment, "frag-b")
+	malformed := tempDir.Write(t, "nope nope nope", "frag-c")
+
+	collector := makeYamlDirCollector(tempDir.Path())
+
+	clusters, err := collector.parseDir()
+	assert.Nil(t, err)
+	assert.HasSameElements(t, clusters, []api.Cluster{simpleTestClusters[0], expectedClusters[1]})
+
+	// a fragment that becomes malformed retains its last known clusters
+	assert.Nil(t, ioutil.WriteFile(second, []byte("nope nope nope"), 0644))
+	clusters, err = collector.parseDir()
+	assert.Nil(t, err)
+	assert.HasSameElements(t, clusters, []api.Cluster{simpleTestClusters[0], expectedClusters[1]})
+
+	// a removed fragment's clusters are dropped
+	assert.Nil(t, os.Remove(second))
+	assert.Nil(t, os.Remove(malformed))
+	clusters, err = collector.parseDir()
+	assert.Nil(t, err)
+	assert.ArrayEqual(t, clusters, simpleTestClusters)
+}
+
+func TestFileCollectorDirEventLoopReloadsOnRemove(t *testing.T) {
+	tempDir := tempfile.TempDir(t, "filecollector-dir")
+	defer tempDir.Cleanup()
+
+	tempDir.Write(t, SimpleYamlInput, "frag-a")
+	second := tempDir.Write(t, SecondYamlFragment, "frag-b")
+
+	collector := makeYamlDirCollector(tempDir.Path())
+
+	events := make(chan fsnotify.Event)
+	errs := make(chan error)
+	snapshots := make(chan []api.Cluster, 1)
+	done := make(chan struct{})
+
+	result := make(chan error, 1)
+	go func() {
+		result <- collector.eventLoop(events, errs, snapshots, done)
+	}()
+
+	assert.Nil(t, os.Remove(second))
+
+	events <- fsnotify.Event{
+		Name: filepath.Join(tempDir.Path(), "unmatched"),
+		Op:   fsnotify.Remove,
+	}
+	events <- fsnotify.Event{
+		Name: second,
+		Op:   fsnotify.Remove,
+	}
+	assert.ArrayEqual(t, <-snapshots, simpleTestClusters)
+	close(done)
+
+	assert.Nil(t, <-result)
+}
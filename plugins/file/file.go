@@ -20,6 +20,7 @@ limitations under the License.
 package file
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -31,11 +32,22 @@ import (
 	"github.com/turbinelabs/rotor"
 )
 
-const fileDescription = `Watches the given JSON or YAML file and updates Clusters
+const (
+	defaultGlob = "*"
+
+	fileDescription = `Watches the given JSON or YAML file and updates Clusters
 stored in the Turbine Labs API at startup and whenever the file changes.
 
 The file can be specified as a flag or as the only argument (but not both).
 
+If the file is a directory, each file within it matching the --glob pattern
+is treated as a fragment, and the clusters from all fragments are merged. The
+directory is reloaded whenever a matching fragment is created, written,
+removed or renamed. A cluster defined in more than one fragment is reported
+and the definition from the lexically first fragment is used. A fragment that
+cannot be parsed is reported and its last successfully parsed clusters (if
+any) are used in its place.
+
 The structure of the JSON and YAML formats is equivalent. Each contains 0 or
 more clusters identified by name, each containing 0 or more instances. For
 example, as YAML:
@@ -65,10 +77,43 @@ Alternatively as JSON:
       }
     ]
 
+Each cluster may additionally specify the following optional fields, which
+use the same structure as the Turbine Labs API Cluster object. For example,
+as YAML:
+
+    - cluster: c1
+      require_tls: true
+      health_checks:
+      - timeout_msec: 1000
+        interval_msec: 5000
+        unhealthy_threshold: 2
+        healthy_threshold: 3
+        health_checker:
+          http_health_check:
+            path: /health
+      circuit_breakers:
+        max_connections: 1024
+        max_pending_requests: 1024
+        max_retries: 3
+        max_requests: 1024
+      outlier_detection:
+        consecutive_5xx: 5
+        interval_msec: 10000
+        base_ejection_time_msec: 30000
+        max_ejection_percent: 10
+      instances:
+      - host: h1
+        port: 8000
+
+At most one health check may be specified, and it must define either an
+http_health_check or a tcp_health_check. Invalid values cause the file to be
+rejected with an error naming the offending cluster.
+
 Note that when updating the file, care should be taken to make the modification
 atomic. In practice, this means writing the updated file to a temporary location and
 then moving/renaming the file to the watched path. Alternatively, the watched path
 may be a symbolic link that is replaced with a reference to the updated file.`
+)
 
 // Cmd creates the file based collector sub command
 func Cmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
@@ -87,12 +132,19 @@ func Cmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 	cmd.Runner = r
 
 	cmd.Flags.StringVar(&r.file, "filename", "", "The file from which to collect")
+	cmd.Flags.StringVar(
+		&r.glob,
+		"glob",
+		defaultGlob,
+		"If the file is a directory, the `pattern` matching fragment file names within it",
+	)
 
 	return cmd
 }
 
 type fileRunner struct {
 	file         string
+	glob         string
 	updaterFlags rotor.UpdaterFromFlags
 	codecFlags   codec.FromFlags
 }
@@ -119,12 +171,16 @@ func (r *fileRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.BadInput(err)
 	}
 
+	if _, err := filepath.Match(r.glob, ""); err != nil {
+		return cmd.BadInputf("invalid --glob %q: %s", r.glob, err)
+	}
+
 	updater, err := r.updaterFlags.Make()
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	collector := NewCollector(file, updater, mkParser(r.codecFlags.Make()))
+	collector := newCollector(file, r.glob, updater, mkParser(r.codecFlags.Make()))
 	if err := collector.Run(); err != nil {
 		return cmd.Error(err)
 	}
@@ -133,30 +189,88 @@ func (r *fileRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 }
 
 type fileCluster struct {
-	ClusterName string        `json:"cluster"`
-	Instances   api.Instances `json:"instances"`
+	ClusterName      string                `json:"cluster"`
+	Instances        api.Instances         `json:"instances"`
+	RequireTLS       bool                  `json:"require_tls,omitempty"`
+	HealthChecks     api.HealthChecks      `json:"health_checks,omitempty"`
+	CircuitBreakers  *api.CircuitBreakers  `json:"circuit_breakers,omitempty"`
+	OutlierDetection *api.OutlierDetection `json:"outlier_detection,omitempty"`
+}
+
+// validate checks the optional cluster-level configuration. Instances are
+// not validated, matching the behavior of other collectors.
+func (fc fileCluster) validate() error {
+	errs := &api.ValidationError{}
+
+	errs.MergePrefixed(fc.HealthChecks.IsValid(), "")
+	if fc.CircuitBreakers != nil {
+		errs.MergePrefixed(fc.CircuitBreakers.IsValid(), "")
+	}
+	if fc.OutlierDetection != nil {
+		errs.MergePrefixed(fc.OutlierDetection.IsValid(), "")
+	}
+
+	if err := errs.OrNil(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (fc fileCluster) toCluster() api.Cluster {
+	return api.Cluster{
+		Name:             fc.ClusterName,
+		Instances:        fc.Instances,
+		RequireTLS:       fc.RequireTLS,
+		HealthChecks:     fc.HealthChecks,
+		CircuitBreakers:  fc.CircuitBreakers,
+		OutlierDetection: fc.OutlierDetection,
+	}
+}
+
+// decodeFileCluster decodes a single cluster entry, producing an error that
+// identifies the cluster by name (if possible) and position in the file.
+func decodeFileCluster(idx int, raw json.RawMessage) (fileCluster, error) {
+	fc := fileCluster{}
+	err := json.Unmarshal(raw, &fc)
+	if err == nil {
+		err = fc.validate()
+	}
+
+	if err != nil {
+		named := struct {
+			ClusterName string `json:"cluster"`
+		}{}
+		if json.Unmarshal(raw, &named) == nil && named.ClusterName != "" {
+			return fileCluster{}, fmt.Errorf("cluster %q (entry %d): %s", named.ClusterName, idx, err)
+		}
+		return fileCluster{}, fmt.Errorf("cluster entry %d: %s", idx, err)
+	}
+
+	return fc, nil
 }
 
 func mkParser(codec codec.Codec) func(io.Reader) ([]api.Cluster, error) {
 	return func(reader io.Reader) ([]api.Cluster, error) {
-		fileClusters := []fileCluster{}
+		entries := []json.RawMessage{}
 
-		err := codec.Decode(reader, &fileClusters)
+		err := codec.Decode(reader, &entries)
 		if err != nil {
 			return nil, err
 		}
 
-		clusters := make(map[string]*api.Cluster, len(fileClusters))
-		for _, fc := range fileClusters {
+		clusters := make(map[string]*api.Cluster, len(entries))
+		for idx, raw := range entries {
+			fc, err := decodeFileCluster(idx, raw)
+			if err != nil {
+				return nil, err
+			}
+
 			if _, exists := clusters[fc.ClusterName]; exists {
 				return nil, fmt.Errorf("duplicate cluster: %s", fc.ClusterName)
 			}
 
-			cluster := &api.Cluster{
-				Name:      fc.ClusterName,
-				Instances: fc.Instances,
-			}
-			clusters[cluster.Name] = cluster
+			cluster := fc.toCluster()
+			clusters[cluster.Name] = &cluster
 		}
 
 		result := make([]api.Cluster, 0, len(clusters))
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/codec"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+)
+
+// FileClustersProviderConfig is the JSON configuration of a file
+// ClusterProvider. Filename may name a file or a directory of fragments,
+// as with "rotor file". Format is either "json" (the default) or "yaml".
+type FileClustersProviderConfig struct {
+	Filename string `json:"filename"`
+	Glob     string `json:"glob"`
+	Format   string `json:"format"`
+}
+
+// NewFileClusterProvider produces a ClusterProvider that parses the
+// configured file (or directory) each time clusters are requested.
+func NewFileClusterProvider(
+	config FileClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	if config.Filename == "" {
+		return nil, errors.New("filename must be specified")
+	}
+
+	var c codec.Codec
+	switch config.Format {
+	case "", "json":
+		c = codec.NewJson()
+	case "yaml":
+		c = codec.NewYaml()
+	default:
+		return nil, fmt.Errorf("format must be json or yaml, was %q", config.Format)
+	}
+
+	if config.Glob == "" {
+		config.Glob = defaultGlob
+	}
+	if _, err := filepath.Match(config.Glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %s", config.Glob, err)
+	}
+
+	return newCollector(filepath.Clean(config.Filename), config.Glob, nil, mkParser(c)), nil
+}
+
+var _ cluster_provider.ClusterProvider = &fileCollector{}
+
+func (c *fileCollector) String() string {
+	if c.isDir() {
+		return fmt.Sprintf("FileClustersProvider{dir=%s, glob=%s}", c.file, c.glob)
+	}
+	return fmt.Sprintf("FileClustersProvider{file=%s}", c.file)
+}
+
+func (c *fileCollector) GetClusters() ([]api.Cluster, error) {
+	if c.isDir() {
+		return c.parseDir()
+	}
+	return c.parseFile(c.file)
+}
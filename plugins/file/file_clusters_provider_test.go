@@ -0,0 +1,79 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+// testFileClustersProviderMatchesFlags checks that the provider produced
+// from configJSON collects the same clusters from the same file as "rotor
+// file" given args.
+func testFileClustersProviderMatchesFlags(t *testing.T, args []string, configJSON string) {
+	cmd := Cmd(nil)
+	assert.Nil(t, cmd.Flags.Parse(args))
+	runner := cmd.Runner.(*fileRunner)
+	assert.Nil(t, runner.codecFlags.Validate())
+	want := newCollector(runner.file, runner.glob, nil, mkParser(runner.codecFlags.Make()))
+
+	var config FileClustersProviderConfig
+	assert.Nil(t, json.Unmarshal([]byte(configJSON), &config))
+	provider, err := NewFileClusterProvider(config)
+	assert.Nil(t, err)
+	got := provider.(*fileCollector)
+
+	assert.Equal(t, got.file, want.file)
+	assert.Equal(t, got.glob, want.glob)
+
+	wantClusters, err := want.GetClusters()
+	assert.Nil(t, err)
+	gotClusters, err := got.GetClusters()
+	assert.Nil(t, err)
+	assert.HasSameElements(t, gotClusters, wantClusters)
+	assert.NotEqual(t, len(gotClusters), 0)
+}
+
+func TestFileClustersProviderConfigDefaultsMatchFlags(t *testing.T) {
+	file, cleanup := tempfile.Write(t, JsonInput, "fileprovider")
+	defer cleanup()
+
+	testFileClustersProviderMatchesFlags(
+		t,
+		[]string{"-filename=" + file},
+		fmt.Sprintf(`{"filename": %q}`, file),
+	)
+}
+
+func TestFileClustersProviderConfigMatchesFlags(t *testing.T) {
+	dir := tempfile.TempDir(t, "fileprovider")
+	defer dir.Cleanup()
+
+	dir.Write(t, SimpleYamlInput, "frag-a")
+	dir.Write(t, SecondYamlFragment, "frag-b")
+	dir.Write(t, "ignored, not yaml", "other")
+
+	testFileClustersProviderMatchesFlags(
+		t,
+		[]string{"-filename=" + dir.Path(), "-glob=frag-*", "-format=yaml"},
+		fmt.Sprintf(`{"filename": %q, "glob": "frag-*", "format": "yaml"}`, dir.Path()),
+	)
+}
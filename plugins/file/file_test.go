@@ -24,7 +24,9 @@ import (
 
 	"github.com/golang/mock/gomock"
 
+	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/codec"
+	"github.com/turbinelabs/nonstdlib/ptr"
 	"github.com/turbinelabs/rotor"
 	"github.com/turbinelabs/test/assert"
 )
@@ -37,6 +39,7 @@ func TestCmd(t *testing.T) {
 	runner := cmd.Runner.(*fileRunner)
 	assert.Equal(t, runner.updaterFlags, mockUpdaterFromFlags)
 	assert.Equal(t, runner.file, "foo")
+	assert.Equal(t, runner.glob, defaultGlob)
 	assert.NonNil(t, runner.codecFlags)
 }
 
@@ -131,3 +134,147 @@ func TestFileRunnerRunUpdateMakeError(t *testing.T) {
 	cmdErr := fr.Run(Cmd(mockFromFlags), []string{})
 	assert.Equal(t, cmdErr.Message, fmt.Sprintf("file: %s", err))
 }
+
+const (
+	yamlInputWithClusterConfig = `
+- cluster: c1
+  require_tls: true
+  health_checks:
+  - timeout_msec: 1000
+    interval_msec: 5000
+    unhealthy_threshold: 2
+    healthy_threshold: 3
+    health_checker:
+      http_health_check:
+        path: /health
+  circuit_breakers:
+    max_connections: 1024
+    max_retries: 3
+  outlier_detection:
+    consecutive_5xx: 5
+  instances:
+  - host: c1h1
+    port: 8000
+`
+
+	jsonInputWithClusterConfig = `
+[
+  {
+    "cluster": "c1",
+    "require_tls": true,
+    "health_checks": [
+      {
+        "timeout_msec": 1000,
+        "interval_msec": 5000,
+        "unhealthy_threshold": 2,
+        "healthy_threshold": 3,
+        "health_checker": {
+          "http_health_check": { "path": "/health" }
+        }
+      }
+    ],
+    "circuit_breakers": { "max_connections": 1024, "max_retries": 3 },
+    "outlier_detection": { "consecutive_5xx": 5 },
+    "instances": [ { "host": "c1h1", "port": 8000 } ]
+  }
+]`
+
+	yamlInputWithInvalidHealthCheck = `
+- cluster: c1
+  instances:
+  - host: c1h1
+    port: 8000
+- cluster: c2
+  health_checks:
+  - timeout_msec: 1000
+    interval_msec: 5000
+    unhealthy_threshold: 2
+    healthy_threshold: 3
+`
+
+	yamlInputWithInvalidCircuitBreakers = `
+- cluster: c1
+  circuit_breakers:
+    max_connections: -1
+`
+
+	yamlInputWithMistypedField = `
+- cluster: c1
+- cluster: c2
+  require_tls: maybe
+`
+)
+
+var expectedClusterWithConfig = api.Cluster{
+	Name:       "c1",
+	RequireTLS: true,
+	Instances:  api.Instances{{Host: "c1h1", Port: 8000}},
+	HealthChecks: api.HealthChecks{
+		{
+			TimeoutMsec:        1000,
+			IntervalMsec:       5000,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   3,
+			HealthChecker: api.HealthChecker{
+				HTTPHealthCheck: &api.HTTPHealthCheck{Path: "/health"},
+			},
+		},
+	},
+	CircuitBreakers: &api.CircuitBreakers{
+		MaxConnections: ptr.Int(1024),
+		MaxRetries:     ptr.Int(3),
+	},
+	OutlierDetection: &api.OutlierDetection{
+		Consecutive5xx: ptr.Int(5),
+	},
+}
+
+func TestMkParserClusterConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		codec codec.Codec
+		input string
+	}{
+		{"yaml", codec.NewYaml(), yamlInputWithClusterConfig},
+		{"json", codec.NewJson(), jsonInputWithClusterConfig},
+	} {
+		assert.Group(tc.name, t, func(g *assert.G) {
+			clusters, err := mkParser(tc.codec)(strings.NewReader(tc.input))
+			assert.Nil(g, err)
+			assert.Equal(g, len(clusters), 1)
+			assert.True(g, clusters[0].Equals(expectedClusterWithConfig))
+		})
+	}
+}
+
+func TestMkParserClusterConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			"health check",
+			yamlInputWithInvalidHealthCheck,
+			[]string{`cluster "c2" (entry 1)`, "health_checks[0].health_checker"},
+		},
+		{
+			"circuit breakers",
+			yamlInputWithInvalidCircuitBreakers,
+			[]string{`cluster "c1" (entry 0)`, "circuit_breakers.max_connections"},
+		},
+		{
+			"mistyped field",
+			yamlInputWithMistypedField,
+			[]string{`cluster "c2" (entry 1)`, "cannot unmarshal"},
+		},
+	} {
+		assert.Group(tc.name, t, func(g *assert.G) {
+			clusters, err := mkParser(codec.NewYaml())(strings.NewReader(tc.input))
+			assert.Nil(g, clusters)
+			for _, want := range tc.want {
+				assert.ErrorContains(g, err, want)
+			}
+		})
+	}
+}
@@ -84,7 +84,7 @@ func Cmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 	cmd.Flags.StringVar(
 		&runner.namespace,
 		"namespace",
-		"default",
+		defaultNamespace,
 		"The Kubernetes cluster `namespace` to watch for pods.")
 
 	cmd.Flags.StringVar(
@@ -102,13 +102,13 @@ func Cmd(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 	cmd.Flags.StringVar(
 		&runner.portName,
 		"port-name",
-		"http",
+		defaultPortName,
 		"The named container port assigned to cluster instances.")
 
 	cmd.Flags.DurationVar(
 		&runner.timeout,
 		"timeout",
-		120*time.Second,
+		defaultTimeout,
 		"The timeout used for Kubernetes API requests (converted to seconds).")
 
 	runner.k8sClientFlags = newClientFromFlags(tbnflag.Wrap(&cmd.Flags))
@@ -164,13 +164,7 @@ func (r *kubernetesRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		labelSelector:        labelSelector,
 	}
 
-	clientPods := c.k8sClient.Core().Pods(c.namespace)
-	updater.Loop(
-		u,
-		func() ([]api.Cluster, error) {
-			return c.getClusters(clientPods)
-		},
-	)
+	updater.Loop(u, c.GetClusters)
 
 	return command.NoError()
 }
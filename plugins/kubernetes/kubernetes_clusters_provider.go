@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+)
+
+const (
+	defaultNamespace = "default"
+	defaultPortName  = "http"
+	defaultTimeout   = 120 * time.Second
+)
+
+// KubernetesClustersProviderConfig is the JSON configuration of a
+// Kubernetes ClusterProvider. Unset fields take the defaults of the
+// equivalent "rotor kubernetes" flags.
+type KubernetesClustersProviderConfig struct {
+	Namespace    string `json:"namespace"`
+	Selector     string `json:"selector"`
+	ClusterLabel string `json:"cluster_label"`
+	// PortName is a pointer since the empty string selects the first
+	// TCP port, while nil selects the default.
+	PortName *string `json:"port_name"`
+	// Timeout is a duration string, e.g. "120s".
+	Timeout string `json:"timeout"`
+
+	KubernetesHost string `json:"kubernetes_host"`
+	CACert         string `json:"ca_cert"`
+	ClientKey      string `json:"client_key"`
+	ClientCert     string `json:"client_cert"`
+}
+
+// settings returns the collector settings and client configuration
+// equivalent to the config.
+func (c KubernetesClustersProviderConfig) settings() (
+	k8sCollectorSettings,
+	*clientFromFlagsImpl,
+	error,
+) {
+	settings := k8sCollectorSettings{
+		namespace:        c.Namespace,
+		selector:         c.Selector,
+		clusterNameLabel: c.ClusterLabel,
+		portName:         defaultPortName,
+		timeout:          defaultTimeout,
+	}
+
+	if settings.namespace == "" {
+		settings.namespace = defaultNamespace
+	}
+	if settings.clusterNameLabel == "" {
+		settings.clusterNameLabel = constants.DefaultClusterLabelName
+	}
+	if c.PortName != nil {
+		settings.portName = *c.PortName
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return k8sCollectorSettings{}, nil, fmt.Errorf("invalid timeout %q: %s", c.Timeout, err)
+		}
+		settings.timeout = timeout
+	}
+
+	clientFlags := &clientFromFlagsImpl{
+		k8sApiHost:     c.KubernetesHost,
+		caCertFile:     c.CACert,
+		clientKeyFile:  c.ClientKey,
+		clientCertFile: c.ClientCert,
+	}
+
+	return settings, clientFlags, nil
+}
+
+// NewKubernetesClusterProvider produces a ClusterProvider that lists pods
+// from the configured Kubernetes cluster.
+func NewKubernetesClusterProvider(
+	config KubernetesClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	settings, clientFlags, err := config.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	labelSelector := labels.NewSelector()
+	if settings.selector != "" {
+		labelSelector, err = labels.Parse(settings.selector)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing selector: %s", err.Error())
+		}
+	}
+
+	k8sClient, err := clientFlags.Make()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to instantiate kubernetes client: %s", err.Error())
+	}
+
+	return &kubernetesCollector{
+		k8sCollectorSettings: settings,
+		k8sClient:            k8sClient,
+		labelSelector:        labelSelector,
+	}, nil
+}
+
+var _ cluster_provider.ClusterProvider = &kubernetesCollector{}
+
+func (c *kubernetesCollector) String() string {
+	return fmt.Sprintf(
+		"KubernetesClustersProvider{namespace=%s, selector=%s, cluster_label=%s, port_name=%s}",
+		c.namespace,
+		c.selector,
+		c.clusterNameLabel,
+		c.portName,
+	)
+}
+
+func (c *kubernetesCollector) GetClusters() ([]api.Cluster, error) {
+	return c.getClusters(c.k8sClient.Core().Pods(c.namespace))
+}
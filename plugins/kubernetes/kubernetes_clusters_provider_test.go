@@ -0,0 +1,76 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestKubernetesClustersProviderConfigDefaultsMatchFlags(t *testing.T) {
+	cmd := Cmd(nil)
+	cmd.Flags.Parse([]string{})
+	runner := cmd.Runner.(*kubernetesRunner)
+
+	settings, clientFlags, err := KubernetesClustersProviderConfig{}.settings()
+	assert.Nil(t, err)
+	assert.Equal(t, settings, runner.k8sCollectorSettings)
+	assert.DeepEqual(t, clientFlags, runner.k8sClientFlags)
+}
+
+func TestKubernetesClustersProviderConfigMatchesFlags(t *testing.T) {
+	cmd := Cmd(nil)
+	cmd.Flags.Parse([]string{
+		"-namespace=ns",
+		"-selector=app=x",
+		"-cluster-label=svc",
+		"-port-name=",
+		"-timeout=30s",
+		"-kubernetes-host=k8s.example.com",
+		"-ca-cert=ca.pem",
+		"-client-key=key.pem",
+		"-client-cert=cert.pem",
+	})
+	runner := cmd.Runner.(*kubernetesRunner)
+
+	var config KubernetesClustersProviderConfig
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"namespace": "ns",
+		"selector": "app=x",
+		"cluster_label": "svc",
+		"port_name": "",
+		"timeout": "30s",
+		"kubernetes_host": "k8s.example.com",
+		"ca_cert": "ca.pem",
+		"client_key": "key.pem",
+		"client_cert": "cert.pem"
+	}`), &config))
+
+	settings, clientFlags, err := config.settings()
+	assert.Nil(t, err)
+	assert.Equal(t, settings, runner.k8sCollectorSettings)
+	assert.Equal(t, settings.timeout, 30*time.Second)
+	assert.DeepEqual(t, clientFlags, runner.k8sClientFlags)
+}
+
+func TestKubernetesClustersProviderConfigInvalidTimeout(t *testing.T) {
+	_, _, err := KubernetesClustersProviderConfig{Timeout: "soon"}.settings()
+	assert.ErrorContains(t, err, `invalid timeout "soon"`)
+}
@@ -53,6 +53,11 @@ func (ff *clientFromFlagsImpl) Make() (marathon.Marathon, error) {
 		return nil, err
 	}
 
+	return newClient(ccfg)
+}
+
+// newClient produces a Marathon client from the given DCOSConfig.
+func newClient(ccfg config.DCOSConfig) (marathon.Marathon, error) {
 	mcfg := marathon.NewDefaultConfig()
 	mcfg.URL = ccfg.URL
 	mcfg.DCOSToken = ccfg.ACSToken
@@ -167,7 +167,7 @@ func (r *marathonRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		filter: filter,
 	}
 
-	updater.Loop(u, collector.getClusters)
+	updater.Loop(u, collector.GetClusters)
 
 	return command.NoError()
 }
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/pkg/cluster_provider"
+	"github.com/turbinelabs/rotor/plugins/marathon/config"
+)
+
+// MarathonClustersProviderConfig is the JSON configuration of a Marathon
+// ClusterProvider. Either TOMLFile or both URL and ACSToken must be set.
+// Unset fields take the defaults of the equivalent "rotor marathon" flags.
+type MarathonClustersProviderConfig struct {
+	URL      string `json:"url"`
+	ACSToken string `json:"acs_token"`
+	Insecure bool   `json:"insecure"`
+	// RequestTimeout is a duration string, e.g. "5s".
+	RequestTimeout string `json:"request_timeout"`
+	TOMLFile       string `json:"toml_file"`
+
+	GroupPrefix  string `json:"group_prefix"`
+	Selector     string `json:"selector"`
+	ClusterLabel string `json:"cluster_label"`
+}
+
+func (c MarathonClustersProviderConfig) dcosConfig() (config.DCOSConfig, error) {
+	if c.TOMLFile != "" {
+		if c.URL != "" || c.ACSToken != "" {
+			return config.DCOSConfig{}, errors.New("toml_file cannot be combined with url or acs_token")
+		}
+		return config.NewFromTOMLFile(c.TOMLFile)
+	}
+
+	if c.URL == "" || c.ACSToken == "" {
+		return config.DCOSConfig{}, errors.New("must specify either toml_file or both url and acs_token")
+	}
+
+	timeout := config.DefaultRequestTimeout
+	if c.RequestTimeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(c.RequestTimeout)
+		if err != nil {
+			return config.DCOSConfig{}, fmt.Errorf("invalid request_timeout %q: %s", c.RequestTimeout, err)
+		}
+		if timeout < time.Second {
+			return config.DCOSConfig{}, fmt.Errorf("request_timeout must be >= 1s, was %q", timeout)
+		}
+	}
+
+	return config.DCOSConfig{
+		URL:            c.URL,
+		Insecure:       c.Insecure,
+		RequestTimeout: timeout,
+		ACSToken:       c.ACSToken,
+	}, nil
+}
+
+// NewMarathonClusterProvider produces a ClusterProvider that collects
+// tasks from the configured Marathon API server.
+func NewMarathonClusterProvider(
+	cfg MarathonClustersProviderConfig,
+) (cluster_provider.ClusterProvider, error) {
+	settings := marathonCollectorSettings{
+		groupPrefix:      cfg.GroupPrefix,
+		clusterLabelName: cfg.ClusterLabel,
+		selector:         cfg.Selector,
+	}
+	if settings.clusterLabelName == "" {
+		settings.clusterLabelName = constants.DefaultClusterLabelName
+	}
+
+	var filters []marathonFilter
+	if settings.selector != "" {
+		filter, err := makeLabelFilter(settings.selector)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	dcosConfig, err := cfg.dcosConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(dcosConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to instantiate Marathon client: %s", err.Error())
+	}
+
+	return &marathonCollector{
+		marathonCollectorSettings: settings,
+		client:                    client,
+		filter:                    makeFilterStack(filters),
+	}, nil
+}
+
+var _ cluster_provider.ClusterProvider = &marathonCollector{}
+
+func (m *marathonCollector) String() string {
+	return fmt.Sprintf(
+		"MarathonClustersProvider{group_prefix=%s, selector=%s, cluster_label=%s}",
+		m.groupPrefix,
+		m.selector,
+		m.clusterLabelName,
+	)
+}
+
+func (m *marathonCollector) GetClusters() ([]api.Cluster, error) {
+	return m.getClusters()
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marathon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/rotor/plugins/marathon/config"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestMarathonClustersProviderConfigDCOSConfig(t *testing.T) {
+	cfg := MarathonClustersProviderConfig{URL: "http://dcos", ACSToken: "token"}
+	dcos, err := cfg.dcosConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, dcos, config.DCOSConfig{
+		URL:            "http://dcos",
+		ACSToken:       "token",
+		RequestTimeout: config.DefaultRequestTimeout,
+	})
+
+	cfg.RequestTimeout = "10s"
+	cfg.Insecure = true
+	dcos, err = cfg.dcosConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, dcos.RequestTimeout, 10*time.Second)
+	assert.True(t, dcos.Insecure)
+}
+
+func TestMarathonClustersProviderConfigDCOSConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  MarathonClustersProviderConfig
+		want string
+	}{
+		{MarathonClustersProviderConfig{URL: "http://dcos"}, "must specify either toml_file"},
+		{MarathonClustersProviderConfig{TOMLFile: "f", URL: "http://dcos"}, "cannot be combined"},
+		{
+			MarathonClustersProviderConfig{URL: "u", ACSToken: "t", RequestTimeout: "x"},
+			"invalid request_timeout",
+		},
+		{
+			MarathonClustersProviderConfig{URL: "u", ACSToken: "t", RequestTimeout: "1ms"},
+			"must be >= 1s",
+		},
+	} {
+		_, err := tc.cfg.dcosConfig()
+		assert.ErrorContains(t, err, tc.want)
+	}
+}
@@ -1,6 +1,8 @@
 package multi
 
 import (
+	"io"
+
 	"github.com/turbinelabs/cli/command"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
 	"github.com/turbinelabs/rotor"
@@ -8,12 +10,12 @@ import (
 	"github.com/turbinelabs/rotor/updater"
 )
 
-
 const defaultConfigFileLocation = "/etc/rotor-multi.json"
 
 type multiRunner struct {
-	configFileLocation string  // file location where multi runner config is present
-	updaterFlags rotor.UpdaterFromFlags
+	configFileLocation string // file location where multi runner config is present
+	watchConfig        bool
+	updaterFlags       rotor.UpdaterFromFlags
 }
 
 func MultiCMD(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
@@ -34,13 +36,20 @@ func MultiCMD(updaterFlags rotor.UpdaterFromFlags) *command.Cmd {
 		"config file location indicating where to read the config file for the multi mode in rotor",
 	)
 
+	flags.BoolVar(
+		&runner.watchConfig,
+		"watch-config",
+		true,
+		"If true, the config file is reloaded when it changes. Only providers whose config changed are rebuilt.",
+	)
+
 	runner.updaterFlags = updaterFlags
 	return cmd
 }
 
 type multiComponent struct {
-	Name string `json:"name"`
-	Config map[string]string `json:"config"`  // change from map[string]string to struct for each using oneof
+	Name   string            `json:"name"`
+	Config map[string]string `json:"config"` // change from map[string]string to struct for each using oneof
 }
 
 func (r multiRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
@@ -48,19 +57,34 @@ func (r multiRunner) Run(cmd *command.Cmd, args []string) command.CmdErr {
 		return cmd.BadInput(err)
 	}
 
+	// the metadata filter is applied per provider, so that providers may
+	// override it
+	metadataFilter := r.updaterFlags.DeferMetadataFilter()
+
 	u, err := r.updaterFlags.Make()
 	if err != nil {
 		return cmd.Error(err)
 	}
 
+	stats, err := r.updaterFlags.MakeStats()
+	if err != nil {
+		return cmd.Error(err)
+	}
+
 	m, err := multi.NewMultiClustersProvider(multi.ClustersProviderConfig{
-		ConfigFileLocation:r.configFileLocation,
+		ConfigFileLocation: r.configFileLocation,
+		Stats:              stats,
+		Watch:              r.watchConfig,
+		MetadataFilter:     metadataFilter,
 	})
 	if err != nil {
 		return cmd.Error(err)
 	}
+	if c, ok := m.(io.Closer); ok {
+		defer c.Close()
+	}
+
 	updater.Loop(u, m.GetClusters)
 
 	return command.NoError()
 }
-
@@ -1,6 +1,92 @@
 package multi
 
+const multiDescription = `Collects clusters from several cluster providers
+at once, as configured by a JSON file (see --config-file), and updates Clusters
+stored in the Turbine Labs API at startup and periodically thereafter.
 
-const multiDescription = `
-todo: add description
-`
\ No newline at end of file
+The config file lists cluster providers, each with an optional name, a type
+and a config object:
+
+    {
+      "conflict_policy": "first_wins",
+      "clusters_providers": [
+        {
+          "name": "ecs",
+          "type": "ECSClustersProvider",
+          "max_staleness": "30m",
+          "stale_policy": "drop",
+          "metadata_deny": ["*-hash"],
+          "config": { "clusters": ["c1"], "aws": { "region": "us-east-1" } }
+        },
+        {
+          "name": "k8s",
+          "type": "KubernetesClustersProvider",
+          "config": { "namespace": "default" }
+        }
+      ]
+    }
+
+The following types are supported. Their config fields correspond to the
+flags of the equivalent collector sub-command, with "-" replaced by "_".
+
+    EC2ClustersProvider         namespace, delimiter, vpc_id, filters,
+                                aws (region, access_key_id,
+                                secret_access_key, iam_role_to_assume)
+    ECSClustersProvider         clusters, cluster_tag, aws (as above)
+    KubernetesClustersProvider  namespace, selector, cluster_label,
+                                port_name, timeout, kubernetes_host,
+                                ca_cert, client_key, client_cert
+    ConsulClustersProvider      dc, cluster_tag, tag_delimiter, hostport,
+                                use_ssl
+    MarathonClustersProvider    url, acs_token, insecure, request_timeout,
+                                toml_file, group_prefix, selector,
+                                cluster_label
+    FileClustersProvider        filename, glob, format
+    EnvoyCDSV1ClustersProvider  addr, sds_addr, clusters_nodes
+    EnvoyCDSV2ClustersProvider  addr, format, zone_name
+
+Durations are given as strings, e.g. "120s". File providers are re-read on
+each poll rather than watched. Provider names must be unique, and default to
+"<type>-<index>", where index is the provider's position in the list.
+
+If a provider fails, its last successfully collected clusters are used. A
+provider that has never succeeded contributes no clusters; the update only
+fails if every provider fails. To bound how long a failing provider's
+clusters are used, set max_staleness (e.g. "30m") on the provider. Once its
+last success is older than max_staleness, the provider's stale_policy is
+applied:
+
+    drop   the provider's clusters are removed (the default)
+    empty  the provider's clusters are kept, with no instances
+
+Instance metadata is filtered using the global --transform.metadata-allow
+and --transform.metadata-deny flags. A provider may override both by
+setting metadata_allow and/or metadata_deny to a list of globs; an empty
+list allows all keys or denies none, respectively. Filters are applied to
+each provider's clusters as they are collected, before any transforms given
+by --transform.config-file.
+
+Unless --watch-config=false is given, the config file is reloaded whenever it
+changes. Providers whose type and config are unchanged are kept as they
+are; others are rebuilt. Providers keep their last known clusters across a
+reload as long as their name is unchanged. If the new config is invalid, it
+is logged and the current providers continue to be used.
+
+Per-provider health is logged and reported as multi.collect,
+multi.healthy, multi.consecutive_failures, multi.snapshot_age,
+multi.clusters and multi.stale stats, tagged with cluster_provider.
+
+The conflict_policy determines what happens when more than one provider
+returns a cluster with the same name:
+
+    first_wins          the cluster from the provider listed first is used
+                        and the conflict is logged (the default)
+    merge_instances     the instances of all same-named clusters are
+                        combined, keeping the first instance seen for each
+                        host:port. Each instance is tagged with the
+                        "cluster_provider" metadata key, set to the name of
+                        the provider it came from. Other cluster settings
+                        come from the provider listed first.
+    prefix_by_provider  every cluster is renamed to
+                        "<provider name>-<cluster name>"
+`
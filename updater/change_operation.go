@@ -17,13 +17,12 @@ limitations under the License.
 package updater
 
 import (
+	"sort"
+
 	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/rotor/differ"
 )
 
-// future implementations of changeOperation would allow delta-based SD regimes
-// to add/remove instances directly
-
 // changeOperation encapsulates API calls to change clusters with the
 // possibility of merging consecutive operations into a single API
 // call.
@@ -46,16 +45,28 @@ type replaceClustersOperation struct {
 }
 
 func (r *replaceClustersOperation) canMerge(other changeOperation) bool {
-	_, ok := other.(*replaceClustersOperation)
-	return ok
+	switch other.(type) {
+	case *replaceClustersOperation, *instanceChangesOperation:
+		return true
+	default:
+		return false
+	}
 }
 
+// merge returns the other operation if it is a replacement. If it is a set
+// of instance changes, they are applied to a copy of the clusters to be
+// replaced.
 func (r *replaceClustersOperation) merge(other changeOperation) changeOperation {
-	if op, ok := other.(*replaceClustersOperation); ok {
+	switch op := other.(type) {
+	case *replaceClustersOperation:
 		return op
-	}
 
-	return nil
+	case *instanceChangesOperation:
+		return &replaceClustersOperation{clusters: op.applyTo(r.clusters)}
+
+	default:
+		return nil
+	}
 }
 
 func (r *replaceClustersOperation) execute(u *updater) error {
@@ -64,3 +75,180 @@ func (r *replaceClustersOperation) execute(u *updater) error {
 }
 
 var _ changeOperation = &replaceClustersOperation{}
+
+// instanceKeyMap maps Instance keys (host:port) to Instances, by cluster name.
+type instanceKeyMap map[string]map[string]api.Instance
+
+func (m instanceKeyMap) put(cluster string, instance api.Instance) {
+	if m[cluster] == nil {
+		m[cluster] = map[string]api.Instance{}
+	}
+	m[cluster][instance.Key()] = instance
+}
+
+func (m instanceKeyMap) remove(cluster string, instance api.Instance) {
+	if is, ok := m[cluster]; ok {
+		delete(is, instance.Key())
+		if len(is) == 0 {
+			delete(m, cluster)
+		}
+	}
+}
+
+func (m instanceKeyMap) copy() instanceKeyMap {
+	c := make(instanceKeyMap, len(m))
+	for cluster, is := range m {
+		for _, i := range is {
+			c.put(cluster, i)
+		}
+	}
+	return c
+}
+
+func (m instanceKeyMap) instances() map[string]api.Instances {
+	result := make(map[string]api.Instances, len(m))
+	for cluster, is := range m {
+		instances := make(api.Instances, 0, len(is))
+		for _, i := range is {
+			instances = append(instances, i)
+		}
+		sort.Sort(api.InstancesByHostPort(instances))
+		result[cluster] = instances
+	}
+	return result
+}
+
+// instanceChangesOperation represents the addition and removal of
+// individual instances, by cluster name. For any given instance, only the
+// most recently requested change is retained. Creation of API clusters is
+// controlled by the updater's DiffOpts.
+type instanceChangesOperation struct {
+	adds    instanceKeyMap
+	removes instanceKeyMap
+}
+
+func newInstanceChangesOperation(
+	cluster string,
+	adds []api.Instance,
+	removes []api.Instance,
+) *instanceChangesOperation {
+	op := &instanceChangesOperation{
+		adds:    instanceKeyMap{},
+		removes: instanceKeyMap{},
+	}
+	for _, i := range removes {
+		op.removes.put(cluster, i)
+	}
+	for _, i := range adds {
+		op.adds.put(cluster, i)
+	}
+	return op
+}
+
+func (o *instanceChangesOperation) canMerge(other changeOperation) bool {
+	switch other.(type) {
+	case *replaceClustersOperation, *instanceChangesOperation:
+		return true
+	default:
+		return false
+	}
+}
+
+// merge returns the other operation if it is a replacement, since it
+// supersedes any pending instance changes. If it is a set of instance
+// changes, the two sets are combined, with the other operation's changes
+// taking precedence.
+func (o *instanceChangesOperation) merge(other changeOperation) changeOperation {
+	switch op := other.(type) {
+	case *replaceClustersOperation:
+		return op
+
+	case *instanceChangesOperation:
+		merged := &instanceChangesOperation{
+			adds:    o.adds.copy(),
+			removes: o.removes.copy(),
+		}
+		for cluster, is := range op.removes {
+			for _, i := range is {
+				merged.adds.remove(cluster, i)
+				merged.removes.put(cluster, i)
+			}
+		}
+		for cluster, is := range op.adds {
+			for _, i := range is {
+				merged.removes.remove(cluster, i)
+				merged.adds.put(cluster, i)
+			}
+		}
+		return merged
+
+	default:
+		return nil
+	}
+}
+
+// applyTo returns a copy of the given clusters with the instance changes
+// applied. Added instances for clusters not present are added as new
+// clusters.
+func (o *instanceChangesOperation) applyTo(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, 0, len(clusters))
+	seen := map[string]bool{}
+	for _, c := range clusters {
+		seen[c.Name] = true
+
+		adds := o.adds[c.Name]
+		removes := o.removes[c.Name]
+		if len(adds) == 0 && len(removes) == 0 {
+			result = append(result, c)
+			continue
+		}
+
+		instances := make(api.Instances, 0, len(c.Instances)+len(adds))
+		for _, i := range c.Instances {
+			if _, removed := removes[i.Key()]; removed {
+				continue
+			}
+			if _, replaced := adds[i.Key()]; replaced {
+				continue
+			}
+			instances = append(instances, i)
+		}
+		for _, i := range adds {
+			instances = append(instances, i)
+		}
+		sort.Sort(api.InstancesByHostPort(instances))
+
+		c.Instances = instances
+		result = append(result, c)
+	}
+
+	names := make([]string, 0, len(o.adds))
+	for name := range o.adds {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	added := o.adds.instances()
+	for _, name := range names {
+		instances := added[name]
+		result = append(result, api.Cluster{Name: name, Instances: instances})
+	}
+
+	return result
+}
+
+func (o *instanceChangesOperation) changes() differ.InstanceChanges {
+	return differ.InstanceChanges{
+		Add:    o.adds.instances(),
+		Remove: o.removes.instances(),
+	}
+}
+
+func (o *instanceChangesOperation) execute(u *updater) error {
+	_, err := differ.DiffAndPatchInstances(u.differ, o.changes(), u.diffOpts)
+	return err
+}
+
+var _ changeOperation = &instanceChangesOperation{}
@@ -0,0 +1,367 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/constants"
+)
+
+// NewDraining returns an Updater that delays the removal of Instances by
+// the given Updater for the given period. Until the period expires, removed
+// Instances remain in their Cluster, with the constants.DrainingMetadataKey
+// metadata key set to the time the period expires. An Instance that
+// reappears before its period expires is no longer draining.
+func NewDraining(underlying Updater, period time.Duration) Updater {
+	return &drainingUpdater{
+		Updater:  underlying,
+		period:   period,
+		time:     tbntime.NewSource(),
+		mutex:    &sync.Mutex{},
+		clusters: map[string]api.Cluster{},
+		draining: map[string]*drainingCluster{},
+	}
+}
+
+// drainingCluster holds the draining Instances of a Cluster, keyed by
+// host:port, along with the most recent version of the Cluster, which is
+// used if the Cluster is no longer present.
+type drainingCluster struct {
+	cluster   api.Cluster
+	instances map[string]drainingInstance
+}
+
+type drainingInstance struct {
+	instance api.Instance
+	expires  time.Time
+}
+
+func (dc *drainingCluster) sortedInstances() api.Instances {
+	instances := make(api.Instances, 0, len(dc.instances))
+	for _, di := range dc.instances {
+		instances = append(instances, di.instance)
+	}
+	sort.Sort(api.InstancesByHostPort(instances))
+	return instances
+}
+
+type drainingUpdater struct {
+	Updater
+
+	period time.Duration
+	time   tbntime.Source
+
+	mutex    *sync.Mutex
+	clusters map[string]api.Cluster
+	draining map[string]*drainingCluster
+	timer    tbntime.Timer
+}
+
+var _ Updater = &drainingUpdater{}
+
+func (d *drainingUpdater) Replace(clusters []api.Cluster) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.time.Now()
+	d.expire(now)
+
+	proposed := make(map[string]api.Cluster, len(clusters))
+	for _, c := range clusters {
+		proposed[c.Name] = c
+	}
+
+	for name, c := range d.clusters {
+		keys := instanceKeySet(proposed[name].Instances)
+		for _, i := range c.Instances {
+			if !keys[i.Key()] {
+				d.drain(c, i, now)
+			}
+		}
+	}
+
+	for _, c := range clusters {
+		for _, i := range c.Instances {
+			d.undrain(c.Name, i)
+		}
+	}
+
+	d.clusters = proposed
+	d.schedule(now)
+
+	d.Updater.Replace(d.withDraining(clusters))
+}
+
+func (d *drainingUpdater) AddInstances(cluster string, instances []api.Instance) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c, ok := d.clusters[cluster]
+	if !ok {
+		c = api.Cluster{Name: cluster}
+	}
+
+	added := instanceKeySet(instances)
+	updated := make(api.Instances, 0, len(c.Instances)+len(instances))
+	for _, i := range c.Instances {
+		if !added[i.Key()] {
+			updated = append(updated, i)
+		}
+	}
+	for _, i := range instances {
+		d.undrain(cluster, i)
+		updated = append(updated, i)
+	}
+	sort.Sort(api.InstancesByHostPort(updated))
+
+	c.Instances = updated
+	d.clusters[cluster] = c
+	d.schedule(d.time.Now())
+
+	d.Updater.AddInstances(cluster, instances)
+}
+
+// RemoveInstances marks known Instances as draining by re-adding them with
+// the draining metadata key. Instances that are unknown and not already
+// draining are removed immediately.
+func (d *drainingUpdater) RemoveInstances(cluster string, instances []api.Instance) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.time.Now()
+
+	c, ok := d.clusters[cluster]
+	if !ok {
+		c = api.Cluster{Name: cluster}
+	}
+
+	removing := instanceKeySet(instances)
+	live := make(api.Instances, 0, len(c.Instances))
+	drained := []api.Instance{}
+	for _, i := range c.Instances {
+		if removing[i.Key()] {
+			drained = append(drained, d.drain(c, i, now))
+			delete(removing, i.Key())
+		} else {
+			live = append(live, i)
+		}
+	}
+
+	removed := []api.Instance{}
+	for _, i := range instances {
+		if !removing[i.Key()] {
+			continue
+		}
+		if dc, ok := d.draining[cluster]; ok {
+			if _, ok := dc.instances[i.Key()]; ok {
+				continue
+			}
+		}
+		removed = append(removed, i)
+	}
+
+	if ok {
+		c.Instances = live
+		d.clusters[cluster] = c
+	}
+	d.schedule(now)
+
+	if len(drained) > 0 {
+		d.Updater.AddInstances(cluster, drained)
+	}
+	if len(removed) > 0 {
+		d.Updater.RemoveInstances(cluster, removed)
+	}
+}
+
+func (d *drainingUpdater) Close() error {
+	d.mutex.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.mutex.Unlock()
+
+	return d.Updater.Close()
+}
+
+// drain marks the given Instance of the given Cluster as draining and
+// returns the marked Instance. Instances that are already draining retain
+// their original expiration. Assumes mutex is locked.
+func (d *drainingUpdater) drain(c api.Cluster, i api.Instance, now time.Time) api.Instance {
+	dc, ok := d.draining[c.Name]
+	if !ok {
+		dc = &drainingCluster{instances: map[string]drainingInstance{}}
+		d.draining[c.Name] = dc
+	}
+	c.Instances = nil
+	dc.cluster = c
+
+	if di, ok := dc.instances[i.Key()]; ok {
+		return di.instance
+	}
+
+	expires := now.Add(d.period)
+	di := drainingInstance{instance: markDraining(i, expires), expires: expires}
+	dc.instances[i.Key()] = di
+	return di.instance
+}
+
+// undrain cancels the drain of the given Instance, if any. Assumes mutex is
+// locked.
+func (d *drainingUpdater) undrain(cluster string, i api.Instance) {
+	if dc, ok := d.draining[cluster]; ok {
+		delete(dc.instances, i.Key())
+		if len(dc.instances) == 0 {
+			delete(d.draining, cluster)
+		}
+	}
+}
+
+// expire discards draining Instances whose period has expired, returning
+// them by Cluster name. Assumes mutex is locked.
+func (d *drainingUpdater) expire(now time.Time) map[string]api.Instances {
+	expired := map[string]api.Instances{}
+	for name, dc := range d.draining {
+		for key, di := range dc.instances {
+			if !di.expires.After(now) {
+				expired[name] = append(expired[name], di.instance)
+				delete(dc.instances, key)
+			}
+		}
+		if len(dc.instances) == 0 {
+			delete(d.draining, name)
+		}
+	}
+	return expired
+}
+
+// schedule arranges for removeExpired to be invoked when the next draining
+// Instance expires. Assumes mutex is locked.
+func (d *drainingUpdater) schedule(now time.Time) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+
+	var next time.Time
+	for _, dc := range d.draining {
+		for _, di := range dc.instances {
+			if next.IsZero() || di.expires.Before(next) {
+				next = di.expires
+			}
+		}
+	}
+
+	if !next.IsZero() {
+		d.timer = d.time.AfterFunc(next.Sub(now), d.removeExpired)
+	}
+}
+
+// removeExpired removes expired draining Instances from the underlying
+// Updater.
+func (d *drainingUpdater) removeExpired() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.time.Now()
+	expired := d.expire(now)
+	d.schedule(now)
+
+	names := make([]string, 0, len(expired))
+	for name := range expired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		instances := expired[name]
+		sort.Sort(api.InstancesByHostPort(instances))
+		d.Updater.RemoveInstances(name, instances)
+	}
+}
+
+// withDraining returns a copy of the given Clusters including draining
+// Instances. Clusters that are no longer present but have draining
+// Instances are included with only their draining Instances. Assumes mutex
+// is locked.
+func (d *drainingUpdater) withDraining(clusters []api.Cluster) []api.Cluster {
+	if len(d.draining) == 0 {
+		return clusters
+	}
+
+	result := make([]api.Cluster, 0, len(clusters)+len(d.draining))
+	seen := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		seen[c.Name] = true
+		if dc, ok := d.draining[c.Name]; ok {
+			instances := make(api.Instances, 0, len(c.Instances)+len(dc.instances))
+			instances = append(instances, c.Instances...)
+			instances = append(instances, dc.sortedInstances()...)
+			sort.Sort(api.InstancesByHostPort(instances))
+			c.Instances = instances
+		}
+		result = append(result, c)
+	}
+
+	names := make([]string, 0, len(d.draining))
+	for name := range d.draining {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dc := d.draining[name]
+		c := dc.cluster
+		c.Instances = dc.sortedInstances()
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// markDraining returns a copy of the given Instance with the draining
+// metadata key set to the given expiration time.
+func markDraining(i api.Instance, expires time.Time) api.Instance {
+	metadata := make(api.Metadata, 0, len(i.Metadata)+1)
+	for _, m := range i.Metadata {
+		if m.Key != constants.DrainingMetadataKey {
+			metadata = append(metadata, m)
+		}
+	}
+	metadata = append(metadata, api.Metadatum{
+		Key:   constants.DrainingMetadataKey,
+		Value: expires.UTC().Format(time.RFC3339),
+	})
+	i.Metadata = metadata
+	return i
+}
+
+func instanceKeySet(instances []api.Instance) map[string]bool {
+	keys := make(map[string]bool, len(instances))
+	for _, i := range instances {
+		keys[i.Key()] = true
+	}
+	return keys
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/test/assert"
+)
+
+func draining(i api.Instance, expires time.Time) api.Instance {
+	i.Metadata = append(
+		append(api.Metadata{}, i.Metadata...),
+		api.Metadatum{
+			Key:   constants.DrainingMetadataKey,
+			Value: expires.UTC().Format(time.RFC3339),
+		},
+	)
+	return i
+}
+
+func TestMarkDraining(t *testing.T) {
+	expires := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	i := api.Instance{
+		Host: "h",
+		Port: 1,
+		Metadata: api.Metadata{
+			{Key: "a", Value: "b"},
+			{Key: constants.DrainingMetadataKey, Value: "old"},
+		},
+	}
+
+	got := markDraining(i, expires)
+	assert.DeepEqual(t, got.Metadata, api.Metadata{
+		{Key: "a", Value: "b"},
+		{Key: constants.DrainingMetadataKey, Value: "2018-01-02T03:04:05Z"},
+	})
+	assert.Equal(t, i.Metadata[1].Value, "old")
+}
+
+func TestDrainingUpdaterReplace(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		ctrl := gomock.NewController(assert.Tracing(t))
+		defer ctrl.Finish()
+
+		underlying := NewMockUpdater(ctrl)
+		d := NewDraining(underlying, time.Minute).(*drainingUpdater)
+		d.time = cs
+
+		h1 := c1Instances[0]
+		h2 := c1Instances[1]
+		h2Draining := draining(h2, cs.Now().Add(10*time.Second+time.Minute))
+
+		c1 := api.Cluster{ClusterKey: "key1", Name: "c1", Instances: api.Instances{h1, h2}}
+		c1Live := api.Cluster{ClusterKey: "key1", Name: "c1", Instances: api.Instances{h1}}
+
+		removed := make(chan struct{})
+
+		gomock.InOrder(
+			underlying.EXPECT().Replace([]api.Cluster{c1}),
+			underlying.EXPECT().Replace([]api.Cluster{
+				{ClusterKey: "key1", Name: "c1", Instances: api.Instances{h1, h2Draining}},
+			}),
+			underlying.EXPECT().Replace([]api.Cluster{
+				{
+					ClusterKey: "key1",
+					Name:       "c1",
+					Instances: api.Instances{
+						draining(h1, cs.Now().Add(20*time.Second+time.Minute)),
+						h2Draining,
+					},
+				},
+			}),
+			underlying.EXPECT().Replace([]api.Cluster{
+				{ClusterKey: "key1", Name: "c1", Instances: api.Instances{h1, h2Draining}},
+			}),
+			underlying.EXPECT().
+				RemoveInstances("c1", []api.Instance{h2Draining}).
+				Do(func(_ string, _ []api.Instance) { close(removed) }),
+			underlying.EXPECT().Close().Return(nil),
+		)
+
+		d.Replace([]api.Cluster{c1})
+
+		cs.Advance(10 * time.Second)
+		d.Replace([]api.Cluster{c1Live})
+
+		cs.Advance(10 * time.Second)
+		d.Replace(nil)
+
+		// h1 reappears
+		cs.Advance(10 * time.Second)
+		d.Replace([]api.Cluster{c1Live})
+
+		cs.Advance(time.Minute)
+		<-removed
+
+		assert.Equal(t, len(d.draining), 0)
+		assert.Nil(t, d.Close())
+	})
+}
+
+func TestDrainingUpdaterInstances(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		ctrl := gomock.NewController(assert.Tracing(t))
+		defer ctrl.Finish()
+
+		underlying := NewMockUpdater(ctrl)
+		d := NewDraining(underlying, time.Minute).(*drainingUpdater)
+		d.time = cs
+
+		h1 := c1Instances[0]
+		h2 := c1Instances[1]
+		h3 := api.Instance{Host: "h3", Port: 1}
+		h1Draining := draining(h1, cs.Now().Add(time.Minute))
+		h2Draining := draining(h2, cs.Now().Add(time.Minute))
+
+		removed := make(chan struct{})
+
+		gomock.InOrder(
+			underlying.EXPECT().AddInstances("c1", []api.Instance{h1, h2}),
+			underlying.EXPECT().AddInstances("c1", []api.Instance{h2Draining}),
+			underlying.EXPECT().RemoveInstances("c1", []api.Instance{h3}),
+			underlying.EXPECT().AddInstances("c1", []api.Instance{h2}),
+			underlying.EXPECT().AddInstances("c1", []api.Instance{h1Draining}),
+			underlying.EXPECT().
+				RemoveInstances("c1", []api.Instance{h1Draining}).
+				Do(func(_ string, _ []api.Instance) { close(removed) }),
+		)
+
+		d.AddInstances("c1", []api.Instance{h1, h2})
+		d.RemoveInstances("c1", []api.Instance{{Host: h2.Host, Port: h2.Port}, h3})
+
+		// already draining
+		d.RemoveInstances("c1", []api.Instance{h2})
+
+		// h2 reappears
+		d.AddInstances("c1", []api.Instance{h2})
+		d.RemoveInstances("c1", []api.Instance{h1})
+
+		cs.Advance(time.Minute)
+		<-removed
+
+		assert.Equal(t, len(d.draining), 0)
+		assert.DeepEqual(t, d.clusters["c1"].Instances, api.Instances{h2})
+	})
+}
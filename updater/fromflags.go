@@ -20,24 +20,44 @@ package updater
 
 import (
 	"errors"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/turbinelabs/api"
 	"github.com/turbinelabs/api/service"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/nonstdlib/log/console"
 	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/pkg/audit"
+	"github.com/turbinelabs/rotor/pkg/health"
+	"github.com/turbinelabs/rotor/pkg/leader"
 	"github.com/turbinelabs/rotor/xds/poller"
+	"github.com/turbinelabs/stats"
 )
 
 // FromFlags represents command-line flags specifying configuration of an Updater.
 type FromFlags interface {
 	Validate() error
-	Make(service.All, api.Zone) Updater
+	Make(service.All, api.Zone, stats.Stats) (Updater, error)
 	MakeStandalone(
 		port int,
 		proxyName,
 		zoneName string,
-	) (func(poller.Consumer) Updater, poller.Registrar)
+		stats stats.Stats,
+	) (func(poller.Consumer) Updater, poller.Registrar, error)
+
+	// SetCollectorName sets the name of the collector to which changes
+	// made by Updaters are attributed in audit records.
+	SetCollectorName(string)
+
+	// SetPlanFunc causes Updaters to compute the changes they would make
+	// without applying them. Each time changes would be applied, the
+	// resulting differ.Plan, or the error computing it, is passed to fn.
+	// Leader election and audit records are disabled, and in standalone
+	// mode the state file is loaded but never saved.
+	SetPlanFunc(fn func(differ.Plan, error))
 }
 
 const defaultDelaySeconds = 30
@@ -69,6 +89,10 @@ func NewFromFlags(
 	ff := &fromFlags{
 		flagset:      flagset,
 		diffOpts:     differ.DiffOptsFromFlags(flagset.Scope("diff.", "")),
+		guardOpts:    differ.GuardOptsFromFlags(flagset.Scope("guard", "")),
+		leaderFlags:  leader.NewFromFlags(flagset.Scope("leader", "")),
+		auditFlags:   audit.NewFromFlags(flagset.Scope("audit", "")),
+		healthFlags:  health.NewFromFlags(flagset.Scope("health", "")),
 		defaultDelay: defaultDelaySeconds,
 	}
 
@@ -82,15 +106,49 @@ func NewFromFlags(
 		time.Duration(ff.defaultDelay)*time.Second,
 		"Sets the minimum time between API updates. If the discovery data changes more frequently than this duration, updates are delayed to maintain the minimum time.")
 
+	flagset.DurationVar(
+		&ff.maxRetryDelay,
+		"max-retry-delay",
+		defaultMaxRetryDelay,
+		"Sets the maximum time between retries of failed API updates. Retries are delayed by exponentially increasing multiples of the minimum delay, up to this maximum.")
+
+	flagset.DurationVar(
+		&ff.drainPeriod,
+		"drain-period",
+		0,
+		"If non-zero, instances removed from service discovery remain in their cluster for this period, marked with the \"rotor.draining\" metadata key, before being removed. Instances that reappear during the period are no longer draining.")
+
+	flagset.StringVar(
+		&ff.stateFile,
+		"state-file",
+		"",
+		"In standalone mode, if set, the clusters most recently applied are recorded in this file, and served at startup until clusters are next collected.")
+
+	flagset.DurationVar(
+		&ff.stateMaxAge,
+		"state-max-age",
+		DefaultStateMaxAge,
+		"The maximum age of clusters loaded from --state-file at startup. Older clusters are ignored. If zero, clusters are loaded regardless of age.")
+
 	return ff
 }
 
 type fromFlags struct {
-	flagset      tbnflag.FlagSet
-	diffOpts     *differ.DiffOpts
-	delay        time.Duration
-	defaultDelay int
-	skipMinDelay bool
+	flagset       tbnflag.FlagSet
+	diffOpts      *differ.DiffOpts
+	guardOpts     *differ.GuardOpts
+	leaderFlags   leader.FromFlags
+	auditFlags    audit.FromFlags
+	healthFlags   health.FromFlags
+	collectorName string
+	planFn        func(differ.Plan, error)
+	delay         time.Duration
+	maxRetryDelay time.Duration
+	drainPeriod   time.Duration
+	stateFile     string
+	stateMaxAge   time.Duration
+	defaultDelay  int
+	skipMinDelay  bool
 }
 
 func (ff *fromFlags) Validate() error {
@@ -99,25 +157,149 @@ func (ff *fromFlags) Validate() error {
 			return errors.New("delay may not be less than 1 second")
 		}
 	}
-	return nil
+	if err := ff.leaderFlags.Validate(); err != nil {
+		return err
+	}
+	if err := ff.auditFlags.Validate(); err != nil {
+		return err
+	}
+	return ff.healthFlags.Validate()
+}
+
+func (ff *fromFlags) SetCollectorName(name string) {
+	ff.collectorName = name
 }
 
-func (ff *fromFlags) Make(svc service.All, zone api.Zone) Updater {
-	return New(
-		differ.New(svc.Cluster(), zone.GetZoneKey()),
-		ff.delay,
-		*ff.diffOpts,
-		zone.Name,
-	)
+func (ff *fromFlags) SetPlanFunc(fn func(differ.Plan, error)) {
+	ff.planFn = fn
+}
+
+func (ff *fromFlags) Make(
+	svc service.All,
+	zone api.Zone,
+	statsClient stats.Stats,
+) (Updater, error) {
+	if ff.stateFile != "" {
+		console.Info().Println("--state-file is only used in standalone mode")
+	}
+
+	diffOpts, err := ff.makeDiffOpts(statsClient, zone.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := ff.makeOptions(statsClient)
+	d := differ.New(svc.Cluster(), zone.GetZoneKey())
+
+	if ff.planFn != nil {
+		d = differ.NewPlanner(d, ff.planFn)
+	} else {
+		elector, err := ff.leaderFlags.Make(statsClient)
+		if err != nil {
+			return nil, err
+		}
+		if elector != nil {
+			opts = append(opts, WithElector(elector))
+		}
+	}
+
+	return ff.wrap(New(d, ff.delay, diffOpts, zone.Name, opts...), statsClient), nil
 }
 
 func (ff *fromFlags) MakeStandalone(
 	port int,
 	proxyName,
 	zoneName string,
-) (func(poller.Consumer) Updater, poller.Registrar) {
+	statsClient stats.Stats,
+) (func(poller.Consumer) Updater, poller.Registrar, error) {
+	if ff.leaderFlags.Enabled() {
+		console.Info().Println("leader election is not used in standalone mode")
+	}
+
+	diffOpts, err := ff.makeDiffOpts(statsClient, zoneName)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	newDiffer, reg := differ.NewStandalone(port, proxyName, zoneName)
+	opts := ff.makeOptions(statsClient)
+
+	if ff.planFn != nil {
+		return func(consumer poller.Consumer) Updater {
+			d := newDiffer(consumer)
+			if ff.stateFile != "" {
+				primeDiffer(d, NewStateFile(ff.stateFile, ff.stateMaxAge))
+			}
+			return ff.wrap(
+				New(differ.NewPlanner(d, ff.planFn), ff.delay, diffOpts, "", opts...),
+				statsClient,
+			)
+		}, reg, nil
+	}
+
+	if ff.stateFile != "" {
+		opts = append(opts, WithStateFile(NewStateFile(ff.stateFile, ff.stateMaxAge)))
+	}
+
 	return func(consumer poller.Consumer) Updater {
-		return New(newDiffer(consumer), ff.delay, *ff.diffOpts, "")
-	}, reg
+		return ff.wrap(New(newDiffer(consumer), ff.delay, diffOpts, "", opts...), statsClient)
+	}, reg, nil
+}
+
+func (ff *fromFlags) makeOptions(statsClient stats.Stats) []Option {
+	return []Option{WithStats(statsClient), WithMaxRetryDelay(ff.maxRetryDelay)}
+}
+
+// wrap wraps the given Updater with a draining Updater if a drain period is
+// configured, and then with a health checking Updater if health checking is
+// enabled and changes are not being planned.
+func (ff *fromFlags) wrap(u Updater, statsClient stats.Stats) Updater {
+	if ff.drainPeriod > 0 {
+		u = NewDraining(u, ff.drainPeriod)
+	}
+	if ff.planFn != nil {
+		return u
+	}
+	if checker := ff.healthFlags.Make(statsClient); checker != nil {
+		u = NewHealthChecking(u, checker, ff.healthFlags.Filter())
+	}
+	return u
+}
+
+// makeDiffOpts returns the configured DiffOpts. If any guard limits are
+// configured, a Guard is included, which is overridden each time the
+// process receives SIGUSR1. If any audit sinks are configured, and changes
+// are not being planned, an Auditor attributing changes to the given zone
+// is included.
+func (ff *fromFlags) makeDiffOpts(
+	statsClient stats.Stats,
+	zoneName string,
+) (differ.DiffOpts, error) {
+	diffOpts := *ff.diffOpts
+	if !ff.guardOpts.IsEmpty() {
+		diffOpts.Guard = differ.NewGuard(*ff.guardOpts, statsClient)
+		overrideOnSignal(diffOpts.Guard)
+	}
+
+	if ff.planFn != nil {
+		return diffOpts, nil
+	}
+
+	auditor, err := ff.auditFlags.Make(zoneName, ff.collectorName)
+	if err != nil {
+		return differ.DiffOpts{}, err
+	}
+	diffOpts.Auditor = auditor
+
+	return diffOpts, nil
+}
+
+func overrideOnSignal(guard differ.Guard) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGUSR1)
+	go func() {
+		for range signalCh {
+			guard.Override()
+		}
+	}()
 }
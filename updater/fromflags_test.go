@@ -17,20 +17,36 @@ limitations under the License.
 package updater
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/xds/poller"
 	"github.com/turbinelabs/test/assert"
 )
 
 func TestNewFromFlags(t *testing.T) {
 	flagset := tbnflag.NewTestFlagSet()
 	ff := NewFromFlags(flagset)
-	flagset.Parse([]string{"-delay=1m"})
+	flagset.Parse([]string{
+		"-delay=1m",
+		"-max-retry-delay=10m",
+		"-state-file=/tmp/state.json",
+		"-state-max-age=2h",
+	})
 	ffImpl := ff.(*fromFlags)
 	assert.NonNil(t, ffImpl.diffOpts)
 	assert.Equal(t, ffImpl.delay, 60*time.Second)
+	assert.Equal(t, ffImpl.maxRetryDelay, 10*time.Minute)
+	assert.Equal(t, ffImpl.stateFile, "/tmp/state.json")
+	assert.Equal(t, ffImpl.stateMaxAge, 2*time.Hour)
 }
 
 func TestNewFromFlagsDefault(t *testing.T) {
@@ -61,3 +77,138 @@ func TestFromFlagsValidateSkipMinDelay(t *testing.T) {
 	ffImpl := ff.(*fromFlags)
 	assert.Equal(t, ffImpl.delay, 500*time.Millisecond)
 }
+
+func TestFromFlagsMakeDiffOpts(t *testing.T) {
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset).(*fromFlags)
+
+	diffOpts, err := ff.makeDiffOpts(nil, "zone")
+	assert.Nil(t, err)
+	assert.Nil(t, diffOpts.Guard)
+	assert.Nil(t, diffOpts.Auditor)
+
+	flagset.Parse([]string{
+		"-guard.max-total-removal-percent=50",
+		"-guard.window=1m",
+		"-audit.stdout",
+	})
+	assert.Equal(t, *ff.guardOpts, differ.GuardOpts{
+		MaxTotalRemovalPercent: 50,
+		Window:                 time.Minute,
+	})
+	diffOpts, err = ff.makeDiffOpts(nil, "zone")
+	assert.Nil(t, err)
+	assert.NonNil(t, diffOpts.Guard)
+	assert.NonNil(t, diffOpts.Auditor)
+}
+
+func TestFromFlagsMakeDiffOptsAuditError(t *testing.T) {
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset).(*fromFlags)
+	flagset.Parse([]string{"-audit.file=/nonexistent/dir/audit.log"})
+
+	_, err := ff.makeDiffOpts(nil, "zone")
+	assert.NonNil(t, err)
+}
+
+func TestFromFlagsValidateLeader(t *testing.T) {
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset)
+	flagset.Parse([]string{"-leader.backend=file"})
+	assert.ErrorContains(t, ff.Validate(), "--leader.file must be specified")
+}
+
+func TestFromFlagsValidateHealth(t *testing.T) {
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset)
+	flagset.Parse([]string{"-health.enabled", "-health.concurrency=0"})
+	assert.ErrorContains(t, ff.Validate(), "--health.concurrency must be at least 1")
+}
+
+func TestFromFlagsWrapHealth(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset).(*fromFlags)
+	underlying := NewMockUpdater(ctrl)
+
+	assert.SameInstance(t, ff.wrap(underlying, nil), underlying)
+
+	flagset.Parse([]string{"-health.enabled", "-drain-period=1m"})
+
+	u := ff.wrap(underlying, nil)
+	hu, ok := u.(*healthCheckingUpdater)
+	assert.True(t, ok)
+	_, ok = hu.Updater.(*drainingUpdater)
+	assert.True(t, ok)
+	assert.Nil(t, hu.checker.Close())
+
+	ff.SetPlanFunc(func(differ.Plan, error) {})
+	_, ok = ff.wrap(underlying, nil).(*drainingUpdater)
+	assert.True(t, ok)
+}
+
+func TestFromFlagsMakeDiffOptsPlan(t *testing.T) {
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset).(*fromFlags)
+	flagset.Parse([]string{"-audit.stdout"})
+	ff.SetPlanFunc(func(differ.Plan, error) {})
+
+	diffOpts, err := ff.makeDiffOpts(nil, "zone")
+	assert.Nil(t, err)
+	assert.Nil(t, diffOpts.Auditor)
+}
+
+func TestFromFlagsMakeStandalonePlan(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "updater")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	saved := []api.Cluster{
+		{Name: "foo", Instances: api.Instances{{Host: "a", Port: 80}}},
+	}
+	assert.Nil(t, NewStateFile(path, 0).Save(saved))
+
+	flagset := tbnflag.NewTestFlagSet()
+	ff := NewFromFlags(flagset)
+	flagset.Parse([]string{"-state-file=" + path})
+
+	var plans []differ.Plan
+	ff.SetPlanFunc(func(plan differ.Plan, err error) {
+		assert.Nil(t, err)
+		plans = append(plans, plan)
+	})
+
+	newUpdater, _, err := ff.MakeStandalone(80, "proxy", "zone", nil)
+	assert.Nil(t, err)
+
+	consumer := poller.NewMockConsumer(ctrl)
+	consumer.EXPECT().Consume(gomock.Any()).Return(nil)
+
+	u := newUpdater(consumer)
+	defer u.Close()
+
+	u.Replace([]api.Cluster{
+		{Name: "foo", Instances: api.Instances{{Host: "b", Port: 80}}},
+	})
+
+	assert.DeepEqual(t, plans, []differ.Plan{
+		{
+			{
+				Name:    "foo",
+				Action:  differ.PlanModify,
+				Added:   api.Instances{{Host: "b", Port: 80}},
+				Removed: api.Instances{{Host: "a", Port: 80}},
+			},
+		},
+	})
+
+	loaded, err := NewStateFile(path, 0).Load()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, loaded, saved)
+}
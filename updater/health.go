@@ -0,0 +1,250 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/pkg/health"
+)
+
+// NewHealthChecking returns an Updater that probes the Instances of the
+// Clusters it is given with the given health.Checker. Instances are passed
+// to the given Updater with the constants.HealthMetadataKey metadata key
+// set once their health is known or, if filter is true, unhealthy
+// Instances are omitted. Each time the health of an Instance changes, it is
+// passed to the given Updater's AddInstances or, if it has become unhealthy
+// and filter is true, RemoveInstances. The Updater closes the
+// health.Checker when it is closed.
+func NewHealthChecking(underlying Updater, checker health.Checker, filter bool) Updater {
+	h := &healthCheckingUpdater{
+		Updater:  underlying,
+		checker:  checker,
+		filter:   filter,
+		clusters: map[string]api.Cluster{},
+		status:   map[string]map[string]health.Status{},
+	}
+	checker.Notify(h.healthChanged)
+	return h
+}
+
+type healthCheckingUpdater struct {
+	Updater
+
+	checker health.Checker
+	filter  bool
+
+	mutex    sync.Mutex
+	clusters map[string]api.Cluster
+
+	// status is the health of each Instance, by Cluster name and Instance
+	// key, as last passed to the underlying Updater.
+	status map[string]map[string]health.Status
+}
+
+var _ Updater = &healthCheckingUpdater{}
+
+func (h *healthCheckingUpdater) Replace(clusters []api.Cluster) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.clusters = make(map[string]api.Cluster, len(clusters))
+	for _, c := range clusters {
+		h.clusters[c.Name] = c
+	}
+	h.checker.SetClusters(clusters)
+
+	h.status = make(map[string]map[string]health.Status, len(clusters))
+	h.Updater.Replace(h.withHealth(clusters))
+}
+
+func (h *healthCheckingUpdater) AddInstances(cluster string, instances []api.Instance) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c, ok := h.clusters[cluster]
+	if !ok {
+		c = api.Cluster{Name: cluster}
+	}
+
+	added := instanceKeySet(instances)
+	updated := make(api.Instances, 0, len(c.Instances)+len(instances))
+	for _, i := range c.Instances {
+		if !added[i.Key()] {
+			updated = append(updated, i)
+		}
+	}
+	updated = append(updated, instances...)
+	sort.Sort(api.InstancesByHostPort(updated))
+
+	c.Instances = updated
+	h.clusters[cluster] = c
+	h.checker.SetClusters(h.sortedClusters())
+
+	h.emit(cluster, instances)
+}
+
+func (h *healthCheckingUpdater) RemoveInstances(cluster string, instances []api.Instance) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if c, ok := h.clusters[cluster]; ok {
+		removed := instanceKeySet(instances)
+		remaining := make(api.Instances, 0, len(c.Instances))
+		for _, i := range c.Instances {
+			if !removed[i.Key()] {
+				remaining = append(remaining, i)
+			}
+		}
+		c.Instances = remaining
+		h.clusters[cluster] = c
+		h.checker.SetClusters(h.sortedClusters())
+	}
+
+	for _, i := range instances {
+		delete(h.status[cluster], i.Key())
+	}
+
+	h.Updater.RemoveInstances(cluster, instances)
+}
+
+func (h *healthCheckingUpdater) Close() error {
+	h.checker.Close()
+	return h.Updater.Close()
+}
+
+// healthChanged passes the Instances whose health changed to the
+// underlying Updater. Replace is never used, since Clusters known only
+// through AddInstances lack the rest of their configuration.
+func (h *healthCheckingUpdater) healthChanged() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, c := range h.sortedClusters() {
+		changed := api.Instances{}
+		for _, i := range c.Instances {
+			if h.checker.Status(c.Name, i) != h.status[c.Name][i.Key()] {
+				changed = append(changed, i)
+			}
+		}
+
+		if len(changed) > 0 {
+			h.emit(c.Name, changed)
+		}
+	}
+}
+
+// emit passes the given Instances of the named Cluster, marked with their
+// health, to the underlying Updater's AddInstances. If filtering, Instances
+// that have become unhealthy are passed to RemoveInstances instead. Assumes
+// mutex is locked.
+func (h *healthCheckingUpdater) emit(cluster string, instances api.Instances) {
+	added := make(api.Instances, 0, len(instances))
+	removed := api.Instances{}
+	for _, i := range instances {
+		previous, seen := h.status[cluster][i.Key()]
+		if marked, ok := h.markInstance(cluster, i); ok {
+			added = append(added, marked)
+		} else if seen && previous != health.Unhealthy {
+			removed = append(removed, i)
+		}
+	}
+
+	if len(added) > 0 {
+		h.Updater.AddInstances(cluster, added)
+	}
+	if len(removed) > 0 {
+		h.Updater.RemoveInstances(cluster, removed)
+	}
+}
+
+// sortedClusters returns the most recently given Clusters, sorted by name.
+// Assumes mutex is locked.
+func (h *healthCheckingUpdater) sortedClusters() []api.Cluster {
+	clusters := make([]api.Cluster, 0, len(h.clusters))
+	for _, c := range h.clusters {
+		clusters = append(clusters, c)
+	}
+	sort.Sort(api.ClusterByName(clusters))
+	return clusters
+}
+
+// withHealth returns a copy of the given Clusters with the health of each
+// Instance applied. Assumes mutex is locked.
+func (h *healthCheckingUpdater) withHealth(clusters []api.Cluster) []api.Cluster {
+	result := make([]api.Cluster, len(clusters))
+	for idx, c := range clusters {
+		c.Instances = h.instancesWithHealth(c.Name, c.Instances)
+		result[idx] = c
+	}
+	return result
+}
+
+// instancesWithHealth returns copies of the given Instances of the named
+// Cluster marked with their health, omitting unhealthy Instances if
+// filtering. Assumes mutex is locked.
+func (h *healthCheckingUpdater) instancesWithHealth(
+	cluster string,
+	instances api.Instances,
+) api.Instances {
+	result := make(api.Instances, 0, len(instances))
+	for _, i := range instances {
+		if marked, ok := h.markInstance(cluster, i); ok {
+			result = append(result, marked)
+		}
+	}
+	return result
+}
+
+// markInstance records the health of the given Instance of the named
+// Cluster and returns a copy marked with it. It returns false if the
+// Instance is unhealthy and filtering. Assumes mutex is locked.
+func (h *healthCheckingUpdater) markInstance(cluster string, i api.Instance) (api.Instance, bool) {
+	status := h.checker.Status(cluster, i)
+	if h.status[cluster] == nil {
+		h.status[cluster] = map[string]health.Status{}
+	}
+	h.status[cluster][i.Key()] = status
+
+	switch status {
+	case health.Healthy:
+		return markHealth(i, constants.HealthyMetadataValue), true
+	case health.Unhealthy:
+		if h.filter {
+			return i, false
+		}
+		return markHealth(i, constants.UnhealthyMetadataValue), true
+	}
+	return i, true
+}
+
+// markHealth returns a copy of the given Instance with the health metadata
+// key set to the given value.
+func markHealth(i api.Instance, value string) api.Instance {
+	metadata := make(api.Metadata, 0, len(i.Metadata)+1)
+	for _, m := range i.Metadata {
+		if m.Key != constants.HealthMetadataKey {
+			metadata = append(metadata, m)
+		}
+	}
+	metadata = append(metadata, api.Metadatum{Key: constants.HealthMetadataKey, Value: value})
+	i.Metadata = metadata
+	return i
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/pkg/health"
+	"github.com/turbinelabs/test/assert"
+)
+
+// fakeChecker reports the configured health of Instances, keyed by
+// cluster and host:port, and records the Clusters it is given.
+type fakeChecker struct {
+	mutex    sync.Mutex
+	status   map[string]health.Status
+	clusters []api.Cluster
+	notify   func()
+	closed   bool
+}
+
+func newFakeChecker() *fakeChecker {
+	return &fakeChecker{status: map[string]health.Status{}}
+}
+
+func (c *fakeChecker) set(cluster string, i api.Instance, s health.Status) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.status[cluster+"/"+i.Key()] = s
+}
+
+func (c *fakeChecker) SetClusters(clusters []api.Cluster) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clusters = clusters
+}
+
+func (c *fakeChecker) Status(cluster string, i api.Instance) health.Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.status[cluster+"/"+i.Key()]
+}
+
+func (c *fakeChecker) Notify(f func()) {
+	c.notify = f
+}
+
+func (c *fakeChecker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func withHealth(i api.Instance, value string) api.Instance {
+	i.Metadata = append(
+		append(api.Metadata{}, i.Metadata...),
+		api.Metadatum{Key: constants.HealthMetadataKey, Value: value},
+	)
+	return i
+}
+
+func TestMarkHealth(t *testing.T) {
+	i := api.Instance{
+		Host: "h",
+		Port: 1,
+		Metadata: api.Metadata{
+			{Key: constants.HealthMetadataKey, Value: "old"},
+			{Key: "a", Value: "b"},
+		},
+	}
+
+	got := markHealth(i, constants.HealthyMetadataValue)
+	assert.DeepEqual(t, got.Metadata, api.Metadata{
+		{Key: "a", Value: "b"},
+		{Key: constants.HealthMetadataKey, Value: constants.HealthyMetadataValue},
+	})
+	assert.Equal(t, i.Metadata[0].Value, "old")
+}
+
+func TestHealthCheckingUpdaterReplace(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	underlying := NewMockUpdater(ctrl)
+	checker := newFakeChecker()
+	u := NewHealthChecking(underlying, checker, false)
+
+	h1 := c1Instances[0]
+	h2 := c1Instances[1]
+	c1 := api.Cluster{ClusterKey: "key1", Name: "c1", Instances: api.Instances{h1, h2}}
+
+	checker.set("c1", h1, health.Healthy)
+
+	gomock.InOrder(
+		underlying.EXPECT().Replace([]api.Cluster{
+			{
+				ClusterKey: "key1",
+				Name:       "c1",
+				Instances:  api.Instances{withHealth(h1, constants.HealthyMetadataValue), h2},
+			},
+		}),
+		underlying.EXPECT().AddInstances(
+			"c1",
+			[]api.Instance{withHealth(h2, constants.UnhealthyMetadataValue)},
+		),
+		underlying.EXPECT().Close().Return(nil),
+	)
+
+	u.Replace([]api.Cluster{c1})
+	assert.DeepEqual(t, checker.clusters, []api.Cluster{c1})
+
+	checker.set("c1", h2, health.Unhealthy)
+	checker.notify()
+
+	assert.Nil(t, u.Close())
+	assert.True(t, checker.closed)
+}
+
+func TestHealthCheckingUpdaterFilter(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	underlying := NewMockUpdater(ctrl)
+	checker := newFakeChecker()
+	u := NewHealthChecking(underlying, checker, true)
+
+	h1 := c1Instances[0]
+	h2 := c1Instances[1]
+
+	checker.set("c1", h2, health.Unhealthy)
+
+	gomock.InOrder(
+		underlying.EXPECT().Replace([]api.Cluster{
+			{Name: "c1", Instances: api.Instances{h1}},
+		}),
+		underlying.EXPECT().AddInstances(
+			"c1",
+			[]api.Instance{withHealth(h2, constants.HealthyMetadataValue)},
+		),
+		underlying.EXPECT().RemoveInstances("c1", []api.Instance{h2}),
+	)
+
+	u.Replace([]api.Cluster{{Name: "c1", Instances: api.Instances{h1, h2}}})
+
+	checker.set("c1", h2, health.Healthy)
+	checker.notify()
+
+	checker.set("c1", h2, health.Unhealthy)
+	checker.notify()
+
+	// no changes, no updates
+	checker.notify()
+}
+
+func TestHealthCheckingUpdaterInstances(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	underlying := NewMockUpdater(ctrl)
+	checker := newFakeChecker()
+	u := NewHealthChecking(underlying, checker, true)
+
+	h1 := c1Instances[0]
+	h2 := c1Instances[1]
+
+	checker.set("c1", h1, health.Healthy)
+	checker.set("c1", h2, health.Unhealthy)
+
+	gomock.InOrder(
+		underlying.EXPECT().AddInstances(
+			"c1",
+			[]api.Instance{withHealth(h1, constants.HealthyMetadataValue)},
+		),
+		underlying.EXPECT().RemoveInstances("c1", []api.Instance{h1}),
+		underlying.EXPECT().AddInstances(
+			"c1",
+			[]api.Instance{withHealth(h2, constants.HealthyMetadataValue)},
+		),
+	)
+
+	u.AddInstances("c1", []api.Instance{h1, h2})
+	assert.DeepEqual(t, checker.clusters, []api.Cluster{
+		{Name: "c1", Instances: api.Instances{h1, h2}},
+	})
+
+	// all instances are unhealthy, so nothing is added
+	u.AddInstances("c1", []api.Instance{h2})
+
+	u.RemoveInstances("c1", []api.Instance{h1})
+	assert.DeepEqual(t, checker.clusters, []api.Cluster{
+		{Name: "c1", Instances: api.Instances{h2}},
+	})
+
+	// c1 is known only through AddInstances, so health changes must not
+	// replace it
+	checker.notify()
+	checker.set("c1", h2, health.Healthy)
+	checker.notify()
+}
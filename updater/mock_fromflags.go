@@ -7,7 +7,9 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	api "github.com/turbinelabs/api"
 	service "github.com/turbinelabs/api/service"
+	differ "github.com/turbinelabs/rotor/differ"
 	poller "github.com/turbinelabs/rotor/xds/poller"
+	stats "github.com/turbinelabs/stats"
 	reflect "reflect"
 )
 
@@ -47,26 +49,48 @@ func (mr *MockFromFlagsMockRecorder) Validate() *gomock.Call {
 }
 
 // Make mocks base method
-func (m *MockFromFlags) Make(arg0 service.All, arg1 api.Zone) Updater {
-	ret := m.ctrl.Call(m, "Make", arg0, arg1)
+func (m *MockFromFlags) Make(arg0 service.All, arg1 api.Zone, arg2 stats.Stats) (Updater, error) {
+	ret := m.ctrl.Call(m, "Make", arg0, arg1, arg2)
 	ret0, _ := ret[0].(Updater)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Make indicates an expected call of Make
-func (mr *MockFromFlagsMockRecorder) Make(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Make", reflect.TypeOf((*MockFromFlags)(nil).Make), arg0, arg1)
+func (mr *MockFromFlagsMockRecorder) Make(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Make", reflect.TypeOf((*MockFromFlags)(nil).Make), arg0, arg1, arg2)
 }
 
 // MakeStandalone mocks base method
-func (m *MockFromFlags) MakeStandalone(port int, proxyName, zoneName string) (func(poller.Consumer) Updater, poller.Registrar) {
-	ret := m.ctrl.Call(m, "MakeStandalone", port, proxyName, zoneName)
+func (m *MockFromFlags) MakeStandalone(port int, proxyName, zoneName string, stats stats.Stats) (func(poller.Consumer) Updater, poller.Registrar, error) {
+	ret := m.ctrl.Call(m, "MakeStandalone", port, proxyName, zoneName, stats)
 	ret0, _ := ret[0].(func(poller.Consumer) Updater)
 	ret1, _ := ret[1].(poller.Registrar)
-	return ret0, ret1
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // MakeStandalone indicates an expected call of MakeStandalone
-func (mr *MockFromFlagsMockRecorder) MakeStandalone(port, proxyName, zoneName interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeStandalone", reflect.TypeOf((*MockFromFlags)(nil).MakeStandalone), port, proxyName, zoneName)
+func (mr *MockFromFlagsMockRecorder) MakeStandalone(port, proxyName, zoneName, stats interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MakeStandalone", reflect.TypeOf((*MockFromFlags)(nil).MakeStandalone), port, proxyName, zoneName, stats)
+}
+
+// SetCollectorName mocks base method
+func (m *MockFromFlags) SetCollectorName(arg0 string) {
+	m.ctrl.Call(m, "SetCollectorName", arg0)
+}
+
+// SetCollectorName indicates an expected call of SetCollectorName
+func (mr *MockFromFlagsMockRecorder) SetCollectorName(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCollectorName", reflect.TypeOf((*MockFromFlags)(nil).SetCollectorName), arg0)
+}
+
+// SetPlanFunc mocks base method
+func (m *MockFromFlags) SetPlanFunc(fn func(differ.Plan, error)) {
+	m.ctrl.Call(m, "SetPlanFunc", fn)
+}
+
+// SetPlanFunc indicates an expected call of SetPlanFunc
+func (mr *MockFromFlagsMockRecorder) SetPlanFunc(fn interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPlanFunc", reflect.TypeOf((*MockFromFlags)(nil).SetPlanFunc), fn)
 }
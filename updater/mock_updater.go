@@ -43,6 +43,26 @@ func (mr *MockUpdaterMockRecorder) Replace(clusters interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replace", reflect.TypeOf((*MockUpdater)(nil).Replace), clusters)
 }
 
+// AddInstances mocks base method
+func (m *MockUpdater) AddInstances(cluster string, instances []api.Instance) {
+	m.ctrl.Call(m, "AddInstances", cluster, instances)
+}
+
+// AddInstances indicates an expected call of AddInstances
+func (mr *MockUpdaterMockRecorder) AddInstances(cluster, instances interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddInstances", reflect.TypeOf((*MockUpdater)(nil).AddInstances), cluster, instances)
+}
+
+// RemoveInstances mocks base method
+func (m *MockUpdater) RemoveInstances(cluster string, instances []api.Instance) {
+	m.ctrl.Call(m, "RemoveInstances", cluster, instances)
+}
+
+// RemoveInstances indicates an expected call of RemoveInstances
+func (mr *MockUpdaterMockRecorder) RemoveInstances(cluster, instances interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveInstances", reflect.TypeOf((*MockUpdater)(nil).RemoveInstances), cluster, instances)
+}
+
 // Delay mocks base method
 func (m *MockUpdater) Delay() time.Duration {
 	ret := m.ctrl.Call(m, "Delay")
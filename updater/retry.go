@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	httperr "github.com/turbinelabs/api/http/error"
+	"github.com/turbinelabs/rotor/differ"
+)
+
+const (
+	// maxConflictRetries is the number of times an operation that fails
+	// due to a checksum conflict is immediately re-diffed and retried.
+	maxConflictRetries = 3
+
+	defaultMaxRetryDelay = 5 * time.Minute
+
+	updateStat                    = "update"
+	updateLatencyStat             = "update.latency"
+	updateLastSuccessStat         = "update.last_success"
+	updateConsecutiveFailuresStat = "update.consecutive_failures"
+	resultTag                     = "result"
+)
+
+// errorClass categorizes the result of a changeOperation.
+type errorClass string
+
+const (
+	// success indicates the operation succeeded.
+	success errorClass = "success"
+
+	// refusedError indicates the operation was refused by a
+	// differ.Guard. It is not retried.
+	refusedError errorClass = "refused"
+
+	// conflictError indicates the operation was made against an
+	// out-of-date Cluster. It is re-diffed and retried immediately.
+	conflictError errorClass = "conflict"
+
+	// retryableError indicates a transient failure, such as a network
+	// error or server error. It is retried with backoff.
+	retryableError errorClass = "retryable"
+
+	// fatalError indicates a failure that will not succeed if retried,
+	// such as an invalid request. It is not retried.
+	fatalError errorClass = "fatal"
+)
+
+// classifyError returns the errorClass of the given error. Errors that
+// cannot be classified are assumed to be retryable.
+func classifyError(err error) errorClass {
+	if err == nil {
+		return success
+	}
+
+	if differ.IsGuardError(err) {
+		return refusedError
+	}
+
+	switch e := err.(type) {
+	case *httperr.Error:
+		switch {
+		case e.Status == http.StatusConflict,
+			e.Code == httperr.UnknownModificationConflict:
+			return conflictError
+
+		case e.Code == httperr.UnknownTransportCode,
+			e.Status == http.StatusTooManyRequests,
+			e.Status >= http.StatusInternalServerError:
+			return retryableError
+
+		case e.Status >= http.StatusBadRequest:
+			return fatalError
+		}
+
+	case net.Error:
+		return retryableError
+	}
+
+	return retryableError
+}
+
+// WithMaxRetryDelay sets the maximum delay between retries of failed
+// updates. Retries are delayed by exponentially increasing multiples of the
+// Updater's minimum delay, up to this maximum, plus up to 50% jitter.
+func WithMaxRetryDelay(d time.Duration) Option {
+	return func(u *updater) {
+		u.maxRetryDelay = d
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	httperr "github.com/turbinelabs/api/http/error"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/stats"
+	"github.com/turbinelabs/test/assert"
+)
+
+// sequenceChangeOperation returns each of its errors in turn, and nil
+// thereafter.
+type sequenceChangeOperation struct {
+	errs         []error
+	executeCalls int
+}
+
+func (s *sequenceChangeOperation) execute(u *updater) error {
+	s.executeCalls++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *sequenceChangeOperation) canMerge(other changeOperation) bool { return false }
+
+func (s *sequenceChangeOperation) merge(other changeOperation) changeOperation { return nil }
+
+func noJitter(d time.Duration) time.Duration { return d }
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want errorClass
+	}{
+		{nil, success},
+		{&differ.GuardError{}, refusedError},
+		{httperr.New409("conflict", httperr.UnknownModificationConflict), conflictError},
+		{httperr.New400("conflict", httperr.UnknownModificationConflict), conflictError},
+		{httperr.New500("boom", httperr.MiscErrorCode), retryableError},
+		{&httperr.Error{Status: 503}, retryableError},
+		{&httperr.Error{Status: 429}, retryableError},
+		{httperr.New400("transport", httperr.UnknownTransportCode), retryableError},
+		{httperr.New400("bad", httperr.InvalidObjectErrorCode), fatalError},
+		{httperr.New404("missing", httperr.NotFoundErrorCode), fatalError},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, retryableError},
+		{errors.New("boom"), retryableError},
+	}
+
+	for _, tc := range testCases {
+		assert.Group(fmt.Sprintf("%v", tc.err), t, func(g *assert.G) {
+			assert.Equal(g, classifyError(tc.err), tc.want)
+		})
+	}
+}
+
+func TestUpdaterRetriesWithRealTimer(t *testing.T) {
+	u := New(nil, 10*time.Millisecond, differ.DiffOpts{}, "")
+
+	boom := errors.New("boom")
+	op := &sequenceChangeOperation{errs: []error{boom, boom}}
+
+	u.mutex.Lock()
+	u.changeOps = []changeOperation{op}
+	u.updateApi(u)
+	u.mutex.Unlock()
+
+	executeCalls := func() int {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		return op.executeCalls
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for executeCalls() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	assert.Equal(t, op.executeCalls, 3)
+	assert.Equal(t, u.failures, 0)
+	assert.Equal(t, len(u.changeOps), 0)
+	assert.Nil(t, u.timer)
+}
+
+func TestUpdaterRetryDelayIsAtLeastDelay(t *testing.T) {
+	u := New(nil, 30*time.Second, differ.DiffOpts{}, "")
+
+	boom := errors.New("boom")
+	op := &sequenceChangeOperation{errs: []error{boom}}
+	u.changeOps = []changeOperation{op}
+
+	var delay time.Duration
+	u.updateApiAfter = func(_ *updater, d time.Duration) {
+		delay = d
+	}
+
+	u.updateApi(u)
+
+	assert.GreaterThanEqual(t, delay, 30*time.Second)
+	assert.LessThanEqual(t, delay, 45*time.Second)
+}
+
+func TestUpdaterUpdateApiBackoff(t *testing.T) {
+	u := New(nil, 30*time.Second, differ.DiffOpts{}, "", WithMaxRetryDelay(100*time.Second))
+	u.jitter = noJitter
+
+	boom := errors.New("boom")
+	op := &sequenceChangeOperation{errs: []error{boom, boom, boom, boom}}
+	u.changeOps = []changeOperation{op}
+
+	delays := []time.Duration{}
+	u.updateApiAfter = func(_ *updater, delay time.Duration) {
+		delays = append(delays, delay)
+	}
+
+	for i := 0; i < 5; i++ {
+		u.lastUpdate = time.Time{}
+		u.updateApi(u)
+	}
+
+	assert.ArrayEqual(t, delays, []time.Duration{
+		30 * time.Second,
+		60 * time.Second,
+		100 * time.Second,
+		100 * time.Second,
+	})
+	assert.Equal(t, op.executeCalls, 5)
+	assert.Equal(t, u.failures, 0)
+	assert.Equal(t, len(u.changeOps), 0)
+}
+
+func TestUpdaterUpdateApiConflictRediffs(t *testing.T) {
+	u := makeUpdater(time.Time{})
+
+	conflict := httperr.New409("conflict", httperr.UnknownModificationConflict)
+	op := &sequenceChangeOperation{errs: []error{conflict, conflict}}
+	u.changeOps = []changeOperation{op}
+
+	updateApiAfterCalls := 0
+	u.updateApiAfter = func(_ *updater, delay time.Duration) {
+		updateApiAfterCalls++
+	}
+
+	u.updateApi(u)
+
+	assert.Equal(t, op.executeCalls, 3)
+	assert.Equal(t, updateApiAfterCalls, 0)
+	assert.Equal(t, len(u.changeOps), 0)
+
+	// persistent conflicts are retried later
+	op = &sequenceChangeOperation{
+		errs: []error{conflict, conflict, conflict, conflict, conflict},
+	}
+	u.changeOps = []changeOperation{op}
+	u.lastUpdate = time.Time{}
+
+	u.updateApi(u)
+
+	assert.Equal(t, op.executeCalls, maxConflictRetries+1)
+	assert.Equal(t, updateApiAfterCalls, 1)
+	assert.Equal(t, u.failures, 1)
+	assert.DeepEqual(t, u.changeOps, []changeOperation{op})
+}
+
+func TestUpdaterUpdateApiDropsFatalOp(t *testing.T) {
+	u := makeUpdater(time.Time{})
+
+	fakeOp1 := &fakeChangeOperation{
+		executeError: httperr.New400("bad", httperr.InvalidObjectErrorCode),
+	}
+	fakeOp2 := &fakeChangeOperation{}
+	u.changeOps = []changeOperation{fakeOp1, fakeOp2}
+
+	updateApiAfterCalls := 0
+	u.updateApiAfter = func(_ *updater, delay time.Duration) {
+		updateApiAfterCalls++
+	}
+
+	u.updateApi(u)
+
+	assert.Equal(t, fakeOp1.executeCalls, 1)
+	assert.Equal(t, fakeOp2.executeCalls, 1)
+	assert.Equal(t, len(u.changeOps), 0)
+	assert.Equal(t, updateApiAfterCalls, 0)
+}
+
+func TestUpdaterUpdateApiStats(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	s := stats.NewMockStats(ctrl)
+	u := New(nil, 30*time.Second, differ.DiffOpts{}, "", WithStats(s))
+	u.updateApiAfter = func(_ *updater, delay time.Duration) {}
+
+	op := &sequenceChangeOperation{errs: []error{errors.New("boom")}}
+	u.changeOps = []changeOperation{op}
+
+	retryable := stats.NewKVTag(resultTag, "retryable")
+	succeeded := stats.NewKVTag(resultTag, "success")
+
+	gomock.InOrder(
+		s.EXPECT().Count(updateStat, 1.0, retryable),
+		s.EXPECT().Timing(updateLatencyStat, gomock.Any(), retryable),
+		s.EXPECT().Gauge(updateConsecutiveFailuresStat, 1.0),
+		s.EXPECT().Count(updateStat, 1.0, succeeded),
+		s.EXPECT().Timing(updateLatencyStat, gomock.Any(), succeeded),
+		s.EXPECT().Gauge(updateConsecutiveFailuresStat, 0.0),
+		s.EXPECT().Gauge(updateLastSuccessStat, gomock.Any()).Do(
+			func(_ string, v float64, _ ...stats.Tag) {
+				assert.True(t, v >= float64(time.Now().Add(-time.Minute).Unix()))
+			},
+		),
+	)
+
+	u.updateApi(u)
+	u.lastUpdate = time.Time{}
+	u.updateApi(u)
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/differ"
+)
+
+// DefaultStateMaxAge is the default maximum age of a StateFile.
+const DefaultStateMaxAge = time.Hour
+
+// StateFile records the clusters most recently applied by an Updater, so
+// that they may be served after a restart until clusters are next
+// collected.
+type StateFile interface {
+	// Load returns the recorded clusters. If the file does not exist, or
+	// was saved longer ago than the file's maximum age, Load returns nil
+	// clusters and no error.
+	Load() ([]api.Cluster, error)
+
+	// Save records the given clusters. The file is replaced atomically, so
+	// that a failed Save leaves the previously saved clusters intact.
+	Save([]api.Cluster) error
+}
+
+// NewStateFile returns a StateFile at the given path. Clusters saved longer
+// ago than maxAge are not loaded. If maxAge is zero, clusters are loaded
+// regardless of age.
+func NewStateFile(path string, maxAge time.Duration) StateFile {
+	return &stateFile{path: path, maxAge: maxAge, time: tbntime.NewSource()}
+}
+
+type stateFile struct {
+	path   string
+	maxAge time.Duration
+	time   tbntime.Source
+}
+
+// savedState is the JSON representation of a StateFile.
+type savedState struct {
+	SavedAt  time.Time     `json:"saved_at"`
+	Clusters []api.Cluster `json:"clusters"`
+}
+
+func (s *stateFile) Load() ([]api.Cluster, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	if age := s.time.Now().Sub(state.SavedAt); s.maxAge > 0 && age > s.maxAge {
+		console.Info().Printf(
+			"ignoring state file %s: saved %s ago, maximum age is %s",
+			s.path,
+			age.Truncate(time.Second),
+			s.maxAge,
+		)
+		return nil, nil
+	}
+
+	return state.Clusters, nil
+}
+
+func (s *stateFile) Save(clusters []api.Cluster) error {
+	data, err := json.Marshal(savedState{SavedAt: s.time.Now().UTC(), Clusters: clusters})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// WithStateFile records the clusters successfully applied by the Updater in
+// the given StateFile. When the Updater is created, any clusters loaded from
+// the StateFile are applied immediately, without delaying the application of
+// subsequent changes.
+func WithStateFile(s StateFile) Option {
+	return func(u *updater) {
+		u.state = s
+	}
+}
+
+// loadState returns the clusters loaded from the given StateFile, logging
+// any error.
+func loadState(s StateFile) []api.Cluster {
+	clusters, err := s.Load()
+	if err != nil {
+		console.Error().Printf("could not load state file: %s", err)
+		return nil
+	}
+
+	if clusters != nil {
+		console.Info().Printf("applying %d clusters from state file", len(clusters))
+	}
+
+	return clusters
+}
+
+// primeDiffer applies the clusters loaded from the given StateFile, if any,
+// directly to the given Differ.
+func primeDiffer(d differ.Differ, s StateFile) {
+	clusters := loadState(s)
+	if clusters == nil {
+		return
+	}
+
+	if _, err := differ.DiffAndPatch(d, clusters, differ.DiffOpts{}); err != nil {
+		console.Error().Printf("could not apply clusters from state file: %s", err)
+	}
+}
+
+// prime applies the clusters loaded from the updater's StateFile, if any.
+func (u *updater) prime() {
+	clusters := loadState(u.state)
+	if clusters == nil {
+		return
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	op := &replaceClustersOperation{clusters: clusters}
+	if _, err := u.execute(op); err != nil {
+		console.Error().Printf("could not apply clusters from state file: %s", err)
+		return
+	}
+	u.applied = clusters
+}
+
+// recordApplied records the clusters resulting from the successful
+// execution of the given changeOperation in the updater's StateFile.
+// Instance changes are recorded only if the clusters to which they were
+// applied are known. Assumes mutex is locked.
+func (u *updater) recordApplied(op changeOperation) {
+	if u.state == nil {
+		return
+	}
+
+	switch o := op.(type) {
+	case *replaceClustersOperation:
+		u.applied = o.clusters
+
+	case *instanceChangesOperation:
+		if u.applied == nil {
+			return
+		}
+		u.applied = o.applyTo(u.applied)
+
+	default:
+		return
+	}
+
+	if err := u.state.Save(u.applied); err != nil {
+		console.Error().Printf("could not save state file: %s", err)
+	}
+}
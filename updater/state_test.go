@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/test/assert"
+)
+
+type fakeStateFile struct {
+	loaded  []api.Cluster
+	loadErr error
+	saved   [][]api.Cluster
+}
+
+func (f *fakeStateFile) Load() ([]api.Cluster, error) {
+	return f.loaded, f.loadErr
+}
+
+func (f *fakeStateFile) Save(clusters []api.Cluster) error {
+	f.saved = append(f.saved, clusters)
+	return nil
+}
+
+func TestStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	clusters := []api.Cluster{
+		{Name: "c1", Instances: c1Instances},
+		{Name: "c2", Instances: c2Instances},
+	}
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		s := &stateFile{path: path, maxAge: time.Hour, time: cs}
+
+		got, err := s.Load()
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+
+		assert.Nil(t, s.Save(clusters))
+
+		got, err = s.Load()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, got, clusters)
+
+		cs.Advance(time.Hour)
+		got, err = s.Load()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, got, clusters)
+
+		cs.Advance(time.Second)
+		got, err = s.Load()
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+
+		s.maxAge = 0
+		got, err = s.Load()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, got, clusters)
+	})
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 1)
+}
+
+func TestStateFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	s := NewStateFile(path, time.Hour)
+	got, err := s.Load()
+	assert.NonNil(t, err)
+	assert.Nil(t, got)
+
+	s = NewStateFile(filepath.Join(dir, "missing", "state.json"), time.Hour)
+	assert.NonNil(t, s.Save(nil))
+}
+
+func TestUpdaterWithStateFile(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockDiffer := differ.NewMockDiffer(ctrl)
+
+	loaded := []api.Cluster{{Name: "c1", Instances: c1Instances}}
+	replaced := []api.Cluster{{Name: "c2", Instances: c2Instances}}
+	added := []api.Cluster{{Name: "c2", Instances: append(c2Instances, c3Instances...)}}
+
+	gomock.InOrder(
+		mockDiffer.EXPECT().Diff(loaded, differ.DiffOpts{}).Return(nil, nil),
+		mockDiffer.EXPECT().Patch(nil).Return(nil),
+		mockDiffer.EXPECT().Diff(replaced, differ.DiffOpts{}).Return(nil, nil),
+		mockDiffer.EXPECT().Patch(nil).Return(nil),
+		mockDiffer.EXPECT().DiffInstances(gomock.Any(), differ.DiffOpts{}).Return(nil, nil),
+	)
+
+	state := &fakeStateFile{loaded: loaded}
+	u := New(mockDiffer, 0, differ.DiffOpts{}, "", WithStateFile(state))
+	assert.True(t, u.lastUpdate.IsZero())
+	assert.DeepEqual(t, u.applied, loaded)
+	assert.Equal(t, len(state.saved), 0)
+
+	u.Replace(replaced)
+	u.AddInstances("c2", c3Instances)
+	assert.DeepEqual(t, state.saved, [][]api.Cluster{replaced, added})
+}
+
+func TestUpdaterWithStateFileLoadError(t *testing.T) {
+	state := &fakeStateFile{loadErr: errors.New("boom")}
+	u := New(nil, 0, differ.DiffOpts{}, "", WithStateFile(state))
+	assert.Nil(t, u.applied)
+}
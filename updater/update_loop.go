@@ -19,6 +19,7 @@ package updater
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/turbinelabs/api"
@@ -26,7 +27,11 @@ import (
 	tbntime "github.com/turbinelabs/nonstdlib/time"
 )
 
-var lastNotifier chan<- os.Signal
+var (
+	notifierMutex    sync.Mutex
+	lastNotifier     chan<- os.Signal
+	interruptPending bool
+)
 
 // Loop is a utility function for Rotor plugins that periodically polls for
 // updates. It invokes the get function at the Updater's minimum update interval
@@ -45,12 +50,39 @@ func Loop(updater Updater, get func() ([]api.Cluster, error)) {
 // StopLoop stops a running Loop invocation by simulating a signal. This function is
 // intended for use in tests only. StopLoop assumes only one event loop is running in
 // a given process, and therefore only the most recently created Loop or
-// SignalNotifier will receive the simulated signal.
+// SignalNotifier will receive the simulated signal. StopLoop never blocks: if
+// that Loop has a signal pending, or has already exited, it does nothing.
 func StopLoop() {
-	lastNotifier <- syscall.SIGINT
+	notifierMutex.Lock()
+	defer notifierMutex.Unlock()
+
+	select {
+	case lastNotifier <- syscall.SIGINT:
+	default:
+	}
 	lastNotifier = nil
 }
 
+// Interrupt stops a running Loop or Watch invocation, or the consumer of a
+// SignalNotifier, as if the process had received SIGTERM. If no
+// SignalNotifier has been created yet, the signal is delivered to the next
+// one created. Like StopLoop, Interrupt assumes only one event loop is
+// running in a given process, and like StopLoop, it never blocks.
+func Interrupt() {
+	notifierMutex.Lock()
+	defer notifierMutex.Unlock()
+
+	if lastNotifier == nil {
+		interruptPending = true
+		return
+	}
+
+	select {
+	case lastNotifier <- syscall.SIGTERM:
+	default:
+	}
+}
+
 // SignalNotifier creates a chan os.Signal that will receive the SIGINT and SIGTERM
 // signals if the current process receives them. If Loop is inadequate for your Rotor
 // plugin, this function can be used to provide the same exit-on-signal behavior. See
@@ -58,7 +90,15 @@ func StopLoop() {
 func SignalNotifier() chan os.Signal {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+
+	notifierMutex.Lock()
+	defer notifierMutex.Unlock()
+
 	lastNotifier = signalCh
+	if interruptPending {
+		signalCh <- syscall.SIGTERM
+		interruptPending = false
+	}
 	return signalCh
 }
 
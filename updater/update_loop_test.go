@@ -19,6 +19,8 @@ package updater
 import (
 	"errors"
 	"os"
+	"os/signal"
+	"syscall"
 	"testing"
 	"time"
 
@@ -221,3 +223,51 @@ func TestStopLoop(t *testing.T) {
 	// No other gets occurred.
 	assert.ChannelEmpty(t, gets)
 }
+
+func TestStopLoopNeverBlocks(t *testing.T) {
+	signalCh := SignalNotifier()
+	defer signal.Stop(signalCh)
+
+	// a signal is already pending
+	Interrupt()
+	StopLoop()
+
+	// no Loop is running
+	StopLoop()
+
+	// the lock was released
+	Interrupt()
+	assert.True(t, interruptPending)
+	interruptPending = false
+
+	assert.Equal(t, <-signalCh, syscall.SIGTERM)
+	assert.ChannelEmpty(t, signalCh)
+}
+
+func TestInterrupt(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockUpdater := NewMockUpdater(ctrl)
+	mockUpdater.EXPECT().Replace(gomock.Any()).Do(func([]api.Cluster) {
+		Interrupt()
+		Interrupt()
+	})
+	mockUpdater.EXPECT().Delay().Return(time.Hour)
+	mockUpdater.EXPECT().Close().Return(nil)
+
+	Loop(mockUpdater, func() ([]api.Cluster, error) {
+		return nil, nil
+	})
+}
+
+func TestInterruptPending(t *testing.T) {
+	lastNotifier = nil
+	Interrupt()
+
+	signalCh := SignalNotifier()
+	defer signal.Stop(signalCh)
+
+	assert.Equal(t, <-signalCh, syscall.SIGTERM)
+	assert.False(t, interruptPending)
+}
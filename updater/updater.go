@@ -22,12 +22,16 @@ package updater
 //go:generate mockgen -source $GOFILE -destination mock_$GOFILE -package $GOPACKAGE --write_package_comment=false
 
 import (
-	"log"
 	"sync"
 	"time"
 
 	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/executor"
+	"github.com/turbinelabs/nonstdlib/log/console"
 	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/pkg/backoff"
+	"github.com/turbinelabs/rotor/pkg/leader"
+	"github.com/turbinelabs/stats"
 )
 
 // Updater provies a mechanism for updating a set of Clusters within a Zone
@@ -42,6 +46,22 @@ type Updater interface {
 	// update, the scheduled update is executed immediately.
 	Replace(clusters []api.Cluster)
 
+	// AddInstances schedules changes to add the given instances to
+	// the named cluster. An added instance replaces any existing
+	// instance with the same host and port. The cluster is created
+	// only if the appropriate flags are set when creating the
+	// Updater. Unapplied changes are merged with these changes,
+	// and if sufficient time has elapsed since the last update,
+	// the scheduled update is executed immediately.
+	AddInstances(cluster string, instances []api.Instance)
+
+	// RemoveInstances schedules changes to remove the instances
+	// with the same host and port as the given instances from the
+	// named cluster. Unapplied changes are merged with these
+	// changes, and if sufficient time has elapsed since the last
+	// update, the scheduled update is executed immediately.
+	RemoveInstances(cluster string, instances []api.Instance)
+
 	// Delay returns the minimum delay between API updates.
 	Delay() time.Duration
 
@@ -61,6 +81,15 @@ type updater struct {
 	changeOps  []changeOperation
 	lastUpdate time.Time
 	timer      *time.Timer
+	failures   int
+
+	stats         stats.Stats
+	elector       leader.Elector
+	state         StateFile
+	applied       []api.Cluster
+	maxRetryDelay time.Duration
+	retryDelay    executor.DelayFunc
+	jitter        func(time.Duration) time.Duration
 
 	updateApi      func(*updater)
 	updateApiAfter func(*updater, time.Duration)
@@ -69,30 +98,134 @@ type updater struct {
 
 var _ Updater = &updater{}
 
+// Option configures optional behavior of an Updater created with New.
+type Option func(*updater)
+
+// WithStats records the results and latency of API updates in the given
+// stats.Stats.
+func WithStats(s stats.Stats) Option {
+	return func(u *updater) {
+		u.stats = s
+	}
+}
+
+// WithElector only applies changes to the API while the given
+// leader.Elector holds leadership. Changes made while following are
+// merged and retained, and applied upon becoming the leader. The
+// Updater closes the leader.Elector when it is closed.
+func WithElector(e leader.Elector) Option {
+	return func(u *updater) {
+		u.elector = e
+	}
+}
+
 func New(
 	differ differ.Differ,
 	delay time.Duration,
 	diffOpts differ.DiffOpts,
 	zoneName string,
+	opts ...Option,
 ) *updater {
-	return &updater{
+	u := &updater{
 		differ:         differ,
 		delay:          delay,
 		mutex:          &sync.Mutex{},
 		changeOps:      []changeOperation{},
 		diffOpts:       diffOpts,
+		stats:          stats.NewNoopStats(),
+		maxRetryDelay:  defaultMaxRetryDelay,
+		jitter:         backoff.Jitter,
 		updateApi:      updateApi,
 		updateApiAfter: updateApiAfter,
 		zoneName:       zoneName,
 	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	if u.stats == nil {
+		u.stats = stats.NewNoopStats()
+	}
+	u.retryDelay = executor.NewExponentialDelayFunc(u.delay, u.maxRetryDelay)
+
+	if u.state != nil {
+		u.prime()
+	}
+
+	if u.elector != nil {
+		u.elector.Notify(u.leadershipChanged)
+	}
+
+	if u.diffOpts.Guard != nil {
+		u.diffOpts.Guard.Notify(u.guardOverridden)
+	}
+
+	return u
+}
+
+// guardOverridden applies any changes refused by the guard once it has
+// been overridden.
+func (u *updater) guardOverridden() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if len(u.changeOps) > 0 {
+		u.updateApi(u)
+	}
+}
+
+// leadershipChanged applies any changes retained while following when
+// this Updater becomes the leader.
+func (u *updater) leadershipChanged(isLeader bool) {
+	if !isLeader {
+		return
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.updateApi(u)
+}
+
+// isFollower returns true if an Elector is configured and does not
+// currently hold leadership.
+func (u *updater) isFollower() bool {
+	return u.elector != nil && !u.elector.IsLeader()
+}
+
+// compact merges consecutive mergeable changeOperations, so that changes
+// retained while following do not accumulate. Assumes mutex is locked.
+func (u *updater) compact() {
+	if len(u.changeOps) < 2 {
+		return
+	}
+
+	compacted := []changeOperation{u.changeOps[0]}
+	for _, op := range u.changeOps[1:] {
+		last := compacted[len(compacted)-1]
+		if last.canMerge(op) {
+			compacted[len(compacted)-1] = last.merge(op)
+		} else {
+			compacted = append(compacted, op)
+		}
+	}
+	u.changeOps = compacted
 }
 
 // Updates the API with the current set of changes. If insufficient
 // time has elapsed since the last update to maintain the minimum time
 // between updates, the update is deferred. Otherwise, cancels any
-// deferred updates and applies the pending changes. Assumes mutex is
-// locked.
+// deferred updates and applies the pending changes. If the updater is
+// following another leader, changes are retained until it becomes the
+// leader. Assumes mutex is locked.
 func updateApi(u *updater) {
+	if u.isFollower() {
+		u.cancelUpdateTimer()
+		u.compact()
+		return
+	}
+
 	elapsed := time.Since(u.lastUpdate)
 
 	if elapsed >= u.delay {
@@ -113,11 +246,40 @@ func updateApi(u *updater) {
 				}
 			}
 
-			err := op.execute(u)
-			if err != nil {
-				log.Printf("rotor: api update failed: %s", err.Error())
-				u.updateApiAfter(u, u.delay)
+			switch class, err := u.execute(op); class {
+			case refusedError:
+				// The guard has logged the refusal. Keep the
+				// operation, so that it is proposed again with
+				// the next change or applied when the guard is
+				// overridden, and serve the previous state until
+				// then. A Replace discards it.
+				u.changeOps = append([]changeOperation{op}, u.changeOps[i:]...)
+				return
+
+			case fatalError:
+				console.Error().Printf("api update failed, not retrying: %s", err)
+
+			case conflictError, retryableError:
+				u.failures++
+				u.stats.Gauge(updateConsecutiveFailuresStat, float64(u.failures))
+
+				delay := u.jitter(u.retryDelay(u.failures))
+				console.Error().Printf(
+					"api update failed (%d consecutive failures), retrying in %s: %s",
+					u.failures,
+					delay,
+					err,
+				)
+				u.updateApiAfter(u, delay)
 				return
+
+			default:
+				if u.failures > 0 {
+					u.failures = 0
+					u.stats.Gauge(updateConsecutiveFailuresStat, 0)
+				}
+				u.stats.Gauge(updateLastSuccessStat, float64(time.Now().Unix()))
+				u.recordApplied(op)
 			}
 
 			u.changeOps = u.changeOps[i:]
@@ -127,11 +289,55 @@ func updateApi(u *updater) {
 	}
 }
 
+// execute executes the given changeOperation, recording the result and
+// latency of each attempt. Operations that fail due to a checksum conflict
+// are immediately retried, which re-diffs them against the current state,
+// up to maxConflictRetries times.
+func (u *updater) execute(op changeOperation) (errorClass, error) {
+	var (
+		class errorClass
+		err   error
+	)
+
+	for attempt := 0; attempt <= maxConflictRetries; attempt++ {
+		start := time.Now()
+		err = op.execute(u)
+		class = classifyError(err)
+
+		tag := stats.NewKVTag(resultTag, string(class))
+		u.stats.Count(updateStat, 1.0, tag)
+		u.stats.Timing(updateLatencyStat, time.Since(start), tag)
+
+		if class != conflictError {
+			break
+		}
+		console.Debug().Printf("api update conflicted, re-diffing: %s", err)
+	}
+
+	return class, err
+}
+
 // Defers an update for the given duration. Assumes mutex is locked
 func updateApiAfter(u *updater, d time.Duration) {
-	if u.timer == nil {
-		u.timer = time.AfterFunc(d, func() { u.updateApi(u) })
+	if u.timer != nil {
+		return
 	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+
+		// The update was canceled, or already applied, while this
+		// callback waited for the lock.
+		if u.timer != timer {
+			return
+		}
+		u.timer = nil
+
+		u.updateApi(u)
+	})
+	u.timer = timer
 }
 
 // Cancels a previously deferred update, if any. Assumes mutex is locked.
@@ -153,6 +359,25 @@ func (u *updater) Replace(clusters []api.Cluster) {
 	u.updateApi(u)
 }
 
+func (u *updater) AddInstances(cluster string, instances []api.Instance) {
+	u.schedule(newInstanceChangesOperation(cluster, instances, nil))
+}
+
+func (u *updater) RemoveInstances(cluster string, instances []api.Instance) {
+	u.schedule(newInstanceChangesOperation(cluster, nil, instances))
+}
+
+// schedule appends the given changeOperation to the pending
+// operations and updates the API if sufficient time has elapsed.
+func (u *updater) schedule(op changeOperation) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.changeOps = append(u.changeOps, op)
+
+	u.updateApi(u)
+}
+
 func (u *updater) Delay() time.Duration {
 	return u.delay
 }
@@ -162,5 +387,8 @@ func (u *updater) ZoneName() string {
 }
 
 func (u *updater) Close() error {
+	if u.elector != nil {
+		return u.elector.Close()
+	}
 	return nil
 }
@@ -252,7 +252,52 @@ func TestUpdaterUpdateApiDelayedOnError(t *testing.T) {
 	assert.DeepEqual(t, u.changeOps, []changeOperation{fakeOp2, fakeOp3})
 	assert.NotEqual(t, u.lastUpdate, lastUpdate)
 	assert.Equal(t, updateApiAfterCalls, 1)
-	assert.Equal(t, updateApiAfterDelay, 30*time.Second)
+	assert.GreaterThanEqual(t, updateApiAfterDelay, 30*time.Second)
+	assert.LessThanEqual(t, updateApiAfterDelay, 45*time.Second)
+}
+
+func TestUpdaterUpdateApiKeepsGuardedOp(t *testing.T) {
+	lastUpdate := time.Now().Add(-60 * time.Second)
+
+	u := makeUpdater(lastUpdate)
+
+	mergedOp := &fakeChangeOperation{executeError: &differ.GuardError{}}
+	fakeOp1 := &fakeChangeOperation{canMergeResult: true, mergeResult: mergedOp}
+	fakeOp2 := &fakeChangeOperation{}
+	fakeOp3 := &fakeChangeOperation{}
+
+	u.changeOps = []changeOperation{fakeOp1, fakeOp2, fakeOp3}
+
+	updateApiAfterCalls := 0
+	u.updateApiAfter = func(_ *updater, delay time.Duration) {
+		updateApiAfterCalls++
+	}
+
+	u.updateApi(u)
+
+	assert.Equal(t, mergedOp.executeCalls, 1)
+	assert.Equal(t, fakeOp3.executeCalls, 0)
+	assert.DeepEqual(t, u.changeOps, []changeOperation{mergedOp, fakeOp3})
+	assert.Equal(t, updateApiAfterCalls, 0)
+}
+
+func TestUpdaterGuardOverrideAppliesRefusedOp(t *testing.T) {
+	guard := differ.NewGuard(differ.GuardOpts{MaxTotalRemovals: 1}, nil)
+	u := New(nil, 30*time.Second, differ.DiffOpts{Guard: guard}, "")
+	u.lastUpdate = time.Now().Add(-60 * time.Second)
+
+	updateApiCalls := 0
+	u.updateApi = func(_ *updater) {
+		updateApiCalls++
+	}
+
+	// nothing pending
+	guard.Override()
+	assert.Equal(t, updateApiCalls, 0)
+
+	u.changeOps = []changeOperation{&fakeChangeOperation{}}
+	guard.Override()
+	assert.Equal(t, updateApiCalls, 1)
 }
 
 func TestUpdaterUpdateApiDelayedOnMergedOpError(t *testing.T) {
@@ -284,7 +329,8 @@ func TestUpdaterUpdateApiDelayedOnMergedOpError(t *testing.T) {
 	assert.DeepEqual(t, u.changeOps, []changeOperation{fakeOp1, fakeOp2, fakeOp3})
 	assert.NotEqual(t, u.lastUpdate, lastUpdate)
 	assert.Equal(t, updateApiAfterCalls, 1)
-	assert.Equal(t, updateApiAfterDelay, 30*time.Second)
+	assert.GreaterThanEqual(t, updateApiAfterDelay, 30*time.Second)
+	assert.LessThanEqual(t, updateApiAfterDelay, 45*time.Second)
 }
 
 func TestUpdaterUpdateApiDelayedOnErrorAfterMergedOp(t *testing.T) {
@@ -316,7 +362,8 @@ func TestUpdaterUpdateApiDelayedOnErrorAfterMergedOp(t *testing.T) {
 	assert.DeepEqual(t, u.changeOps, []changeOperation{fakeOp3})
 	assert.NotEqual(t, u.lastUpdate, lastUpdate)
 	assert.Equal(t, updateApiAfterCalls, 1)
-	assert.Equal(t, updateApiAfterDelay, 30*time.Second)
+	assert.GreaterThanEqual(t, updateApiAfterDelay, 30*time.Second)
+	assert.LessThanEqual(t, updateApiAfterDelay, 45*time.Second)
 }
 
 func TestUpdaterUpdateApiAfter(t *testing.T) {
@@ -331,7 +378,9 @@ func TestUpdaterUpdateApiAfter(t *testing.T) {
 		wg.Done()
 	}
 
+	u.mutex.Lock()
 	u.updateApiAfter(u, 10*time.Millisecond)
+	u.mutex.Unlock()
 
 	wg.Wait()
 	assert.Equal(t, updateApiCalls, 1)
@@ -424,3 +473,155 @@ func TestClose(t *testing.T) {
 	u := &updater{}
 	assert.Nil(t, u.Close())
 }
+
+func TestUpdaterAddAndRemoveInstances(t *testing.T) {
+	u := New(nil, 30*time.Second, differ.DiffOpts{}, "")
+
+	updateApiCalls := 0
+	u.updateApi = func(_ *updater) {
+		updateApiCalls++
+	}
+
+	u.AddInstances("c1", c1Instances)
+	u.RemoveInstances("c2", c2Instances)
+
+	assert.DeepEqual(
+		t,
+		u.changeOps,
+		[]changeOperation{
+			newInstanceChangesOperation("c1", c1Instances, nil),
+			newInstanceChangesOperation("c2", nil, c2Instances),
+		},
+	)
+	assert.Equal(t, updateApiCalls, 2)
+
+	// Replace discards pending instance changes
+	u.Replace(emptyClusters)
+	assert.DeepEqual(
+		t,
+		u.changeOps,
+		[]changeOperation{&replaceClustersOperation{clusters: emptyClusters}},
+	)
+}
+
+func TestInstanceChangesOpCanMerge(t *testing.T) {
+	op := newInstanceChangesOperation("c1", c1Instances, nil)
+
+	assert.True(t, op.canMerge(newInstanceChangesOperation("c2", c2Instances, nil)))
+	assert.True(t, op.canMerge(&replaceClustersOperation{}))
+	assert.False(t, op.canMerge(&fakeChangeOperation{}))
+	assert.True(t, (&replaceClustersOperation{}).canMerge(op))
+}
+
+func TestInstanceChangesOpMerge(t *testing.T) {
+	op1 := newInstanceChangesOperation("c1", c1Instances, c3Instances)
+	op2 := newInstanceChangesOperation("c1", c3Instances, c1Instances[:1])
+	replace := &replaceClustersOperation{clusters: emptyClusters}
+
+	assert.SameInstance(t, op1.merge(replace), replace)
+	assert.Nil(t, op1.merge(&fakeChangeOperation{}))
+
+	merged := op1.merge(op2).(*instanceChangesOperation)
+	changes := merged.changes()
+	assert.ArrayEqual(t, changes.Add["c1"], api.Instances{c1Instances[1], c3Instances[0]})
+	assert.ArrayEqual(t, changes.Remove["c1"], c1Instances[:1])
+
+	// op1 is unchanged
+	assert.ArrayEqual(t, op1.changes().Remove["c1"], c3Instances)
+}
+
+func TestReplaceClustersOpMergeInstanceChanges(t *testing.T) {
+	replace := &replaceClustersOperation{
+		clusters: []api.Cluster{
+			{Name: "c1", Instances: c1Instances},
+			{Name: "c2", Instances: c2Instances},
+		},
+	}
+
+	updated := c1Instances[0]
+	updated.Metadata = api.Metadata{{Key: "new", Value: "value"}}
+
+	changes := newInstanceChangesOperation("c1", api.Instances{updated}, c1Instances[1:]).
+		merge(newInstanceChangesOperation("c3", c3Instances, nil))
+
+	merged := replace.merge(changes).(*replaceClustersOperation)
+	assert.DeepEqual(t, merged.clusters, []api.Cluster{
+		{Name: "c1", Instances: api.Instances{updated}},
+		{Name: "c2", Instances: c2Instances},
+		{Name: "c3", Instances: c3Instances},
+	})
+
+	// the original replacement is unchanged
+	assert.DeepEqual(t, replace.clusters[0].Instances, c1Instances)
+}
+
+func TestInstanceChangesOpExecute(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockDiffer := differ.NewMockDiffer(ctrl)
+	u := New(mockDiffer, 30*time.Second, differ.DiffOpts{}, "")
+
+	op := newInstanceChangesOperation("c1", c1Instances[:1], c1Instances[1:])
+	changes := differ.InstanceChanges{
+		Add:    map[string]api.Instances{"c1": c1Instances[:1]},
+		Remove: map[string]api.Instances{"c1": c1Instances[1:]},
+	}
+
+	diffs := []differ.Diff{
+		differ.NewDiffAddInstance("key1", api.Checksum{}, c1Instances[0]),
+	}
+	mockDiffer.EXPECT().DiffInstances(changes, differ.DiffOpts{}).Return(diffs, nil)
+	mockDiffer.EXPECT().Patch(diffs).Return(nil)
+	assert.Nil(t, op.execute(u))
+
+	err := errors.New("boom")
+	mockDiffer.EXPECT().DiffInstances(changes, differ.DiffOpts{}).Return(nil, err)
+	assert.DeepEqual(t, op.execute(u), err)
+}
+
+type fakeElector struct {
+	leader   bool
+	notifyFn func(bool)
+	closed   bool
+}
+
+func (e *fakeElector) IsLeader() bool               { return e.leader }
+func (e *fakeElector) Notify(f func(isLeader bool)) { e.notifyFn = f }
+func (e *fakeElector) Close() error                 { e.closed = true; return nil }
+
+func (e *fakeElector) setLeader(leader bool) {
+	e.leader = leader
+	e.notifyFn(leader)
+}
+
+func TestUpdaterUpdateApiRetainsOpsWhileFollowing(t *testing.T) {
+	elector := &fakeElector{}
+	u := New(nil, 30*time.Second, differ.DiffOpts{}, "", WithElector(elector))
+
+	mergedOp := &fakeChangeOperation{}
+	fakeOp1 := &fakeChangeOperation{canMergeResult: true, mergeResult: mergedOp}
+	fakeOp2 := &fakeChangeOperation{}
+	u.changeOps = []changeOperation{fakeOp1, fakeOp2}
+	u.timer = time.AfterFunc(time.Hour, func() {})
+
+	u.updateApi(u)
+
+	assert.Equal(t, fakeOp1.executeCalls, 0)
+	assert.Equal(t, fakeOp1.mergeCalls, 1)
+	assert.DeepEqual(t, u.changeOps, []changeOperation{mergedOp})
+	assert.Nil(t, u.timer)
+
+	elector.setLeader(true)
+	assert.Equal(t, mergedOp.executeCalls, 1)
+	assert.Equal(t, len(u.changeOps), 0)
+
+	elector.setLeader(false)
+	u.changeOps = []changeOperation{fakeOp2}
+	u.lastUpdate = time.Time{}
+	u.updateApi(u)
+	assert.Equal(t, fakeOp2.executeCalls, 0)
+
+	assert.Nil(t, u.Close())
+	assert.True(t, elector.closed)
+}
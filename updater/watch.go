@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+const (
+	// DefaultQuietPeriod is the default WatchOpts.QuietPeriod.
+	DefaultQuietPeriod = time.Second
+
+	// DefaultMaxLatency is the default WatchOpts.MaxLatency.
+	DefaultMaxLatency = 10 * time.Second
+)
+
+// WatchOpts configure the debouncing of snapshots by Watch.
+type WatchOpts struct {
+	// QuietPeriod is the time that must elapse without a new snapshot
+	// before the most recent snapshot is applied.
+	QuietPeriod time.Duration
+
+	// MaxLatency is the longest time a snapshot may be delayed by
+	// subsequent snapshots arriving within the QuietPeriod. If zero,
+	// snapshots may be delayed indefinitely.
+	MaxLatency time.Duration
+}
+
+// DefaultWatchOpts returns WatchOpts with the default quiet period and
+// maximum latency.
+func DefaultWatchOpts() WatchOpts {
+	return WatchOpts{QuietPeriod: DefaultQuietPeriod, MaxLatency: DefaultMaxLatency}
+}
+
+// Watch is a utility function for Rotor plugins that are notified of
+// changes, rather than polling for them. Each set of Clusters received from
+// snapshots supersedes any previously received but unapplied set. A set is
+// passed to Updater.Replace once the WatchOpts.QuietPeriod elapses without
+// another arriving, or once the oldest unapplied set has waited for
+// WatchOpts.MaxLatency. In either case, Updater.Replace is invoked no more
+// often than the Updater's minimum delay. Watch installs a signal handler
+// for SIGINT and SIGTERM (via SignalNotifier). It returns after closing the
+// Updater when either signal is received, discarding any unapplied set, or
+// when snapshots is closed, after applying any unapplied set.
+func Watch(updater Updater, snapshots <-chan []api.Cluster, opts WatchOpts) {
+	w := &watcher{
+		time:     tbntime.NewSource(),
+		signalCh: SignalNotifier(),
+		opts:     opts,
+	}
+	w.run(updater, snapshots)
+}
+
+type watcher struct {
+	time     tbntime.Source
+	signalCh chan os.Signal
+	opts     WatchOpts
+
+	pending    []api.Cluster
+	hasPending bool
+	first      time.Time
+	last       time.Time
+	applied    time.Time
+	timer      tbntime.Timer
+}
+
+func (w *watcher) run(updater Updater, snapshots <-chan []api.Cluster) {
+	defer updater.Close()
+	defer signal.Stop(w.signalCh)
+	defer w.stopTimer()
+
+	delay := updater.Delay()
+
+	var timerC <-chan time.Time
+	for {
+		select {
+		case clusters, ok := <-snapshots:
+			if !ok {
+				if w.hasPending {
+					w.apply(updater)
+				}
+				return
+			}
+
+			now := w.time.Now()
+			if !w.hasPending {
+				w.first = now
+			}
+			w.pending = clusters
+			w.hasPending = true
+			w.last = now
+
+			w.stopTimer()
+			w.timer = w.time.NewTimer(w.deadline(delay).Sub(now))
+			timerC = w.timer.C()
+
+		case <-timerC:
+			timerC = nil
+			w.timer = nil
+			w.apply(updater)
+
+		case signal := <-w.signalCh:
+			console.Info().Printf("%s: exiting", signal.String())
+			return
+		}
+	}
+}
+
+// deadline returns the time at which the pending snapshot should be
+// applied.
+func (w *watcher) deadline(delay time.Duration) time.Time {
+	at := w.last.Add(w.opts.QuietPeriod)
+
+	if w.opts.MaxLatency > 0 {
+		if latest := w.first.Add(w.opts.MaxLatency); latest.Before(at) {
+			at = latest
+		}
+	}
+
+	if !w.applied.IsZero() {
+		if earliest := w.applied.Add(delay); at.Before(earliest) {
+			at = earliest
+		}
+	}
+
+	return at
+}
+
+func (w *watcher) apply(updater Updater) {
+	console.Debug().Printf("applying %d clusters", len(w.pending))
+	w.applied = w.time.Now()
+	updater.Replace(w.pending)
+
+	w.pending = nil
+	w.hasPending = false
+}
+
+func (w *watcher) stopTimer() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
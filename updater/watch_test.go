@@ -0,0 +1,228 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package updater
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/api"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+// notifyingSource notifies its channel after each new Timer is created.
+type notifyingSource struct {
+	tbntime.ControlledSource
+	timers chan struct{}
+}
+
+func (s *notifyingSource) NewTimer(d time.Duration) tbntime.Timer {
+	t := s.ControlledSource.NewTimer(d)
+	s.timers <- struct{}{}
+	return t
+}
+
+type watchTest struct {
+	source    *notifyingSource
+	snapshots chan []api.Cluster
+	signalCh  chan os.Signal
+	done      chan struct{}
+}
+
+func startWatcher(
+	u Updater,
+	cs tbntime.ControlledSource,
+	opts WatchOpts,
+) *watchTest {
+	wt := &watchTest{
+		source:    &notifyingSource{cs, make(chan struct{})},
+		snapshots: make(chan []api.Cluster),
+		signalCh:  make(chan os.Signal, 1),
+		done:      make(chan struct{}),
+	}
+
+	w := &watcher{time: wt.source, signalCh: wt.signalCh, opts: opts}
+	go func() {
+		defer close(wt.done)
+		w.run(u, wt.snapshots)
+	}()
+
+	return wt
+}
+
+// send sends the given clusters and waits for the watcher to schedule
+// their application.
+func (wt *watchTest) send(clusters []api.Cluster) {
+	wt.snapshots <- clusters
+	<-wt.source.timers
+}
+
+func mkNamedClusters(names ...string) []api.Cluster {
+	clusters := make([]api.Cluster, len(names))
+	for i, name := range names {
+		clusters[i] = api.Cluster{Name: name}
+	}
+	return clusters
+}
+
+func TestWatchDebounces(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	a := mkNamedClusters("a")
+	b := mkNamedClusters("b")
+	c := mkNamedClusters("c")
+
+	applied := make(chan struct{})
+	mockUpdater := NewMockUpdater(ctrl)
+	gomock.InOrder(
+		mockUpdater.EXPECT().Delay().Return(time.Second),
+		mockUpdater.EXPECT().Replace(c).Do(func(_ []api.Cluster) { applied <- struct{}{} }),
+		mockUpdater.EXPECT().Close().Return(nil),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		wt := startWatcher(mockUpdater, cs, WatchOpts{QuietPeriod: time.Second})
+
+		wt.send(a)
+		cs.Advance(500 * time.Millisecond)
+		wt.send(b)
+		cs.Advance(900 * time.Millisecond)
+		wt.send(c)
+		cs.Advance(999 * time.Millisecond)
+		assert.ChannelEmpty(t, applied)
+		cs.Advance(time.Millisecond)
+		<-applied
+
+		close(wt.snapshots)
+		<-wt.done
+	})
+}
+
+func TestWatchMaxLatency(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	a := mkNamedClusters("a")
+	b := mkNamedClusters("b")
+	c := mkNamedClusters("c")
+
+	applied := make(chan struct{})
+	mockUpdater := NewMockUpdater(ctrl)
+	gomock.InOrder(
+		mockUpdater.EXPECT().Delay().Return(time.Second),
+		mockUpdater.EXPECT().Replace(c).Do(func(_ []api.Cluster) { applied <- struct{}{} }),
+		mockUpdater.EXPECT().Close().Return(nil),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		wt := startWatcher(
+			mockUpdater,
+			cs,
+			WatchOpts{QuietPeriod: time.Second, MaxLatency: 2 * time.Second},
+		)
+
+		wt.send(a)
+		cs.Advance(900 * time.Millisecond)
+		wt.send(b)
+		cs.Advance(900 * time.Millisecond)
+		wt.send(c)
+		cs.Advance(200 * time.Millisecond)
+		<-applied
+
+		wt.signalCh <- os.Interrupt
+		<-wt.done
+	})
+}
+
+func TestWatchRespectsDelay(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	a := mkNamedClusters("a")
+	b := mkNamedClusters("b")
+
+	applied := make(chan struct{})
+	sync := func(_ []api.Cluster) { applied <- struct{}{} }
+	mockUpdater := NewMockUpdater(ctrl)
+	gomock.InOrder(
+		mockUpdater.EXPECT().Delay().Return(time.Minute),
+		mockUpdater.EXPECT().Replace(a).Do(sync),
+		mockUpdater.EXPECT().Replace(b).Do(sync),
+		mockUpdater.EXPECT().Close().Return(nil),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		wt := startWatcher(mockUpdater, cs, WatchOpts{})
+
+		wt.send(a)
+		<-applied
+
+		cs.Advance(time.Second)
+		wt.send(b)
+		cs.Advance(58 * time.Second)
+		assert.ChannelEmpty(t, applied)
+		cs.Advance(time.Second)
+		<-applied
+
+		wt.signalCh <- os.Interrupt
+		<-wt.done
+	})
+}
+
+func TestWatchAppliesPendingOnClose(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockUpdater := NewMockUpdater(ctrl)
+	gomock.InOrder(
+		mockUpdater.EXPECT().Delay().Return(time.Minute),
+		mockUpdater.EXPECT().Replace(testClusters),
+		mockUpdater.EXPECT().Close().Return(nil),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		wt := startWatcher(mockUpdater, cs, DefaultWatchOpts())
+
+		wt.send(testClusters)
+		close(wt.snapshots)
+		<-wt.done
+	})
+}
+
+func TestWatchDiscardsPendingOnSignal(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockUpdater := NewMockUpdater(ctrl)
+	gomock.InOrder(
+		mockUpdater.EXPECT().Delay().Return(time.Minute),
+		mockUpdater.EXPECT().Close().Return(nil),
+	)
+
+	tbntime.WithCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		wt := startWatcher(mockUpdater, cs, DefaultWatchOpts())
+
+		wt.send(testClusters)
+		wt.signalCh <- os.Interrupt
+		<-wt.done
+	})
+}
@@ -31,6 +31,8 @@ import (
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
 	"github.com/turbinelabs/nonstdlib/log/console"
 	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/pkg/transform"
 	"github.com/turbinelabs/rotor/updater"
 	"github.com/turbinelabs/rotor/xds/adapter"
 	"github.com/turbinelabs/rotor/xds/poller"
@@ -50,6 +52,28 @@ type UpdaterFromFlags interface {
 	ValidateXDSOnly() error
 	Make() (updater.Updater, error)
 	MakeXDS() (adapter.XDS, error)
+
+	// MakeStats returns the stats.Stats configured by flags, for use by
+	// plugins reporting their own metrics. The same stats.Stats is
+	// returned on each call.
+	MakeStats() (stats.Stats, error)
+
+	// DeferMetadataFilter returns the metadata key filter configured by
+	// flags and prevents Make from applying it, so that plugins managing
+	// several collectors can apply it, or per-collector overrides, to each
+	// collector's clusters.
+	DeferMetadataFilter() transform.MetadataFilterConfig
+
+	// SetCollectorName sets the name of the collector to which changes
+	// made by the Updater are attributed in audit records. It must be
+	// called before Make.
+	SetCollectorName(string)
+
+	// SetPlanFunc causes Make to produce an Updater that computes the
+	// changes it would make without applying them, passing each resulting
+	// differ.Plan, or the error computing it, to fn. Neither the xDS server
+	// nor the API poller is started. It must be called before Make.
+	SetPlanFunc(fn func(differ.Plan, error))
 }
 
 // NewUpdaterFromFlags installs an UpdaterFromFlags into the given FlagSet
@@ -120,6 +144,9 @@ func NewUpdaterFromFlags(flagset tbnflag.FlagSet) UpdaterFromFlags {
 		xdsFromFlags:     xdsFromFlags,
 		pollerFromFlags:  poller.NewFromFlags(xdsFlagset),
 		statsFromFlags:   statsFromFlags,
+		transformFromFlags: transform.NewFromFlags(
+			flagset.Scope("transform", "cluster transform"),
+		),
 	}
 
 	xdsFlagset.BoolVar(
@@ -165,11 +192,16 @@ type updaterFromFlags struct {
 	xdsFromFlags        adapter.XDSFromFlags
 	pollerFromFlags     poller.FromFlags
 	statsFromFlags      stats.FromFlags
+	transformFromFlags  transform.FromFlags
 	standalonePort      int
 	standaloneProxyName string
 	standaloneZoneName  string
 	startXDS            func(adapter.XDS)
 	pollLoop            func(poller.Poller)
+
+	statsClient            stats.Stats
+	metadataFilterDeferred bool
+	planning               bool
 }
 
 func (ff *updaterFromFlags) Validate() error {
@@ -193,6 +225,10 @@ func (ff *updaterFromFlags) validate(xdsOnly bool) error {
 		return err
 	}
 
+	if err := ff.transformFromFlags.Validate(); err != nil {
+		return err
+	}
+
 	if ff.apiConfigFromFlags.APIKey() == "" {
 		if xdsOnly {
 			if ff.disableXDS {
@@ -238,13 +274,11 @@ func (ff *updaterFromFlags) mkSvcAndXDS() (service.All, adapter.XDS, error) {
 		return svc, nil, nil
 	}
 
-	statsClient, err := ff.statsFromFlags.Make()
+	statsClient, err := ff.MakeStats()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	statsClient.AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion))
-
 	registrar := poller.NewDelayedRegistrar(poller.NewRegistrar(svc), deregDelay)
 	xds, err := ff.xdsFromFlags.Make(registrar)
 	if err != nil {
@@ -258,14 +292,55 @@ func (ff *updaterFromFlags) mkSvcAndXDS() (service.All, adapter.XDS, error) {
 
 }
 
+func (ff *updaterFromFlags) MakeStats() (stats.Stats, error) {
+	if ff.statsClient != nil {
+		return ff.statsClient, nil
+	}
+
+	statsClient, err := ff.statsFromFlags.Make()
+	if err != nil {
+		return nil, err
+	}
+
+	statsClient.AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion))
+	ff.statsClient = statsClient
+
+	return statsClient, nil
+}
+
+func (ff *updaterFromFlags) DeferMetadataFilter() transform.MetadataFilterConfig {
+	ff.metadataFilterDeferred = true
+	return ff.transformFromFlags.MetadataFilterConfig()
+}
+
+func (ff *updaterFromFlags) SetCollectorName(name string) {
+	ff.updaterFromFlags.SetCollectorName(name)
+}
+
+func (ff *updaterFromFlags) SetPlanFunc(fn func(differ.Plan, error)) {
+	ff.planning = true
+	ff.updaterFromFlags.SetPlanFunc(fn)
+}
+
+// nopConsumer discards the objects produced by a standalone Updater that is
+// only planning changes.
+type nopConsumer struct{}
+
+func (nopConsumer) Consume(*poller.Objects) error { return nil }
+
 func (ff *updaterFromFlags) Make() (updater.Updater, error) {
 	var (
 		up  updater.Updater
 		xds adapter.XDS
 	)
 
+	pipeline, err := ff.transformFromFlags.Make()
+	if err != nil {
+		return nil, err
+	}
+
 	if ff.apiConfigFromFlags.APIKey() == "" {
-		if ff.disableXDS {
+		if ff.disableXDS && !ff.planning {
 			return nil, errors.New("no --api.key specified; " +
 				"cannot use standalone mode because xDS is disabled")
 		}
@@ -278,25 +353,41 @@ func (ff *updaterFromFlags) Make() (updater.Updater, error) {
 			ff.standaloneProxyName,
 			ff.standaloneZoneName,
 		)
-		newUpdater, registrar := ff.updaterFromFlags.MakeStandalone(
+		statsClient, err := ff.MakeStats()
+		if err != nil {
+			return nil, err
+		}
+
+		newUpdater, registrar, err := ff.updaterFromFlags.MakeStandalone(
 			ff.standalonePort,
 			ff.standaloneProxyName,
 			ff.standaloneZoneName,
+			statsClient,
 		)
-
-		var err error
-		xds, err = ff.xdsFromFlags.Make(registrar)
 		if err != nil {
 			return nil, err
 		}
-		up = newUpdater(xds)
+
+		if ff.planning {
+			up = newUpdater(nopConsumer{})
+		} else {
+			xds, err = ff.xdsFromFlags.Make(registrar)
+			if err != nil {
+				return nil, err
+			}
+			up = newUpdater(xds)
+		}
 	} else {
 		var (
 			svc service.All
 			err error
 		)
 
-		svc, xds, err = ff.mkSvcAndXDS()
+		if ff.planning {
+			svc, err = ff.apiClientFromFlags.Make()
+		} else {
+			svc, xds, err = ff.mkSvcAndXDS()
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -306,10 +397,30 @@ func (ff *updaterFromFlags) Make() (updater.Updater, error) {
 			return nil, err
 		}
 
-		up = ff.updaterFromFlags.Make(svc, zone)
+		statsClient, err := ff.MakeStats()
+		if err != nil {
+			return nil, err
+		}
+
+		up, err = ff.updaterFromFlags.Make(svc, zone, statsClient)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if ff.disableXDS {
+	if mfc := ff.transformFromFlags.MetadataFilterConfig(); !mfc.IsEmpty() && !ff.metadataFilterDeferred {
+		statsClient, err := ff.MakeStats()
+		if err != nil {
+			return nil, err
+		}
+		up = transform.WrapUpdater(transform.NewMetadataFilter(mfc, statsClient), up)
+	}
+
+	if pipeline != nil {
+		up = transform.WrapUpdater(pipeline, up)
+	}
+
+	if ff.disableXDS || ff.planning {
 		return up, nil
 	}
 
@@ -27,11 +27,14 @@ import (
 	"github.com/turbinelabs/api/service"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
 	"github.com/turbinelabs/rotor/constants"
+	"github.com/turbinelabs/rotor/differ"
+	"github.com/turbinelabs/rotor/pkg/transform"
 	"github.com/turbinelabs/rotor/updater"
 	"github.com/turbinelabs/rotor/xds/adapter"
 	"github.com/turbinelabs/rotor/xds/poller"
 	"github.com/turbinelabs/stats"
 	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
 )
 
 func TestNewUpdaterFromFlags(t *testing.T) {
@@ -64,6 +67,7 @@ func TestNewUpdaterFromFlags(t *testing.T) {
 	assert.NonNil(t, ffImpl.xdsFromFlags)
 	assert.NonNil(t, ffImpl.pollerFromFlags)
 	assert.NonNil(t, ffImpl.statsFromFlags)
+	assert.NonNil(t, ffImpl.transformFromFlags)
 	assert.NonNil(t, ffImpl.startXDS)
 	assert.NonNil(t, ffImpl.pollLoop)
 }
@@ -111,6 +115,7 @@ func newUFFMocks(t *testing.T) *uffMocks {
 		xdsFromFlags:        uffm.xdsFromFlags,
 		pollerFromFlags:     uffm.pollerFromFlags,
 		statsFromFlags:      uffm.statsFromFlags,
+		transformFromFlags:  transform.NewFromFlags(tbnflag.NewTestFlagSet()),
 		standalonePort:      1234,
 		standaloneProxyName: "that-cluster",
 		standaloneZoneName:  "that-zone",
@@ -215,7 +220,7 @@ func TestUpdaterFromFlagsValidateXDSErr(t *testing.T) {
 func TestUpdaterFromFlagsValidateApiKeyNoZoneName(t *testing.T) {
 	err := errors.New("--api.zone-name must be specified if --api.key is specified")
 	uffValidateTestCase{
-		apiKey: "apikey",
+		apiKey:                   "apikey",
 		exitBeforeClientValidate: true,
 		wantErr:                  err,
 	}.run(t)
@@ -272,6 +277,7 @@ type uffMakeTestCase struct {
 	updaterMakeErr   error
 	statsMakeErr     error
 	xdsMakeErr       error
+	transformConfig  string
 	wantStandalone   bool
 	wantErr          error
 }
@@ -282,6 +288,15 @@ func (tc uffMakeTestCase) run(t *testing.T) {
 	mocks.ff.startXDS = mocks.ff.syncStartXDS
 	mocks.ff.pollLoop = syncPollLoop
 
+	if tc.transformConfig != "" {
+		file, cleanup := tempfile.Write(t, tc.transformConfig, "transform")
+		defer cleanup()
+
+		flagset := tbnflag.NewTestFlagSet()
+		mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+		flagset.Parse([]string{"-config-file", file})
+	}
+
 	mockXDS := adapter.NewMockXDS(mocks.ctrl)
 	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
 	mockRegistrar := poller.NewMockRegistrar(mocks.ctrl)
@@ -306,13 +321,18 @@ func (tc uffMakeTestCase) run(t *testing.T) {
 			return
 		}
 
-		if tc.disableXDS {
-			assert.Equal(t, got, mockUpdater)
-		} else {
+		if !tc.disableXDS {
 			ux, ok := got.(*updaterWithXDS)
 			assert.True(t, ok)
-			assert.Equal(t, ux.Updater, mockUpdater)
 			assert.Equal(t, ux.xds, mockXDS)
+			got = ux.Updater
+		}
+
+		if tc.transformConfig != "" {
+			mocks.expect(mockUpdater.EXPECT().Replace([]api.Cluster{{Name: "c"}}))
+			got.Replace([]api.Cluster{{Name: "c"}, {Name: "c-canary"}})
+		} else {
+			assert.Equal(t, got, mockUpdater)
 		}
 	})
 
@@ -329,10 +349,13 @@ func (tc uffMakeTestCase) run(t *testing.T) {
 			assert.DeepEqual(t, c, mockXDS)
 			return mockUpdater
 		}
+		sc := stats.NewMockStats(mocks.ctrl)
 		mocks.expect(
+			mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+			sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
 			mocks.updaterFromFlags.EXPECT().
-				MakeStandalone(1234, "that-cluster", "that-zone").
-				Return(newUpdater, mockRegistrar),
+				MakeStandalone(1234, "that-cluster", "that-zone", sc).
+				Return(newUpdater, mockRegistrar, nil),
 		)
 
 		if tc.xdsMakeErr != nil {
@@ -357,13 +380,13 @@ func (tc uffMakeTestCase) run(t *testing.T) {
 	svc := service.NewMockAll(mocks.ctrl)
 	mocks.expect(mocks.apiClientFromFlags.EXPECT().Make().Return(svc, nil))
 
+	sc := stats.NewMockStats(mocks.ctrl)
 	if !tc.disableXDS {
 		if tc.statsMakeErr != nil {
 			mocks.expect(mocks.statsFromFlags.EXPECT().Make().Return(nil, tc.statsMakeErr))
 			return
 		}
 
-		sc := stats.NewMockStats(mocks.ctrl)
 		ca := poller.NewMockPoller(mocks.ctrl)
 
 		mocks.expect(
@@ -393,10 +416,18 @@ func (tc uffMakeTestCase) run(t *testing.T) {
 	}
 
 	z := api.Zone{ZoneKey: "zk"}
-	mocks.expect(
-		zoneRef.EXPECT().Get(svc).Return(z, nil),
-		mocks.updaterFromFlags.EXPECT().Make(svc, z).Return(mockUpdater),
-	)
+	mocks.expect(zoneRef.EXPECT().Get(svc).Return(z, nil))
+	if tc.disableXDS {
+		mocks.expect(
+			mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+			sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
+		)
+	}
+	if tc.updaterMakeErr != nil {
+		mocks.expect(mocks.updaterFromFlags.EXPECT().Make(svc, z, sc).Return(nil, tc.updaterMakeErr))
+		return
+	}
+	mocks.expect(mocks.updaterFromFlags.EXPECT().Make(svc, z, sc).Return(mockUpdater, nil))
 }
 
 func (tc uffMakeTestCase) runMakeXDS(t *testing.T) {
@@ -405,6 +436,15 @@ func (tc uffMakeTestCase) runMakeXDS(t *testing.T) {
 	mocks.ff.startXDS = mocks.ff.syncStartXDS
 	mocks.ff.pollLoop = syncPollLoop
 
+	if tc.transformConfig != "" {
+		file, cleanup := tempfile.Write(t, tc.transformConfig, "transform")
+		defer cleanup()
+
+		flagset := tbnflag.NewTestFlagSet()
+		mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+		flagset.Parse([]string{"-config-file", file})
+	}
+
 	mockXDS := adapter.NewMockXDS(mocks.ctrl)
 
 	defer mocks.finish(func() {
@@ -488,6 +528,15 @@ func TestUpdaterFromFlagsMakeZoneErr(t *testing.T) {
 	}.run(t)
 }
 
+func TestUpdaterFromFlagsMakeUpdaterErr(t *testing.T) {
+	err := errors.New("boom")
+	uffMakeTestCase{
+		apiKey:         "apikey",
+		updaterMakeErr: err,
+		wantErr:        err,
+	}.run(t)
+}
+
 func TestUpdaterFromFlagsMakeXDSFromFlagsErr(t *testing.T) {
 	err := errors.New("boom")
 	uffMakeTestCase{
@@ -503,6 +552,172 @@ func TestUpdaterFromFlagsMake(t *testing.T) {
 	}.run(t)
 }
 
+func TestUpdaterFromFlagsMakeWithTransform(t *testing.T) {
+	uffMakeTestCase{
+		apiKey:          "apikey",
+		transformConfig: "transforms:\n  - exclude: -canary$\n",
+	}.run(t)
+}
+
+func TestUpdaterFromFlagsMakeStandaloneWithTransform(t *testing.T) {
+	uffMakeTestCase{
+		transformConfig: "transforms:\n  - exclude: -canary$\n",
+		wantStandalone:  true,
+	}.run(t)
+}
+
+func TestUpdaterFromFlagsMakeWithMetadataFilter(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	flagset := tbnflag.NewTestFlagSet()
+	mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+	flagset.Parse([]string{"-metadata-deny", "hash"})
+	mocks.ff.disableXDS = true
+
+	svc := service.NewMockAll(mocks.ctrl)
+	zoneRef := service.NewMockZoneRef(mocks.ctrl)
+	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
+	sc := stats.NewMockStats(mocks.ctrl)
+	zone := api.Zone{Name: "z"}
+
+	gomock.InOrder(
+		mocks.apiConfigFromFlags.EXPECT().APIKey().Return("apikey"),
+		mocks.apiClientFromFlags.EXPECT().Make().Return(svc, nil),
+		mocks.zoneFromFlags.EXPECT().Ref().Return(zoneRef),
+		zoneRef.EXPECT().Get(svc).Return(zone, nil),
+		mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+		sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
+		mocks.updaterFromFlags.EXPECT().Make(svc, zone, sc).Return(mockUpdater, nil),
+		sc.EXPECT().Count("metadata.dropped_keys", 1.0, stats.NewKVTag("metadata_key", "hash")),
+		mockUpdater.EXPECT().Replace([]api.Cluster{
+			{Name: "c", Instances: api.Instances{{Host: "h", Port: 1, Metadata: api.Metadata{}}}},
+		}),
+	)
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, err)
+	got.Replace([]api.Cluster{
+		{
+			Name:      "c",
+			Instances: api.Instances{{Host: "h", Port: 1, Metadata: api.Metadata{{Key: "hash", Value: "x"}}}},
+		},
+	})
+}
+
+func TestUpdaterFromFlagsDeferMetadataFilter(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	flagset := tbnflag.NewTestFlagSet()
+	mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+	flagset.Parse([]string{"-metadata-deny", "hash"})
+	mocks.ff.disableXDS = true
+
+	assert.ArrayEqual(t, mocks.ff.DeferMetadataFilter().Deny, []string{"hash"})
+
+	svc := service.NewMockAll(mocks.ctrl)
+	zoneRef := service.NewMockZoneRef(mocks.ctrl)
+	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
+	sc := stats.NewMockStats(mocks.ctrl)
+	zone := api.Zone{Name: "z"}
+
+	gomock.InOrder(
+		mocks.apiConfigFromFlags.EXPECT().APIKey().Return("apikey"),
+		mocks.apiClientFromFlags.EXPECT().Make().Return(svc, nil),
+		mocks.zoneFromFlags.EXPECT().Ref().Return(zoneRef),
+		zoneRef.EXPECT().Get(svc).Return(zone, nil),
+		mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+		sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
+		mocks.updaterFromFlags.EXPECT().Make(svc, zone, sc).Return(mockUpdater, nil),
+	)
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, err)
+	assert.Equal(t, got, mockUpdater)
+}
+
+// The metadata filter runs after the transform pipeline unless it is
+// deferred, in which case the plugin applies it to each collector's clusters
+// before they reach the pipeline.
+func TestUpdaterFromFlagsMetadataFilterAfterTransforms(t *testing.T) {
+	testMetadataFilterOrder(t, false)
+}
+
+func TestUpdaterFromFlagsDeferredMetadataFilterBeforeTransforms(t *testing.T) {
+	testMetadataFilterOrder(t, true)
+}
+
+func testMetadataFilterOrder(t *testing.T, deferred bool) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	file, cleanup := tempfile.Write(t, "transforms:\n  - metadata:\n      add: {hash: x}\n", "transform")
+	defer cleanup()
+
+	flagset := tbnflag.NewTestFlagSet()
+	mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+	flagset.Parse([]string{"-config-file", file, "-metadata-deny", "hash"})
+	mocks.ff.disableXDS = true
+
+	if deferred {
+		mocks.ff.DeferMetadataFilter()
+	}
+
+	svc := service.NewMockAll(mocks.ctrl)
+	zoneRef := service.NewMockZoneRef(mocks.ctrl)
+	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
+	sc := stats.NewMockStats(mocks.ctrl)
+	zone := api.Zone{Name: "z"}
+
+	want := api.Metadata{}
+	if deferred {
+		want = api.Metadata{{Key: "hash", Value: "x"}}
+	}
+
+	calls := []*gomock.Call{
+		mocks.apiConfigFromFlags.EXPECT().APIKey().Return("apikey"),
+		mocks.apiClientFromFlags.EXPECT().Make().Return(svc, nil),
+		mocks.zoneFromFlags.EXPECT().Ref().Return(zoneRef),
+		zoneRef.EXPECT().Get(svc).Return(zone, nil),
+		mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+		sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
+		mocks.updaterFromFlags.EXPECT().Make(svc, zone, sc).Return(mockUpdater, nil),
+	}
+	if !deferred {
+		calls = append(
+			calls,
+			sc.EXPECT().Count("metadata.dropped_keys", 1.0, stats.NewKVTag("metadata_key", "hash")),
+		)
+	}
+	calls = append(
+		calls,
+		mockUpdater.EXPECT().Replace([]api.Cluster{
+			{Name: "c", Instances: api.Instances{{Host: "h", Port: 1, Metadata: want}}},
+		}),
+	)
+	gomock.InOrder(calls...)
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, err)
+	got.Replace([]api.Cluster{
+		{Name: "c", Instances: api.Instances{{Host: "h", Port: 1}}},
+	})
+}
+
+func TestUpdaterFromFlagsMakeTransformErr(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	flagset := tbnflag.NewTestFlagSet()
+	mocks.ff.transformFromFlags = transform.NewFromFlags(flagset)
+	flagset.Parse([]string{"-config-file", "/nonexistent/transform.yaml"})
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "no such file or directory")
+}
+
 func TestUpdaterFromFlagsMakeDisabledXDS(t *testing.T) {
 	uffMakeTestCase{
 		disableXDS: true,
@@ -542,3 +757,87 @@ func TestUpdaterFromFlagsMakeXDSWithDisabledXDS(t *testing.T) {
 		wantErr:    err,
 	}.runMakeXDS(t)
 }
+
+func TestUpdaterFromFlagsMakeStats(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	sc := stats.NewMockStats(mocks.ctrl)
+	gomock.InOrder(
+		mocks.statsFromFlags.EXPECT().Make().Return(sc, nil),
+		sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion)),
+	)
+
+	got, err := mocks.ff.MakeStats()
+	assert.Nil(t, err)
+	assert.SameInstance(t, got, sc)
+
+	got, err = mocks.ff.MakeStats()
+	assert.Nil(t, err)
+	assert.SameInstance(t, got, sc)
+}
+
+func TestUpdaterFromFlagsMakeStatsError(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	err := errors.New("boom")
+	mocks.statsFromFlags.EXPECT().Make().Return(nil, err)
+
+	got, gotErr := mocks.ff.MakeStats()
+	assert.Nil(t, got)
+	assert.Equal(t, gotErr, err)
+}
+
+func TestUpdaterFromFlagsMakeStandalonePlan(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	mocks.ff.disableXDS = true
+	mocks.updaterFromFlags.EXPECT().SetPlanFunc(gomock.Any())
+	mocks.ff.SetPlanFunc(func(differ.Plan, error) {})
+
+	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
+	newUpdater := func(c poller.Consumer) updater.Updater {
+		assert.Equal(t, c, nopConsumer{})
+		return mockUpdater
+	}
+
+	sc := stats.NewMockStats(mocks.ctrl)
+	mocks.apiConfigFromFlags.EXPECT().APIKey().Return("")
+	mocks.statsFromFlags.EXPECT().Make().Return(sc, nil)
+	sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion))
+	mocks.updaterFromFlags.EXPECT().
+		MakeStandalone(1234, "that-cluster", "that-zone", sc).
+		Return(newUpdater, poller.NewMockRegistrar(mocks.ctrl), nil)
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, err)
+	assert.Equal(t, got, mockUpdater)
+}
+
+func TestUpdaterFromFlagsMakePlan(t *testing.T) {
+	mocks := newUFFMocks(t)
+	defer mocks.ctrl.Finish()
+
+	mocks.updaterFromFlags.EXPECT().SetPlanFunc(gomock.Any())
+	mocks.ff.SetPlanFunc(func(differ.Plan, error) {})
+
+	svc := service.NewMockAll(mocks.ctrl)
+	zoneRef := service.NewMockZoneRef(mocks.ctrl)
+	z := api.Zone{ZoneKey: "zk"}
+	sc := stats.NewMockStats(mocks.ctrl)
+	mockUpdater := updater.NewMockUpdater(mocks.ctrl)
+
+	mocks.apiConfigFromFlags.EXPECT().APIKey().Return("apikey")
+	mocks.apiClientFromFlags.EXPECT().Make().Return(svc, nil)
+	mocks.zoneFromFlags.EXPECT().Ref().Return(zoneRef)
+	zoneRef.EXPECT().Get(svc).Return(z, nil)
+	mocks.statsFromFlags.EXPECT().Make().Return(sc, nil)
+	sc.EXPECT().AddTags(stats.NewKVTag(stats.ProxyVersionTag, constants.TbnPublicVersion))
+	mocks.updaterFromFlags.EXPECT().Make(svc, z, sc).Return(mockUpdater, nil)
+
+	got, err := mocks.ff.Make()
+	assert.Nil(t, err)
+	assert.Equal(t, got, mockUpdater)
+}
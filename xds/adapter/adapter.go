@@ -22,15 +22,18 @@ package adapter
 import (
 	"encoding/base64"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/types"
 
 	tbnapi "github.com/turbinelabs/api"
@@ -151,6 +154,26 @@ func newSnapshotAdapter(
 	}
 }
 
+// resourceVersions returns a version for each of the given Resources, keyed
+// by name. Versions are derived from the content of each Resource, so that a
+// Resource that is unchanged between snapshots retains its version, and
+// incremental xDS clients are sent only the Resources that changed.
+func resourceVersions(resources map[string]cache.Resource) (map[string]string, error) {
+	// jsonpb orders map keys, making the output stable where the binary
+	// encoding is not.
+	marshaler := &jsonpb.Marshaler{}
+
+	versions := make(map[string]string, len(resources))
+	for name, resource := range resources {
+		h := fnv.New64a()
+		if err := marshaler.Marshal(h, resource); err != nil {
+			return nil, fmt.Errorf("could not version resource %s: %s", name, err)
+		}
+		versions[name] = strconv.FormatUint(h.Sum64(), 36)
+	}
+	return versions, nil
+}
+
 // newEndpointAdapter returns a resourceAdapter that produces Endpoint
 // Resources.
 func newEndpointAdapter(resolveDNS bool) resourceAdapter {
@@ -163,9 +186,11 @@ func newEndpointAdapter(resolveDNS bool) resourceAdapter {
 // newClusterAdapter returns a resourceAdapter that produces Cluster Resources.
 // If non-empty, the caFile string specifies a path for the certificate
 // authority, which must be present on the Envoy serving traffic to these
-// Clusters.
-func newClusterAdapter(caFile string) clusterAdapter {
-	return cds{caFile: caFile}
+// Clusters. If ads is true, Clusters reference the aggregated discovery
+// service for their endpoints. Otherwise, if delta is true, Clusters
+// reference the incremental endpoint discovery service.
+func newClusterAdapter(caFile string, ads, delta bool) clusterAdapter {
+	return cds{caFile: caFile, ads: ads, delta: delta}
 }
 
 // newRouteAdapter returns a resourceAdapter that produces Route Resources. The
@@ -177,9 +202,12 @@ func newRouteAdapter(defaultTimeout time.Duration) resourceAdapter {
 
 // newListenerAdapter returns a resourceAdapter that produces Listener
 // Resources. The loggingCluster argument specifies the AccessLogService cluster
-// name to be used when configuring logging for each Listener.
-func newListenerAdapter(loggingCluster string) listenerAdapter {
-	return lds{loggingCluster: loggingCluster}
+// name to be used when configuring logging for each Listener. If ads is true,
+// Listeners reference the aggregated discovery service for their routes.
+// Otherwise, if delta is true, Listeners reference the incremental route
+// discovery service.
+func newListenerAdapter(loggingCluster string, ads, delta bool) listenerAdapter {
+	return lds{loggingCluster: loggingCluster, ads: ads, delta: delta}
 }
 
 // constants used when handing out configs for other xDS resources,
@@ -210,8 +238,46 @@ var (
 			},
 		},
 	}
+
+	deltaClusterConfig = envoycore.ConfigSource{
+		ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
+			ApiConfigSource: &envoycore.ApiConfigSource{
+				ApiType: envoycore.ApiConfigSource_DELTA_GRPC,
+				GrpcServices: []*envoycore.GrpcService{
+					{
+						TargetSpecifier: &envoycore.GrpcService_EnvoyGrpc_{
+							EnvoyGrpc: &envoycore.GrpcService_EnvoyGrpc{
+								ClusterName: xdsClusterName,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	adsClusterConfig = envoycore.ConfigSource{
+		ConfigSourceSpecifier: &envoycore.ConfigSource_Ads{
+			Ads: &envoycore.AggregatedConfigSource{},
+		},
+	}
 )
 
+// xdsConfigSource returns the ConfigSource used to reference other xDS
+// resources served by this service: the aggregated discovery service if ads
+// is true, and otherwise the individual discovery service for the resource,
+// incremental if delta is true.
+func xdsConfigSource(ads, delta bool) *envoycore.ConfigSource {
+	switch {
+	case ads:
+		return &adsClusterConfig
+	case delta:
+		return &deltaClusterConfig
+	default:
+		return &xdsClusterConfig
+	}
+}
+
 func mkEnvoyAddress(host string, port int) *envoycore.Address {
 	return &envoycore.Address{
 		Address: &envoycore.Address_SocketAddress{
@@ -253,22 +319,15 @@ func isHTTPSRedirect(host string, rd tbnapi.Redirect) bool {
 	nameOk := rd.Name == httpsRedirectName
 	fromOk := rd.From == "(.*)"
 
-	u, err := url.Parse(rd.To)
+	// The capture group must terminate the destination. Strip it before
+	// parsing since url.Parse rejects ports with trailing garbage.
+	to := strings.TrimSuffix(rd.To, "$1")
+	u, err := url.Parse(to)
 	// who knows what happened here, but it's not a redirect
 	if err != nil {
 		return false
 	}
-	hostPortOk := false
-	// Url parsing is a bit weird when it comes to including capture groups.
-	// Depending on whether there's a port specified, the '$1' will end up
-	// in a different spot.
-	switch {
-	case u.Hostname() == "$host" || u.Hostname() == host:
-		hostPortOk = strings.HasSuffix(u.Port(), "$1") && strings.Count(u.Port(), "$1") == 1
-
-	case u.Hostname() == "$host$1" || u.Hostname() == fmt.Sprintf("%s$1", host):
-		hostPortOk = u.Port() == ""
-	}
+	hostPortOk := to != rd.To && (u.Hostname() == "$host" || u.Hostname() == host)
 
 	destPathOk := u.EscapedPath() == ""
 	toOk := u.Scheme == "https" && hostPortOk && destPathOk
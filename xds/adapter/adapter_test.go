@@ -40,7 +40,7 @@ import (
 func mkTestListener(name, host string, port uint32) *envoyapi.Listener {
 	return &envoyapi.Listener{
 		Name: name,
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{
 					Protocol: envoycore.TCP,
@@ -388,7 +388,7 @@ func TestNewSnapshotAdapterStaticLoadAssignmentsOverwrite(t *testing.T) {
 func ifaceToValue(tb testing.TB, i interface{}) *types.Value {
 	if i == nil {
 		return &types.Value{
-			Kind: &types.Value_NullValue{NullValue: types.NULL_VALUE},
+			Kind: &types.Value_NullValue{NullValue: types.NullValue_NULL_VALUE},
 		}
 	}
 
@@ -836,3 +836,25 @@ func TestTimeDurationPtrToInt(t *testing.T) {
 		10,
 	)
 }
+
+func TestResourceVersions(t *testing.T) {
+	a := &envoyapi.Cluster{Name: "a"}
+	versions, err := resourceVersions(map[string]cache.Resource{
+		"a": a,
+		"b": &envoyapi.Cluster{Name: "b"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, len(versions), 2)
+	assert.NotEqual(t, versions["a"], versions["b"])
+
+	again, err := resourceVersions(map[string]cache.Resource{
+		"a": &envoyapi.Cluster{Name: "a"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, again["a"], versions["a"])
+
+	a.LbPolicy = envoyapi.Cluster_RANDOM
+	changed, err := resourceVersions(map[string]cache.Resource{"a": a})
+	assert.Nil(t, err)
+	assert.NotEqual(t, changed["a"], versions["a"])
+}
@@ -333,7 +333,7 @@ func testStreamAccessLogs(t *testing.T, mode string, setStartTime bool) {
 										Address: &core.Address_SocketAddress{
 											SocketAddress: &core.SocketAddress{
 												Address:       "1.2.3.4",
-												PortSpecifier: &core.SocketAddress_PortValue{9999},
+												PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9999},
 											},
 										},
 									},
@@ -447,7 +447,7 @@ func TestStreamAccessLogsMultipleMessages(t *testing.T) {
 										Address: &core.Address_SocketAddress{
 											SocketAddress: &core.SocketAddress{
 												Address:       "1.2.3.4",
-												PortSpecifier: &core.SocketAddress_PortValue{9999},
+												PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9999},
 											},
 										},
 									},
@@ -476,7 +476,7 @@ func TestStreamAccessLogsMultipleMessages(t *testing.T) {
 										Address: &core.Address_SocketAddress{
 											SocketAddress: &core.SocketAddress{
 												Address:       "1.2.3.4",
-												PortSpecifier: &core.SocketAddress_PortValue{9999},
+												PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9999},
 											},
 										},
 									},
@@ -548,7 +548,7 @@ func TestStreamAccessLogsMultipleMessagesAndChangingLogName(t *testing.T) {
 										Address: &core.Address_SocketAddress{
 											SocketAddress: &core.SocketAddress{
 												Address:       "1.2.3.4",
-												PortSpecifier: &core.SocketAddress_PortValue{9999},
+												PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9999},
 											},
 										},
 									},
@@ -580,7 +580,7 @@ func TestStreamAccessLogsMultipleMessagesAndChangingLogName(t *testing.T) {
 										Address: &core.Address_SocketAddress{
 											SocketAddress: &core.SocketAddress{
 												Address:       "1.2.3.4",
-												PortSpecifier: &core.SocketAddress_PortValue{9999},
+												PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9999},
 											},
 										},
 									},
@@ -655,7 +655,7 @@ func TestAddrToString(t *testing.T) {
 			Address: &core.Address_SocketAddress{
 				SocketAddress: &core.SocketAddress{
 					Address:       "2.3.4.5",
-					PortSpecifier: &core.SocketAddress_PortValue{8888},
+					PortSpecifier: &core.SocketAddress_PortValue{PortValue: 8888},
 				},
 			},
 		}),
@@ -667,7 +667,7 @@ func TestAddrToString(t *testing.T) {
 			Address: &core.Address_SocketAddress{
 				SocketAddress: &core.SocketAddress{
 					Address:       "2.3.4.5",
-					PortSpecifier: &core.SocketAddress_NamedPort{"http"},
+					PortSpecifier: &core.SocketAddress_NamedPort{NamedPort: "http"},
 				},
 			},
 		}),
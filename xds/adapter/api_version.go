@@ -0,0 +1,494 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	accesslog "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	envoydiscovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/envoyproxy/go-control-plane/pkg/server"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc"
+)
+
+// Rotor serves Envoy's v2 and v3 xDS APIs side by side. Each resource type
+// is served in the version of the type URL Envoy requests it with, whether
+// the request arrives over a v2 or a v3 service, so the resource and
+// transport API versions may be migrated independently. Requests for v3
+// type URLs are answered from the v2 caches, and the responses translated
+// to v3 (see v3_resources.go). The v3 xDS and ALS messages are wire
+// compatible with their v2 counterparts, so the v3 services are served by
+// the v2 servers.
+
+// apiVersions records, for each resource type requested on a stream,
+// whether it was requested with its v2 or v3 type URL.
+type apiVersions struct {
+	defaultTypeURL string
+
+	mu sync.Mutex
+	v3 map[string]bool
+}
+
+// newAPIVersions returns an apiVersions for a stream whose requests, if
+// they omit their type URL, request the given type URL.
+func newAPIVersions(defaultTypeURL string) *apiVersions {
+	return &apiVersions{defaultTypeURL: defaultTypeURL, v3: map[string]bool{}}
+}
+
+// request records the version of a requested type URL and returns its v2
+// equivalent.
+func (v *apiVersions) request(typeURL string) string {
+	if typeURL == "" {
+		typeURL = v.defaultTypeURL
+	}
+
+	v2TypeURL, isV3 := v2TypeURLs[typeURL]
+	if !isV3 {
+		v2TypeURL = typeURL
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.v3[v2TypeURL] = isV3
+
+	return v2TypeURL
+}
+
+// v3TypeURL returns the v3 equivalent of the given v2 type URL, and true,
+// if it was last requested with its v3 type URL.
+func (v *apiVersions) v3TypeURL(typeURL string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.v3[typeURL] {
+		return "", false
+	}
+	return v3TypeURLs[typeURL], true
+}
+
+// response returns the given response, translated to v3 if its type was
+// requested with a v3 type URL.
+func (v *apiVersions) response(resp *envoyapi.DiscoveryResponse) (*envoyapi.DiscoveryResponse, error) {
+	typeURL, ok := v.v3TypeURL(resp.GetTypeUrl())
+	if !ok {
+		return resp, nil
+	}
+
+	// The response may be retained by callbacks, so translate a copy.
+	out := *resp
+	out.TypeUrl = typeURL
+	out.Resources = make([]*types.Any, len(resp.Resources))
+	for i, resource := range resp.Resources {
+		r, err := v3Resource(resource)
+		if err != nil {
+			return nil, err
+		}
+		out.Resources[i] = r
+	}
+
+	return &out, nil
+}
+
+// deltaResponse returns the given incremental response, translated to v3 if
+// its type was requested with a v3 type URL.
+func (v *apiVersions) deltaResponse(
+	resp *envoyapi.DeltaDiscoveryResponse,
+) (*envoyapi.DeltaDiscoveryResponse, error) {
+	typeURL, ok := v.v3TypeURL(resp.GetTypeUrl())
+	if !ok {
+		return resp, nil
+	}
+
+	out := *resp
+	out.TypeUrl = typeURL
+	out.Resources = make([]*envoyapi.Resource, len(resp.Resources))
+	for i, resource := range resp.Resources {
+		r, err := v3Resource(resource.GetResource())
+		if err != nil {
+			return nil, err
+		}
+		translated := *resource
+		translated.Resource = r
+		out.Resources[i] = &translated
+	}
+
+	return &out, nil
+}
+
+// versionedStream serves a state-of-the-world xDS stream of either API
+// version to a v2 server.
+type versionedStream struct {
+	grpc.ServerStream
+	versions *apiVersions
+}
+
+func (s *versionedStream) Recv() (*envoyapi.DiscoveryRequest, error) {
+	req := &envoyapi.DiscoveryRequest{}
+	if err := s.RecvMsg(req); err != nil {
+		return nil, err
+	}
+	req.TypeUrl = s.versions.request(req.GetTypeUrl())
+	return req, nil
+}
+
+func (s *versionedStream) Send(resp *envoyapi.DiscoveryResponse) error {
+	resp, err := s.versions.response(resp)
+	if err != nil {
+		return err
+	}
+	return s.SendMsg(resp)
+}
+
+// versionedDeltaStream serves an incremental xDS stream of either API
+// version to a v2 server.
+type versionedDeltaStream struct {
+	grpc.ServerStream
+	versions *apiVersions
+}
+
+func (s *versionedDeltaStream) Recv() (*envoyapi.DeltaDiscoveryRequest, error) {
+	req := &envoyapi.DeltaDiscoveryRequest{}
+	if err := s.RecvMsg(req); err != nil {
+		return nil, err
+	}
+	req.TypeUrl = s.versions.request(req.GetTypeUrl())
+	return req, nil
+}
+
+func (s *versionedDeltaStream) Send(resp *envoyapi.DeltaDiscoveryResponse) error {
+	resp, err := s.versions.deltaResponse(resp)
+	if err != nil {
+		return err
+	}
+	return s.SendMsg(resp)
+}
+
+// versionedServer serves the v2 xDS services, and, via the ServiceDescs in
+// v3DiscoveryServices, the v3 xDS services, from an xdsServer.
+type versionedServer struct {
+	xdsServer
+}
+
+var _ server.Server = versionedServer{}
+
+// serveStream serves a state-of-the-world stream for the given v2 type URL
+// (or cache.AnyType for ADS). Requests that omit their type URL request
+// defaultTypeURL, if it is not empty.
+func (s versionedServer) serveStream(stream grpc.ServerStream, typeURL, defaultTypeURL string) error {
+	vs := &versionedStream{ServerStream: stream, versions: newAPIVersions(defaultTypeURL)}
+
+	switch typeURL {
+	case cache.ClusterType:
+		return s.xdsServer.StreamClusters(vs)
+	case cache.EndpointType:
+		return s.xdsServer.StreamEndpoints(vs)
+	case cache.RouteType:
+		return s.xdsServer.StreamRoutes(vs)
+	case cache.ListenerType:
+		return s.xdsServer.StreamListeners(vs)
+	default:
+		return s.xdsServer.StreamAggregatedResources(vs)
+	}
+}
+
+// serveDelta serves an incremental stream, as serveStream does.
+func (s versionedServer) serveDelta(stream grpc.ServerStream, typeURL, defaultTypeURL string) error {
+	vs := &versionedDeltaStream{ServerStream: stream, versions: newAPIVersions(defaultTypeURL)}
+	return s.delta.handler(vs, typeURL)
+}
+
+// serveFetch serves a fetch for the given v2 type URL, translating the
+// response to v3 if the request's type URL, or defaultTypeURL if it has
+// none, is a v3 type URL.
+func (s versionedServer) serveFetch(
+	ctx context.Context,
+	req *envoyapi.DiscoveryRequest,
+	typeURL string,
+	defaultTypeURL string,
+) (*envoyapi.DiscoveryResponse, error) {
+	versions := newAPIVersions(defaultTypeURL)
+	versions.request(req.GetTypeUrl())
+	req.TypeUrl = typeURL
+
+	resp, err := s.Fetch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return versions.response(resp)
+}
+
+func (s versionedServer) StreamAggregatedResources(
+	stream envoydiscovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer,
+) error {
+	return s.serveStream(stream, cache.AnyType, "")
+}
+
+func (s versionedServer) DeltaAggregatedResources(
+	stream envoydiscovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+) error {
+	return s.serveDelta(stream, cache.AnyType, "")
+}
+
+func (s versionedServer) StreamClusters(stream envoyapi.ClusterDiscoveryService_StreamClustersServer) error {
+	return s.serveStream(stream, cache.ClusterType, "")
+}
+
+func (s versionedServer) DeltaClusters(stream envoyapi.ClusterDiscoveryService_DeltaClustersServer) error {
+	return s.serveDelta(stream, cache.ClusterType, "")
+}
+
+func (s versionedServer) FetchClusters(
+	ctx context.Context,
+	req *envoyapi.DiscoveryRequest,
+) (*envoyapi.DiscoveryResponse, error) {
+	return s.serveFetch(ctx, req, cache.ClusterType, "")
+}
+
+func (s versionedServer) StreamEndpoints(stream envoyapi.EndpointDiscoveryService_StreamEndpointsServer) error {
+	return s.serveStream(stream, cache.EndpointType, "")
+}
+
+func (s versionedServer) DeltaEndpoints(stream envoyapi.EndpointDiscoveryService_DeltaEndpointsServer) error {
+	return s.serveDelta(stream, cache.EndpointType, "")
+}
+
+func (s versionedServer) FetchEndpoints(
+	ctx context.Context,
+	req *envoyapi.DiscoveryRequest,
+) (*envoyapi.DiscoveryResponse, error) {
+	return s.serveFetch(ctx, req, cache.EndpointType, "")
+}
+
+func (s versionedServer) StreamRoutes(stream envoyapi.RouteDiscoveryService_StreamRoutesServer) error {
+	return s.serveStream(stream, cache.RouteType, "")
+}
+
+func (s versionedServer) DeltaRoutes(stream envoyapi.RouteDiscoveryService_DeltaRoutesServer) error {
+	return s.serveDelta(stream, cache.RouteType, "")
+}
+
+func (s versionedServer) FetchRoutes(
+	ctx context.Context,
+	req *envoyapi.DiscoveryRequest,
+) (*envoyapi.DiscoveryResponse, error) {
+	return s.serveFetch(ctx, req, cache.RouteType, "")
+}
+
+func (s versionedServer) StreamListeners(stream envoyapi.ListenerDiscoveryService_StreamListenersServer) error {
+	return s.serveStream(stream, cache.ListenerType, "")
+}
+
+func (s versionedServer) DeltaListeners(stream envoyapi.ListenerDiscoveryService_DeltaListenersServer) error {
+	return s.serveDelta(stream, cache.ListenerType, "")
+}
+
+func (s versionedServer) FetchListeners(
+	ctx context.Context,
+	req *envoyapi.DiscoveryRequest,
+) (*envoyapi.DiscoveryResponse, error) {
+	return s.serveFetch(ctx, req, cache.ListenerType, "")
+}
+
+// v3DiscoveryServices describe the v3 xDS services, to be registered with a
+// versionedServer.
+var v3DiscoveryServices = []grpc.ServiceDesc{
+	v3DiscoveryService(
+		"envoy.service.discovery.v3.AggregatedDiscoveryService",
+		"AggregatedResources",
+		cache.AnyType,
+		"envoy/service/discovery/v3/ads.proto",
+	),
+	v3DiscoveryService(
+		"envoy.service.cluster.v3.ClusterDiscoveryService",
+		"Clusters",
+		cache.ClusterType,
+		"envoy/service/cluster/v3/cds.proto",
+	),
+	v3DiscoveryService(
+		"envoy.service.endpoint.v3.EndpointDiscoveryService",
+		"Endpoints",
+		cache.EndpointType,
+		"envoy/service/endpoint/v3/eds.proto",
+	),
+	v3DiscoveryService(
+		"envoy.service.route.v3.RouteDiscoveryService",
+		"Routes",
+		cache.RouteType,
+		"envoy/service/route/v3/rds.proto",
+	),
+	v3DiscoveryService(
+		"envoy.service.listener.v3.ListenerDiscoveryService",
+		"Listeners",
+		cache.ListenerType,
+		"envoy/service/listener/v3/lds.proto",
+	),
+}
+
+// v3DiscoveryService describes a v3 xDS service, with Stream, Delta and
+// (except for ADS) Fetch methods for the given resources, served by a
+// versionedServer for the given v2 type URL.
+func v3DiscoveryService(serviceName, resources, typeURL, metadata string) grpc.ServiceDesc {
+	// Requests to the v3 services request v3 resources by default.
+	defaultTypeURL := v3TypeURLs[typeURL]
+
+	desc := grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*server.Server)(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "Stream" + resources,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					return srv.(versionedServer).serveStream(stream, typeURL, defaultTypeURL)
+				},
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+			{
+				StreamName: "Delta" + resources,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					return srv.(versionedServer).serveDelta(stream, typeURL, defaultTypeURL)
+				},
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+		},
+		Metadata: metadata,
+	}
+
+	if typeURL == cache.AnyType {
+		return desc
+	}
+
+	method := "Fetch" + resources
+	desc.Methods = []grpc.MethodDesc{
+		{
+			MethodName: method,
+			Handler: func(
+				srv interface{},
+				ctx context.Context,
+				dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor,
+			) (interface{}, error) {
+				req := &envoyapi.DiscoveryRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(versionedServer).serveFetch(
+						ctx,
+						req.(*envoyapi.DiscoveryRequest),
+						typeURL,
+						defaultTypeURL,
+					)
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: fmt.Sprintf("/%s/%s", serviceName, method),
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	}
+
+	return desc
+}
+
+// v3AccessLogService describes the v3 ALS, to be registered with a v2
+// accesslog.AccessLogServiceServer.
+var v3AccessLogService = grpc.ServiceDesc{
+	ServiceName: "envoy.service.accesslog.v3.AccessLogService",
+	HandlerType: (*accesslog.AccessLogServiceServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamAccessLogs",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(accesslog.AccessLogServiceServer).StreamAccessLogs(
+					&v3AccessLogStream{stream},
+				)
+			},
+			ClientStreams: true,
+		},
+	},
+	Metadata: "envoy/service/accesslog/v3/als.proto",
+}
+
+// v3AccessLogStream serves a v3 ALS stream to a v2 server.
+type v3AccessLogStream struct {
+	grpc.ServerStream
+}
+
+func (s *v3AccessLogStream) SendAndClose(resp *accesslog.StreamAccessLogsResponse) error {
+	return s.SendMsg(resp)
+}
+
+func (s *v3AccessLogStream) Recv() (*accesslog.StreamAccessLogsMessage, error) {
+	msg := &accesslog.StreamAccessLogsMessage{}
+	if err := s.RecvMsg(msg); err != nil {
+		return nil, err
+	}
+	v2Node(msg.GetIdentifier().GetNode())
+	return msg, nil
+}
+
+// v2Node sets the build version of a v3 Node, which v3 replaces with the
+// user agent version, or its major, minor and patch numbers.
+func v2Node(node *envoycore.Node) {
+	if node == nil || node.BuildVersion != "" {
+		return
+	}
+
+	wireFields(node.XXX_unrecognized, func(field, wireType int, value []byte) {
+		if wireType != proto.WireBytes {
+			return
+		}
+
+		switch field {
+		case 7: // user_agent_version
+			node.BuildVersion = string(value)
+
+		case 8: // user_agent_build_version
+			wireFields(value, func(field, wireType int, value []byte) {
+				if field == 1 && wireType == proto.WireBytes { // version
+					node.BuildVersion = semanticVersion(value)
+				}
+			})
+		}
+	})
+}
+
+// semanticVersion formats an encoded envoy.type.v3.SemanticVersion.
+func semanticVersion(b []byte) string {
+	var numbers [3]uint64
+	wireFields(b, func(field, wireType int, value []byte) {
+		if field >= 1 && field <= 3 && wireType == proto.WireVarint {
+			numbers[field-1], _ = proto.DecodeVarint(value)
+		}
+	})
+	return fmt.Sprintf("%d.%d.%d", numbers[0], numbers[1], numbers[2])
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"testing"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/gogo/protobuf/types"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestAPIVersionsRequest(t *testing.T) {
+	versions := newAPIVersions("")
+
+	assert.Equal(t, versions.request(cache.ClusterType), cache.ClusterType)
+	_, ok := versions.v3TypeURL(cache.ClusterType)
+	assert.False(t, ok)
+
+	assert.Equal(t, versions.request(v3ClusterType), cache.ClusterType)
+	typeURL, ok := versions.v3TypeURL(cache.ClusterType)
+	assert.True(t, ok)
+	assert.Equal(t, typeURL, v3ClusterType)
+
+	// other types are unaffected
+	_, ok = versions.v3TypeURL(cache.RouteType)
+	assert.False(t, ok)
+
+	assert.Equal(t, versions.request(cache.ClusterType), cache.ClusterType)
+	_, ok = versions.v3TypeURL(cache.ClusterType)
+	assert.False(t, ok)
+
+	assert.Equal(t, versions.request(cache.SecretType), cache.SecretType)
+	_, ok = versions.v3TypeURL(cache.SecretType)
+	assert.False(t, ok)
+}
+
+func TestAPIVersionsRequestDefault(t *testing.T) {
+	versions := newAPIVersions(v3EndpointType)
+
+	assert.Equal(t, versions.request(""), cache.EndpointType)
+	typeURL, ok := versions.v3TypeURL(cache.EndpointType)
+	assert.True(t, ok)
+	assert.Equal(t, typeURL, v3EndpointType)
+
+	assert.Equal(t, newAPIVersions("").request(""), "")
+}
+
+func mkEndpointsResponse() *envoyapi.DiscoveryResponse {
+	return &envoyapi.DiscoveryResponse{
+		VersionInfo: "1",
+		TypeUrl:     cache.EndpointType,
+		Resources:   []*types.Any{{TypeUrl: cache.EndpointType, Value: []byte{1, 2, 3}}},
+	}
+}
+
+func TestAPIVersionsResponse(t *testing.T) {
+	versions := newAPIVersions("")
+	versions.request(cache.EndpointType)
+
+	resp := mkEndpointsResponse()
+	got, err := versions.response(resp)
+	assert.Nil(t, err)
+	assert.SameInstance(t, got, resp)
+
+	versions.request(v3EndpointType)
+	got, err = versions.response(resp)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &envoyapi.DiscoveryResponse{
+		VersionInfo: "1",
+		TypeUrl:     v3EndpointType,
+		Resources:   []*types.Any{{TypeUrl: v3EndpointType, Value: []byte{1, 2, 3}}},
+	})
+
+	// the original is unchanged
+	assert.DeepEqual(t, resp, mkEndpointsResponse())
+}
+
+func TestAPIVersionsDeltaResponse(t *testing.T) {
+	mkResp := func() *envoyapi.DeltaDiscoveryResponse {
+		return &envoyapi.DeltaDiscoveryResponse{
+			SystemVersionInfo: "1",
+			TypeUrl:           cache.EndpointType,
+			Resources: []*envoyapi.Resource{
+				{
+					Name:     "foo",
+					Version:  "1",
+					Resource: &types.Any{TypeUrl: cache.EndpointType, Value: []byte{1, 2, 3}},
+				},
+			},
+			RemovedResources: []string{"bar"},
+		}
+	}
+
+	versions := newAPIVersions("")
+	versions.request(cache.EndpointType)
+
+	resp := mkResp()
+	got, err := versions.deltaResponse(resp)
+	assert.Nil(t, err)
+	assert.SameInstance(t, got, resp)
+
+	versions.request(v3EndpointType)
+	got, err = versions.deltaResponse(resp)
+	assert.Nil(t, err)
+
+	want := mkResp()
+	want.TypeUrl = v3EndpointType
+	want.Resources[0].Resource.TypeUrl = v3EndpointType
+	assert.DeepEqual(t, got, want)
+
+	assert.DeepEqual(t, resp, mkResp())
+}
+
+func TestV2Node(t *testing.T) {
+	node := &envoycore.Node{Id: "foo"}
+	node.XXX_unrecognized = appendBytesField(nil, 7, []byte("1.2.3-dev"))
+	v2Node(node)
+	assert.Equal(t, node.BuildVersion, "1.2.3-dev")
+
+	version := appendVarintField(nil, 1, 1)
+	version = appendVarintField(version, 2, 14)
+	version = appendVarintField(version, 3, 300)
+	node = &envoycore.Node{Id: "foo"}
+	node.XXX_unrecognized = appendBytesField(nil, 8, appendBytesField(nil, 1, version))
+	v2Node(node)
+	assert.Equal(t, node.BuildVersion, "1.14.300")
+
+	// v2 nodes are unchanged
+	node = &envoycore.Node{Id: "foo", BuildVersion: "abc/1.12.0"}
+	node.XXX_unrecognized = appendBytesField(nil, 7, []byte("1.2.3"))
+	v2Node(node)
+	assert.Equal(t, node.BuildVersion, "abc/1.12.0")
+
+	v2Node(nil)
+}
+
+func TestSemanticVersion(t *testing.T) {
+	assert.Equal(t, semanticVersion(nil), "0.0.0")
+	assert.Equal(t, semanticVersion(appendVarintField(nil, 2, 5)), "0.5.0")
+}
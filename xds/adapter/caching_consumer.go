@@ -17,12 +17,13 @@ limitations under the License.
 package adapter
 
 import (
-        "context"
+	"context"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
 	"github.com/envoyproxy/go-control-plane/pkg/server"
 
 	"github.com/turbinelabs/api"
@@ -34,11 +35,12 @@ import (
 //go:generate $TBN_HOME/scripts/mockgen_internal.sh -type cachingConsumer,streamRefsIface -source $GOFILE -destination mock_$GOFILE -package $GOPACKAGE --write_package_comment=false
 
 // cachingConsumer implements poller.Consumer, consumes poller.Objects,
-// receives callbacks from the go-control-plane server, and produces cache
-// Snapshots.
+// receives callbacks from the go-control-plane server and the incremental
+// xDS server, and produces cache Snapshots.
 type cachingConsumer interface {
 	poller.Consumer
 	server.Callbacks
+	deltaCallbacks
 }
 
 // newCachingConsumer produces a new cachingConsumer
@@ -49,6 +51,8 @@ func newCachingConsumer(
 	caFile string,
 	defaultTimeout time.Duration,
 	resolveDNS bool,
+	ads bool,
+	delta bool,
 	provider staticResourcesProvider,
 ) cachingConsumer {
 	return registeringCachingConsumer{
@@ -56,12 +60,13 @@ func newCachingConsumer(
 		registrar: registrar,
 		adapt: newSnapshotAdapter(
 			newEndpointAdapter(resolveDNS),
-			newClusterAdapter(caFile),
+			newClusterAdapter(caFile, ads, delta),
 			newRouteAdapter(defaultTimeout),
-			newListenerAdapter(loggingCluster),
+			newListenerAdapter(loggingCluster, ads, delta),
 			provider,
 		),
-		streamRefs: newStreamRefs(),
+		streamRefs:      newStreamRefs(),
+		deltaStreamRefs: newStreamRefs(),
 		getObjects: func(svc service.All, proxy api.Proxy) (*poller.Objects, error) {
 			return poller.NewRemote(svc).Objects(proxy.ProxyKey)
 		},
@@ -168,11 +173,12 @@ func (r *streamRefs) RemoveAll(streamID int64) []service.ProxyRef {
 // registeringCachingConsumer signals its desire to consume objects by
 // registering with a poller.Registrar
 type registeringCachingConsumer struct {
-	cache      snapshotCache
-	registrar  poller.Registrar
-	adapt      snapshotAdapter
-	streamRefs streamRefsIface
-	getObjects func(service.All, api.Proxy) (*poller.Objects, error)
+	cache           snapshotCache
+	registrar       poller.Registrar
+	adapt           snapshotAdapter
+	streamRefs      streamRefsIface
+	deltaStreamRefs streamRefsIface
+	getObjects      func(service.All, api.Proxy) (*poller.Objects, error)
 }
 
 // Consume implements poller.Consumer
@@ -190,8 +196,11 @@ func (c registeringCachingConsumer) Consume(objs *poller.Objects) error {
 // OnStreamOpen implements
 // go-control-plane/pkg/server/Callbacks.OnStreamOpen
 func (c registeringCachingConsumer) OnStreamOpen(ctx context.Context, streamID int64, streamType string) error {
+	if streamType == cache.AnyType {
+		streamType = "ADS"
+	}
 	console.Debug().Println("stream open: ", streamID, streamType)
-        return nil
+	return nil
 }
 
 // OnStreamClosed implements
@@ -208,7 +217,7 @@ func (c registeringCachingConsumer) OnStreamClosed(streamID int64) {
 func (c registeringCachingConsumer) OnStreamRequest(streamID int64, req *v2.DiscoveryRequest) error {
 	c.streamRefs.Add(streamID, proxyRefFromNode(req.GetNode()))
 	c.onRequest(streamID, req)
-        return nil
+	return nil
 }
 
 // OnStreamResponse implements
@@ -226,7 +235,7 @@ func (c registeringCachingConsumer) OnStreamResponse(
 // go-control-plane/pkg/server/Callbacks.OnFetchRequest
 func (c registeringCachingConsumer) OnFetchRequest(ctx context.Context, req *v2.DiscoveryRequest) error {
 	c.onRequest(-1, req)
-        return nil
+	return nil
 }
 
 func (c registeringCachingConsumer) onRequest(streamID int64, req *v2.DiscoveryRequest) {
@@ -251,7 +260,83 @@ func (c registeringCachingConsumer) onRequest(streamID int64, req *v2.DiscoveryR
 		req.GetVersionInfo(),
 	)
 
+	c.register(proxyRefFromNode(req.GetNode()))
+}
+
+// OnDeltaStreamOpen implements deltaCallbacks.OnDeltaStreamOpen
+func (c registeringCachingConsumer) OnDeltaStreamOpen(
+	ctx context.Context,
+	streamID int64,
+	streamType string,
+) error {
+	if streamType == cache.AnyType {
+		streamType = "ADS"
+	}
+	console.Debug().Println("delta stream open: ", streamID, streamType)
+	return nil
+}
+
+// OnDeltaStreamClosed implements deltaCallbacks.OnDeltaStreamClosed
+func (c registeringCachingConsumer) OnDeltaStreamClosed(streamID int64) {
+	for _, ref := range c.deltaStreamRefs.RemoveAll(streamID) {
+		c.deregister(ref)
+	}
+	console.Debug().Println("delta stream closed: ", streamID)
+}
+
+// OnStreamDeltaRequest implements deltaCallbacks.OnStreamDeltaRequest
+func (c registeringCachingConsumer) OnStreamDeltaRequest(
+	streamID int64,
+	req *v2.DeltaDiscoveryRequest,
+) error {
+	console.Debug().Printf(`
+-----------
+     DELTA STREAM: %d
+         RECEIVED: %s
+             NODE: %s
+          CLUSTER: %s
+         LOCALITY: %s
+        SUBSCRIBE: %s
+      UNSUBSCRIBE: %s
+            NONCE: %s
+`,
+		streamID,
+		req.GetTypeUrl(),
+		req.GetNode().GetId(),
+		req.GetNode().GetCluster(),
+		req.GetNode().GetLocality(),
+		strings.Join(req.GetResourceNamesSubscribe(), ", "),
+		strings.Join(req.GetResourceNamesUnsubscribe(), ", "),
+		req.GetResponseNonce(),
+	)
+
+	pRef := proxyRefFromNode(req.GetNode())
+	c.deltaStreamRefs.Add(streamID, pRef)
+	c.register(pRef)
+	return nil
+}
+
+// OnStreamDeltaResponse implements deltaCallbacks.OnStreamDeltaResponse
+func (c registeringCachingConsumer) OnStreamDeltaResponse(
+	streamID int64,
+	req *v2.DeltaDiscoveryRequest,
+	resp *v2.DeltaDiscoveryResponse,
+) {
+	console.Debug().Printf(
+		"Responding (delta %d) with type: %s, version: %s, resources: %d, removed: %d",
+		streamID,
+		resp.GetTypeUrl(),
+		resp.GetSystemVersionInfo(),
+		len(resp.GetResources()),
+		len(resp.GetRemovedResources()),
+	)
+
 	pRef := proxyRefFromNode(req.GetNode())
+	c.deregister(pRef)
+	c.deltaStreamRefs.Remove(streamID, pRef)
+}
+
+func (c registeringCachingConsumer) register(pRef service.ProxyRef) {
 	ifFirst := func(svc service.All, proxy api.Proxy) {
 		console.Debug().Println("First registration of", pRef.MapKey())
 		if objs, err := c.getObjects(svc, proxy); err != nil {
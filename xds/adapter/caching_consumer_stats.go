@@ -17,11 +17,12 @@ limitations under the License.
 package adapter
 
 import (
-        "context"
+	"context"
 	"sync"
 	"time"
 
 	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/gogo/googleapis/google/rpc"
 	"github.com/turbinelabs/api/service/stats/v2"
 	"github.com/turbinelabs/nonstdlib/log/console"
@@ -34,12 +35,13 @@ const fetchStream = -1
 var timeSource = tbntime.NewSource()
 
 // cachingConsumerStats is a wrapper for an underlying cachingConsumer that records
-// stats about xDS requests.
+// stats about xDS requests, both state-of-the-world and incremental.
 type cachingConsumerStats struct {
 	cachingConsumer
 
-	stats       stats.Stats
-	streamState *streamStateMap
+	stats            stats.Stats
+	streamState      *streamStateMap
+	deltaStreamState *streamStateMap
 }
 
 // newCachingConsumerStats wraps the given cachingConsumer and reports stats on xDS
@@ -49,9 +51,10 @@ func newCachingConsumerStats(
 	stats stats.Stats,
 ) cachingConsumer {
 	return &cachingConsumerStats{
-		cachingConsumer: underlying,
-		stats:           stats,
-		streamState:     newStreamStateMap(),
+		cachingConsumer:  underlying,
+		stats:            stats,
+		streamState:      newStreamStateMap(),
+		deltaStreamState: newStreamStateMap(),
 	}
 }
 
@@ -134,9 +137,9 @@ func (c *cachingConsumerStats) completeResponse(
 func (c *cachingConsumerStats) OnStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
 	defer c.streamState.remove(streamID)
 	if err := c.cachingConsumer.OnStreamOpen(ctx, streamID, typeURL); err != nil {
-                return err
-        }
-        return nil
+		return err
+	}
+	return nil
 }
 
 // OnStreamClosed implements
@@ -151,9 +154,9 @@ func (c *cachingConsumerStats) OnStreamClosed(streamID int64) {
 func (c *cachingConsumerStats) OnStreamRequest(streamID int64, req *envoyapi.DiscoveryRequest) error {
 	defer c.startRequest(streamID, req)
 	if err := c.cachingConsumer.OnStreamRequest(streamID, req); err != nil {
-                return err
-        }
-        return nil
+		return err
+	}
+	return nil
 }
 
 // OnStreamResponse implements
@@ -172,9 +175,9 @@ func (c cachingConsumerStats) OnStreamResponse(
 func (c *cachingConsumerStats) OnFetchRequest(ctx context.Context, req *envoyapi.DiscoveryRequest) error {
 	defer c.startRequest(fetchStream, req)
 	if err := c.cachingConsumer.OnFetchRequest(ctx, req); err != nil {
-                return err
-        }
-        return nil
+		return err
+	}
+	return nil
 }
 
 // OnFetchResponse implements
@@ -187,6 +190,93 @@ func (c cachingConsumerStats) OnFetchResponse(
 	c.cachingConsumer.OnFetchResponse(req, resp)
 }
 
+func (c *cachingConsumerStats) startDeltaRequest(
+	streamID int64,
+	req *envoyapi.DeltaDiscoveryRequest,
+) {
+	streamState, created := c.deltaStreamState.getForNode(streamID, req.GetNode(), req.GetTypeUrl())
+	if !created && req.GetResponseNonce() != "" && req.GetResponseNonce() != streamState.responseNonce {
+		// Stale nonce, which the server ignores.
+		console.Error().Printf(
+			"Delta stream %d, %s: got nonce %q, expected %q",
+			streamID,
+			req.GetTypeUrl(),
+			req.GetResponseNonce(),
+			streamState.responseNonce,
+		)
+		return
+	}
+
+	streamState.start(c.stats)
+
+	if created || req.GetResponseNonce() == "" {
+		// An initial request or a change in subscriptions, rather than an
+		// ack or nack.
+		return
+	}
+
+	if detail := req.GetErrorDetail(); detail != nil {
+		console.Error().Printf(
+			"Delta stream %d, %s: NACK response version %q: Error Code %s, Message %q",
+			streamID,
+			req.GetTypeUrl(),
+			streamState.responseVersion,
+			rpc.Code(detail.GetCode()).String(),
+			detail.GetMessage(),
+		)
+		streamState.nack(c.stats)
+		return
+	}
+
+	console.Info().Printf(
+		"Delta stream %d, %s: ack response version %q",
+		streamID,
+		req.GetTypeUrl(),
+		streamState.responseVersion,
+	)
+	streamState.ack(c.stats)
+}
+
+func (c *cachingConsumerStats) completeDeltaResponse(
+	streamID int64,
+	req *envoyapi.DeltaDiscoveryRequest,
+	resp *envoyapi.DeltaDiscoveryResponse,
+) {
+	streamState, _ := c.deltaStreamState.getForNode(streamID, req.GetNode(), resp.GetTypeUrl())
+	streamState.complete(c.stats, resp.GetSystemVersionInfo(), resp.GetNonce())
+}
+
+// OnDeltaStreamOpen implements deltaCallbacks.OnDeltaStreamOpen
+func (c *cachingConsumerStats) OnDeltaStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	defer c.deltaStreamState.remove(streamID)
+	return c.cachingConsumer.OnDeltaStreamOpen(ctx, streamID, typeURL)
+}
+
+// OnDeltaStreamClosed implements deltaCallbacks.OnDeltaStreamClosed
+func (c *cachingConsumerStats) OnDeltaStreamClosed(streamID int64) {
+	defer c.deltaStreamState.remove(streamID)
+	c.cachingConsumer.OnDeltaStreamClosed(streamID)
+}
+
+// OnStreamDeltaRequest implements deltaCallbacks.OnStreamDeltaRequest
+func (c *cachingConsumerStats) OnStreamDeltaRequest(
+	streamID int64,
+	req *envoyapi.DeltaDiscoveryRequest,
+) error {
+	defer c.startDeltaRequest(streamID, req)
+	return c.cachingConsumer.OnStreamDeltaRequest(streamID, req)
+}
+
+// OnStreamDeltaResponse implements deltaCallbacks.OnStreamDeltaResponse
+func (c *cachingConsumerStats) OnStreamDeltaResponse(
+	streamID int64,
+	req *envoyapi.DeltaDiscoveryRequest,
+	resp *envoyapi.DeltaDiscoveryResponse,
+) {
+	defer c.completeDeltaResponse(streamID, req, resp)
+	c.cachingConsumer.OnStreamDeltaResponse(streamID, req, resp)
+}
+
 type streamState struct {
 	nodeID  string
 	proxy   string
@@ -201,19 +291,23 @@ type streamState struct {
 }
 
 func newStreamState(req *envoyapi.DiscoveryRequest) *streamState {
-	if req.Node == nil {
+	return newNodeStreamState(req.GetNode(), req.GetTypeUrl())
+}
+
+func newNodeStreamState(node *core.Node, typeURL string) *streamState {
+	if node == nil {
 		return &streamState{
-			typeURL: req.GetTypeUrl(),
+			typeURL: typeURL,
 		}
 	}
 
-	proxyRef := proxyRefFromNode(req.Node)
+	proxyRef := proxyRefFromNode(node)
 
 	return &streamState{
-		nodeID:  req.Node.GetId(),
+		nodeID:  node.GetId(),
 		proxy:   proxyRef.Name(),
 		zone:    proxyRef.ZoneRef().Name(),
-		typeURL: req.GetTypeUrl(),
+		typeURL: typeURL,
 	}
 }
 
@@ -283,8 +377,14 @@ func newStreamStateMap() *streamStateMap {
 }
 
 func (m *streamStateMap) get(streamID int64, req *envoyapi.DiscoveryRequest) (*streamState, bool) {
-	typeURL := req.GetTypeUrl()
+	return m.getForNode(streamID, req.GetNode(), req.GetTypeUrl())
+}
 
+func (m *streamStateMap) getForNode(
+	streamID int64,
+	node *core.Node,
+	typeURL string,
+) (*streamState, bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -296,7 +396,7 @@ func (m *streamStateMap) get(streamID int64, req *envoyapi.DiscoveryRequest) (*s
 
 	state, ok := streamMap[typeURL]
 	if !ok {
-		state := newStreamState(req)
+		state := newNodeStreamState(node, typeURL)
 		streamMap[typeURL] = state
 		return state, true
 	}
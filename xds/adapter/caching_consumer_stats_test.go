@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -584,7 +585,7 @@ func TestCachingConsumerStatsOnStreamOpen(t *testing.T) {
 
 	mockStats := stats.NewMockStats(ctrl)
 	mockConsumer := newMockCachingConsumer(ctrl)
-	mockConsumer.EXPECT().OnStreamOpen(int64(1), "type-url")
+	mockConsumer.EXPECT().OnStreamOpen(context.Background(), int64(1), "type-url")
 
 	ccs := newCachingConsumerStats(mockConsumer, mockStats)
 
@@ -592,7 +593,7 @@ func TestCachingConsumerStatsOnStreamOpen(t *testing.T) {
 	ccsImpl.startRequest(1, testEDSRequest)
 	ccsImpl.startRequest(2, testCDSRequest)
 
-	ccs.OnStreamOpen(1, "type-url")
+	ccs.OnStreamOpen(context.Background(), 1, "type-url")
 	assert.Nil(t, ccsImpl.streamState.state[1])
 	assert.NotDeepEqual(t, ccsImpl.streamState.state[2], map[string]*streamState{})
 }
@@ -624,10 +625,10 @@ func TestCachingConsumerStatsOnFetchRequest(t *testing.T) {
 		mockStats := stats.NewMockStats(ctrl)
 
 		mockConsumer := newMockCachingConsumer(ctrl)
-		mockConsumer.EXPECT().OnFetchRequest(testEDSRequest)
+		mockConsumer.EXPECT().OnFetchRequest(context.Background(), testEDSRequest)
 
 		ccs := newCachingConsumerStats(mockConsumer, mockStats)
-		ccs.OnFetchRequest(testEDSRequest)
+		ccs.OnFetchRequest(context.Background(), testEDSRequest)
 
 		streamState, created :=
 			ccs.(*cachingConsumerStats).streamState.get(fetchStream, testEDSRequest)
@@ -659,11 +660,11 @@ func TestCachingConsumerStatsOnFetchResponse(t *testing.T) {
 		}
 
 		mockConsumer := newMockCachingConsumer(ctrl)
-		mockConsumer.EXPECT().OnFetchRequest(&req)
+		mockConsumer.EXPECT().OnFetchRequest(context.Background(), &req)
 		mockConsumer.EXPECT().OnFetchResponse(&req, resp)
 
 		ccs := newCachingConsumerStats(mockConsumer, mockStats)
-		ccs.OnFetchRequest(&req)
+		ccs.OnFetchRequest(context.Background(), &req)
 
 		cs.Advance(100 * time.Millisecond)
 
@@ -676,3 +677,132 @@ func TestCachingConsumerStatsOnFetchResponse(t *testing.T) {
 		assert.Equal(t, streamState.responseNonce, "nonce")
 	})
 }
+
+func TestCachingConsumerStatsADSStream(t *testing.T) {
+	withCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		ctrl := gomock.NewController(assert.Tracing(t))
+		defer ctrl.Finish()
+
+		mockStats := stats.NewMockStats(ctrl)
+		mockStats.EXPECT().Timing(v2.ConfigLatency, gomock.Any(), gomock.Any()).Times(2)
+		mockStats.EXPECT().Timing(v2.ConfigInterval, gomock.Any(), gomock.Any()).Times(2)
+		for _, typeURL := range []string{cache.ClusterType, cache.EndpointType} {
+			mockStats.EXPECT().Count(
+				v2.Config,
+				1.0,
+				stats.NewKVTag(stats.NodeTag, "node"),
+				stats.NewKVTag(stats.ProxyTag, "proxy"),
+				stats.NewKVTag(stats.ZoneTag, "zone"),
+				stats.NewKVTag(v2.ConfigState, v2.ConfigValid),
+				stats.NewKVTag(v2.ConfigType, typeURL),
+			)
+		}
+
+		ccs := newCachingConsumerStats(nil, mockStats).(*cachingConsumerStats)
+
+		// A single ADS stream carries requests for each type, with responses
+		// sharing the stream's nonce sequence.
+		ccs.startRequest(1, testCDSRequest)
+		ccs.startRequest(1, testEDSRequest)
+		ccs.completeResponse(
+			1,
+			testCDSRequest,
+			&envoyapi.DiscoveryResponse{VersionInfo: "v1", Nonce: "1"},
+		)
+		ccs.completeResponse(
+			1,
+			testEDSRequest,
+			&envoyapi.DiscoveryResponse{VersionInfo: "v1", Nonce: "2"},
+		)
+
+		cdsAck := *testCDSRequest
+		cdsAck.ResponseNonce = "1"
+		cdsAck.VersionInfo = "v1"
+		edsAck := *testEDSRequest
+		edsAck.ResponseNonce = "2"
+		edsAck.VersionInfo = "v1"
+
+		ccs.startRequest(1, &edsAck)
+		ccs.startRequest(1, &cdsAck)
+
+		assert.Equal(t, len(ccs.streamState.state[1]), 2)
+	})
+}
+
+func TestCachingConsumerStatsDeltaStream(t *testing.T) {
+	ch, cleanup := console.ConsumeConsoleLogs(10)
+	defer cleanup()
+
+	withCurrentTimeFrozen(func(cs tbntime.ControlledSource) {
+		ctrl := gomock.NewController(assert.Tracing(t))
+		defer ctrl.Finish()
+
+		countTags := func(state string) []interface{} {
+			return []interface{}{
+				stats.NewKVTag(stats.NodeTag, "node"),
+				stats.NewKVTag(stats.ProxyTag, "proxy"),
+				stats.NewKVTag(stats.ZoneTag, "zone"),
+				stats.NewKVTag(v2.ConfigState, state),
+				stats.NewKVTag(v2.ConfigType, cache.ClusterType),
+			}
+		}
+
+		mockStats := stats.NewMockStats(ctrl)
+		mockStats.EXPECT().Timing(v2.ConfigLatency, gomock.Any(), gomock.Any()).Times(2)
+		mockStats.EXPECT().Timing(v2.ConfigInterval, gomock.Any(), gomock.Any()).Times(2)
+		gomock.InOrder(
+			mockStats.EXPECT().Count(v2.Config, 1.0, countTags(v2.ConfigValid)...),
+			mockStats.EXPECT().Count(v2.Config, 1.0, countTags(v2.ConfigInvalid)...),
+		)
+
+		ccs := newCachingConsumerStats(nil, mockStats).(*cachingConsumerStats)
+
+		req := &envoyapi.DeltaDiscoveryRequest{
+			Node:    testCDSRequest.Node,
+			TypeUrl: cache.ClusterType,
+		}
+		resp := &envoyapi.DeltaDiscoveryResponse{
+			TypeUrl:           cache.ClusterType,
+			SystemVersionInfo: "v1",
+			Nonce:             "1",
+		}
+
+		ccs.startDeltaRequest(1, req)
+		ccs.completeDeltaResponse(1, req, resp)
+
+		// later requests need not carry the node
+		ack := &envoyapi.DeltaDiscoveryRequest{TypeUrl: cache.ClusterType, ResponseNonce: "1"}
+		ccs.startDeltaRequest(1, ack)
+		msg := <-ch
+		assert.Equal(
+			t,
+			msg.Message,
+			fmt.Sprintf("[info] Delta stream 1, %s: ack response version \"v1\"\n", cache.ClusterType),
+		)
+
+		resp.Nonce = "2"
+		ccs.completeDeltaResponse(1, ack, resp)
+
+		// stale
+		ccs.startDeltaRequest(1, ack)
+		msg = <-ch
+		assert.Equal(
+			t,
+			msg.Message,
+			fmt.Sprintf("[error] Delta stream 1, %s: got nonce \"1\", expected \"2\"\n", cache.ClusterType),
+		)
+
+		nack := &envoyapi.DeltaDiscoveryRequest{
+			TypeUrl:       cache.ClusterType,
+			ResponseNonce: "2",
+			ErrorDetail:   &rpc.Status{Code: int32(rpc.INVALID_ARGUMENT), Message: "bad"},
+		}
+		ccs.startDeltaRequest(1, nack)
+		msg = <-ch
+		assert.MatchesRegex(t, msg.Message, "NACK response version \"v1\": Error Code INVALID_ARGUMENT")
+
+		// the delta and state-of-the-world stream IDs are independent
+		assert.Equal(t, len(ccs.deltaStreamState.state), 1)
+		assert.Equal(t, len(ccs.streamState.state), 0)
+	})
+}
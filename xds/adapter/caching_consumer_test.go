@@ -17,6 +17,7 @@ limitations under the License.
 package adapter
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"testing"
@@ -290,7 +291,7 @@ func TestCachingConsumerOnStreamOpen(t *testing.T) {
 	mocks := newCachingConsumerMocks(t, nil)
 	defer mocks.ctrl.Finish()
 
-	mocks.consumer.OnStreamOpen(23, "the-type")
+	mocks.consumer.OnStreamOpen(context.Background(), 23, "the-type")
 
 	msg := <-ch
 	assert.Equal(
@@ -365,7 +366,7 @@ func TestCachingConsumerOnFetchRequest(t *testing.T) {
 
 	mocks.registrar.EXPECT().Register(mocks.pRef, gomock.Any()).Return(nil)
 
-	mocks.consumer.OnFetchRequest(mocks.req)
+	mocks.consumer.OnFetchRequest(context.Background(), mocks.req)
 }
 
 func TestCachingConsumerOnFetchResponse(t *testing.T) {
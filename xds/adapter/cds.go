@@ -36,6 +36,8 @@ const (
 
 type cds struct {
 	caFile   string
+	ads      bool
+	delta    bool
 	template *envoyapi.Cluster
 }
 
@@ -58,6 +60,8 @@ func (s cds) withTemplate(l *envoyapi.Cluster) clusterAdapter {
 	}
 	return cds{
 		caFile:   s.caFile,
+		ads:      s.ads,
+		delta:    s.delta,
 		template: l,
 	}
 }
@@ -130,12 +134,12 @@ func (s cds) tbnToEnvoyCluster(
 		return nil, err
 	}
 
-        connectTimeout := clusterConnectTimeoutSecs * time.Second
+	connectTimeout := clusterConnectTimeoutSecs * time.Second
 	return &envoyapi.Cluster{
-		Name: tbnCluster.Name,
-                ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
+		Name:                 tbnCluster.Name,
+		ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 		EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
-			EdsConfig:   &xdsClusterConfig,
+			EdsConfig:   xdsConfigSource(s.ads, s.delta),
 			ServiceName: tbnCluster.Name,
 		},
 		ConnectTimeout:   &connectTimeout,
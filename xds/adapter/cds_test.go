@@ -83,8 +83,8 @@ func TestManyClusters(t *testing.T) {
 
 	expectedEnvoyClusters := []envoyapi.Cluster{
 		{
-			Name: "foo",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "foo",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -105,7 +105,7 @@ func TestManyClusters(t *testing.T) {
 				},
 				ServiceName: "foo",
 			},
-			ConnectTimeout: clusterConnectTimeoutSecs * time.Second,
+			ConnectTimeout: ptr.Duration(clusterConnectTimeoutSecs * time.Second),
 			LbPolicy:       envoyapi.Cluster_LEAST_REQUEST,
 			TlsContext: &envoyauth.UpstreamTlsContext{
 				CommonTlsContext: &envoyauth.CommonTlsContext{
@@ -175,8 +175,8 @@ func TestManyClusters(t *testing.T) {
 			},
 		},
 		{
-			Name: "baz",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "baz",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -197,12 +197,12 @@ func TestManyClusters(t *testing.T) {
 				},
 				ServiceName: "baz",
 			},
-			ConnectTimeout: clusterConnectTimeoutSecs * time.Second,
+			ConnectTimeout: ptr.Duration(clusterConnectTimeoutSecs * time.Second),
 			LbPolicy:       envoyapi.Cluster_LEAST_REQUEST,
 		},
 		{
-			Name: "bar",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "bar",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -223,7 +223,7 @@ func TestManyClusters(t *testing.T) {
 				},
 				ServiceName: "bar",
 			},
-			ConnectTimeout: clusterConnectTimeoutSecs * time.Second,
+			ConnectTimeout: ptr.Duration(clusterConnectTimeoutSecs * time.Second),
 			LbPolicy:       envoyapi.Cluster_LEAST_REQUEST,
 			LbSubsetConfig: &envoyapi.Cluster_LbSubsetConfig{
 				FallbackPolicy: envoyapi.Cluster_LbSubsetConfig_ANY_ENDPOINT,
@@ -292,8 +292,8 @@ func TestAdaptClustersTemplate(t *testing.T) {
 	objects := poller.MkFixtureObjects()
 	s := cds{}.withTemplate(
 		&envoyapi.Cluster{
-			Name: "ignored",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "ignored",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -314,7 +314,7 @@ func TestAdaptClustersTemplate(t *testing.T) {
 				},
 				ServiceName: "ignored",
 			},
-			ConnectTimeout: time.Minute,
+			ConnectTimeout: ptr.Duration(time.Minute),
 			LbPolicy:       envoyapi.Cluster_RING_HASH,
 		},
 	)
@@ -327,8 +327,8 @@ func TestAdaptClustersTemplate(t *testing.T) {
 
 	expectedEnvoyClusters := []envoyapi.Cluster{
 		{
-			Name: "foo",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "foo",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -349,12 +349,12 @@ func TestAdaptClustersTemplate(t *testing.T) {
 				},
 				ServiceName: "foo",
 			},
-			ConnectTimeout: time.Minute,
+			ConnectTimeout: ptr.Duration(time.Minute),
 			LbPolicy:       envoyapi.Cluster_RING_HASH,
 		},
 		{
-			Name: "baz",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "baz",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -375,12 +375,12 @@ func TestAdaptClustersTemplate(t *testing.T) {
 				},
 				ServiceName: "baz",
 			},
-			ConnectTimeout: time.Minute,
+			ConnectTimeout: ptr.Duration(time.Minute),
 			LbPolicy:       envoyapi.Cluster_RING_HASH,
 		},
 		{
-			Name: "bar",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "bar",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 			EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
 				EdsConfig: &envoycore.ConfigSource{
 					ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
@@ -401,7 +401,7 @@ func TestAdaptClustersTemplate(t *testing.T) {
 				},
 				ServiceName: "bar",
 			},
-			ConnectTimeout: time.Minute,
+			ConnectTimeout: ptr.Duration(time.Minute),
 			LbPolicy:       envoyapi.Cluster_RING_HASH,
 		},
 	}
@@ -603,3 +603,20 @@ func TestTbnToEnvoyHealthChecksConvertsSuccessfully(t *testing.T) {
 		},
 	})
 }
+
+func TestClusterADSConfigSource(t *testing.T) {
+	objects := poller.MkFixtureObjects()
+
+	for _, s := range []clusterAdapter{
+		cds{ads: true},
+		cds{ads: true}.withTemplate(nil),
+	} {
+		resources, err := s.adapt(objects)
+		assert.Nil(t, err)
+		assert.NotEqual(t, len(resources.Items), 0)
+		for _, r := range resources.Items {
+			c := r.(*envoyapi.Cluster)
+			assert.SameInstance(t, c.GetEdsClusterConfig().GetEdsConfig(), &adsClusterConfig)
+		}
+	}
+}
@@ -94,8 +94,8 @@ func TestClusterTransformerInvalidClusterTypeSkipped(t *testing.T) {
 	clusterName := "bad-cluster"
 	input := []*envoyapi.Cluster{
 		{
-			Name: clusterName,
-			Type: envoyapi.Cluster_ORIGINAL_DST,
+			Name:                 clusterName,
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_ORIGINAL_DST},
 		},
 	}
 
@@ -111,27 +111,27 @@ func TestClusterTransformerInvalidClusterTypeSkipped(t *testing.T) {
 func TestClusterTransformerGroupsClustersAccordingly(t *testing.T) {
 	staticInput := []*envoyapi.Cluster{
 		{
-			Name: "static-1",
-			Type: envoyapi.Cluster_STATIC,
+			Name:                 "static-1",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
 		},
 		{
-			Name: "static-2",
-			Type: envoyapi.Cluster_STRICT_DNS,
+			Name:                 "static-2",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STRICT_DNS},
 		},
 		{
-			Name: "static-3",
-			Type: envoyapi.Cluster_LOGICAL_DNS,
+			Name:                 "static-3",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_LOGICAL_DNS},
 		},
 	}
 
 	dynamicInput := []*envoyapi.Cluster{
 		{
-			Name: "dynamic-1",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "dynamic-1",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 		},
 		{
-			Name: "dynamic-2",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "dynamic-2",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 		},
 	}
 	input := append(staticInput, dynamicInput...)
@@ -158,22 +158,22 @@ func TestClusterTransformerUnderlyingErrorsGetReturned(t *testing.T) {
 	errs := []error{errors.New("boom")}
 	staticInput := []*envoyapi.Cluster{
 		{
-			Name: "cluster-1",
-			Type: envoyapi.Cluster_LOGICAL_DNS,
+			Name:                 "cluster-1",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_LOGICAL_DNS},
 		},
 		{
-			Name: "cluster-2",
-			Type: envoyapi.Cluster_STATIC,
+			Name:                 "cluster-2",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
 		},
 	}
 	dynamicInput := []*envoyapi.Cluster{
 		{
-			Name: "cluster-3",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "cluster-3",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 		},
 		{
-			Name: "cluster-4",
-			Type: envoyapi.Cluster_EDS,
+			Name:                 "cluster-4",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
 		},
 	}
 	input := append(staticInput, dynamicInput...)
@@ -248,9 +248,9 @@ func TestMkStaticClustersNoHostsTlsContextWithCircuitBreakers(t *testing.T) {
 
 func TestMkStaticClustersWithHostsAndSubstructs(t *testing.T) {
 	i := &envoyapi.Cluster{
-		Name:       "c1",
-		Type:       envoyapi.Cluster_STATIC,
-		TlsContext: &envoyauth.UpstreamTlsContext{},
+		Name:                 "c1",
+		ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
+		TlsContext:           &envoyauth.UpstreamTlsContext{},
 		Hosts: []*envoycore.Address{
 			{
 				Address: &envoycore.Address_SocketAddress{
@@ -333,9 +333,9 @@ func TestMkStaticClustersWithHostsAndSubstructs(t *testing.T) {
 
 func TestMkStaticClustersBadHostsGetSkipped(t *testing.T) {
 	i := &envoyapi.Cluster{
-		Name:       "c1",
-		Type:       envoyapi.Cluster_STATIC,
-		TlsContext: &envoyauth.UpstreamTlsContext{},
+		Name:                 "c1",
+		ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
+		TlsContext:           &envoyauth.UpstreamTlsContext{},
 		Hosts: []*envoycore.Address{
 			{
 				Address: &envoycore.Address_SocketAddress{
@@ -556,15 +556,15 @@ func TestNewClusterResolverForRestLegacy(t *testing.T) {
 		&envoycore.ConfigSource{
 			ConfigSourceSpecifier: &envoycore.ConfigSource_ApiConfigSource{
 				ApiConfigSource: &envoycore.ApiConfigSource{
-					ApiType:      envoycore.ApiConfigSource_REST_LEGACY,
+					ApiType:      envoycore.ApiConfigSource_UNSUPPORTED_REST_LEGACY,
 					ClusterNames: []string{"c1"},
 				},
 			},
 		},
 	)
 
-	assert.NonNil(t, cr)
-	assert.Nil(t, err)
+	assert.Nil(t, cr)
+	assert.ErrorContains(t, err, "Unrecognized ApiConfigSourceType")
 }
 
 func TestNewClusterResolverForRest(t *testing.T) {
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"sync"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+)
+
+// multiSnapshotCache is a snapshotCache that sets and clears snapshots in
+// each of its snapshotCaches.
+type multiSnapshotCache []snapshotCache
+
+func (m multiSnapshotCache) SetSnapshot(node string, snapshot cache.Snapshot) error {
+	for _, c := range m {
+		if err := c.SetSnapshot(node, snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSnapshotCache) ClearSnapshot(node string) {
+	for _, c := range m {
+		c.ClearSnapshot(node)
+	}
+}
+
+// deltaResources are the Resources of a single type from a snapshot, along
+// with the version of the snapshot's Resources of that type and the
+// version of each Resource.
+type deltaResources struct {
+	version  string
+	items    map[string]cache.Resource
+	versions map[string]string
+}
+
+// deltaCache is a snapshotCache that serves the incremental xDS server.
+// Unlike the go-control-plane cache, it does not answer requests itself;
+// instead it notifies watchers of the node whenever the node's snapshot
+// changes, and provides per-resource versions, computed on first use, for
+// each type.
+type deltaCache struct {
+	mutex      sync.Mutex
+	snapshots  map[string]*deltaSnapshot
+	watches    map[string]map[int64]chan struct{}
+	watchCount int64
+}
+
+type deltaSnapshot struct {
+	snapshot cache.Snapshot
+
+	mutex    sync.Mutex
+	versions map[string]map[string]string
+}
+
+func newDeltaCache() *deltaCache {
+	return &deltaCache{
+		snapshots: map[string]*deltaSnapshot{},
+		watches:   map[string]map[int64]chan struct{}{},
+	}
+}
+
+var _ snapshotCache = &deltaCache{}
+
+// SetSnapshot replaces the node's snapshot and notifies its watchers.
+func (c *deltaCache) SetSnapshot(node string, snapshot cache.Snapshot) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.snapshots[node] = &deltaSnapshot{
+		snapshot: snapshot,
+		versions: map[string]map[string]string{},
+	}
+
+	for _, ch := range c.watches[node] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// ClearSnapshot removes the node's snapshot. Watchers are not notified:
+// snapshots are only cleared once no streams remain for the node.
+func (c *deltaCache) ClearSnapshot(node string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.snapshots, node)
+}
+
+// watch returns a channel that receives a value each time the node's
+// snapshot changes, and a function to cancel the watch.
+func (c *deltaCache) watch(node string) (<-chan struct{}, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.watchCount++
+	id := c.watchCount
+
+	ch := make(chan struct{}, 1)
+	if c.watches[node] == nil {
+		c.watches[node] = map[int64]chan struct{}{}
+	}
+	c.watches[node][id] = ch
+
+	return ch, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		delete(c.watches[node], id)
+		if len(c.watches[node]) == 0 {
+			delete(c.watches, node)
+		}
+	}
+}
+
+// resources returns the node's Resources of the given type, or false if
+// the node has no snapshot.
+func (c *deltaCache) resources(node, typeURL string) (deltaResources, bool, error) {
+	c.mutex.Lock()
+	ds, ok := c.snapshots[node]
+	c.mutex.Unlock()
+
+	if !ok {
+		return deltaResources{}, false, nil
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	items := ds.snapshot.GetResources(typeURL)
+	versions, ok := ds.versions[typeURL]
+	if !ok {
+		var err error
+		if versions, err = resourceVersions(items); err != nil {
+			return deltaResources{}, false, err
+		}
+		ds.versions[typeURL] = versions
+	}
+
+	return deltaResources{
+		version:  ds.snapshot.GetVersion(typeURL),
+		items:    items,
+		versions: versions,
+	}, true, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"errors"
+	"testing"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkDeltaSnapshot(version string, clusters ...string) cache.Snapshot {
+	resources := make([]cache.Resource, len(clusters))
+	for i, name := range clusters {
+		resources[i] = &envoyapi.Cluster{Name: name}
+	}
+	return cache.NewSnapshot(version, nil, resources, nil, nil)
+}
+
+func TestMultiSnapshotCache(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	snapshot := mkDeltaSnapshot("1", "a")
+
+	c1 := newMockSnapshotCache(ctrl)
+	c2 := newMockSnapshotCache(ctrl)
+	gomock.InOrder(
+		c1.EXPECT().SetSnapshot("node", snapshot).Return(nil),
+		c2.EXPECT().SetSnapshot("node", snapshot).Return(nil),
+		c1.EXPECT().ClearSnapshot("node"),
+		c2.EXPECT().ClearSnapshot("node"),
+		c1.EXPECT().SetSnapshot("node", snapshot).Return(errors.New("boom")),
+	)
+
+	m := multiSnapshotCache{c1, c2}
+	assert.Nil(t, m.SetSnapshot("node", snapshot))
+	m.ClearSnapshot("node")
+	assert.ErrorContains(t, m.SetSnapshot("node", snapshot), "boom")
+}
+
+func TestDeltaCacheResources(t *testing.T) {
+	c := newDeltaCache()
+
+	_, ok, err := c.resources("node", cache.ClusterType)
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.SetSnapshot("node", mkDeltaSnapshot("1", "a", "b")))
+	r1, ok, err := c.resources("node", cache.ClusterType)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, r1.version, "1")
+	assert.Equal(t, len(r1.items), 2)
+	assert.Equal(t, len(r1.versions), 2)
+	assert.NotEqual(t, r1.versions["a"], r1.versions["b"])
+
+	// unchanged resources keep their versions
+	assert.Nil(t, c.SetSnapshot("node", mkDeltaSnapshot("2", "a")))
+	r2, ok, err := c.resources("node", cache.ClusterType)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, r2.version, "2")
+	assert.DeepEqual(t, r2.versions, map[string]string{"a": r1.versions["a"]})
+
+	c.ClearSnapshot("node")
+	_, ok, _ = c.resources("node", cache.ClusterType)
+	assert.False(t, ok)
+}
+
+func TestDeltaCacheWatch(t *testing.T) {
+	c := newDeltaCache()
+
+	ch1, cancel1 := c.watch("node")
+	ch2, cancel2 := c.watch("node")
+	other, cancelOther := c.watch("other")
+	defer cancelOther()
+
+	// notifications coalesce
+	assert.Nil(t, c.SetSnapshot("node", mkDeltaSnapshot("1", "a")))
+	assert.Nil(t, c.SetSnapshot("node", mkDeltaSnapshot("2", "a")))
+
+	for _, ch := range []<-chan struct{}{ch1, ch2} {
+		select {
+		case <-ch:
+		default:
+			t.Fatal("expected notification")
+		}
+		select {
+		case <-ch:
+			t.Fatal("unexpected notification")
+		default:
+		}
+	}
+
+	select {
+	case <-other:
+		t.Fatal("unexpected notification")
+	default:
+	}
+
+	cancel1()
+	assert.Nil(t, c.SetSnapshot("node", mkDeltaSnapshot("3", "a")))
+	select {
+	case <-ch1:
+		t.Fatal("unexpected notification")
+	default:
+	}
+	<-ch2
+
+	cancel2()
+	assert.Equal(t, len(c.watches), 1)
+}
@@ -0,0 +1,378 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoydiscovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/envoyproxy/go-control-plane/pkg/server"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// deltaCallbacks receives callbacks from the incremental xDS server, as
+// go-control-plane's server.Callbacks does for state-of-the-world streams.
+type deltaCallbacks interface {
+	// OnDeltaStreamOpen is called once an incremental xDS stream is open
+	// with a stream ID and the type URL (or "" for ADS). Returning an
+	// error ends processing and closes the stream. OnDeltaStreamClosed is
+	// still called.
+	OnDeltaStreamOpen(context.Context, int64, string) error
+
+	// OnDeltaStreamClosed is called immediately prior to closing an
+	// incremental xDS stream with a stream ID.
+	OnDeltaStreamClosed(int64)
+
+	// OnStreamDeltaRequest is called once a request is received on an
+	// incremental stream. Returning an error ends processing and closes
+	// the stream. OnDeltaStreamClosed is still called.
+	OnStreamDeltaRequest(int64, *envoyapi.DeltaDiscoveryRequest) error
+
+	// OnStreamDeltaResponse is called immediately prior to sending a
+	// response on an incremental stream, with the most recent request for
+	// the response's type.
+	OnStreamDeltaResponse(int64, *envoyapi.DeltaDiscoveryRequest, *envoyapi.DeltaDiscoveryResponse)
+}
+
+// xdsServer serves state-of-the-world xDS with the go-control-plane
+// server.Server, and incremental xDS, which it does not implement, with a
+// deltaServer.
+type xdsServer struct {
+	server.Server
+	delta *deltaServer
+}
+
+func (s xdsServer) DeltaAggregatedResources(
+	stream envoydiscovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+) error {
+	return s.delta.handler(stream, cache.AnyType)
+}
+
+func (s xdsServer) DeltaEndpoints(stream envoyapi.EndpointDiscoveryService_DeltaEndpointsServer) error {
+	return s.delta.handler(stream, cache.EndpointType)
+}
+
+func (s xdsServer) DeltaClusters(stream envoyapi.ClusterDiscoveryService_DeltaClustersServer) error {
+	return s.delta.handler(stream, cache.ClusterType)
+}
+
+func (s xdsServer) DeltaRoutes(stream envoyapi.RouteDiscoveryService_DeltaRoutesServer) error {
+	return s.delta.handler(stream, cache.RouteType)
+}
+
+func (s xdsServer) DeltaListeners(stream envoyapi.ListenerDiscoveryService_DeltaListenersServer) error {
+	return s.delta.handler(stream, cache.ListenerType)
+}
+
+// deltaStream is the common interface of incremental xDS streams.
+type deltaStream interface {
+	grpc.ServerStream
+
+	Send(*envoyapi.DeltaDiscoveryResponse) error
+	Recv() (*envoyapi.DeltaDiscoveryRequest, error)
+}
+
+// deltaServer serves incremental xDS streams from the snapshots in a
+// deltaCache. Each response carries only the resources that were added or
+// changed since the client's last response, along with the names of
+// resources that were removed.
+type deltaServer struct {
+	cache       *deltaCache
+	callbacks   deltaCallbacks
+	streamCount int64
+}
+
+func newDeltaServer(cache *deltaCache, callbacks deltaCallbacks) *deltaServer {
+	return &deltaServer{cache: cache, callbacks: callbacks}
+}
+
+// deltaSubscription tracks the resources of a single type that a client
+// has subscribed to on a stream, and the versions it has been sent.
+type deltaSubscription struct {
+	wildcard bool
+	names    map[string]bool
+	known    map[string]string
+
+	// lastRequest is the most recent request for the type.
+	lastRequest *envoyapi.DeltaDiscoveryRequest
+
+	// nonce is the nonce of the most recent response for the type.
+	nonce string
+
+	// respond is true if a response is owed to the client, even if no
+	// resources changed.
+	respond bool
+}
+
+// newDeltaSubscription creates a subscription from the first request for a
+// type on a stream. Clusters and Listeners are subscribed by wildcard if
+// the request names no resources.
+func newDeltaSubscription(req *envoyapi.DeltaDiscoveryRequest) *deltaSubscription {
+	sub := &deltaSubscription{
+		names:   map[string]bool{},
+		known:   map[string]string{},
+		respond: true,
+	}
+
+	switch req.GetTypeUrl() {
+	case cache.ClusterType, cache.ListenerType:
+		sub.wildcard = len(req.GetResourceNamesSubscribe()) == 0
+	}
+
+	for name, version := range req.GetInitialResourceVersions() {
+		sub.known[name] = version
+	}
+
+	return sub
+}
+
+// update applies the subscription changes in the given request.
+// Resources named in the subscribe list are always sent, even if the
+// client is believed to have them, unless the client reports its version
+// of them in the request.
+func (sub *deltaSubscription) update(req *envoyapi.DeltaDiscoveryRequest) {
+	sub.lastRequest = req
+
+	initial := req.GetInitialResourceVersions()
+	for _, name := range req.GetResourceNamesSubscribe() {
+		sub.names[name] = true
+		if _, ok := initial[name]; !ok {
+			delete(sub.known, name)
+		}
+		sub.respond = true
+	}
+
+	for _, name := range req.GetResourceNamesUnsubscribe() {
+		delete(sub.names, name)
+		delete(sub.known, name)
+	}
+}
+
+// diff returns the response bringing the client up to date with the given
+// resources, recording them as sent, or nil if no response is required.
+func (sub *deltaSubscription) diff(
+	typeURL string,
+	resources deltaResources,
+) (*envoyapi.DeltaDiscoveryResponse, error) {
+	resp := &envoyapi.DeltaDiscoveryResponse{
+		SystemVersionInfo: resources.version,
+		TypeUrl:           typeURL,
+	}
+
+	names := make([]string, 0, len(resources.items))
+	for name := range resources.items {
+		if sub.wildcard || sub.names[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := resources.versions[name]
+		if known, ok := sub.known[name]; ok && known == version {
+			continue
+		}
+
+		data, err := proto.Marshal(resources.items[name])
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Resources = append(resp.Resources, &envoyapi.Resource{
+			Name:     name,
+			Version:  version,
+			Resource: &types.Any{TypeUrl: typeURL, Value: data},
+		})
+		sub.known[name] = version
+	}
+
+	for name := range sub.known {
+		if _, ok := resources.items[name]; !ok {
+			resp.RemovedResources = append(resp.RemovedResources, name)
+			delete(sub.known, name)
+		}
+	}
+	sort.Strings(resp.RemovedResources)
+
+	if !sub.respond && len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 {
+		return nil, nil
+	}
+
+	sub.respond = false
+	return resp, nil
+}
+
+// handler converts blocking reads from the stream to a channel and
+// processes the stream.
+func (s *deltaServer) handler(stream deltaStream, typeURL string) error {
+	reqCh := make(chan *envoyapi.DeltaDiscoveryRequest)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(reqCh)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case reqCh <- req:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return s.process(stream, reqCh, typeURL)
+}
+
+// process handles the requests of an incremental xDS stream, responding to
+// each and to each change in the requesting node's snapshot.
+func (s *deltaServer) process(
+	stream deltaStream,
+	reqCh <-chan *envoyapi.DeltaDiscoveryRequest,
+	defaultTypeURL string,
+) error {
+	streamID := atomic.AddInt64(&s.streamCount, 1)
+
+	var (
+		streamNonce int64
+		node        *core.Node
+		nodeID      string
+		changed     <-chan struct{}
+		cancel      func()
+		subs        = map[string]*deltaSubscription{}
+	)
+
+	defer func() {
+		if cancel != nil {
+			cancel()
+		}
+		s.callbacks.OnDeltaStreamClosed(streamID)
+	}()
+
+	// send sends the response, if any, owed for the given subscription.
+	send := func(typeURL string, sub *deltaSubscription) error {
+		resources, ok, err := s.cache.resources(nodeID, typeURL)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err)
+		}
+		if !ok {
+			// The node's snapshot is not yet available.
+			return nil
+		}
+
+		resp, err := sub.diff(typeURL, resources)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%s", err)
+		}
+		if resp == nil {
+			return nil
+		}
+
+		streamNonce++
+		resp.Nonce = strconv.FormatInt(streamNonce, 10)
+		sub.nonce = resp.Nonce
+
+		s.callbacks.OnStreamDeltaResponse(streamID, sub.lastRequest, resp)
+		return stream.Send(resp)
+	}
+
+	if err := s.callbacks.OnDeltaStreamOpen(stream.Context(), streamID, defaultTypeURL); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-changed:
+			typeURLs := make([]string, 0, len(subs))
+			for typeURL := range subs {
+				typeURLs = append(typeURLs, typeURL)
+			}
+			sort.Strings(typeURLs)
+
+			for _, typeURL := range typeURLs {
+				if err := send(typeURL, subs[typeURL]); err != nil {
+					return err
+				}
+			}
+
+		case req, more := <-reqCh:
+			if !more {
+				return nil
+			}
+			if req == nil {
+				return status.Errorf(codes.Unavailable, "empty request")
+			}
+
+			// type URL is required for ADS but is implicit for xDS
+			if defaultTypeURL == cache.AnyType {
+				if req.TypeUrl == "" {
+					return status.Errorf(codes.InvalidArgument, "type URL is required for ADS")
+				}
+			} else if req.TypeUrl == "" {
+				req.TypeUrl = defaultTypeURL
+			}
+
+			// the node need only be sent with the first request
+			if req.Node == nil {
+				req.Node = node
+			} else if node == nil {
+				node = req.Node
+				nodeID = tbnProxyNodeHash{}.ID(node)
+				changed, cancel = s.cache.watch(nodeID)
+			}
+
+			if err := s.callbacks.OnStreamDeltaRequest(streamID, req); err != nil {
+				return err
+			}
+
+			sub, ok := subs[req.TypeUrl]
+			if !ok {
+				sub = newDeltaSubscription(req)
+				subs[req.TypeUrl] = sub
+			} else if req.ResponseNonce != "" && req.ResponseNonce != sub.nonce {
+				// stale request, sent before our most recent response
+				console.Debug().Printf(
+					"delta stream %d, %s: ignoring stale nonce %q",
+					streamID,
+					req.TypeUrl,
+					req.ResponseNonce,
+				)
+				continue
+			}
+
+			sub.update(req)
+			if err := send(req.TypeUrl, sub); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoyendpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/gogo/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+var testDeltaNode = &core.Node{
+	Id:       "node",
+	Cluster:  "proxy",
+	Locality: &core.Locality{Zone: "zone"},
+}
+
+type fakeDeltaStream struct {
+	grpc.ServerStream
+
+	recv chan *envoyapi.DeltaDiscoveryRequest
+	sent chan *envoyapi.DeltaDiscoveryResponse
+}
+
+func newFakeDeltaStream() *fakeDeltaStream {
+	return &fakeDeltaStream{
+		recv: make(chan *envoyapi.DeltaDiscoveryRequest, 10),
+		sent: make(chan *envoyapi.DeltaDiscoveryResponse, 10),
+	}
+}
+
+func (s *fakeDeltaStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeDeltaStream) Send(resp *envoyapi.DeltaDiscoveryResponse) error {
+	s.sent <- resp
+	return nil
+}
+
+func (s *fakeDeltaStream) Recv() (*envoyapi.DeltaDiscoveryRequest, error) {
+	req, ok := <-s.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *fakeDeltaStream) next(t *testing.T) *envoyapi.DeltaDiscoveryResponse {
+	select {
+	case resp := <-s.sent:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response")
+		return nil
+	}
+}
+
+// recordingDeltaCallbacks records the requests and responses it sees.
+type recordingDeltaCallbacks struct {
+	mutex     sync.Mutex
+	opened    []string
+	closed    []int64
+	requests  []*envoyapi.DeltaDiscoveryRequest
+	responses []*envoyapi.DeltaDiscoveryResponse
+}
+
+func (c *recordingDeltaCallbacks) OnDeltaStreamOpen(_ context.Context, _ int64, typeURL string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.opened = append(c.opened, typeURL)
+	return nil
+}
+
+func (c *recordingDeltaCallbacks) OnDeltaStreamClosed(streamID int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = append(c.closed, streamID)
+}
+
+func (c *recordingDeltaCallbacks) OnStreamDeltaRequest(_ int64, req *envoyapi.DeltaDiscoveryRequest) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests = append(c.requests, req)
+	return nil
+}
+
+func (c *recordingDeltaCallbacks) OnStreamDeltaResponse(
+	_ int64,
+	_ *envoyapi.DeltaDiscoveryRequest,
+	resp *envoyapi.DeltaDiscoveryResponse,
+) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.responses = append(c.responses, resp)
+}
+
+func resourceNames(resp *envoyapi.DeltaDiscoveryResponse) []string {
+	names := make([]string, len(resp.GetResources()))
+	for i, r := range resp.GetResources() {
+		names[i] = r.GetName()
+	}
+	return names
+}
+
+func runDeltaServer(
+	s *deltaServer,
+	stream *fakeDeltaStream,
+	typeURL string,
+) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.handler(stream, typeURL)
+	}()
+	return errCh
+}
+
+func TestDeltaServerWildcard(t *testing.T) {
+	nodeKey := tbnProxyNodeHash{}.ID(testDeltaNode)
+	dc := newDeltaCache()
+	callbacks := &recordingDeltaCallbacks{}
+	s := newDeltaServer(dc, callbacks)
+	stream := newFakeDeltaStream()
+	errCh := runDeltaServer(s, stream, cache.ClusterType)
+
+	// no snapshot yet, so the response waits
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{Node: testDeltaNode}
+	assert.Nil(t, dc.SetSnapshot(nodeKey, mkDeltaSnapshot("1", "a", "b")))
+
+	resp := stream.next(t)
+	assert.Equal(t, resp.GetTypeUrl(), cache.ClusterType)
+	assert.Equal(t, resp.GetSystemVersionInfo(), "1")
+	assert.Equal(t, resp.GetNonce(), "1")
+	assert.ArrayEqual(t, resourceNames(resp), []string{"a", "b"})
+	assert.Equal(t, len(resp.GetRemovedResources()), 0)
+
+	cluster := &envoyapi.Cluster{}
+	assert.Nil(t, proto.Unmarshal(resp.GetResources()[0].GetResource().GetValue(), cluster))
+	assert.Equal(t, cluster.GetName(), "a")
+
+	// ack without a node; no response
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{ResponseNonce: "1"}
+
+	// a changes, b is removed, c is added
+	assert.Nil(t, dc.SetSnapshot(
+		nodeKey,
+		cache.NewSnapshot(
+			"2",
+			nil,
+			[]cache.Resource{
+				&envoyapi.Cluster{Name: "a", LbPolicy: envoyapi.Cluster_RANDOM},
+				&envoyapi.Cluster{Name: "c"},
+			},
+			nil,
+			nil,
+		),
+	))
+
+	resp = stream.next(t)
+	assert.Equal(t, resp.GetSystemVersionInfo(), "2")
+	assert.Equal(t, resp.GetNonce(), "2")
+	assert.ArrayEqual(t, resourceNames(resp), []string{"a", "c"})
+	assert.ArrayEqual(t, resp.GetRemovedResources(), []string{"b"})
+
+	// an unchanged snapshot produces no response; the next response is for
+	// the following change
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{ResponseNonce: "2"}
+	assert.Nil(t, dc.SetSnapshot(
+		nodeKey,
+		cache.NewSnapshot(
+			"3",
+			nil,
+			[]cache.Resource{
+				&envoyapi.Cluster{Name: "a", LbPolicy: envoyapi.Cluster_RANDOM},
+				&envoyapi.Cluster{Name: "c"},
+			},
+			nil,
+			nil,
+		),
+	))
+	assert.Nil(t, dc.SetSnapshot(nodeKey, mkDeltaSnapshot("4", "c")))
+
+	resp = stream.next(t)
+	assert.Equal(t, resp.GetSystemVersionInfo(), "4")
+	assert.Equal(t, len(resp.GetResources()), 0)
+	assert.ArrayEqual(t, resp.GetRemovedResources(), []string{"a"})
+
+	close(stream.recv)
+	assert.Nil(t, <-errCh)
+
+	callbacks.mutex.Lock()
+	defer callbacks.mutex.Unlock()
+	assert.ArrayEqual(t, callbacks.opened, []string{cache.ClusterType})
+	assert.ArrayEqual(t, callbacks.closed, []int64{1})
+	assert.Equal(t, len(callbacks.requests), 3)
+	assert.Equal(t, len(callbacks.responses), 3)
+	for _, req := range callbacks.requests {
+		assert.Equal(t, req.GetTypeUrl(), cache.ClusterType)
+		assert.SameInstance(t, req.GetNode(), testDeltaNode)
+	}
+}
+
+func TestDeltaServerSubscriptions(t *testing.T) {
+	nodeKey := tbnProxyNodeHash{}.ID(testDeltaNode)
+	dc := newDeltaCache()
+	s := newDeltaServer(dc, &recordingDeltaCallbacks{})
+	stream := newFakeDeltaStream()
+	errCh := runDeltaServer(s, stream, cache.AnyType)
+
+	a := &envoyapi.ClusterLoadAssignment{ClusterName: "a"}
+	b := &envoyapi.ClusterLoadAssignment{ClusterName: "b"}
+	assert.Nil(t, dc.SetSnapshot(
+		nodeKey,
+		cache.NewSnapshot("1", []cache.Resource{a, b}, nil, nil, nil),
+	))
+
+	versions, err := resourceVersions(map[string]cache.Resource{"a": a, "b": b})
+	assert.Nil(t, err)
+
+	// the client already has a, so only b is sent
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{
+		Node:                    testDeltaNode,
+		TypeUrl:                 cache.EndpointType,
+		ResourceNamesSubscribe:  []string{"a", "b"},
+		InitialResourceVersions: map[string]string{"a": versions["a"]},
+	}
+	resp := stream.next(t)
+	assert.ArrayEqual(t, resourceNames(resp), []string{"b"})
+
+	// resubscribing always resends
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{
+		TypeUrl:                cache.EndpointType,
+		ResponseNonce:          resp.GetNonce(),
+		ResourceNamesSubscribe: []string{"a"},
+	}
+	resp = stream.next(t)
+	assert.ArrayEqual(t, resourceNames(resp), []string{"a"})
+
+	// unsubscribed resources are not sent, even when they change; a
+	// subscription to a missing resource is answered with no resources
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{
+		TypeUrl:                  cache.EndpointType,
+		ResponseNonce:            resp.GetNonce(),
+		ResourceNamesSubscribe:   []string{"c"},
+		ResourceNamesUnsubscribe: []string{"b"},
+	}
+	resp = stream.next(t)
+	assert.Equal(t, len(resp.GetResources()), 0)
+	assert.Equal(t, len(resp.GetRemovedResources()), 0)
+
+	assert.Nil(t, dc.SetSnapshot(
+		nodeKey,
+		cache.NewSnapshot(
+			"2",
+			[]cache.Resource{
+				a,
+				&envoyapi.ClusterLoadAssignment{ClusterName: "b", Endpoints: []*envoyendpoint.LocalityLbEndpoints{{}}},
+			},
+			nil,
+			nil,
+			nil,
+		),
+	))
+
+	// stale nonces are ignored
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{
+		TypeUrl:                cache.EndpointType,
+		ResponseNonce:          "1",
+		ResourceNamesSubscribe: []string{"b"},
+	}
+
+	// a type URL is required with ADS
+	stream.recv <- &envoyapi.DeltaDiscoveryRequest{}
+	err = <-errCh
+	assert.Equal(t, status.Code(err), codes.InvalidArgument)
+
+	select {
+	case resp := <-stream.sent:
+		t.Fatalf("unexpected response: %v", resp)
+	default:
+	}
+}
@@ -57,8 +57,8 @@ func TestClusterServiceReturnsEmptyResponseFromUnderlying(t *testing.T) {
 func TestClusterServiceUnderlyingResponseParsedAndReturned(t *testing.T) {
 	expectedClusters := []*envoyapi.Cluster{
 		{
-			Name: "cluster1",
-			Type: envoyapi.Cluster_STATIC,
+			Name:                 "cluster1",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
 			Hosts: []*envoycore.Address{
 				{
 					Address: &envoycore.Address_SocketAddress{
@@ -74,8 +74,8 @@ func TestClusterServiceUnderlyingResponseParsedAndReturned(t *testing.T) {
 			},
 		},
 		{
-			Name: "cluster2",
-			Type: envoyapi.Cluster_STATIC,
+			Name:                 "cluster2",
+			ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
 			Hosts: []*envoycore.Address{
 				{
 					Address: &envoycore.Address_SocketAddress{
@@ -94,7 +94,7 @@ func TestClusterServiceUnderlyingResponseParsedAndReturned(t *testing.T) {
 
 	cs := clusterService(&fnDiscoveryService{
 		fetchFn: func(*envoyapi.DiscoveryRequest) (*envoyapi.DiscoveryResponse, error) {
-			resources := make([]types.Any, len(expectedClusters))
+			resources := make([]*types.Any, len(expectedClusters))
 			var typeURL string
 			for idx, c := range expectedClusters {
 				any, err := types.MarshalAny(c)
@@ -102,7 +102,7 @@ func TestClusterServiceUnderlyingResponseParsedAndReturned(t *testing.T) {
 					return nil, err
 				}
 
-				resources[idx] = *any
+				resources[idx] = any
 				typeURL = any.GetTypeUrl()
 			}
 
@@ -186,11 +186,11 @@ func TestAsClusterResolverClusterLoadAssignmentEndpointsConverted(t *testing.T)
 
 	cla := &envoyapi.ClusterLoadAssignment{
 		ClusterName: clusterName,
-		Endpoints: []envoyendpoint.LocalityLbEndpoints{
+		Endpoints: []*envoyendpoint.LocalityLbEndpoints{
 			{
-				LbEndpoints: []envoyendpoint.LbEndpoint{
+				LbEndpoints: []*envoyendpoint.LbEndpoint{
 					{
-						Endpoint: &envoyendpoint.Endpoint{
+						HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 							Address: &envoycore.Address{
 								Address: &envoycore.Address_SocketAddress{
 									SocketAddress: &envoycore.SocketAddress{
@@ -202,7 +202,7 @@ func TestAsClusterResolverClusterLoadAssignmentEndpointsConverted(t *testing.T)
 									},
 								},
 							},
-						},
+						}},
 						HealthStatus: envoycore.HealthStatus_HEALTHY,
 						Metadata: &envoycore.Metadata{
 							FilterMetadata: map[string]*types.Struct{
@@ -229,7 +229,7 @@ func TestAsClusterResolverClusterLoadAssignmentEndpointsConverted(t *testing.T)
 						},
 					},
 					{
-						Endpoint: &envoyendpoint.Endpoint{
+						HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 							Address: &envoycore.Address{
 								Address: &envoycore.Address_SocketAddress{
 									SocketAddress: &envoycore.SocketAddress{
@@ -241,7 +241,7 @@ func TestAsClusterResolverClusterLoadAssignmentEndpointsConverted(t *testing.T)
 									},
 								},
 							},
-						},
+						}},
 						HealthStatus: envoycore.HealthStatus_HEALTHY,
 						Metadata: &envoycore.Metadata{
 							FilterMetadata: map[string]*types.Struct{
@@ -275,7 +275,7 @@ func TestAsClusterResolverClusterLoadAssignmentEndpointsConverted(t *testing.T)
 	any, err := types.MarshalAny(cla)
 	assert.Nil(t, err)
 	response := &envoyapi.DiscoveryResponse{
-		Resources: []types.Any{*any},
+		Resources: []*types.Any{any},
 	}
 
 	es := endpointService(&fnDiscoveryService{
@@ -341,7 +341,7 @@ func TestEndpointServiceSourceTooManyResponsesReturnsError(t *testing.T) {
 			assert.ArrayEqual(t, dr.GetResourceNames(), []string{clusterName})
 
 			return &envoyapi.DiscoveryResponse{
-				Resources: []types.Any{
+				Resources: []*types.Any{
 					{
 						TypeUrl: "blerp",
 					},
@@ -365,7 +365,7 @@ func TestEndpointServiceSourceBadUnmarshalReturnsError(t *testing.T) {
 			assert.ArrayEqual(t, dr.GetResourceNames(), []string{clusterName})
 
 			return &envoyapi.DiscoveryResponse{
-				Resources: []types.Any{
+				Resources: []*types.Any{
 					{
 						TypeUrl: "invalid-type-url",
 					},
@@ -29,6 +29,7 @@ import (
 
 	tbnapi "github.com/turbinelabs/api"
 	"github.com/turbinelabs/nonstdlib/log/console"
+	"github.com/turbinelabs/rotor/constants"
 	"github.com/turbinelabs/rotor/xds/poller"
 )
 
@@ -88,10 +89,33 @@ func mkEnvoyLbEndpoint(host string, port int, metadata tbnapi.Metadata) *envoyen
 				Address: mkEnvoyAddress(host, port),
 			},
 		},
-		Metadata: toEnvoyMetadata(metadata),
+		Metadata:     toEnvoyMetadata(metadata),
+		HealthStatus: envoyHealthStatus(metadata),
 	}
 }
 
+// envoyHealthStatus returns DRAINING for Instances marked with the draining
+// metadata key, HEALTHY or UNHEALTHY for Instances whose health metadata key
+// records the result of rotor's health checks, and UNKNOWN otherwise,
+// leaving health to Envoy.
+func envoyHealthStatus(metadata tbnapi.Metadata) envoycore.HealthStatus {
+	status := envoycore.HealthStatus_UNKNOWN
+	for _, m := range metadata {
+		switch m.Key {
+		case constants.DrainingMetadataKey:
+			return envoycore.HealthStatus_DRAINING
+		case constants.HealthMetadataKey:
+			switch m.Value {
+			case constants.HealthyMetadataValue:
+				status = envoycore.HealthStatus_HEALTHY
+			case constants.UnhealthyMetadataValue:
+				status = envoycore.HealthStatus_UNHEALTHY
+			}
+		}
+	}
+	return status
+}
+
 func envoyEndpointsToTbnInstances(
 	lles []*envoyendpoint.LocalityLbEndpoints,
 ) (tbnapi.Instances, []error) {
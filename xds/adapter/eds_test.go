@@ -27,6 +27,7 @@ import (
 	"github.com/gogo/protobuf/types"
 
 	tbnapi "github.com/turbinelabs/api"
+	"github.com/turbinelabs/rotor/constants"
 	"github.com/turbinelabs/rotor/xds/poller"
 	"github.com/turbinelabs/test/assert"
 )
@@ -80,11 +81,11 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 	expectedClusterAssignments := []envoyapi.ClusterLoadAssignment{
 		{
 			ClusterName: "foo",
-			Endpoints: []envoyendpoint.LocalityLbEndpoints{
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{
 				{
-					LbEndpoints: []envoyendpoint.LbEndpoint{
+					LbEndpoints: []*envoyendpoint.LbEndpoint{
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -96,7 +97,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -110,7 +111,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 							},
 						},
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -122,7 +123,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -136,7 +137,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 							},
 						},
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -148,7 +149,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -162,7 +163,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 							},
 						},
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -174,7 +175,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -193,11 +194,11 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 		},
 		{
 			ClusterName: "baz",
-			Endpoints: []envoyendpoint.LocalityLbEndpoints{
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{
 				{
-					LbEndpoints: []envoyendpoint.LbEndpoint{
+					LbEndpoints: []*envoyendpoint.LbEndpoint{
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -209,7 +210,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{},
 						},
 					},
@@ -218,11 +219,11 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 		},
 		{
 			ClusterName: "bar",
-			Endpoints: []envoyendpoint.LocalityLbEndpoints{
+			Endpoints: []*envoyendpoint.LocalityLbEndpoints{
 				{
-					LbEndpoints: []envoyendpoint.LbEndpoint{
+					LbEndpoints: []*envoyendpoint.LbEndpoint{
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -234,7 +235,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -246,7 +247,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 							},
 						},
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -258,7 +259,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -272,7 +273,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 							},
 						},
 						{
-							Endpoint: &envoyendpoint.Endpoint{
+							HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 								Address: &envoycore.Address{
 									Address: &envoycore.Address_SocketAddress{
 										SocketAddress: &envoycore.SocketAddress{
@@ -284,7 +285,7 @@ func TestFullRequestFullClusterLoadAssignments(t *testing.T) {
 										},
 									},
 								},
-							},
+							}},
 							Metadata: &envoycore.Metadata{
 								FilterMetadata: map[string]*types.Struct{
 									"envoy.lb": {
@@ -330,11 +331,11 @@ func TestEnvoyEndpointsToTbnInstancesEmptyInputReturnsEmpty(t *testing.T) {
 }
 
 func TestEnvoyEndpointsToTbnInstancesReturnsErrorsAndGoodInstances(t *testing.T) {
-	lles := []envoyendpoint.LocalityLbEndpoints{
+	lles := []*envoyendpoint.LocalityLbEndpoints{
 		{
-			LbEndpoints: []envoyendpoint.LbEndpoint{
+			LbEndpoints: []*envoyendpoint.LbEndpoint{
 				{
-					Endpoint: &envoyendpoint.Endpoint{
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 						Address: &envoycore.Address{
 							Address: &envoycore.Address_SocketAddress{
 								SocketAddress: &envoycore.SocketAddress{
@@ -346,7 +347,7 @@ func TestEnvoyEndpointsToTbnInstancesReturnsErrorsAndGoodInstances(t *testing.T)
 								},
 							},
 						},
-					},
+					}},
 					Metadata: &envoycore.Metadata{
 						FilterMetadata: map[string]*types.Struct{
 							"envoy.lb": {
@@ -367,8 +368,8 @@ func TestEnvoyEndpointsToTbnInstancesReturnsErrorsAndGoodInstances(t *testing.T)
 					},
 				},
 				{
-					Endpoint: &envoyendpoint.Endpoint{},
-					Metadata: &envoycore.Metadata{},
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{}},
+					Metadata:       &envoycore.Metadata{},
 				},
 			},
 		},
@@ -392,12 +393,12 @@ func TestEnvoyEndpointsToTbnInstancesReturnsErrorsAndGoodInstances(t *testing.T)
 }
 
 func TestEnvoyEndpointsToTbnInstancesReturnsInstancesWithMetadata(t *testing.T) {
-	lles := []envoyendpoint.LocalityLbEndpoints{
+	lles := []*envoyendpoint.LocalityLbEndpoints{
 		{
 			Locality: &envoycore.Locality{},
-			LbEndpoints: []envoyendpoint.LbEndpoint{
+			LbEndpoints: []*envoyendpoint.LbEndpoint{
 				{
-					Endpoint: &envoyendpoint.Endpoint{
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 						Address: &envoycore.Address{
 							Address: &envoycore.Address_SocketAddress{
 								SocketAddress: &envoycore.SocketAddress{
@@ -409,7 +410,7 @@ func TestEnvoyEndpointsToTbnInstancesReturnsInstancesWithMetadata(t *testing.T)
 								},
 							},
 						},
-					},
+					}},
 					Metadata: &envoycore.Metadata{
 						FilterMetadata: map[string]*types.Struct{
 							"envoy.lb": {
@@ -430,7 +431,7 @@ func TestEnvoyEndpointsToTbnInstancesReturnsInstancesWithMetadata(t *testing.T)
 					},
 				},
 				{
-					Endpoint: &envoyendpoint.Endpoint{
+					HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{
 						Address: &envoycore.Address{
 							Address: &envoycore.Address_SocketAddress{
 								SocketAddress: &envoycore.SocketAddress{
@@ -442,7 +443,7 @@ func TestEnvoyEndpointsToTbnInstancesReturnsInstancesWithMetadata(t *testing.T)
 								},
 							},
 						},
-					},
+					}},
 					Metadata: &envoycore.Metadata{
 						FilterMetadata: map[string]*types.Struct{
 							"envoy.lb": {
@@ -486,7 +487,7 @@ func TestEnvoyEndpointsToTbnInstancesReturnsInstancesWithMetadata(t *testing.T)
 func TestEnvoyEndpointToTbnInstanceReturnsErrorForEmptyLbEndpoint(t *testing.T) {
 	badInputs := []envoyendpoint.LbEndpoint{
 		{},
-		{Endpoint: &envoyendpoint.Endpoint{}},
+		{HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{Endpoint: &envoyendpoint.Endpoint{}}},
 	}
 
 	for _, badInput := range badInputs {
@@ -639,3 +640,64 @@ func TestEnvoyMetadataToTbnMetadataProperlyConvertsInputIgnoresStructsLists(t *t
 	assert.Equal(t, mm["field3"], "1.43234234")
 	assert.Equal(t, mm["field4"], "true")
 }
+
+func TestMkEnvoyLbEndpointDraining(t *testing.T) {
+	le := mkEnvoyLbEndpoint("1.2.3.4", 80, tbnapi.Metadata{{Key: "a", Value: "b"}})
+	assert.Equal(t, le.GetHealthStatus(), envoycore.HealthStatus_UNKNOWN)
+
+	le = mkEnvoyLbEndpoint(
+		"1.2.3.4",
+		80,
+		tbnapi.Metadata{
+			{Key: "a", Value: "b"},
+			{Key: constants.DrainingMetadataKey, Value: "2018-01-02T03:04:05Z"},
+		},
+	)
+	assert.Equal(t, le.GetHealthStatus(), envoycore.HealthStatus_DRAINING)
+	assert.Equal(
+		t,
+		le.GetMetadata().GetFilterMetadata()[envoyLb].GetFields()[constants.DrainingMetadataKey].GetStringValue(),
+		"2018-01-02T03:04:05Z",
+	)
+}
+
+func TestMkEnvoyLbEndpointHealth(t *testing.T) {
+	mk := func(md ...tbnapi.Metadatum) envoycore.HealthStatus {
+		return mkEnvoyLbEndpoint("1.2.3.4", 80, tbnapi.Metadata(md)).GetHealthStatus()
+	}
+
+	healthy := tbnapi.Metadatum{
+		Key:   constants.HealthMetadataKey,
+		Value: constants.HealthyMetadataValue,
+	}
+	unhealthy := tbnapi.Metadatum{
+		Key:   constants.HealthMetadataKey,
+		Value: constants.UnhealthyMetadataValue,
+	}
+	draining := tbnapi.Metadatum{
+		Key:   constants.DrainingMetadataKey,
+		Value: "2018-01-02T03:04:05Z",
+	}
+
+	assert.Equal(t, mk(healthy), envoycore.HealthStatus_HEALTHY)
+	assert.Equal(t, mk(unhealthy), envoycore.HealthStatus_UNHEALTHY)
+	assert.Equal(t, mk(healthy, draining), envoycore.HealthStatus_DRAINING)
+	assert.Equal(t, mk(draining, unhealthy), envoycore.HealthStatus_DRAINING)
+	assert.Equal(
+		t,
+		mk(tbnapi.Metadatum{Key: constants.HealthMetadataKey, Value: "bogus"}),
+		envoycore.HealthStatus_UNKNOWN,
+	)
+}
+
+func TestMkEnvoyLbEndpointIgnoresCollectedHealthLabels(t *testing.T) {
+	le := mkEnvoyLbEndpoint(
+		"1.2.3.4",
+		80,
+		tbnapi.Metadata{
+			{Key: "draining", Value: "true"},
+			{Key: "health", Value: constants.UnhealthyMetadataValue},
+		},
+	)
+	assert.Equal(t, le.GetHealthStatus(), envoycore.HealthStatus_UNKNOWN)
+}
@@ -47,6 +47,8 @@ const (
 
 type lds struct {
 	loggingCluster string
+	ads            bool
+	delta          bool
 }
 
 // adapt turns poller.Objects into Listener cache.Resources
@@ -111,7 +113,7 @@ func (s lds) inject(l *envoyapi.Listener) error {
 
 					router.UpstreamLog = append(router.UpstreamLog, upstreamLog)
 
-                                        var hfConfig *types.Struct
+					var hfConfig *types.Struct
 					if hfConfig, err = util.MessageToStruct(router); err != nil {
 						console.Error().Printf(
 							"failed to serialize router for listener %q: %s",
@@ -120,7 +122,7 @@ func (s lds) inject(l *envoyapi.Listener) error {
 						)
 					}
 
-                                        hf.ConfigType = &envoyhcm.HttpFilter_Config{Config: hfConfig}
+					hf.ConfigType = &envoyhcm.HttpFilter_Config{Config: hfConfig}
 				}
 			}
 
@@ -182,8 +184,8 @@ func (s lds) inject(l *envoyapi.Listener) error {
 				}
 			}
 
-                        var filterConfig *types.Struct
-			if filterConfig , err = util.MessageToStruct(httpFilter); err != nil {
+			var filterConfig *types.Struct
+			if filterConfig, err = util.MessageToStruct(httpFilter); err != nil {
 				console.Error().Printf(
 					"failed to serialize HttpConnectionManager for Listener %q: %s",
 					l.GetName(),
@@ -191,7 +193,7 @@ func (s lds) inject(l *envoyapi.Listener) error {
 				)
 			}
 
-                        f.ConfigType = &envoylistener.Filter_Config{Config: filterConfig}
+			f.ConfigType = &envoylistener.Filter_Config{Config: filterConfig}
 		}
 	}
 
@@ -360,10 +362,10 @@ func mkGRPCAccessLog(id string, cluster string, format log.Format) (*envoylog.Ac
 	}
 
 	return &envoylog.AccessLog{
-		Name:   util.HTTPGRPCAccessLog,
-                ConfigType: &envoylog.AccessLog_Config{
-                        Config: grpcAccessLog,
-                },
+		Name: util.HTTPGRPCAccessLog,
+		ConfigType: &envoylog.AccessLog_Config{
+			Config: grpcAccessLog,
+		},
 	}, nil
 }
 
@@ -437,6 +439,11 @@ func (s lds) mkHTTPConnectionManager(
 		accessLogs = []*envoylog.AccessLog{accessLog}
 	}
 
+	routerFilter := &envoyhcm.HttpFilter{Name: util.Router}
+	if router != nil {
+		routerFilter.ConfigType = &envoyhcm.HttpFilter_Config{Config: router}
+	}
+
 	return &envoyhcm.HttpConnectionManager{
 		CodecType:  envoyhcm.AUTO,
 		StatPrefix: mkStatsName(proxyName, port),
@@ -447,22 +454,17 @@ func (s lds) mkHTTPConnectionManager(
 		// defined, this filter is a no-op.
 		HttpFilters: []*envoyhcm.HttpFilter{
 			{
-				Name:   util.CORS,
-				ConfigType: &envoyhcm.HttpFilter_Config{
-                                        Config: &types.Struct{},
-                                },
-			},
-			{
-				Name:   util.Router,
+				Name: util.CORS,
 				ConfigType: &envoyhcm.HttpFilter_Config{
-                                        Config: router,
-                                },
+					Config: &types.Struct{},
+				},
 			},
+			routerFilter,
 		},
 		RouteSpecifier: &envoyhcm.HttpConnectionManager_Rds{
 			Rds: &envoyhcm.Rds{
 				RouteConfigName: mkListenerName(proxyName, port),
-				ConfigSource:    &xdsClusterConfig,
+				ConfigSource:    xdsConfigSource(s.ads, s.delta),
 			},
 		},
 		Tracing:   tracing,
@@ -498,10 +500,10 @@ func (s lds) mkListener(
 
 			if len(lfs) == 0 {
 				lfs = append(lfs, &envoylistener.ListenerFilter{
-					Name:   "envoy.listener.tls_inspector",
+					Name: "envoy.listener.tls_inspector",
 					ConfigType: &envoylistener.ListenerFilter_Config{
-                                                Config: &types.Struct{},
-                                        },
+						Config: &types.Struct{},
+					},
 				})
 			}
 
@@ -537,10 +539,10 @@ func (s lds) mkListener(
 				TlsContext: tlsContext,
 				Filters: []*envoylistener.Filter{
 					{
-						Name:   util.HTTPConnectionManager,
-                                                ConfigType: &envoylistener.Filter_Config{
-					                Config: httpFilter,
-				                },
+						Name: util.HTTPConnectionManager,
+						ConfigType: &envoylistener.Filter_Config{
+							Config: httpFilter,
+						},
 					},
 				},
 			})
@@ -561,10 +563,10 @@ func (s lds) mkListener(
 				},
 				Filters: []*envoylistener.Filter{
 					{
-						Name:   util.HTTPConnectionManager,
-                                                ConfigType: &envoylistener.Filter_Config{
-					                Config: httpFilter,
-				                },
+						Name: util.HTTPConnectionManager,
+						ConfigType: &envoylistener.Filter_Config{
+							Config: httpFilter,
+						},
 					},
 				},
 			}
@@ -604,7 +606,7 @@ func (s lds) mkListener(
 // may still be populated.
 func hostPortForListener(l *envoyapi.Listener) (string, int, error) {
 	if l == nil {
-		return "", 1, errors.New("could not lookup port for nil listener")
+		return "", 0, errors.New("could not lookup port for nil listener")
 	}
 
 	addr := l.GetAddress()
@@ -79,8 +79,8 @@ func testTracingConfig(t *testing.T, ingress bool, requestHeadersForTags []strin
 			StatPrefix: "foo-1000",
 			HttpFilters: []*envoyhcm.HttpFilter{
 				{
-					Name:   util.CORS,
-					Config: &types.Struct{},
+					Name:       util.CORS,
+					ConfigType: &envoyhcm.HttpFilter_Config{Config: &types.Struct{}},
 				},
 				{
 					Name: util.Router,
@@ -89,7 +89,7 @@ func testTracingConfig(t *testing.T, ingress bool, requestHeadersForTags []strin
 			RouteSpecifier: &envoyhcm.HttpConnectionManager_Rds{
 				Rds: &envoyhcm.Rds{
 					RouteConfigName: "foo:1000",
-					ConfigSource:    xdsClusterConfig,
+					ConfigSource:    &xdsClusterConfig,
 				},
 			},
 			Tracing: &envoyhcm.HttpConnectionManager_Tracing{
@@ -114,8 +114,8 @@ func TestMkHttpConnectionManager(t *testing.T) {
 			StatPrefix: "foo-1000",
 			HttpFilters: []*envoyhcm.HttpFilter{
 				{
-					Name:   util.CORS,
-					Config: &types.Struct{},
+					Name:       util.CORS,
+					ConfigType: &envoyhcm.HttpFilter_Config{Config: &types.Struct{}},
 				},
 				{
 					Name: util.Router,
@@ -124,7 +124,7 @@ func TestMkHttpConnectionManager(t *testing.T) {
 			RouteSpecifier: &envoyhcm.HttpConnectionManager_Rds{
 				Rds: &envoyhcm.Rds{
 					RouteConfigName: "foo:1000",
-					ConfigSource:    xdsClusterConfig,
+					ConfigSource:    &xdsClusterConfig,
 				},
 			},
 			Tracing: nil,
@@ -158,12 +158,12 @@ func TestMkHttpConnectionManagerWithGRPCLog(t *testing.T) {
 			StatPrefix: "foo-1000",
 			HttpFilters: []*envoyhcm.HttpFilter{
 				{
-					Name:   util.CORS,
-					Config: &types.Struct{},
+					Name:       util.CORS,
+					ConfigType: &envoyhcm.HttpFilter_Config{Config: &types.Struct{}},
 				},
 				{
 					Name: util.Router,
-					Config: mapToStruct(t, map[string]interface{}{
+					ConfigType: &envoyhcm.HttpFilter_Config{Config: mapToStruct(t, map[string]interface{}{
 						"upstream_log": []map[string]interface{}{
 							{
 								"name": util.HTTPGRPCAccessLog,
@@ -182,19 +182,19 @@ func TestMkHttpConnectionManagerWithGRPCLog(t *testing.T) {
 								},
 							},
 						},
-					}),
+					})},
 				},
 			},
 			RouteSpecifier: &envoyhcm.HttpConnectionManager_Rds{
 				Rds: &envoyhcm.Rds{
 					RouteConfigName: "foo:1000",
-					ConfigSource:    xdsClusterConfig,
+					ConfigSource:    &xdsClusterConfig,
 				},
 			},
 			AccessLog: []*envoylog.AccessLog{
 				{
 					Name: util.HTTPGRPCAccessLog,
-					Config: mapToStruct(t, map[string]interface{}{
+					ConfigType: &envoylog.AccessLog_Config{Config: mapToStruct(t, map[string]interface{}{
 						"common_config": map[string]interface{}{
 							"log_name": grpcAccessLogID,
 							"grpc_service": map[string]interface{}{
@@ -206,7 +206,7 @@ func TestMkHttpConnectionManagerWithGRPCLog(t *testing.T) {
 						"additional_request_headers_to_log": log.EnvoyGRPCRequestHeaders(
 							log.TbnAccessFormat,
 						),
-					}),
+					})},
 				},
 			},
 		},
@@ -250,7 +250,7 @@ func TestEmptyRequestSeveralDomains(t *testing.T) {
 	expectedEnvoyListeners := []envoyapi.Listener{
 		{
 			Name: "main-test-proxy:8080",
-			Address: envoycore.Address{
+			Address: &envoycore.Address{
 				Address: &envoycore.Address_SocketAddress{
 					SocketAddress: &envoycore.SocketAddress{
 						Protocol: envoycore.TCP,
@@ -261,13 +261,13 @@ func TestEmptyRequestSeveralDomains(t *testing.T) {
 					},
 				},
 			},
-			FilterChains: []envoylistener.FilterChain{
+			FilterChains: []*envoylistener.FilterChain{
 				{
 					FilterChainMatch: &envoylistener.FilterChainMatch{},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8080,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8080},
 						},
 					},
 				},
@@ -275,7 +275,7 @@ func TestEmptyRequestSeveralDomains(t *testing.T) {
 		},
 		{
 			Name: "main-test-proxy:8443",
-			Address: envoycore.Address{
+			Address: &envoycore.Address{
 				Address: &envoycore.Address_SocketAddress{
 					SocketAddress: &envoycore.SocketAddress{
 						Protocol: envoycore.TCP,
@@ -286,13 +286,13 @@ func TestEmptyRequestSeveralDomains(t *testing.T) {
 					},
 				},
 			},
-			ListenerFilters: []envoylistener.ListenerFilter{
+			ListenerFilters: []*envoylistener.ListenerFilter{
 				{
-					Name:   "envoy.listener.tls_inspector",
-					Config: &types.Struct{},
+					Name:       "envoy.listener.tls_inspector",
+					ConfigType: &envoylistener.ListenerFilter_Config{Config: &types.Struct{}},
 				},
 			},
-			FilterChains: []envoylistener.FilterChain{
+			FilterChains: []*envoylistener.FilterChain{
 				{
 					FilterChainMatch: &envoylistener.FilterChainMatch{
 						ServerNames: []string{"foo.example.com"},
@@ -307,10 +307,10 @@ func TestEmptyRequestSeveralDomains(t *testing.T) {
 							},
 						},
 					},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8443,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8443},
 						},
 					},
 				},
@@ -396,7 +396,7 @@ func TestEmptyRequestSeveralDomainsOnePort(t *testing.T) {
 	expectedEnvoyListeners := []envoyapi.Listener{
 		{
 			Name: "main-test-proxy:8080",
-			Address: envoycore.Address{
+			Address: &envoycore.Address{
 				Address: &envoycore.Address_SocketAddress{
 					SocketAddress: &envoycore.SocketAddress{
 						Protocol: envoycore.TCP,
@@ -407,13 +407,13 @@ func TestEmptyRequestSeveralDomainsOnePort(t *testing.T) {
 					},
 				},
 			},
-			FilterChains: []envoylistener.FilterChain{
+			FilterChains: []*envoylistener.FilterChain{
 				{
 					FilterChainMatch: &envoylistener.FilterChainMatch{},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8080,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8080},
 						},
 					},
 				},
@@ -518,7 +518,7 @@ func TestEmptyRequestSeveralDomainsOnePortSSL(t *testing.T) {
 	expectedEnvoyListeners := []envoyapi.Listener{
 		{
 			Name: "main-test-proxy:8443",
-			Address: envoycore.Address{
+			Address: &envoycore.Address{
 				Address: &envoycore.Address_SocketAddress{
 					SocketAddress: &envoycore.SocketAddress{
 						Protocol: envoycore.TCP,
@@ -529,13 +529,13 @@ func TestEmptyRequestSeveralDomainsOnePortSSL(t *testing.T) {
 					},
 				},
 			},
-			ListenerFilters: []envoylistener.ListenerFilter{
+			ListenerFilters: []*envoylistener.ListenerFilter{
 				{
-					Name:   "envoy.listener.tls_inspector",
-					Config: &types.Struct{},
+					Name:       "envoy.listener.tls_inspector",
+					ConfigType: &envoylistener.ListenerFilter_Config{Config: &types.Struct{}},
 				},
 			},
-			FilterChains: []envoylistener.FilterChain{
+			FilterChains: []*envoylistener.FilterChain{
 				{
 					FilterChainMatch: &envoylistener.FilterChainMatch{
 						ServerNames: []string{"foo.example.com"},
@@ -550,10 +550,10 @@ func TestEmptyRequestSeveralDomainsOnePortSSL(t *testing.T) {
 							},
 						},
 					},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8443,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8443},
 						},
 					},
 				},
@@ -571,10 +571,10 @@ func TestEmptyRequestSeveralDomainsOnePortSSL(t *testing.T) {
 							},
 						},
 					},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8443,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8443},
 						},
 					},
 				},
@@ -670,7 +670,7 @@ func TestEmptyRequestSeveralDomainsOnePortMixed(t *testing.T) {
 	expectedEnvoyListeners := []envoyapi.Listener{
 		{
 			Name: "main-test-proxy:8443",
-			Address: envoycore.Address{
+			Address: &envoycore.Address{
 				Address: &envoycore.Address_SocketAddress{
 					SocketAddress: &envoycore.SocketAddress{
 						Protocol: envoycore.TCP,
@@ -681,21 +681,21 @@ func TestEmptyRequestSeveralDomainsOnePortMixed(t *testing.T) {
 					},
 				},
 			},
-			ListenerFilters: []envoylistener.ListenerFilter{
+			ListenerFilters: []*envoylistener.ListenerFilter{
 				{
-					Name:   "envoy.listener.tls_inspector",
-					Config: &types.Struct{},
+					Name:       "envoy.listener.tls_inspector",
+					ConfigType: &envoylistener.ListenerFilter_Config{Config: &types.Struct{}},
 				},
 			},
-			FilterChains: []envoylistener.FilterChain{
+			FilterChains: []*envoylistener.FilterChain{
 				{
 					FilterChainMatch: &envoylistener.FilterChainMatch{
 						ServerNames: []string{"bar.example.com"},
 					},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8443,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8443},
 						},
 					},
 				},
@@ -713,10 +713,10 @@ func TestEmptyRequestSeveralDomainsOnePortMixed(t *testing.T) {
 							},
 						},
 					},
-					Filters: []envoylistener.Filter{
+					Filters: []*envoylistener.Filter{
 						{
-							Name:   util.HTTPConnectionManager,
-							Config: httpFilter8443,
+							Name:       util.HTTPConnectionManager,
+							ConfigType: &envoylistener.Filter_Config{Config: httpFilter8443},
 						},
 					},
 				},
@@ -912,66 +912,65 @@ func TestInject(t *testing.T) {
                             "path": "/cat"
                           },
                           "route": {
-                            "cluster": "cat",
-                            "request_headers_to_add": [
-                              {
-                                "append": false,
-                                "header": {
-                                  "key": "x-tbn-route",
-                                  "value": "animals:8080/cat"
-                                }
+                            "cluster": "cat"
+                          },
+                          "request_headers_to_add": [
+                            {
+                              "append": false,
+                              "header": {
+                                "key": "x-tbn-route",
+                                "value": "animals:8080/cat"
                               }
-                            ]
-                          }
+                            }
+                          ]
                         },
                         {
-                          "match": {},
                           "route": {
-                            "cluster": "dog",
-                            "request_headers_to_add": [
-                              {
-                                "append": false,
-                                "header": {
-                                  "key": "x-tbn-route",
-                                  "value": "animals:8080/DEFAULT"
-                                }
+                            "cluster": "dog"
+                          },
+                          "request_headers_to_add": [
+                            {
+                              "append": false,
+                              "header": {
+                                "key": "x-tbn-route",
+                                "value": "animals:8080/DEFAULT"
                               }
-                            ]
-                          }
+                            }
+                          ]
                         },
                         {
                           "match": {
                             "prefix": "/"
                           },
                           "route": {
-                            "cluster": "animals",
-                            "request_headers_to_add": [
-                              {
-                                "append": false,
-                                "header": {
-                                  "key": "x-tbn-route",
-                                  "value": "animals:8080/"
-                                }
+                            "cluster": "animals"
+                          },
+                          "request_headers_to_add": [
+                            {
+                              "append": false,
+                              "header": {
+                                "key": "x-tbn-route",
+                                "value": "animals:8080/"
                               }
-                            ]
-                          }
+                            }
+                          ]
                         },
                         {
                           "match": {
                             "regex": "$/(dog|wolf)^"
                           },
                           "route": {
-                            "cluster": "canine",
-                            "request_headers_to_add": [
-                              {
-                                "append": false,
-                                "header": {
-                                  "key": "x-tbn-route",
-                                  "value": "animals:8080$/(dog|wolf)^"
-                                }
+                            "cluster": "canine"
+                          },
+                          "request_headers_to_add": [
+                            {
+                              "append": false,
+                              "header": {
+                                "key": "x-tbn-route",
+                                "value": "animals:8080$/(dog|wolf)^"
                               }
-                            ]
-                          }
+                            }
+                          ]
                         }
                       ]
                     }
@@ -1165,7 +1164,7 @@ func TestHostPortForListenerNoSocketAddress(t *testing.T) {
 func TestHostPortForListenerNoPort(t *testing.T) {
 	l := &envoyapi.Listener{
 		Name: "the listener",
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{},
 			},
@@ -1180,7 +1179,7 @@ func TestHostPortForListenerNoPort(t *testing.T) {
 func TestHostPortForListenerPortValue(t *testing.T) {
 	l := &envoyapi.Listener{
 		Name: "the listener",
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{
 					Address: "the address",
@@ -1200,7 +1199,7 @@ func TestHostPortForListenerPortValue(t *testing.T) {
 func TestHostPortForListenerBadNamedPort(t *testing.T) {
 	l := &envoyapi.Listener{
 		Name: "the listener",
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{
 					PortSpecifier: &envoycore.SocketAddress_NamedPort{
@@ -1219,7 +1218,7 @@ func TestHostPortForListenerBadNamedPort(t *testing.T) {
 func TestHostPortForListenerNamedPortNoProto(t *testing.T) {
 	l := &envoyapi.Listener{
 		Name: "the listener",
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{
 					Address: "the address",
@@ -1239,13 +1238,13 @@ func TestHostPortForListenerNamedPortNoProto(t *testing.T) {
 func TestHostPortForListenerNamedPortWithProto(t *testing.T) {
 	l := &envoyapi.Listener{
 		Name: "the listener",
-		Address: envoycore.Address{
+		Address: &envoycore.Address{
 			Address: &envoycore.Address_SocketAddress{
 				SocketAddress: &envoycore.SocketAddress{
 					Protocol: envoycore.UDP,
 					Address:  "the address",
 					PortSpecifier: &envoycore.SocketAddress_NamedPort{
-						NamedPort: "ssh",
+						NamedPort: "domain",
 					},
 				},
 			},
@@ -1253,7 +1252,7 @@ func TestHostPortForListenerNamedPortWithProto(t *testing.T) {
 	}
 	gotHost, gotPort, gotErr := hostPortForListener(l)
 	assert.Equal(t, gotHost, "the address")
-	assert.Equal(t, gotPort, 22)
+	assert.Equal(t, gotPort, 53)
 	assert.Nil(t, gotErr)
 }
 
@@ -1289,3 +1288,21 @@ func TestAddHeaderIfMissing(t *testing.T) {
 	got = addHeaderIfMissing("the-key", "the-value", want)
 	assert.DeepEqual(t, got, want)
 }
+
+func TestMkHttpConnectionManagerADS(t *testing.T) {
+	httpConnMgr, err := lds{}.mkHTTPConnectionManager("foo", 1000, nil)
+	assert.Nil(t, err)
+	assert.SameInstance(t, httpConnMgr.GetRds().GetConfigSource(), &xdsClusterConfig)
+
+	httpConnMgr, err = lds{ads: true}.mkHTTPConnectionManager("foo", 1000, nil)
+	assert.Nil(t, err)
+	assert.SameInstance(t, httpConnMgr.GetRds().GetConfigSource(), &adsClusterConfig)
+
+	httpConnMgr, err = lds{delta: true}.mkHTTPConnectionManager("foo", 1000, nil)
+	assert.Nil(t, err)
+	assert.SameInstance(t, httpConnMgr.GetRds().GetConfigSource(), &deltaClusterConfig)
+
+	httpConnMgr, err = lds{ads: true, delta: true}.mkHTTPConnectionManager("foo", 1000, nil)
+	assert.Nil(t, err)
+	assert.SameInstance(t, httpConnMgr.GetRds().GetConfigSource(), &adsClusterConfig)
+}
@@ -4,6 +4,7 @@
 package adapter
 
 import (
+	context "context"
 	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	gomock "github.com/golang/mock/gomock"
 	service "github.com/turbinelabs/api/service"
@@ -47,13 +48,15 @@ func (mr *mockCachingConsumerMockRecorder) Consume(arg0 interface{}) *gomock.Cal
 }
 
 // OnStreamOpen mocks base method
-func (m *mockCachingConsumer) OnStreamOpen(arg0 int64, arg1 string) {
-	m.ctrl.Call(m, "OnStreamOpen", arg0, arg1)
+func (m *mockCachingConsumer) OnStreamOpen(arg0 context.Context, arg1 int64, arg2 string) error {
+	ret := m.ctrl.Call(m, "OnStreamOpen", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // OnStreamOpen indicates an expected call of OnStreamOpen
-func (mr *mockCachingConsumerMockRecorder) OnStreamOpen(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnStreamOpen", reflect.TypeOf((*mockCachingConsumer)(nil).OnStreamOpen), arg0, arg1)
+func (mr *mockCachingConsumerMockRecorder) OnStreamOpen(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnStreamOpen", reflect.TypeOf((*mockCachingConsumer)(nil).OnStreamOpen), arg0, arg1, arg2)
 }
 
 // OnStreamClosed mocks base method
@@ -67,8 +70,10 @@ func (mr *mockCachingConsumerMockRecorder) OnStreamClosed(arg0 interface{}) *gom
 }
 
 // OnStreamRequest mocks base method
-func (m *mockCachingConsumer) OnStreamRequest(arg0 int64, arg1 *v2.DiscoveryRequest) {
-	m.ctrl.Call(m, "OnStreamRequest", arg0, arg1)
+func (m *mockCachingConsumer) OnStreamRequest(arg0 int64, arg1 *v2.DiscoveryRequest) error {
+	ret := m.ctrl.Call(m, "OnStreamRequest", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // OnStreamRequest indicates an expected call of OnStreamRequest
@@ -87,13 +92,15 @@ func (mr *mockCachingConsumerMockRecorder) OnStreamResponse(arg0, arg1, arg2 int
 }
 
 // OnFetchRequest mocks base method
-func (m *mockCachingConsumer) OnFetchRequest(arg0 *v2.DiscoveryRequest) {
-	m.ctrl.Call(m, "OnFetchRequest", arg0)
+func (m *mockCachingConsumer) OnFetchRequest(arg0 context.Context, arg1 *v2.DiscoveryRequest) error {
+	ret := m.ctrl.Call(m, "OnFetchRequest", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // OnFetchRequest indicates an expected call of OnFetchRequest
-func (mr *mockCachingConsumerMockRecorder) OnFetchRequest(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnFetchRequest", reflect.TypeOf((*mockCachingConsumer)(nil).OnFetchRequest), arg0)
+func (mr *mockCachingConsumerMockRecorder) OnFetchRequest(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnFetchRequest", reflect.TypeOf((*mockCachingConsumer)(nil).OnFetchRequest), arg0, arg1)
 }
 
 // OnFetchResponse mocks base method
@@ -106,6 +113,50 @@ func (mr *mockCachingConsumerMockRecorder) OnFetchResponse(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnFetchResponse", reflect.TypeOf((*mockCachingConsumer)(nil).OnFetchResponse), arg0, arg1)
 }
 
+// OnDeltaStreamOpen mocks base method
+func (m *mockCachingConsumer) OnDeltaStreamOpen(arg0 context.Context, arg1 int64, arg2 string) error {
+	ret := m.ctrl.Call(m, "OnDeltaStreamOpen", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// OnDeltaStreamOpen indicates an expected call of OnDeltaStreamOpen
+func (mr *mockCachingConsumerMockRecorder) OnDeltaStreamOpen(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnDeltaStreamOpen", reflect.TypeOf((*mockCachingConsumer)(nil).OnDeltaStreamOpen), arg0, arg1, arg2)
+}
+
+// OnDeltaStreamClosed mocks base method
+func (m *mockCachingConsumer) OnDeltaStreamClosed(arg0 int64) {
+	m.ctrl.Call(m, "OnDeltaStreamClosed", arg0)
+}
+
+// OnDeltaStreamClosed indicates an expected call of OnDeltaStreamClosed
+func (mr *mockCachingConsumerMockRecorder) OnDeltaStreamClosed(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnDeltaStreamClosed", reflect.TypeOf((*mockCachingConsumer)(nil).OnDeltaStreamClosed), arg0)
+}
+
+// OnStreamDeltaRequest mocks base method
+func (m *mockCachingConsumer) OnStreamDeltaRequest(arg0 int64, arg1 *v2.DeltaDiscoveryRequest) error {
+	ret := m.ctrl.Call(m, "OnStreamDeltaRequest", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// OnStreamDeltaRequest indicates an expected call of OnStreamDeltaRequest
+func (mr *mockCachingConsumerMockRecorder) OnStreamDeltaRequest(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnStreamDeltaRequest", reflect.TypeOf((*mockCachingConsumer)(nil).OnStreamDeltaRequest), arg0, arg1)
+}
+
+// OnStreamDeltaResponse mocks base method
+func (m *mockCachingConsumer) OnStreamDeltaResponse(arg0 int64, arg1 *v2.DeltaDiscoveryRequest, arg2 *v2.DeltaDiscoveryResponse) {
+	m.ctrl.Call(m, "OnStreamDeltaResponse", arg0, arg1, arg2)
+}
+
+// OnStreamDeltaResponse indicates an expected call of OnStreamDeltaResponse
+func (mr *mockCachingConsumerMockRecorder) OnStreamDeltaResponse(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnStreamDeltaResponse", reflect.TypeOf((*mockCachingConsumer)(nil).OnStreamDeltaResponse), arg0, arg1, arg2)
+}
+
 // mockStreamRefsIface is a mock of streamRefsIface interface
 type mockStreamRefsIface struct {
 	ctrl     *gomock.Controller
@@ -269,8 +269,8 @@ func mkEnvoyCorsPolicy(corsConfig *tbnapi.CorsConfig) *envoyroute.CorsPolicy {
 		MaxAge:           fmt.Sprintf("%d", corsConfig.MaxAge),
 		AllowCredentials: boolValue(corsConfig.AllowCredentials),
 		EnabledSpecifier: &envoyroute.CorsPolicy_Enabled{
-                        Enabled:          boolValue(true),
-                },
+			Enabled: boolValue(true),
+		},
 	}
 }
 
@@ -312,12 +312,15 @@ func mkEnvoyRoutes(
 //   - modifying the destination protocol
 //   - using capture groups in the destination address(e.g. '$1', '$2', etc)
 //   - using nginx style variables(e.g. '$host')
+//
 // this method ensures we provide envoy with a valid route by stripping
 // capture groups and resolving nginx variables.
 func tbnRedirectToEnvoyRoutes(domain tbnapi.Domain) []*envoyroute.Route {
 	routes := []*envoyroute.Route{}
 	for _, redirect := range domain.Redirects {
-		url, err := url.Parse(redirect.To)
+		// Capture groups are dropped anyway, and url.Parse rejects them
+		// when they trail a port.
+		url, err := url.Parse(scrubCaptureGroups(redirect.To))
 		if err != nil {
 			console.Error().Printf(
 				"Invalid Redirect destination for Domain[%s:%d], Redirect[%s]",
@@ -351,9 +354,9 @@ func tbnRedirectToEnvoyRoutes(domain tbnapi.Domain) []*envoyroute.Route {
 			ResponseCode: responseCode,
 		}
 		if url.Scheme == "https" {
-			redirectAction.SchemeRewriteSpecifier =  &envoyroute.RedirectAction_HttpsRedirect{
-                                HttpsRedirect: true,
-                        }
+			redirectAction.SchemeRewriteSpecifier = &envoyroute.RedirectAction_HttpsRedirect{
+				HttpsRedirect: true,
+			}
 		}
 
 		pathRewrite := scrubCaptureGroups(path)
@@ -472,31 +475,31 @@ func tbnToEnvoyRoutes(
 				},
 			}
 
-                        requestHeadersToAdd := []*envoycore.HeaderValueOption{
-                                                 {
-                                                         Header: &envoycore.HeaderValue{
-                                                                 Key:   headerRouteKey,
-                                                                 Value: valueOrDefault(string(routeConfig.Route.RouteKey)),
-                                                         },
-                                                         Append: boolValue(false),
-                                                 },
-                                                 {
-                                                         Header: &envoycore.HeaderValue{
-                                                                 Key:   headerRuleKey,
-                                                                 Value: valueOrDefault(string(rv.RuleKey)),
-                                                         },
-                                                         Append: boolValue(false),
-                                                 },
-                                                 {
-                                                         Header: &envoycore.HeaderValue{
-                                                                 Key:   headerSharedRulesKey,
-                                                                 Value: valueOrDefault(rv.SharedRulesName),
-                                                         },
-                                                         Append: boolValue(false),
-                                                 },
-                                         }
-
-			routes = append(routes, &envoyroute.Route{Match: &match, Action: action,RequestHeadersToAdd: requestHeadersToAdd})
+			requestHeadersToAdd := []*envoycore.HeaderValueOption{
+				{
+					Header: &envoycore.HeaderValue{
+						Key:   headerRouteKey,
+						Value: valueOrDefault(string(routeConfig.Route.RouteKey)),
+					},
+					Append: boolValue(false),
+				},
+				{
+					Header: &envoycore.HeaderValue{
+						Key:   headerRuleKey,
+						Value: valueOrDefault(string(rv.RuleKey)),
+					},
+					Append: boolValue(false),
+				},
+				{
+					Header: &envoycore.HeaderValue{
+						Key:   headerSharedRulesKey,
+						Value: valueOrDefault(rv.SharedRulesName),
+					},
+					Append: boolValue(false),
+				},
+			}
+
+			routes = append(routes, &envoyroute.Route{Match: &match, Action: action, RequestHeadersToAdd: requestHeadersToAdd})
 		}
 	}
 
@@ -691,7 +694,7 @@ func mkEnvoyHeaderMatchers(matches []requestMatch, methods []string) []*envoyrou
 			headerMatcher := &envoyroute.HeaderMatcher{
 				Name: cookieHeaderName,
 				HeaderMatchSpecifier: &envoyroute.HeaderMatcher_RegexMatch{
-					fmt.Sprintf(
+					RegexMatch: fmt.Sprintf(
 						wildcardCookieMatchTemplate,
 						regexp.QuoteMeta(hmm.metadatum.Key),
 					),
@@ -223,7 +223,7 @@ func TestAllPortsRequest(t *testing.T) {
 	expected := []envoyapi.RouteConfiguration{
 		{
 			Name: "main-test-proxy:8443",
-			VirtualHosts: []envoyroute.VirtualHost{
+			VirtualHosts: []*envoyroute.VirtualHost{
 				{
 					Name: "foo.example.com-8443",
 					Domains: []string{
@@ -244,9 +244,9 @@ func TestAllPortsRequest(t *testing.T) {
 							Append: boolValue(false),
 						},
 					},
-					Routes: []envoyroute.Route{
+					Routes: []*envoyroute.Route{
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "(.*)",
 								},
@@ -262,13 +262,13 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 							Action: &envoyroute.Route_Redirect{
 								Redirect: &envoyroute.RedirectAction{
-									HostRedirect:  "foo.example.com",
-									HttpsRedirect: true,
+									HostRedirect:           "foo.example.com",
+									SchemeRewriteSpecifier: &envoyroute.RedirectAction_HttpsRedirect{HttpsRedirect: true},
 								},
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: ".*/redirect",
 								},
@@ -276,13 +276,13 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 							Action: &envoyroute.Route_Redirect{
 								Redirect: &envoyroute.RedirectAction{
-									HostRedirect:  "duckduckgo.com",
-									HttpsRedirect: true,
+									HostRedirect:           "duckduckgo.com",
+									SchemeRewriteSpecifier: &envoyroute.RedirectAction_HttpsRedirect{HttpsRedirect: true},
 								},
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "/docs/versions/1.0/guides/tbnctl-guide",
 								},
@@ -299,7 +299,7 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "/api-explorer(.*)",
 								},
@@ -316,7 +316,7 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "(.*)",
 								},
@@ -332,13 +332,13 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 							Action: &envoyroute.Route_Redirect{
 								Redirect: &envoyroute.RedirectAction{
-									HostRedirect:  "www.turbinelabs.io",
-									HttpsRedirect: true,
+									HostRedirect:           "www.turbinelabs.io",
+									SchemeRewriteSpecifier: &envoyroute.RedirectAction_HttpsRedirect{HttpsRedirect: true},
 								},
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "/docs/versions/1.0(.*)",
 								},
@@ -355,7 +355,7 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foo/bar",
 								},
@@ -415,30 +415,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(100),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "R1R0",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -446,9 +424,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "R1R0",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foo/bar",
 								},
@@ -508,30 +509,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(1),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "R1R0",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -539,9 +518,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "R1R0",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foo/bar",
 								},
@@ -600,30 +602,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(100),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "R1R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -631,9 +611,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "R1R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foo/bar",
 								},
@@ -693,30 +696,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(100),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "R1R2",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -724,9 +705,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "R1R2",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foo/bar",
 								},
@@ -800,30 +804,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(102),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R1",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "SRK-1",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -831,9 +813,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R1",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "SRK-1",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/",
 								},
@@ -871,30 +876,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(1),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R0",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "SRK-0",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(34 * time.Millisecond),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(12),
@@ -902,6 +885,29 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R0",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "SRK-0",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 					},
 					Cors: &envoyroute.CorsPolicy{
@@ -911,14 +917,14 @@ func TestAllPortsRequest(t *testing.T) {
 						ExposeHeaders:    "foo,bar-baz",
 						MaxAge:           "60",
 						AllowCredentials: boolValue(true),
-						Enabled:          boolValue(true),
+						EnabledSpecifier: &envoyroute.CorsPolicy_Enabled{Enabled: boolValue(true)},
 					},
 				},
 			},
 		},
 		{
 			Name: "main-test-proxy:8080",
-			VirtualHosts: []envoyroute.VirtualHost{
+			VirtualHosts: []*envoyroute.VirtualHost{
 				{
 					Name:    "bar.example.com-8080",
 					Domains: []string{"bar.example.com", "bar.example.com:8080"},
@@ -931,9 +937,9 @@ func TestAllPortsRequest(t *testing.T) {
 							Append: boolValue(false),
 						},
 					},
-					Routes: []envoyroute.Route{
+					Routes: []*envoyroute.Route{
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foos/bars",
 								},
@@ -1003,30 +1009,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(100),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R2",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "R2R0",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -1034,9 +1018,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R2",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "R2R0",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foos/bars",
 								},
@@ -1159,30 +1166,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(83),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R2",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "SRK2-R2R0",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "SRK-2",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -1190,9 +1175,32 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R2",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "SRK2-R2R0",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "SRK-2",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/foos/bars",
 								},
@@ -1284,30 +1292,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(101),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R2",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "SRK-2",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(rdsTestDefaultTimeout),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(rdsDefaultNumRetries),
@@ -1315,6 +1301,29 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(rdsTestDefaultTimeout),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R2",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "SRK-2",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 					},
 				},
@@ -1331,9 +1340,9 @@ func TestAllPortsRequest(t *testing.T) {
 							Append: boolValue(false),
 						},
 					},
-					Routes: []envoyroute.Route{
+					Routes: []*envoyroute.Route{
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Regex{
 									Regex: "(.*)",
 								},
@@ -1354,7 +1363,7 @@ func TestAllPortsRequest(t *testing.T) {
 							},
 						},
 						{
-							Match: envoyroute.RouteMatch{
+							Match: &envoyroute.RouteMatch{
 								PathSpecifier: &envoyroute.RouteMatch_Prefix{
 									Prefix: "/",
 								},
@@ -1392,30 +1401,8 @@ func TestAllPortsRequest(t *testing.T) {
 											TotalWeight: uint32Value(1),
 										},
 									},
-									RequestHeadersToAdd: []*envoycore.HeaderValueOption{
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRouteKey,
-												Value: "R3",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerRuleKey,
-												Value: "DEFAULT",
-											},
-											Append: boolValue(false),
-										},
-										{
-											Header: &envoycore.HeaderValue{
-												Key:   headerSharedRulesKey,
-												Value: "SRK-0",
-											},
-											Append: boolValue(false),
-										},
-									},
-									RetryPolicy: &envoyroute.RouteAction_RetryPolicy{
+
+									RetryPolicy: &envoyroute.RetryPolicy{
 										PerTryTimeout: ptr.Duration(500 * time.Millisecond),
 										RetryOn:       rdsRetryOn,
 										NumRetries:    uint32Value(5),
@@ -1423,6 +1410,29 @@ func TestAllPortsRequest(t *testing.T) {
 									Timeout: ptr.Duration(1 * time.Second),
 								},
 							},
+							RequestHeadersToAdd: []*envoycore.HeaderValueOption{
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRouteKey,
+										Value: "R3",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerRuleKey,
+										Value: "DEFAULT",
+									},
+									Append: boolValue(false),
+								},
+								{
+									Header: &envoycore.HeaderValue{
+										Key:   headerSharedRulesKey,
+										Value: "SRK-0",
+									},
+									Append: boolValue(false),
+								},
+							},
 						},
 					},
 				},
@@ -57,7 +57,7 @@ func TestEnvoyToTbnRoundTrip(t *testing.T) {
 		}
 	}
 
-	clusterAdapter := newClusterAdapter("")
+	clusterAdapter := newClusterAdapter("", false, false)
 	envoyResources, err := clusterAdapter.adapt(objects)
 	assert.NonNil(t, envoyResources.Items)
 	assert.Nil(t, err)
@@ -141,14 +141,14 @@ func mkTestEndpointService(objects *poller.Objects) endpointService {
 		}
 
 		typeURL := ""
-		resources := make([]types.Any, len(found))
+		resources := make([]*types.Any, len(found))
 		for idx, cla := range found {
 			any, err := types.MarshalAny(cla)
 			if err != nil {
 				return nil, err
 			}
 
-			resources[idx] = *any
+			resources[idx] = any
 			typeURL = any.GetTypeUrl()
 		}
 		resp := &envoyapi.DiscoveryResponse{
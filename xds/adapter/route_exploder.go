@@ -186,10 +186,10 @@ func (e routeExploder) findMatchingMetadata(
 }
 
 // processMatches produces a struct containing:
-//   1. the necessary header matches (wildcard matches have an empty Value)
-//   2. the derived cluster constraints (wildcard matches have an empty Value)
-//   3. a key mapping from match keys to derived constraint keys
-//   4. response data for the rule
+//  1. the necessary header matches (wildcard matches have an empty Value)
+//  2. the derived cluster constraints (wildcard matches have an empty Value)
+//  3. a key mapping from match keys to derived constraint keys
+//  4. response data for the rule
 func processMatches(
 	rule tbnapi.Rule,
 	ruleToStr func(tbnapi.Rule) string,
@@ -696,7 +696,7 @@ func TestSatisfiedMatchesTreeSlice(t *testing.T) {
 			{Key: "CM2K", Value: "CM2V"},
 		},
 		responseData: tbnapi.ResponseData{
-			Headers: []tbnapi.HeaderDatum{{tbnapi.ResponseDatum{Name: "bob", Value: "newhart"}}},
+			Headers: []tbnapi.HeaderDatum{{ResponseDatum: tbnapi.ResponseDatum{Name: "bob", Value: "newhart"}}},
 		},
 	}
 
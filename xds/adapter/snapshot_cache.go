@@ -62,9 +62,11 @@ func (consoleLogger) Errorf(format string, args ...interface{}) {
 	console.Error().Printf(format, args...)
 }
 
-// newSnapshotCache returns a configured cache.SnapshotCache
-func newSnapshotCache() cache.SnapshotCache {
-	return cache.NewSnapshotCache(false, tbnProxyNodeHash{}, consoleLogger{})
+// newSnapshotCache returns a configured cache.SnapshotCache. If ads is true,
+// responses are held until all resources of a type are requested, so that
+// Envoys using the aggregated discovery service receive consistent updates.
+func newSnapshotCache(ads bool) cache.SnapshotCache {
+	return cache.NewSnapshotCache(ads, tbnProxyNodeHash{}, consoleLogger{})
 }
 
 func proxyRefFromNode(node *core.Node) service.ProxyRef {
@@ -450,5 +450,5 @@ func TestResFromFileString(t *testing.T) {
 		ClusterTemplate: &v2.Cluster{Name: "the-cluster"},
 		Listeners:       []*v2.Listener{},
 	}
-	assert.Equal(t, rff.String(), `cluster_template:<name:"the-cluster" connect_timeout:<> > `)
+	assert.Equal(t, rff.String(), `cluster_template:<name:"the-cluster" > `)
 }
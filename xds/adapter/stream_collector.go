@@ -0,0 +1,601 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/grpc/codes"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/executor"
+	"github.com/turbinelabs/nonstdlib/log/console"
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/rotor/pkg/backoff"
+	"github.com/turbinelabs/rotor/xds/collector"
+)
+
+const (
+	streamInitialBackoff = 500 * time.Millisecond
+	streamMaxBackoff     = 30 * time.Second
+)
+
+// xdsStream is the subset of a bidirectional xDS gRPC stream used by the
+// streaming collector.
+type xdsStream interface {
+	Send(*envoyapi.DiscoveryRequest) error
+	Recv() (*envoyapi.DiscoveryResponse, error)
+}
+
+// streamOpener opens a new xdsStream, bound to the given context.
+type streamOpener func(context.Context) (xdsStream, error)
+
+// NewStreamingClusterCollector produces a StreamingClusterCollector which
+// connects to an xDS server on the given addr and subscribes to clusters for
+// the given zone name. If ads is true, clusters and endpoints are received
+// over a single Aggregated Discovery Service stream; otherwise separate CDS and
+// EDS streams are opened. In either case, ClusterLoadAssignments for EDS
+// clusters are requested from the server at addr, regardless of the
+// EdsClusterConfig of the cluster.
+func NewStreamingClusterCollector(
+	addr, zoneName string,
+	ads bool,
+) (collector.StreamingClusterCollector, error) {
+	conn, err := mkConnection(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var open streamOpener
+	if ads {
+		client := discovery.NewAggregatedDiscoveryServiceClient(conn)
+		open = func(ctx context.Context) (xdsStream, error) {
+			return client.StreamAggregatedResources(ctx)
+		}
+	} else {
+		cds := envoyapi.NewClusterDiscoveryServiceClient(conn)
+		eds := envoyapi.NewEndpointDiscoveryServiceClient(conn)
+		open = func(ctx context.Context) (xdsStream, error) {
+			cs, err := cds.StreamClusters(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			es, err := eds.StreamEndpoints(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return newSplitStream(ctx, cs, es), nil
+		}
+	}
+
+	sc := newStreamCollector(addr, zoneName, open)
+	sc.closeFn = conn.Close
+
+	return sc, nil
+}
+
+func newStreamCollector(addr, zoneName string, open streamOpener) *streamCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &streamCollector{
+		addr: addr,
+		node: &envoycore.Node{
+			Locality: &envoycore.Locality{Zone: zoneName},
+		},
+		open:    open,
+		backoff: executor.NewExponentialDelayFunc(streamInitialBackoff, streamMaxBackoff),
+		time:    tbntime.NewSource(),
+		ctx:     ctx,
+		cancel:  cancel,
+		closeFn: func() error { return nil },
+
+		clusters:    map[string]*envoyapi.Cluster{},
+		assignments: map[string]*envoyapi.ClusterLoadAssignment{},
+		converted:   map[string]convertedCluster{},
+		versions:    map[string]string{},
+	}
+}
+
+// convertedCluster caches the conversion of a single envoy cluster, so that
+// only clusters affected by a pushed update are converted again.
+type convertedCluster struct {
+	cluster *api.Cluster
+	errs    []error
+}
+
+type streamCollector struct {
+	addr    string
+	node    *envoycore.Node
+	open    streamOpener
+	backoff executor.DelayFunc
+	time    tbntime.Source
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeFn   func() error
+	closeOnce sync.Once
+	closeErr  error
+
+	// state accepted from the server, retained across reconnects
+	clusters    map[string]*envoyapi.Cluster
+	assignments map[string]*envoyapi.ClusterLoadAssignment
+	converted   map[string]convertedCluster
+	versions    map[string]string
+	edsNames    []string
+
+	// per-stream state
+	nonces map[string]string
+}
+
+var _ collector.StreamingClusterCollector = &streamCollector{}
+
+func (c *streamCollector) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		c.closeErr = c.closeFn()
+	})
+	return c.closeErr
+}
+
+func (c *streamCollector) Run(publish func(api.Clusters, map[string][]error)) error {
+	attempt := 0
+	for {
+		received, err := c.runStream(publish)
+		if c.ctx.Err() != nil {
+			return nil
+		}
+
+		if received {
+			attempt = 0
+		}
+		attempt++
+
+		delay := backoff.Jitter(c.backoff(attempt))
+		console.Error().Printf(
+			"xDS stream to %s failed: %s; reconnecting in %s",
+			c.addr,
+			err,
+			delay,
+		)
+
+		timer := c.time.NewTimer(delay)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// runStream opens a stream and processes responses until the stream fails.
+// The returned bool indicates whether any response was received.
+func (c *streamCollector) runStream(
+	publish func(api.Clusters, map[string][]error),
+) (bool, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	stream, err := c.open(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	c.nonces = map[string]string{}
+
+	if err := stream.Send(c.request(cache.ClusterType, nil)); err != nil {
+		return false, err
+	}
+
+	if len(c.edsNames) > 0 {
+		if err := stream.Send(c.request(cache.EndpointType, nil)); err != nil {
+			return false, err
+		}
+	}
+
+	received := false
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+
+		reqs, changed := c.handle(res)
+		for _, req := range reqs {
+			if err := stream.Send(req); err != nil {
+				return received, err
+			}
+		}
+
+		if changed {
+			publish(c.collect())
+		}
+	}
+}
+
+// request produces a DiscoveryRequest for the given type URL, carrying the
+// last accepted version and nonce. A non-nil err produces a NACK.
+func (c *streamCollector) request(typeURL string, err error) *envoyapi.DiscoveryRequest {
+	req := &envoyapi.DiscoveryRequest{
+		VersionInfo:   c.versions[typeURL],
+		Node:          c.node,
+		TypeUrl:       typeURL,
+		ResponseNonce: c.nonces[typeURL],
+	}
+
+	if typeURL == cache.EndpointType {
+		req.ResourceNames = c.edsNames
+	}
+
+	if err != nil {
+		req.ErrorDetail = &rpc.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: err.Error(),
+		}
+	}
+
+	return req
+}
+
+// handle applies a DiscoveryResponse to the collector state. It returns the
+// requests to send in reply (an ACK or NACK, followed by an updated EDS
+// subscription if needed) and whether the set of clusters may have changed
+// and should be published.
+func (c *streamCollector) handle(
+	res *envoyapi.DiscoveryResponse,
+) ([]*envoyapi.DiscoveryRequest, bool) {
+	typeURL := res.GetTypeUrl()
+	c.nonces[typeURL] = res.GetNonce()
+
+	switch typeURL {
+	case cache.ClusterType:
+		clusters, err := unmarshalClusters(res)
+		if err != nil {
+			console.Error().Printf(
+				"xDS: rejecting CDS version %s: %s",
+				res.GetVersionInfo(),
+				err,
+			)
+			return []*envoyapi.DiscoveryRequest{c.request(typeURL, err)}, false
+		}
+
+		c.versions[typeURL] = res.GetVersionInfo()
+		c.applyClusters(clusters)
+		reqs := []*envoyapi.DiscoveryRequest{c.request(typeURL, nil)}
+
+		// An EDS request without resource names is a wildcard subscription,
+		// so when no EDS clusters remain the stale subscription is left in
+		// place and its responses ignored.
+		added, changed := c.updateEDSNames()
+		if changed && len(c.edsNames) > 0 {
+			reqs = append(reqs, c.request(cache.EndpointType, nil))
+		}
+
+		// If new EDS clusters were added, wait for their assignments before
+		// publishing.
+		return reqs, !added
+
+	case cache.EndpointType:
+		if len(c.edsNames) == 0 {
+			// Neither ACK nor NACK: either would subscribe to all
+			// assignments.
+			return nil, false
+		}
+
+		assignments, err := unmarshalAssignments(res)
+		if err != nil {
+			console.Error().Printf(
+				"xDS: rejecting EDS version %s: %s",
+				res.GetVersionInfo(),
+				err,
+			)
+			return []*envoyapi.DiscoveryRequest{c.request(typeURL, err)}, false
+		}
+
+		c.versions[typeURL] = res.GetVersionInfo()
+		c.applyAssignments(assignments)
+		return []*envoyapi.DiscoveryRequest{c.request(typeURL, nil)}, true
+
+	default:
+		err := fmt.Errorf("unexpected type URL %q", typeURL)
+		console.Error().Printf("xDS: rejecting response: %s", err)
+		return []*envoyapi.DiscoveryRequest{c.request(typeURL, err)}, false
+	}
+}
+
+func unmarshalClusters(res *envoyapi.DiscoveryResponse) (map[string]*envoyapi.Cluster, error) {
+	clusters := make(map[string]*envoyapi.Cluster, len(res.GetResources()))
+	for _, any := range res.GetResources() {
+		c := &envoyapi.Cluster{}
+		if err := types.UnmarshalAny(any, c); err != nil {
+			return nil, err
+		}
+
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+
+		if _, exists := clusters[c.GetName()]; exists {
+			return nil, fmt.Errorf("duplicate cluster %s", c.GetName())
+		}
+
+		clusters[c.GetName()] = c
+	}
+
+	return clusters, nil
+}
+
+func unmarshalAssignments(
+	res *envoyapi.DiscoveryResponse,
+) ([]*envoyapi.ClusterLoadAssignment, error) {
+	assignments := make([]*envoyapi.ClusterLoadAssignment, 0, len(res.GetResources()))
+	for _, any := range res.GetResources() {
+		cla := &envoyapi.ClusterLoadAssignment{}
+		if err := types.UnmarshalAny(any, cla); err != nil {
+			return nil, err
+		}
+
+		if err := cla.Validate(); err != nil {
+			return nil, err
+		}
+
+		assignments = append(assignments, cla)
+	}
+
+	return assignments, nil
+}
+
+// applyClusters replaces the accepted clusters, discarding cached conversions
+// of clusters that were changed or removed.
+func (c *streamCollector) applyClusters(clusters map[string]*envoyapi.Cluster) {
+	for name, existing := range c.clusters {
+		if updated, ok := clusters[name]; !ok || !proto.Equal(existing, updated) {
+			delete(c.converted, name)
+		}
+	}
+
+	c.clusters = clusters
+}
+
+// applyAssignments records the given ClusterLoadAssignments that are still
+// required, discarding cached conversions of the clusters that use them.
+func (c *streamCollector) applyAssignments(assignments []*envoyapi.ClusterLoadAssignment) {
+	required := make(map[string]bool, len(c.edsNames))
+	for _, name := range c.edsNames {
+		required[name] = true
+	}
+
+	updated := map[string]bool{}
+	for _, cla := range assignments {
+		name := cla.GetClusterName()
+		if !required[name] {
+			continue
+		}
+
+		if existing, ok := c.assignments[name]; ok && proto.Equal(existing, cla) {
+			continue
+		}
+
+		c.assignments[name] = cla
+		updated[name] = true
+	}
+
+	for name, cluster := range c.clusters {
+		if updated[edsServiceName(cluster)] {
+			delete(c.converted, name)
+		}
+	}
+}
+
+// updateEDSNames recomputes the EDS resource names required by the accepted
+// clusters and discards assignments that are no longer required. It reports
+// whether any names were added and whether the set changed.
+func (c *streamCollector) updateEDSNames() (bool, bool) {
+	required := map[string]bool{}
+	for _, cluster := range c.clusters {
+		if cluster.GetType() == envoyapi.Cluster_EDS {
+			required[edsServiceName(cluster)] = true
+		}
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for name := range c.assignments {
+		if !required[name] {
+			delete(c.assignments, name)
+		}
+	}
+
+	previous := make(map[string]bool, len(c.edsNames))
+	for _, name := range c.edsNames {
+		previous[name] = true
+	}
+
+	added := false
+	for _, name := range names {
+		if !previous[name] {
+			added = true
+			break
+		}
+	}
+
+	changed := added || len(names) != len(c.edsNames)
+	c.edsNames = names
+
+	return added, changed
+}
+
+func edsServiceName(c *envoyapi.Cluster) string {
+	if name := c.GetEdsClusterConfig().GetServiceName(); name != "" {
+		return name
+	}
+	return c.GetName()
+}
+
+// collect produces the current set of tbn clusters, ordered by name, and any
+// errors encountered converting them.
+func (c *streamCollector) collect() (api.Clusters, map[string][]error) {
+	names := make([]string, 0, len(c.clusters))
+	for name := range c.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tbnClusters := api.Clusters{}
+	errorsMap := map[string][]error{}
+	for _, name := range names {
+		cc, ok := c.converted[name]
+		if !ok {
+			cc = c.convert(c.clusters[name])
+			c.converted[name] = cc
+		}
+
+		if len(cc.errs) > 0 {
+			errorsMap[name] = cc.errs
+		}
+
+		if cc.cluster != nil {
+			tbnClusters = append(tbnClusters, *cc.cluster)
+		}
+	}
+
+	return tbnClusters, errorsMap
+}
+
+func (c *streamCollector) convert(ec *envoyapi.Cluster) convertedCluster {
+	switch ec.GetType() {
+	case envoyapi.Cluster_STATIC, envoyapi.Cluster_STRICT_DNS, envoyapi.Cluster_LOGICAL_DNS:
+		cluster, errs := mkStaticCluster(ec)
+		return convertedCluster{cluster, errs}
+
+	case envoyapi.Cluster_EDS:
+		serviceName := edsServiceName(ec)
+		cla, ok := c.assignments[serviceName]
+		if !ok {
+			return convertedCluster{
+				errs: []error{
+					fmt.Errorf("No ClusterLoadAssignment received for %s", serviceName),
+				},
+			}
+		}
+
+		is, errs := envoyEndpointsToTbnInstances(cla.GetEndpoints())
+		return convertedCluster{
+			cluster: &api.Cluster{
+				Name:             ec.GetName(),
+				RequireTLS:       ec.GetTlsContext() != nil,
+				Instances:        is,
+				CircuitBreakers:  envoyToTbnCircuitBreakers(ec.GetCircuitBreakers()),
+				OutlierDetection: envoyToTbnOutlierDetection(ec.GetOutlierDetection()),
+				HealthChecks:     envoyToTbnHealthChecks(ec.GetHealthChecks()),
+			},
+			errs: errs,
+		}
+
+	default:
+		return convertedCluster{
+			errs: []error{
+				fmt.Errorf("Unknown Cluster_DiscoveryType: %s", ec.GetType().String()),
+			},
+		}
+	}
+}
+
+type streamResult struct {
+	res *envoyapi.DiscoveryResponse
+	err error
+}
+
+// splitStream multiplexes separate CDS and EDS streams as a single xdsStream.
+type splitStream struct {
+	ctx     context.Context
+	cds     xdsStream
+	eds     xdsStream
+	results chan streamResult
+}
+
+func newSplitStream(ctx context.Context, cds, eds xdsStream) xdsStream {
+	s := &splitStream{
+		ctx:     ctx,
+		cds:     cds,
+		eds:     eds,
+		results: make(chan streamResult),
+	}
+
+	go s.recvLoop(ctx, cds, cache.ClusterType)
+	go s.recvLoop(ctx, eds, cache.EndpointType)
+
+	return s
+}
+
+func (s *splitStream) recvLoop(ctx context.Context, stream xdsStream, typeURL string) {
+	for {
+		res, err := stream.Recv()
+		if err == nil && res.GetTypeUrl() == "" {
+			res.TypeUrl = typeURL
+		}
+
+		select {
+		case s.results <- streamResult{res, err}:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *splitStream) Send(req *envoyapi.DiscoveryRequest) error {
+	switch req.GetTypeUrl() {
+	case cache.ClusterType:
+		return s.cds.Send(req)
+	case cache.EndpointType:
+		return s.eds.Send(req)
+	default:
+		return errors.New("unsupported type URL: " + req.GetTypeUrl())
+	}
+}
+
+func (s *splitStream) Recv() (*envoyapi.DiscoveryResponse, error) {
+	select {
+	case r := <-s.results:
+		return r.res, r.err
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoyendpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/executor"
+	"github.com/turbinelabs/test/assert"
+)
+
+type fakeStream struct {
+	ctx       context.Context
+	mutex     sync.Mutex
+	sent      []*envoyapi.DiscoveryRequest
+	responses chan streamResult
+}
+
+func newFakeStream(ctx context.Context) *fakeStream {
+	return &fakeStream{ctx: ctx, responses: make(chan streamResult, 10)}
+}
+
+func (s *fakeStream) Send(req *envoyapi.DiscoveryRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sent = append(s.sent, req)
+	return nil
+}
+
+func (s *fakeStream) Recv() (*envoyapi.DiscoveryResponse, error) {
+	select {
+	case r := <-s.responses:
+		return r.res, r.err
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *fakeStream) requests() []*envoyapi.DiscoveryRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*envoyapi.DiscoveryRequest{}, s.sent...)
+}
+
+func mkResponse(
+	t *testing.T,
+	typeURL, version, nonce string,
+	msgs ...proto.Message,
+) *envoyapi.DiscoveryResponse {
+	res := &envoyapi.DiscoveryResponse{
+		VersionInfo: version,
+		TypeUrl:     typeURL,
+		Nonce:       nonce,
+	}
+	for _, msg := range msgs {
+		any, err := types.MarshalAny(msg)
+		assert.Nil(t, err)
+		res.Resources = append(res.Resources, any)
+	}
+	return res
+}
+
+func mkStreamStaticCluster(name string, port uint32) *envoyapi.Cluster {
+	return &envoyapi.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_STATIC},
+		Hosts: []*envoycore.Address{
+			{
+				Address: &envoycore.Address_SocketAddress{
+					SocketAddress: &envoycore.SocketAddress{
+						Address:       "127.0.0.1",
+						PortSpecifier: &envoycore.SocketAddress_PortValue{PortValue: port},
+					},
+				},
+			},
+		},
+	}
+}
+
+func mkStreamEDSCluster(name, serviceName string) *envoyapi.Cluster {
+	return &envoyapi.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &envoyapi.Cluster_Type{Type: envoyapi.Cluster_EDS},
+		EdsClusterConfig: &envoyapi.Cluster_EdsClusterConfig{
+			EdsConfig: &envoycore.ConfigSource{
+				ConfigSourceSpecifier: &envoycore.ConfigSource_Ads{
+					Ads: &envoycore.AggregatedConfigSource{},
+				},
+			},
+			ServiceName: serviceName,
+		},
+	}
+}
+
+func mkStreamAssignment(name string, ports ...uint32) *envoyapi.ClusterLoadAssignment {
+	lbEndpoints := []*envoyendpoint.LbEndpoint{}
+	for _, port := range ports {
+		lbEndpoints = append(lbEndpoints, &envoyendpoint.LbEndpoint{
+			HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
+				Endpoint: &envoyendpoint.Endpoint{
+					Address: &envoycore.Address{
+						Address: &envoycore.Address_SocketAddress{
+							SocketAddress: &envoycore.SocketAddress{
+								Address:       "10.0.0.1",
+								PortSpecifier: &envoycore.SocketAddress_PortValue{PortValue: port},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return &envoyapi.ClusterLoadAssignment{
+		ClusterName: name,
+		Endpoints:   []*envoyendpoint.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+	}
+}
+
+func TestStreamCollectorHandleStaticClusters(t *testing.T) {
+	c := newStreamCollector("addr", "zone", nil)
+	c.nonces = map[string]string{}
+
+	reqs, changed := c.handle(
+		mkResponse(t, cache.ClusterType, "v1", "n1", mkStreamStaticCluster("c1", 8080)),
+	)
+	assert.True(t, changed)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].GetTypeUrl(), cache.ClusterType)
+	assert.Equal(t, reqs[0].GetVersionInfo(), "v1")
+	assert.Equal(t, reqs[0].GetResponseNonce(), "n1")
+	assert.Equal(t, reqs[0].GetNode().GetLocality().GetZone(), "zone")
+	assert.Nil(t, reqs[0].GetErrorDetail())
+
+	clusters, errs := c.collect()
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, len(clusters), 1)
+	assert.Equal(t, clusters[0].Name, "c1")
+	assert.ArrayEqual(t, clusters[0].Instances, api.Instances{{Host: "127.0.0.1", Port: 8080, Metadata: api.Metadata{}}})
+}
+
+func TestStreamCollectorHandleEDSClusters(t *testing.T) {
+	c := newStreamCollector("addr", "zone", nil)
+	c.nonces = map[string]string{}
+
+	reqs, changed := c.handle(
+		mkResponse(
+			t,
+			cache.ClusterType,
+			"v1",
+			"n1",
+			mkStreamEDSCluster("c1", ""),
+			mkStreamEDSCluster("c2", "svc2"),
+		),
+	)
+	assert.False(t, changed)
+	assert.Equal(t, len(reqs), 2)
+	assert.Equal(t, reqs[0].GetTypeUrl(), cache.ClusterType)
+	assert.Equal(t, reqs[1].GetTypeUrl(), cache.EndpointType)
+	assert.ArrayEqual(t, reqs[1].GetResourceNames(), []string{"c1", "svc2"})
+
+	clusters, errs := c.collect()
+	assert.Equal(t, len(clusters), 0)
+	assert.Equal(t, len(errs), 2)
+	assert.ErrorContains(t, errs["c2"][0], "No ClusterLoadAssignment received for svc2")
+
+	reqs, changed = c.handle(
+		mkResponse(
+			t,
+			cache.EndpointType,
+			"e1",
+			"n2",
+			mkStreamAssignment("c1", 1, 2),
+			mkStreamAssignment("svc2", 3),
+		),
+	)
+	assert.True(t, changed)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].GetTypeUrl(), cache.EndpointType)
+	assert.Equal(t, reqs[0].GetVersionInfo(), "e1")
+	assert.Equal(t, reqs[0].GetResponseNonce(), "n2")
+	assert.ArrayEqual(t, reqs[0].GetResourceNames(), []string{"c1", "svc2"})
+
+	clusters, errs = c.collect()
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, len(clusters), 2)
+	assert.Equal(t, clusters[0].Name, "c1")
+	assert.Equal(t, len(clusters[0].Instances), 2)
+	assert.Equal(t, clusters[1].Name, "c2")
+	assert.ArrayEqual(t, clusters[1].Instances, api.Instances{{Host: "10.0.0.1", Port: 3, Metadata: api.Metadata{}}})
+
+	// removing c1 shrinks the subscription without waiting for EDS
+	reqs, changed = c.handle(
+		mkResponse(t, cache.ClusterType, "v2", "n3", mkStreamEDSCluster("c2", "svc2")),
+	)
+	assert.True(t, changed)
+	assert.Equal(t, len(reqs), 2)
+	assert.ArrayEqual(t, reqs[1].GetResourceNames(), []string{"svc2"})
+	assert.Equal(t, len(c.assignments), 1)
+
+	clusters, errs = c.collect()
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, len(clusters), 1)
+	assert.Equal(t, clusters[0].Name, "c2")
+}
+
+func TestStreamCollectorHandleNoEDSClusters(t *testing.T) {
+	c := newStreamCollector("addr", "zone", nil)
+	c.nonces = map[string]string{}
+
+	c.handle(mkResponse(t, cache.ClusterType, "v1", "n1", mkStreamEDSCluster("c1", "")))
+	c.handle(mkResponse(t, cache.EndpointType, "e1", "n2", mkStreamAssignment("c1", 1)))
+
+	// dropping the last EDS cluster must not send an EDS request without
+	// resource names, which would subscribe to every assignment
+	reqs, changed := c.handle(
+		mkResponse(t, cache.ClusterType, "v2", "n3", mkStreamStaticCluster("c2", 2)),
+	)
+	assert.True(t, changed)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].GetTypeUrl(), cache.ClusterType)
+	assert.Equal(t, len(c.assignments), 0)
+
+	// late responses to the stale subscription are neither applied nor
+	// acknowledged
+	reqs, changed = c.handle(
+		mkResponse(t, cache.EndpointType, "e2", "n4", mkStreamAssignment("c1", 3)),
+	)
+	assert.False(t, changed)
+	assert.Equal(t, len(reqs), 0)
+	assert.Equal(t, len(c.assignments), 0)
+
+	clusters, errs := c.collect()
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, len(clusters), 1)
+	assert.Equal(t, clusters[0].Name, "c2")
+}
+
+func TestStreamCollectorHandleNACK(t *testing.T) {
+	c := newStreamCollector("addr", "zone", nil)
+	c.nonces = map[string]string{}
+
+	_, changed := c.handle(
+		mkResponse(t, cache.ClusterType, "v1", "n1", mkStreamStaticCluster("c1", 8080)),
+	)
+	assert.True(t, changed)
+
+	reqs, changed := c.handle(
+		mkResponse(t, cache.ClusterType, "v2", "n2", &envoyapi.Cluster{}),
+	)
+	assert.False(t, changed)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].GetVersionInfo(), "v1")
+	assert.Equal(t, reqs[0].GetResponseNonce(), "n2")
+	assert.NonNil(t, reqs[0].GetErrorDetail())
+	assert.True(t, reqs[0].GetErrorDetail().GetMessage() != "")
+
+	clusters, _ := c.collect()
+	assert.Equal(t, len(clusters), 1)
+	assert.Equal(t, clusters[0].Name, "c1")
+
+	reqs, changed = c.handle(&envoyapi.DiscoveryResponse{TypeUrl: cache.RouteType, Nonce: "n3"})
+	assert.False(t, changed)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].GetResponseNonce(), "n3")
+	assert.ErrorContains(
+		t,
+		errors.New(reqs[0].GetErrorDetail().GetMessage()),
+		"unexpected type URL",
+	)
+}
+
+func TestStreamCollectorReusesConversions(t *testing.T) {
+	c := newStreamCollector("addr", "zone", nil)
+	c.nonces = map[string]string{}
+
+	c.handle(
+		mkResponse(
+			t,
+			cache.ClusterType,
+			"v1",
+			"n1",
+			mkStreamStaticCluster("c1", 1),
+			mkStreamStaticCluster("c2", 2),
+		),
+	)
+	c.collect()
+	c1 := c.converted["c1"].cluster
+	c2 := c.converted["c2"].cluster
+
+	c.handle(
+		mkResponse(
+			t,
+			cache.ClusterType,
+			"v2",
+			"n2",
+			mkStreamStaticCluster("c1", 1),
+			mkStreamStaticCluster("c2", 3),
+		),
+	)
+	clusters, _ := c.collect()
+	assert.SameInstance(t, c.converted["c1"].cluster, c1)
+	assert.NotSameInstance(t, c.converted["c2"].cluster, c2)
+	assert.Equal(t, clusters[1].Instances[0].Port, 3)
+}
+
+func TestStreamCollectorRunReconnects(t *testing.T) {
+	streams := make(chan *fakeStream, 2)
+	c := newStreamCollector(
+		"addr",
+		"zone",
+		func(ctx context.Context) (xdsStream, error) {
+			s := newFakeStream(ctx)
+			streams <- s
+			return s, nil
+		},
+	)
+	c.backoff = executor.NewConstantDelayFunc(0)
+
+	published := make(chan api.Clusters, 10)
+	done := make(chan error)
+	go func() {
+		done <- c.Run(func(cs api.Clusters, _ map[string][]error) { published <- cs })
+	}()
+
+	first := <-streams
+	first.responses <- streamResult{
+		res: mkResponse(t, cache.ClusterType, "v1", "n1", mkStreamStaticCluster("c1", 1)),
+	}
+	cs := <-published
+	assert.Equal(t, len(cs), 1)
+
+	first.responses <- streamResult{err: errors.New("boom")}
+
+	second := <-streams
+	second.responses <- streamResult{
+		res: mkResponse(
+			t,
+			cache.ClusterType,
+			"v2",
+			"n2",
+			mkStreamStaticCluster("c1", 1),
+			mkStreamStaticCluster("c2", 2),
+		),
+	}
+	cs = <-published
+	assert.Equal(t, len(cs), 2)
+
+	assert.Nil(t, c.Close())
+	assert.Nil(t, <-done)
+
+	firstReqs := first.requests()
+	assert.Equal(t, len(firstReqs), 2)
+	assert.Equal(t, firstReqs[0].GetVersionInfo(), "")
+	assert.Equal(t, firstReqs[1].GetVersionInfo(), "v1")
+
+	secondReqs := second.requests()
+	assert.Equal(t, len(secondReqs), 2)
+	assert.Equal(t, secondReqs[0].GetVersionInfo(), "v1")
+	assert.Equal(t, secondReqs[0].GetResponseNonce(), "")
+	assert.Equal(t, secondReqs[1].GetVersionInfo(), "v2")
+	assert.Equal(t, secondReqs[1].GetResponseNonce(), "n2")
+}
+
+func TestSplitStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cds := newFakeStream(ctx)
+	eds := newFakeStream(ctx)
+	s := newSplitStream(ctx, cds, eds)
+
+	assert.Nil(t, s.Send(&envoyapi.DiscoveryRequest{TypeUrl: cache.ClusterType}))
+	assert.Nil(t, s.Send(&envoyapi.DiscoveryRequest{TypeUrl: cache.EndpointType}))
+	assert.NonNil(t, s.Send(&envoyapi.DiscoveryRequest{TypeUrl: cache.RouteType}))
+	assert.Equal(t, len(cds.requests()), 1)
+	assert.Equal(t, len(eds.requests()), 1)
+
+	eds.responses <- streamResult{res: &envoyapi.DiscoveryResponse{VersionInfo: "e1"}}
+	res, err := s.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, res.GetTypeUrl(), cache.EndpointType)
+	assert.Equal(t, res.GetVersionInfo(), "e1")
+
+	cds.responses <- streamResult{err: errors.New("boom")}
+	_, err = s.Recv()
+	assert.ErrorContains(t, err, "boom")
+
+	cancel()
+	_, err = s.Recv()
+	assert.NonNil(t, err)
+}
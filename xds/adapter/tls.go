@@ -0,0 +1,405 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	accesslog "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	fsnotify "github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+const anyName = "*"
+
+// certReloader serves the certificate, key and client CAs in the given files,
+// reloading them when the files change. If a reload fails, for example
+// because only one of the certificate and key has been replaced so far, the
+// previously loaded files continue to be served.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// newCertReloader loads the given files and starts watching them for changes.
+// The clientCAFile may be empty, in which case client certificates are not
+// requested.
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		done:         make(chan struct{}),
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watch error: %s", err)
+	}
+
+	// Watch the parent directories rather than the files, so that files
+	// replaced by rename (or by swapping a symlink, as with Kubernetes
+	// secrets) are noticed.
+	for _, dir := range r.dirs() {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watch dir error: %s", err)
+		}
+	}
+
+	r.watcher = watcher
+	go r.watch()
+
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) dirs() []string {
+	seen := map[string]bool{}
+	dirs := []string{}
+	for _, file := range r.files() {
+		dir := filepath.Dir(file)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// matches returns true if the named file is one of the watched files, or the
+// data link Kubernetes swaps when updating a mounted secret.
+func (r *certReloader) matches(name string) bool {
+	name = filepath.Clean(name)
+	if filepath.Base(name) == "..data" {
+		return true
+	}
+	for _, file := range r.files() {
+		if name == filepath.Clean(file) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) watch() {
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if r.matches(event.Name) {
+				if err := r.reload(); err != nil {
+					console.Error().Printf("TLS reload error: %s", err)
+				}
+			}
+
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			console.Error().Printf("TLS watch error: %s", err)
+
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate %s and key %s: %s", r.certFile, r.keyFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	console.Info().Printf("loaded TLS certificate from %s", r.certFile)
+
+	return nil
+}
+
+// config returns a tls.Config for a single handshake, using the most
+// recently loaded files.
+func (r *certReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{*r.cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2"},
+	}
+	if r.clientCAs != nil {
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// credentials returns gRPC transport credentials that use the most recently
+// loaded files for each new connection.
+func (r *certReloader) credentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{GetConfigForClient: r.config})
+}
+
+func (r *certReloader) Close() error {
+	close(r.done)
+	return r.watcher.Close()
+}
+
+// proxyPattern matches a proxy and zone name. Either may be anyName, which
+// matches all names.
+type proxyPattern struct {
+	proxy string
+	zone  string
+}
+
+func (p proxyPattern) matches(proxy, zone string) bool {
+	return (p.proxy == anyName || p.proxy == proxy) && (p.zone == anyName || p.zone == zone)
+}
+
+func (p proxyPattern) String() string {
+	return p.proxy + "/" + p.zone
+}
+
+// clientAuthorizer maps client certificate subject alternative names to the
+// proxies and zones the client may request.
+type clientAuthorizer map[string][]proxyPattern
+
+// newClientAuthorizer parses rules of the form IDENTITY=PROXY[/ZONE], where
+// IDENTITY is a DNS, URI, email or IP subject alternative name, and PROXY and
+// ZONE may be "*" to allow any name. If ZONE is omitted, any zone is allowed.
+func newClientAuthorizer(rules []string) (clientAuthorizer, error) {
+	authz := clientAuthorizer{}
+	for _, rule := range rules {
+		idx := strings.LastIndex(rule, "=")
+		if idx <= 0 || idx == len(rule)-1 {
+			return nil, fmt.Errorf("malformed authorization %q: expected IDENTITY=PROXY[/ZONE]", rule)
+		}
+
+		identity := rule[:idx]
+		pattern := proxyPattern{proxy: rule[idx+1:], zone: anyName}
+		if parts := strings.SplitN(pattern.proxy, "/", 2); len(parts) == 2 {
+			pattern.proxy, pattern.zone = parts[0], parts[1]
+		}
+		if pattern.proxy == "" || pattern.zone == "" {
+			return nil, fmt.Errorf("malformed authorization %q: empty proxy or zone", rule)
+		}
+
+		authz[identity] = append(authz[identity], pattern)
+	}
+
+	return authz, nil
+}
+
+// identities returns the subject alternative names of the verified client
+// certificate of the given context's peer.
+func identities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	ids := []string{}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+
+	return ids
+}
+
+// authorize returns a PermissionDenied error unless the context's peer may
+// request the proxy and zone of the given node. A nil node is allowed, since
+// streams need only identify their node in the first request.
+func (a clientAuthorizer) authorize(ctx context.Context, node *envoycore.Node) error {
+	pRef := proxyRefFromNode(node)
+	if pRef == nil {
+		return nil
+	}
+
+	proxy := pRef.Name()
+	zone := pRef.ZoneRef().Name()
+
+	ids := identities(ctx)
+	for _, id := range ids {
+		for _, pattern := range a[id] {
+			if pattern.matches(proxy, zone) {
+				return nil
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return status.Errorf(
+			codes.PermissionDenied,
+			"unidentified client may not request proxy %q in zone %q",
+			proxy,
+			zone,
+		)
+	}
+
+	return status.Errorf(
+		codes.PermissionDenied,
+		"client %s may not request proxy %q in zone %q",
+		strings.Join(ids, ", "),
+		proxy,
+		zone,
+	)
+}
+
+// requestNode returns the node identified by an xDS or ALS request message,
+// if any.
+func requestNode(msg interface{}) *envoycore.Node {
+	switch m := msg.(type) {
+	case interface{ GetNode() *envoycore.Node }:
+		return m.GetNode()
+	case *accesslog.StreamAccessLogsMessage:
+		return m.GetIdentifier().GetNode()
+	}
+	return nil
+}
+
+// serverOptions returns gRPC server options that authorize each request
+// message.
+func (a clientAuthorizer) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(a.unaryInterceptor),
+		grpc.StreamInterceptor(a.streamInterceptor),
+	}
+}
+
+func (a clientAuthorizer) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := a.authorize(ctx, requestNode(req)); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a clientAuthorizer) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	s := &authorizingStream{ServerStream: stream, authorizer: a}
+	err := handler(srv, s)
+
+	// Handlers may not return the error from RecvMsg (go-control-plane's
+	// server, for instance, treats any receive error as the end of the
+	// stream), so report the authorization failure directly.
+	if denied := s.deniedErr(); denied != nil {
+		return denied
+	}
+	return err
+}
+
+// authorizingStream authorizes each message received on a grpc.ServerStream.
+type authorizingStream struct {
+	grpc.ServerStream
+	authorizer clientAuthorizer
+
+	mu     sync.Mutex
+	denied error
+}
+
+func (s *authorizingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if err := s.authorizer.authorize(s.Context(), requestNode(m)); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.denied = err
+		return err
+	}
+
+	return nil
+}
+
+func (s *authorizingStream) deniedErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.denied
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoyals "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	serial  int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial:  1,
+	}
+}
+
+// issue returns PEM-encoded certificate and key, with the given DNS and URI
+// subject alternative names.
+func (ca *testCA) issue(t *testing.T, dnsName string, uris ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		assert.Nil(t, err)
+		template.URIs = append(template.URIs, parsed)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTLSFiles writes a server certificate and key, and the CA certificate,
+// to the given directory, returning their paths.
+func writeTLSFiles(t *testing.T, dir string, ca *testCA, certPEM, keyPEM []byte) (string, string, string) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(caFile, ca.certPEM, 0600))
+	return certFile, keyFile, caFile
+}
+
+func servedCert(t *testing.T, r *certReloader) *x509.Certificate {
+	config, err := r.config(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, len(config.Certificates), 1)
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	assert.Nil(t, err)
+	return cert
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "rotor-1")
+	certFile, keyFile, caFile := writeTLSFiles(t, dir, ca, certPEM, keyPEM)
+
+	r, err := newCertReloader(certFile, keyFile, caFile)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	config, err := r.config(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, config.ClientAuth, tls.RequireAndVerifyClientCert)
+	assert.NonNil(t, config.ClientCAs)
+	assert.ArrayEqual(t, config.NextProtos, []string{"h2"})
+	assert.Equal(t, servedCert(t, r).Subject.CommonName, "rotor-1")
+
+	// A mismatched certificate and key is ignored.
+	certPEM, keyPEM = ca.issue(t, "rotor-2")
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.NonNil(t, r.reload())
+	assert.Equal(t, servedCert(t, r).Subject.CommonName, "rotor-1")
+
+	// Once both are replaced, the new certificate is served.
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCert(t, r).Subject.CommonName != "rotor-2" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCertReloaderWithoutClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "rotor")
+	certFile, keyFile, _ := writeTLSFiles(t, dir, ca, certPEM, keyPEM)
+
+	r, err := newCertReloader(certFile, keyFile, "")
+	assert.Nil(t, err)
+	defer r.Close()
+
+	config, err := r.config(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, config.ClientAuth, tls.NoClientCert)
+	assert.Nil(t, config.ClientCAs)
+}
+
+func TestCertReloaderErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "rotor")
+	certFile, keyFile, caFile := writeTLSFiles(t, dir, ca, certPEM, keyPEM)
+
+	_, err = newCertReloader(filepath.Join(dir, "missing.pem"), keyFile, caFile)
+	assert.ErrorContains(t, err, "could not load certificate")
+
+	_, err = newCertReloader(certFile, keyFile, filepath.Join(dir, "missing.pem"))
+	assert.NonNil(t, err)
+
+	_, err = newCertReloader(certFile, keyFile, keyFile)
+	assert.ErrorContains(t, err, "no certificates found")
+}
+
+func TestNewClientAuthorizer(t *testing.T) {
+	authz, err := newClientAuthorizer([]string{
+		"spiffe://mesh/web=web-proxy/us-east",
+		"spiffe://mesh/web=web-proxy/us-west",
+		"api.example.com=api-proxy",
+		"admin@example.com=*/*",
+	})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, authz, clientAuthorizer{
+		"spiffe://mesh/web": {{"web-proxy", "us-east"}, {"web-proxy", "us-west"}},
+		"api.example.com":   {{"api-proxy", anyName}},
+		"admin@example.com": {{anyName, anyName}},
+	})
+
+	for _, rule := range []string{"", "id", "=proxy", "id=", "id=/zone", "id=proxy/"} {
+		_, err := newClientAuthorizer([]string{rule})
+		assert.ErrorContains(t, err, "malformed authorization")
+	}
+}
+
+func peerContext(t *testing.T, ca *testCA, dnsName string, uris ...string) context.Context {
+	certPEM, _ := ca.issue(t, dnsName, uris...)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}},
+		},
+	})
+}
+
+func mkNode(proxy, zone string) *envoycore.Node {
+	return &envoycore.Node{Cluster: proxy, Locality: &envoycore.Locality{Zone: zone}}
+}
+
+func assertPermissionDenied(t *testing.T, err error) {
+	assert.NonNil(t, err)
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+}
+
+func TestClientAuthorizerAuthorize(t *testing.T) {
+	ca := newTestCA(t)
+	authz, err := newClientAuthorizer([]string{
+		"spiffe://mesh/web=web-proxy/us-east",
+		"api.example.com=api-proxy",
+	})
+	assert.Nil(t, err)
+
+	webCtx := peerContext(t, ca, "web.example.com", "spiffe://mesh/web")
+	assert.Nil(t, authz.authorize(webCtx, mkNode("web-proxy", "us-east")))
+	assert.Nil(t, authz.authorize(webCtx, nil))
+	assertPermissionDenied(t, authz.authorize(webCtx, mkNode("web-proxy", "us-west")))
+	assertPermissionDenied(t, authz.authorize(webCtx, mkNode("api-proxy", "us-east")))
+	assertPermissionDenied(t, authz.authorize(webCtx, &envoycore.Node{}))
+
+	apiCtx := peerContext(t, ca, "api.example.com")
+	assert.Nil(t, authz.authorize(apiCtx, mkNode("api-proxy", "us-east")))
+	assert.Nil(t, authz.authorize(apiCtx, mkNode("api-proxy", "us-west")))
+	assertPermissionDenied(t, authz.authorize(apiCtx, mkNode("web-proxy", "us-east")))
+
+	err = authz.authorize(context.Background(), mkNode("api-proxy", "us-east"))
+	assertPermissionDenied(t, err)
+	assert.ErrorContains(t, err, "unidentified client")
+}
+
+func TestRequestNode(t *testing.T) {
+	node := mkNode("proxy", "zone")
+
+	assert.SameInstance(t, requestNode(&envoyapi.DiscoveryRequest{Node: node}), node)
+	assert.SameInstance(t, requestNode(&envoyapi.DeltaDiscoveryRequest{Node: node}), node)
+	assert.SameInstance(
+		t,
+		requestNode(&envoyals.StreamAccessLogsMessage{
+			Identifier: &envoyals.StreamAccessLogsMessage_Identifier{Node: node},
+		}),
+		node,
+	)
+	assert.Nil(t, requestNode(&envoyals.StreamAccessLogsMessage{}))
+	assert.Nil(t, requestNode("something else"))
+}
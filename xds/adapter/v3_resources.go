@@ -0,0 +1,740 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoyauth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoyendpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	envoylistener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	envoyroute "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoyals "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
+	envoylog "github.com/envoyproxy/go-control-plane/envoy/config/filter/accesslog/v2"
+	envoyrouter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
+	envoyhcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/envoyproxy/go-control-plane/pkg/util"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	"github.com/turbinelabs/nonstdlib/log/console"
+)
+
+// Rotor generates v2 resources. Envoys that request v3 resources are sent
+// the v3 equivalent of each. Most v3 messages are wire compatible with
+// their v2 counterparts, so a resource is translated by decoding it,
+// replacing the v2 fields that v3 removed, and re-encoding it with a v3 type
+// URL. Replacement fields that the v2 messages lack are encoded by hand and
+// carried in the messages' unrecognized fields, which the v2 encoder writes
+// out unchanged.
+
+const (
+	typeURLPrefix = "type.googleapis.com/"
+
+	v3ClusterType  = typeURLPrefix + "envoy.config.cluster.v3.Cluster"
+	v3EndpointType = typeURLPrefix + "envoy.config.endpoint.v3.ClusterLoadAssignment"
+	v3RouteType    = typeURLPrefix + "envoy.config.route.v3.RouteConfiguration"
+	v3ListenerType = typeURLPrefix + "envoy.config.listener.v3.Listener"
+
+	v3HTTPConnectionManagerName = "envoy.filters.network.http_connection_manager"
+	v3HTTPConnectionManagerType = typeURLPrefix +
+		"envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+
+	v3TLSTransportSocketName   = "envoy.transport_sockets.tls"
+	v3UpstreamTLSContextType   = typeURLPrefix + "envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext"
+	v3DownstreamTLSContextType = typeURLPrefix + "envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext"
+
+	// v3APIVersion is the value of envoy.config.core.v3.ApiVersion V3.
+	v3APIVersion = 2
+
+	// values of envoy.config.core.v3.TrafficDirection
+	v3TrafficDirectionInbound  = 1
+	v3TrafficDirectionOutbound = 2
+
+	// value of envoy.type.v3.CodecClientType HTTP2
+	v3CodecClientTypeHTTP2 = 1
+)
+
+var (
+	// v3TypeURLs maps v2 resource type URLs to their v3 equivalents.
+	v3TypeURLs = map[string]string{
+		cache.ClusterType:  v3ClusterType,
+		cache.EndpointType: v3EndpointType,
+		cache.RouteType:    v3RouteType,
+		cache.ListenerType: v3ListenerType,
+	}
+
+	// v2TypeURLs maps v3 resource type URLs to their v2 equivalents.
+	v2TypeURLs = map[string]string{
+		v3ClusterType:  cache.ClusterType,
+		v3EndpointType: cache.EndpointType,
+		v3RouteType:    cache.RouteType,
+		v3ListenerType: cache.ListenerType,
+	}
+)
+
+// v3Extension describes the v3 equivalent of a v2 filter or access logger.
+type v3Extension struct {
+	name    string
+	typeURL string
+
+	// config returns an empty v2 config for the extension.
+	config func() proto.Message
+
+	// convert, if not nil, translates a v2 config to v3 in place.
+	convert func(proto.Message) error
+}
+
+// typedConfig converts a v2 extension config, given as either a Struct or
+// an Any of the v2 type, to an Any of the v3 type. Any other Any is assumed
+// to hold a v3 config already, and is returned as is.
+func (e v3Extension) typedConfig(config *types.Struct, typedConfig *types.Any) (*types.Any, error) {
+	msg := e.config()
+	ok, err := v2Config(config, typedConfig, msg)
+	if err != nil || !ok {
+		return typedConfig, err
+	}
+
+	if e.convert != nil {
+		if err := e.convert(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	return v3Any(e.typeURL, msg)
+}
+
+// v3Extensions returns the given extensions keyed by both their v2 and
+// their v3 names, since v2 Envoys accept either.
+func v3Extensions(byV2Name map[string]v3Extension) map[string]v3Extension {
+	extensions := make(map[string]v3Extension, 2*len(byV2Name))
+	for name, ext := range byV2Name {
+		extensions[name] = ext
+		extensions[ext.name] = ext
+	}
+	return extensions
+}
+
+func emptyConfig() proto.Message {
+	return &types.Empty{}
+}
+
+var (
+	v3HTTPFilters = v3Extensions(map[string]v3Extension{
+		util.Router: {
+			name:    "envoy.filters.http.router",
+			typeURL: typeURLPrefix + "envoy.extensions.filters.http.router.v3.Router",
+			config:  func() proto.Message { return &envoyrouter.Router{} },
+			convert: func(m proto.Message) error { return v3Router(m.(*envoyrouter.Router)) },
+		},
+		util.CORS: {
+			name:    "envoy.filters.http.cors",
+			typeURL: typeURLPrefix + "envoy.extensions.filters.http.cors.v3.Cors",
+			config:  emptyConfig,
+		},
+	})
+
+	v3AccessLoggers = v3Extensions(map[string]v3Extension{
+		util.HTTPGRPCAccessLog: {
+			name:    "envoy.access_loggers.http_grpc",
+			typeURL: typeURLPrefix + "envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+			config:  func() proto.Message { return &envoyals.HttpGrpcAccessLogConfig{} },
+			convert: func(m proto.Message) error {
+				v3HTTPGRPCAccessLogConfig(m.(*envoyals.HttpGrpcAccessLogConfig))
+				return nil
+			},
+		},
+		util.FileAccessLog: {
+			name:    "envoy.access_loggers.file",
+			typeURL: typeURLPrefix + "envoy.extensions.access_loggers.file.v3.FileAccessLog",
+			config:  func() proto.Message { return &envoyals.FileAccessLog{} },
+		},
+	})
+
+	v3ListenerFilters = v3Extensions(map[string]v3Extension{
+		util.TlsInspector: {
+			name:    "envoy.filters.listener.tls_inspector",
+			typeURL: typeURLPrefix + "envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector",
+			config:  emptyConfig,
+		},
+	})
+)
+
+// v3Resource translates an Any holding a v2 resource to an Any holding its
+// v3 equivalent. Resources of other types are returned as is.
+func v3Resource(resource *types.Any) (*types.Any, error) {
+	var (
+		msg     proto.Message
+		convert func() error
+	)
+
+	switch resource.GetTypeUrl() {
+	case cache.ClusterType:
+		c := &envoyapi.Cluster{}
+		msg, convert = c, func() error { return v3Cluster(c) }
+
+	case cache.EndpointType:
+		// ClusterLoadAssignments are unchanged in v3.
+		return &types.Any{TypeUrl: v3EndpointType, Value: resource.GetValue()}, nil
+
+	case cache.RouteType:
+		rc := &envoyapi.RouteConfiguration{}
+		msg, convert = rc, func() error {
+			v3RouteConfiguration(rc)
+			return nil
+		}
+
+	case cache.ListenerType:
+		l := &envoyapi.Listener{}
+		msg, convert = l, func() error { return v3Listener(l) }
+
+	default:
+		return resource, nil
+	}
+
+	if err := proto.Unmarshal(resource.GetValue(), msg); err != nil {
+		return nil, err
+	}
+
+	if err := convert(); err != nil {
+		return nil, err
+	}
+
+	return v3Any(v3TypeURLs[resource.GetTypeUrl()], msg)
+}
+
+func v3Cluster(c *envoyapi.Cluster) error {
+	if c.TlsContext != nil {
+		v3CommonTLSContext(c.TlsContext.GetCommonTlsContext())
+		ts, err := v3TLSTransportSocket(v3UpstreamTLSContextType, c.TlsContext)
+		if err != nil {
+			return err
+		}
+		c.TransportSocket = ts
+		c.TlsContext = nil
+	}
+
+	if len(c.Hosts) > 0 {
+		if c.LoadAssignment == nil {
+			c.LoadAssignment = hostsLoadAssignment(c.Name, c.Hosts)
+		}
+		c.Hosts = nil
+	}
+
+	if len(c.ExtensionProtocolOptions) > 0 {
+		v3Dropped("cluster "+c.Name, "extension_protocol_options")
+		c.ExtensionProtocolOptions = nil
+	}
+
+	v3ConfigSource(c.GetEdsClusterConfig().GetEdsConfig())
+
+	for _, hc := range c.HealthChecks {
+		v3HealthCheck(hc)
+	}
+
+	return nil
+}
+
+// hostsLoadAssignment returns the ClusterLoadAssignment equivalent to a
+// Cluster's hosts, which v3 removes.
+func hostsLoadAssignment(name string, hosts []*envoycore.Address) *envoyapi.ClusterLoadAssignment {
+	lbEndpoints := make([]*envoyendpoint.LbEndpoint, len(hosts))
+	for i, host := range hosts {
+		lbEndpoints[i] = &envoyendpoint.LbEndpoint{
+			HostIdentifier: &envoyendpoint.LbEndpoint_Endpoint{
+				Endpoint: &envoyendpoint.Endpoint{Address: host},
+			},
+		}
+	}
+
+	return &envoyapi.ClusterLoadAssignment{
+		ClusterName: name,
+		Endpoints:   []*envoyendpoint.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+	}
+}
+
+func v3HealthCheck(hc *envoycore.HealthCheck) {
+	hhc := hc.GetHttpHealthCheck()
+	if hhc == nil {
+		return
+	}
+
+	if hhc.ServiceName != "" {
+		// v2 matched service_name as a prefix
+		matcher := appendBytesField(nil, 2, []byte(hhc.ServiceName))
+		hhc.XXX_unrecognized = appendBytesField(hhc.XXX_unrecognized, 11, matcher) // service_name_matcher
+		hhc.ServiceName = ""
+	}
+
+	if hhc.UseHttp2 {
+		hhc.XXX_unrecognized = appendVarintField(hhc.XXX_unrecognized, 10, v3CodecClientTypeHTTP2) // codec_client_type
+		hhc.UseHttp2 = false
+	}
+}
+
+// v3ConfigSource marks a ConfigSource as referring to v3 resources served
+// over the v3 transport.
+func v3ConfigSource(cs *envoycore.ConfigSource) {
+	if cs == nil {
+		return
+	}
+
+	cs.XXX_unrecognized = appendVarintField(cs.XXX_unrecognized, 6, v3APIVersion) // resource_api_version
+
+	if api := cs.GetApiConfigSource(); api != nil {
+		api.XXX_unrecognized = appendVarintField(api.XXX_unrecognized, 8, v3APIVersion) // transport_api_version
+	}
+}
+
+func v3CommonTLSContext(ctx *envoyauth.CommonTlsContext) {
+	v3CertificateValidationContext(ctx.GetValidationContext())
+	v3CertificateValidationContext(ctx.GetCombinedValidationContext().GetDefaultValidationContext())
+}
+
+func v3CertificateValidationContext(vc *envoyauth.CertificateValidationContext) {
+	if vc == nil {
+		return
+	}
+
+	for _, name := range vc.VerifySubjectAltName {
+		vc.XXX_unrecognized = appendBytesField(vc.XXX_unrecognized, 9, v3ExactStringMatcher(name)) // match_subject_alt_names
+	}
+	vc.VerifySubjectAltName = nil
+}
+
+// v3TLSTransportSocket returns a TLS TransportSocket with the given v2
+// Upstream- or DownstreamTlsContext, which v3 configures only as a
+// TransportSocket.
+func v3TLSTransportSocket(typeURL string, tlsContext proto.Message) (*envoycore.TransportSocket, error) {
+	config, err := v3Any(typeURL, tlsContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoycore.TransportSocket{
+		Name:       v3TLSTransportSocketName,
+		ConfigType: &envoycore.TransportSocket_TypedConfig{TypedConfig: config},
+	}, nil
+}
+
+func v3Listener(l *envoyapi.Listener) error {
+	for _, lf := range l.ListenerFilters {
+		ext, ok := v3ListenerFilters[lf.Name]
+		if !ok {
+			v3Untranslated("listener "+l.Name, "listener filter "+lf.Name)
+			continue
+		}
+
+		config, err := ext.typedConfig(lf.GetConfig(), lf.GetTypedConfig())
+		if err != nil {
+			return err
+		}
+		lf.Name = ext.name
+		lf.ConfigType = &envoylistener.ListenerFilter_TypedConfig{TypedConfig: config}
+	}
+
+	var trafficDirection uint64
+	for _, fc := range l.FilterChains {
+		if fc.TlsContext != nil {
+			v3CommonTLSContext(fc.TlsContext.GetCommonTlsContext())
+			ts, err := v3TLSTransportSocket(v3DownstreamTLSContextType, fc.TlsContext)
+			if err != nil {
+				return err
+			}
+			fc.TransportSocket = ts
+			fc.TlsContext = nil
+		}
+
+		for _, f := range fc.Filters {
+			if f.Name != util.HTTPConnectionManager && f.Name != v3HTTPConnectionManagerName {
+				v3Untranslated("listener "+l.Name, "filter "+f.Name)
+				continue
+			}
+
+			hcm := &envoyhcm.HttpConnectionManager{}
+			ok, err := v2Config(f.GetConfig(), f.GetTypedConfig(), hcm)
+			if err != nil {
+				return err
+			}
+			f.Name = v3HTTPConnectionManagerName
+			if !ok {
+				continue
+			}
+
+			// v3 takes the tracing operation name from the listener's
+			// traffic direction.
+			if tracing := hcm.GetTracing(); tracing != nil {
+				trafficDirection = v3TrafficDirectionInbound
+				if tracing.OperationName == envoyhcm.EGRESS {
+					trafficDirection = v3TrafficDirectionOutbound
+				}
+			}
+
+			if err := v3HTTPConnectionManager(hcm); err != nil {
+				return err
+			}
+
+			config, err := v3Any(v3HTTPConnectionManagerType, hcm)
+			if err != nil {
+				return err
+			}
+			f.ConfigType = &envoylistener.Filter_TypedConfig{TypedConfig: config}
+		}
+	}
+
+	if trafficDirection != 0 {
+		l.XXX_unrecognized = appendVarintField(l.XXX_unrecognized, 16, trafficDirection) // traffic_direction
+	}
+
+	return nil
+}
+
+func v3HTTPConnectionManager(hcm *envoyhcm.HttpConnectionManager) error {
+	v3ConfigSource(hcm.GetRds().GetConfigSource())
+
+	if rc := hcm.GetRouteConfig(); rc != nil {
+		v3RouteConfiguration(rc)
+	}
+
+	for _, hf := range hcm.HttpFilters {
+		ext, ok := v3HTTPFilters[hf.Name]
+		if !ok {
+			v3Untranslated("http connection manager "+hcm.StatPrefix, "http filter "+hf.Name)
+			continue
+		}
+
+		config, err := ext.typedConfig(hf.GetConfig(), hf.GetTypedConfig())
+		if err != nil {
+			return err
+		}
+		hf.Name = ext.name
+		hf.ConfigType = &envoyhcm.HttpFilter_TypedConfig{TypedConfig: config}
+	}
+
+	for _, al := range hcm.AccessLog {
+		if err := v3AccessLog(al); err != nil {
+			return err
+		}
+	}
+
+	if tracing := hcm.Tracing; tracing != nil {
+		for _, header := range tracing.RequestHeadersForTags {
+			tag := appendBytesField(nil, 1, []byte(header))                               // tag
+			tag = appendBytesField(tag, 4, appendBytesField(nil, 1, []byte(header)))      // request_header.name
+			tracing.XXX_unrecognized = appendBytesField(tracing.XXX_unrecognized, 8, tag) // custom_tags
+		}
+		tracing.RequestHeadersForTags = nil
+		tracing.OperationName = envoyhcm.INGRESS
+	}
+
+	if hcm.IdleTimeout != nil {
+		timeout, err := proto.Marshal(types.DurationProto(*hcm.IdleTimeout))
+		if err != nil {
+			return err
+		}
+		options := appendBytesField(nil, 1, timeout)                               // idle_timeout
+		hcm.XXX_unrecognized = appendBytesField(hcm.XXX_unrecognized, 35, options) // common_http_protocol_options
+		hcm.IdleTimeout = nil
+	}
+
+	return nil
+}
+
+func v3Router(r *envoyrouter.Router) error {
+	for _, al := range r.UpstreamLog {
+		if err := v3AccessLog(al); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func v3AccessLog(al *envoylog.AccessLog) error {
+	ext, ok := v3AccessLoggers[al.Name]
+	if !ok {
+		v3Untranslated("access log", al.Name)
+		return nil
+	}
+
+	config, err := ext.typedConfig(al.GetConfig(), al.GetTypedConfig())
+	if err != nil {
+		return err
+	}
+	al.Name = ext.name
+	al.ConfigType = &envoylog.AccessLog_TypedConfig{TypedConfig: config}
+
+	return nil
+}
+
+// v3HTTPGRPCAccessLogConfig causes Envoy to send access logs to the v3 ALS.
+func v3HTTPGRPCAccessLogConfig(c *envoyals.HttpGrpcAccessLogConfig) {
+	if cc := c.GetCommonConfig(); cc != nil {
+		cc.XXX_unrecognized = appendVarintField(cc.XXX_unrecognized, 6, v3APIVersion) // transport_api_version
+	}
+}
+
+func v3RouteConfiguration(rc *envoyapi.RouteConfiguration) {
+	for _, vh := range rc.VirtualHosts {
+		v3VirtualHost(vh)
+	}
+}
+
+func v3VirtualHost(vh *envoyroute.VirtualHost) {
+	where := "virtual host " + vh.Name
+
+	for _, r := range vh.Routes {
+		v3Route(where, r)
+	}
+
+	for _, vc := range vh.VirtualClusters {
+		v3VirtualCluster(vc)
+	}
+
+	v3CorsPolicy(vh.Cors)
+
+	if len(vh.PerFilterConfig) > 0 {
+		v3Dropped(where, "per_filter_config")
+		vh.PerFilterConfig = nil
+	}
+}
+
+func v3Route(where string, r *envoyroute.Route) {
+	v3RouteMatch(r.Match)
+
+	if action := r.GetRoute(); action != nil {
+		v3CorsPolicy(action.Cors)
+
+		for _, cw := range action.GetWeightedClusters().GetClusters() {
+			if len(cw.PerFilterConfig) > 0 {
+				v3Dropped(where, "weighted cluster per_filter_config")
+				cw.PerFilterConfig = nil
+			}
+		}
+
+		if action.RequestMirrorPolicy != nil {
+			v3Dropped(where, "request_mirror_policy")
+			action.RequestMirrorPolicy = nil
+		}
+	}
+
+	if len(r.PerFilterConfig) > 0 {
+		v3Dropped(where, "route per_filter_config")
+		r.PerFilterConfig = nil
+	}
+}
+
+func v3RouteMatch(m *envoyroute.RouteMatch) {
+	if m == nil {
+		return
+	}
+
+	if regex, ok := m.PathSpecifier.(*envoyroute.RouteMatch_Regex); ok {
+		m.XXX_unrecognized = appendBytesField(m.XXX_unrecognized, 10, v3RegexMatcher(regex.Regex)) // safe_regex
+		m.PathSpecifier = nil
+	}
+
+	for _, h := range m.Headers {
+		v3HeaderMatcher(h)
+	}
+
+	for _, q := range m.QueryParameters {
+		v3QueryParameterMatcher(q)
+	}
+}
+
+func v3HeaderMatcher(h *envoyroute.HeaderMatcher) {
+	if regex, ok := h.HeaderMatchSpecifier.(*envoyroute.HeaderMatcher_RegexMatch); ok {
+		h.XXX_unrecognized = appendBytesField(h.XXX_unrecognized, 11, v3RegexMatcher(regex.RegexMatch)) // safe_regex_match
+		h.HeaderMatchSpecifier = nil
+	}
+}
+
+func v3QueryParameterMatcher(q *envoyroute.QueryParameterMatcher) {
+	switch {
+	case q.GetRegex().GetValue():
+		q.XXX_unrecognized = appendBytesField(q.XXX_unrecognized, 5, v3RegexStringMatcher(q.Value)) // string_match
+	case q.Value != "":
+		q.XXX_unrecognized = appendBytesField(q.XXX_unrecognized, 5, v3ExactStringMatcher(q.Value)) // string_match
+	default:
+		// v2 matched the presence of parameters without a value
+		q.XXX_unrecognized = appendVarintField(q.XXX_unrecognized, 6, 1) // present_match
+	}
+
+	q.Value = ""
+	q.Regex = nil
+}
+
+func v3VirtualCluster(vc *envoyroute.VirtualCluster) {
+	if vc.Pattern != "" {
+		path := appendBytesField(nil, 1, []byte(":path"))                    // name
+		path = appendBytesField(path, 11, v3RegexMatcher(vc.Pattern))        // safe_regex_match
+		vc.XXX_unrecognized = appendBytesField(vc.XXX_unrecognized, 4, path) // headers
+		vc.Pattern = ""
+	}
+
+	if vc.Method != envoycore.METHOD_UNSPECIFIED {
+		method := appendBytesField(nil, 1, []byte(":method"))                  // name
+		method = appendBytesField(method, 4, []byte(vc.Method.String()))       // exact_match
+		vc.XXX_unrecognized = appendBytesField(vc.XXX_unrecognized, 4, method) // headers
+		vc.Method = envoycore.METHOD_UNSPECIFIED
+	}
+}
+
+func v3CorsPolicy(c *envoyroute.CorsPolicy) {
+	if c == nil {
+		return
+	}
+
+	for _, origin := range c.AllowOrigin {
+		matcher := v3ExactStringMatcher(origin)
+		if origin == "*" {
+			matcher = v3RegexStringMatcher(".*")
+		}
+		c.XXX_unrecognized = appendBytesField(c.XXX_unrecognized, 11, matcher) // allow_origin_string_match
+	}
+	c.AllowOrigin = nil
+
+	for _, regex := range c.AllowOriginRegex {
+		c.XXX_unrecognized = appendBytesField(c.XXX_unrecognized, 11, v3RegexStringMatcher(regex)) // allow_origin_string_match
+	}
+	c.AllowOriginRegex = nil
+
+	if enabled, ok := c.EnabledSpecifier.(*envoyroute.CorsPolicy_Enabled); ok {
+		var numerator uint32
+		if enabled.Enabled == nil || enabled.Enabled.Value {
+			numerator = 100
+		}
+
+		c.EnabledSpecifier = &envoyroute.CorsPolicy_FilterEnabled{
+			FilterEnabled: &envoycore.RuntimeFractionalPercent{
+				DefaultValue: &envoytype.FractionalPercent{
+					Numerator:   numerator,
+					Denominator: envoytype.FractionalPercent_HUNDRED,
+				},
+			},
+		}
+	}
+}
+
+// v2Config decodes a v2 extension config, given as either a Struct or an
+// Any of the v2 type, into msg. It returns false if the config is an Any of
+// another type.
+func v2Config(config *types.Struct, typedConfig *types.Any, msg proto.Message) (bool, error) {
+	switch {
+	case typedConfig != nil:
+		if typedConfig.GetTypeUrl() != typeURLPrefix+proto.MessageName(msg) {
+			return false, nil
+		}
+		return true, proto.Unmarshal(typedConfig.GetValue(), msg)
+
+	case config != nil:
+		return true, util.StructToMessage(config, msg)
+	}
+
+	return true, nil
+}
+
+func v3Any(typeURL string, msg proto.Message) (*types.Any, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Any{TypeUrl: typeURL, Value: data}, nil
+}
+
+func v3Dropped(where, field string) {
+	console.Error().Printf("%s: dropping %s, which has no v3 equivalent", where, field)
+}
+
+func v3Untranslated(where, extension string) {
+	console.Error().Printf("%s: cannot translate config of %s to v3", where, extension)
+}
+
+// v3RegexMatcher encodes an envoy.type.matcher.v3.RegexMatcher using the
+// RE2 engine.
+func v3RegexMatcher(regex string) []byte {
+	b := appendBytesField(nil, 1, nil)           // google_re2
+	return appendBytesField(b, 2, []byte(regex)) // regex
+}
+
+// v3ExactStringMatcher encodes an envoy.type.matcher.v3.StringMatcher that
+// matches the given string exactly.
+func v3ExactStringMatcher(s string) []byte {
+	return appendBytesField(nil, 1, []byte(s)) // exact
+}
+
+// v3RegexStringMatcher encodes an envoy.type.matcher.v3.StringMatcher that
+// matches the given regular expression.
+func v3RegexStringMatcher(regex string) []byte {
+	return appendBytesField(nil, 5, v3RegexMatcher(regex)) // safe_regex
+}
+
+// appendBytesField appends a length-delimited field to an encoded message.
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = append(b, proto.EncodeVarint(uint64(field)<<3|proto.WireBytes)...)
+	b = append(b, proto.EncodeVarint(uint64(len(value)))...)
+	return append(b, value...)
+}
+
+// appendVarintField appends a varint field to an encoded message.
+func appendVarintField(b []byte, field int, value uint64) []byte {
+	b = append(b, proto.EncodeVarint(uint64(field)<<3|proto.WireVarint)...)
+	return append(b, proto.EncodeVarint(value)...)
+}
+
+// wireFields calls fn with the number, wire type and value of each field of
+// an encoded message, stopping at the first malformed field. Varint values
+// are passed in their encoded form.
+func wireFields(b []byte, fn func(field int, wireType int, value []byte)) {
+	for len(b) > 0 {
+		key, n := proto.DecodeVarint(b)
+		if n == 0 {
+			return
+		}
+		b = b[n:]
+
+		var size int
+		switch wireType := int(key & 7); wireType {
+		case proto.WireVarint:
+			if _, size = proto.DecodeVarint(b); size == 0 {
+				return
+			}
+		case proto.WireFixed64:
+			size = 8
+		case proto.WireFixed32:
+			size = 4
+		case proto.WireBytes:
+			length, n := proto.DecodeVarint(b)
+			if n == 0 || length > uint64(len(b)-n) {
+				return
+			}
+			b = b[n:]
+			size = int(length)
+		default:
+			return
+		}
+
+		if size > len(b) {
+			return
+		}
+		fn(int(key>>3), int(key&7), b[:size])
+		b = b[size:]
+	}
+}
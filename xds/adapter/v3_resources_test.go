@@ -0,0 +1,444 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoyauth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoylistener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	envoyroute "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoyals "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
+	envoyrouter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
+	envoyhcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"github.com/envoyproxy/go-control-plane/pkg/util"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	"github.com/turbinelabs/api"
+	"github.com/turbinelabs/nonstdlib/ptr"
+	"github.com/turbinelabs/rotor/xds/poller"
+	"github.com/turbinelabs/test/assert"
+)
+
+// wireValues returns the values of the given field of an encoded message.
+func wireValues(b []byte, field int) [][]byte {
+	var values [][]byte
+	wireFields(b, func(f, _ int, value []byte) {
+		if f == field {
+			values = append(values, value)
+		}
+	})
+	return values
+}
+
+func mkV2Any(t *testing.T, typeURL string, msg proto.Message) *types.Any {
+	data, err := proto.Marshal(msg)
+	assert.Nil(t, err)
+	return &types.Any{TypeUrl: typeURL, Value: data}
+}
+
+func assertV3ConfigSource(t *testing.T, cs *envoycore.ConfigSource) {
+	assert.ArrayEqual(t, wireValues(cs.XXX_unrecognized, 6), [][]byte{{v3APIVersion}})
+	assert.ArrayEqual(
+		t,
+		wireValues(cs.GetApiConfigSource().XXX_unrecognized, 8),
+		[][]byte{{v3APIVersion}},
+	)
+}
+
+func TestV3ResourceCluster(t *testing.T) {
+	objects := poller.MkFixtureObjects()
+	cluster, err := cds{caFile: "ca.pem"}.tbnToEnvoyCluster(objects.Clusters[0], objects)
+	assert.Nil(t, err)
+	assert.NonNil(t, cluster.TlsContext)
+
+	host := mkEnvoyAddress("1.2.3.4", 80)
+	cluster.Hosts = []*envoycore.Address{host}
+	cluster.TlsContext.CommonTlsContext.GetValidationContext().VerifySubjectAltName = []string{"foo"}
+	cluster.HealthChecks = []*envoycore.HealthCheck{
+		{
+			HealthChecker: &envoycore.HealthCheck_HttpHealthCheck_{
+				HttpHealthCheck: &envoycore.HealthCheck_HttpHealthCheck{
+					Path:        "/health",
+					ServiceName: "foo",
+					UseHttp2:    true,
+				},
+			},
+		},
+	}
+
+	resource, err := v3Resource(mkV2Any(t, cache.ClusterType, cluster))
+	assert.Nil(t, err)
+	assert.Equal(t, resource.TypeUrl, v3ClusterType)
+
+	got := &envoyapi.Cluster{}
+	assert.Nil(t, proto.Unmarshal(resource.Value, got))
+	assert.Equal(t, got.Name, cluster.Name)
+	assert.Nil(t, got.TlsContext)
+	assert.Nil(t, got.Hosts)
+
+	assert.Equal(t, got.TransportSocket.Name, v3TLSTransportSocketName)
+	tlsConfig := got.TransportSocket.GetTypedConfig()
+	assert.Equal(t, tlsConfig.TypeUrl, v3UpstreamTLSContextType)
+	tlsContext := &envoyauth.UpstreamTlsContext{}
+	assert.Nil(t, proto.Unmarshal(tlsConfig.Value, tlsContext))
+	assert.Equal(t, tlsContext.Sni, cluster.Name)
+	vc := tlsContext.CommonTlsContext.GetValidationContext()
+	assert.Nil(t, vc.VerifySubjectAltName)
+	assert.ArrayEqual(t, wireValues(vc.XXX_unrecognized, 9), [][]byte{v3ExactStringMatcher("foo")})
+
+	assert.DeepEqual(t, got.LoadAssignment, hostsLoadAssignment(cluster.Name, []*envoycore.Address{host}))
+
+	assertV3ConfigSource(t, got.EdsClusterConfig.EdsConfig)
+
+	hhc := got.HealthChecks[0].GetHttpHealthCheck()
+	assert.Equal(t, hhc.Path, "/health")
+	assert.Equal(t, hhc.ServiceName, "")
+	assert.False(t, hhc.UseHttp2)
+	assert.ArrayEqual(
+		t,
+		wireValues(hhc.XXX_unrecognized, 11),
+		[][]byte{appendBytesField(nil, 2, []byte("foo"))},
+	)
+	assert.ArrayEqual(t, wireValues(hhc.XXX_unrecognized, 10), [][]byte{{v3CodecClientTypeHTTP2}})
+}
+
+func TestV3ResourceEndpoints(t *testing.T) {
+	cla := &envoyapi.ClusterLoadAssignment{ClusterName: "foo"}
+	v2 := mkV2Any(t, cache.EndpointType, cla)
+
+	resource, err := v3Resource(v2)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, resource, &types.Any{TypeUrl: v3EndpointType, Value: v2.Value})
+}
+
+func TestV3ResourceUnknownType(t *testing.T) {
+	v2 := &types.Any{TypeUrl: cache.SecretType}
+	resource, err := v3Resource(v2)
+	assert.Nil(t, err)
+	assert.SameInstance(t, resource, v2)
+}
+
+func TestV3ResourceListener(t *testing.T) {
+	listener, err := lds{loggingCluster: "tbn-xds"}.mkListener(
+		api.Proxy{Name: "proxy"},
+		8443,
+		api.Domains{
+			{
+				Name: "foo.example.com",
+				Port: 8443,
+				SSLConfig: &api.SSLConfig{
+					CertKeyPairs: []api.CertKeyPathPair{{CertificatePath: "cert", KeyPath: "key"}},
+				},
+			},
+		},
+		&api.Listener{
+			TracingConfig: &api.TracingConfig{RequestHeadersForTags: []string{"x-tag"}},
+		},
+	)
+	assert.Nil(t, err)
+
+	resource, err := v3Resource(mkV2Any(t, cache.ListenerType, listener))
+	assert.Nil(t, err)
+	assert.Equal(t, resource.TypeUrl, v3ListenerType)
+
+	got := &envoyapi.Listener{}
+	assert.Nil(t, proto.Unmarshal(resource.Value, got))
+	assert.Equal(t, got.Name, listener.Name)
+
+	// egress tracing
+	assert.ArrayEqual(
+		t,
+		wireValues(got.XXX_unrecognized, 16),
+		[][]byte{{v3TrafficDirectionOutbound}},
+	)
+
+	assert.Equal(t, len(got.ListenerFilters), 1)
+	assert.Equal(t, got.ListenerFilters[0].Name, "envoy.filters.listener.tls_inspector")
+	assert.Equal(
+		t,
+		got.ListenerFilters[0].GetTypedConfig().TypeUrl,
+		typeURLPrefix+"envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector",
+	)
+
+	assert.Equal(t, len(got.FilterChains), 1)
+	fc := got.FilterChains[0]
+	assert.Nil(t, fc.TlsContext)
+	assert.Equal(t, fc.TransportSocket.Name, v3TLSTransportSocketName)
+	assert.Equal(t, fc.TransportSocket.GetTypedConfig().TypeUrl, v3DownstreamTLSContextType)
+
+	assert.Equal(t, len(fc.Filters), 1)
+	assert.Equal(t, fc.Filters[0].Name, v3HTTPConnectionManagerName)
+	hcmConfig := fc.Filters[0].GetTypedConfig()
+	assert.Equal(t, hcmConfig.TypeUrl, v3HTTPConnectionManagerType)
+
+	hcm := &envoyhcm.HttpConnectionManager{}
+	assert.Nil(t, proto.Unmarshal(hcmConfig.Value, hcm))
+	assert.Equal(t, hcm.StatPrefix, "proxy-8443")
+	assertV3ConfigSource(t, hcm.GetRds().ConfigSource)
+
+	assert.Equal(t, hcm.Tracing.OperationName, envoyhcm.INGRESS)
+	assert.Nil(t, hcm.Tracing.RequestHeadersForTags)
+	tag := appendBytesField(nil, 1, []byte("x-tag"))
+	tag = appendBytesField(tag, 4, appendBytesField(nil, 1, []byte("x-tag")))
+	assert.ArrayEqual(t, wireValues(hcm.Tracing.XXX_unrecognized, 8), [][]byte{tag})
+
+	assert.Equal(t, len(hcm.HttpFilters), 2)
+	assert.Equal(t, hcm.HttpFilters[0].Name, "envoy.filters.http.cors")
+	assert.Equal(
+		t,
+		hcm.HttpFilters[0].GetTypedConfig().TypeUrl,
+		typeURLPrefix+"envoy.extensions.filters.http.cors.v3.Cors",
+	)
+	assert.Equal(t, hcm.HttpFilters[1].Name, "envoy.filters.http.router")
+	routerConfig := hcm.HttpFilters[1].GetTypedConfig()
+	assert.Equal(
+		t,
+		routerConfig.TypeUrl,
+		typeURLPrefix+"envoy.extensions.filters.http.router.v3.Router",
+	)
+
+	router := &envoyrouter.Router{}
+	assert.Nil(t, proto.Unmarshal(routerConfig.Value, router))
+	assert.Equal(t, len(router.UpstreamLog), 1)
+	assertV3GRPCAccessLog(t, router.UpstreamLog[0].Name, router.UpstreamLog[0].GetTypedConfig(), grpcUpstreamLogID)
+
+	assert.Equal(t, len(hcm.AccessLog), 1)
+	assertV3GRPCAccessLog(t, hcm.AccessLog[0].Name, hcm.AccessLog[0].GetTypedConfig(), grpcAccessLogID)
+}
+
+func assertV3GRPCAccessLog(t *testing.T, name string, config *types.Any, logName string) {
+	assert.Equal(t, name, "envoy.access_loggers.http_grpc")
+	assert.Equal(
+		t,
+		config.TypeUrl,
+		typeURLPrefix+"envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+	)
+
+	alsConfig := &envoyals.HttpGrpcAccessLogConfig{}
+	assert.Nil(t, proto.Unmarshal(config.Value, alsConfig))
+	assert.Equal(t, alsConfig.CommonConfig.LogName, logName)
+	assert.Equal(
+		t,
+		alsConfig.CommonConfig.GrpcService.GetEnvoyGrpc().ClusterName,
+		"tbn-xds",
+	)
+	assert.ArrayEqual(
+		t,
+		wireValues(alsConfig.CommonConfig.XXX_unrecognized, 6),
+		[][]byte{{v3APIVersion}},
+	)
+}
+
+func TestV3ResourceListenerIngressAndIdleTimeout(t *testing.T) {
+	hcm := &envoyhcm.HttpConnectionManager{
+		StatPrefix:  "foo",
+		IdleTimeout: ptr.Duration(5 * time.Second),
+		Tracing:     &envoyhcm.HttpConnectionManager_Tracing{OperationName: envoyhcm.INGRESS},
+	}
+	listener := &envoyapi.Listener{
+		Name: "foo",
+		FilterChains: []*envoylistener.FilterChain{
+			{
+				Filters: []*envoylistener.Filter{
+					{
+						Name: util.HTTPConnectionManager,
+						ConfigType: &envoylistener.Filter_TypedConfig{
+							TypedConfig: mkV2Any(t, typeURLPrefix+proto.MessageName(hcm), hcm),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	resource, err := v3Resource(mkV2Any(t, cache.ListenerType, listener))
+	assert.Nil(t, err)
+
+	got := &envoyapi.Listener{}
+	assert.Nil(t, proto.Unmarshal(resource.Value, got))
+	assert.ArrayEqual(
+		t,
+		wireValues(got.XXX_unrecognized, 16),
+		[][]byte{{v3TrafficDirectionInbound}},
+	)
+
+	f := got.FilterChains[0].Filters[0]
+	assert.Equal(t, f.Name, v3HTTPConnectionManagerName)
+	assert.Equal(t, f.GetTypedConfig().TypeUrl, v3HTTPConnectionManagerType)
+
+	gotHCM := &envoyhcm.HttpConnectionManager{}
+	assert.Nil(t, proto.Unmarshal(f.GetTypedConfig().Value, gotHCM))
+	assert.Nil(t, gotHCM.IdleTimeout)
+
+	timeout, err := proto.Marshal(types.DurationProto(5 * time.Second))
+	assert.Nil(t, err)
+	assert.ArrayEqual(
+		t,
+		wireValues(gotHCM.XXX_unrecognized, 35),
+		[][]byte{appendBytesField(nil, 1, timeout)},
+	)
+}
+
+func TestV3ResourceRoutes(t *testing.T) {
+	rc := &envoyapi.RouteConfiguration{
+		Name: "routes",
+		VirtualHosts: []*envoyroute.VirtualHost{
+			{
+				Name: "vh",
+				Cors: mkEnvoyCorsPolicy(&api.CorsConfig{AllowedOrigins: []string{"*", "foo.com"}}),
+				Routes: []*envoyroute.Route{
+					{
+						Match: &envoyroute.RouteMatch{
+							PathSpecifier: &envoyroute.RouteMatch_Regex{Regex: "/foo/.*"},
+							Headers: []*envoyroute.HeaderMatcher{
+								{
+									Name:                 ":method",
+									HeaderMatchSpecifier: &envoyroute.HeaderMatcher_RegexMatch{RegexMatch: "^(GET|PUT)$"},
+								},
+								{
+									Name:                 "x-exact",
+									HeaderMatchSpecifier: &envoyroute.HeaderMatcher_ExactMatch{ExactMatch: "x"},
+								},
+							},
+							QueryParameters: []*envoyroute.QueryParameterMatcher{
+								{Name: "exact", Value: "x", Regex: boolValue(false)},
+								{Name: "regex", Value: "x.*", Regex: boolValue(true)},
+								{Name: "present"},
+							},
+						},
+						Action: &envoyroute.Route_Route{
+							Route: &envoyroute.RouteAction{
+								ClusterSpecifier: &envoyroute.RouteAction_Cluster{Cluster: "foo"},
+								Cors: &envoyroute.CorsPolicy{
+									AllowOriginRegex: []string{".*\\.foo\\.com"},
+									EnabledSpecifier: &envoyroute.CorsPolicy_Enabled{Enabled: boolValue(false)},
+								},
+							},
+						},
+					},
+				},
+				VirtualClusters: []*envoyroute.VirtualCluster{
+					{Name: "vc", Pattern: "/foo/.*", Method: envoycore.POST},
+				},
+			},
+		},
+	}
+
+	resource, err := v3Resource(mkV2Any(t, cache.RouteType, rc))
+	assert.Nil(t, err)
+	assert.Equal(t, resource.TypeUrl, v3RouteType)
+
+	got := &envoyapi.RouteConfiguration{}
+	assert.Nil(t, proto.Unmarshal(resource.Value, got))
+	assert.Equal(t, got.Name, "routes")
+
+	vh := got.VirtualHosts[0]
+	assert.Nil(t, vh.Cors.AllowOrigin)
+	assert.ArrayEqual(
+		t,
+		wireValues(vh.Cors.XXX_unrecognized, 11),
+		[][]byte{v3RegexStringMatcher(".*"), v3ExactStringMatcher("foo.com")},
+	)
+	assert.DeepEqual(
+		t,
+		vh.Cors.GetFilterEnabled().DefaultValue,
+		&envoytype.FractionalPercent{Numerator: 100, Denominator: envoytype.FractionalPercent_HUNDRED},
+	)
+
+	match := vh.Routes[0].Match
+	assert.Nil(t, match.PathSpecifier)
+	assert.ArrayEqual(t, wireValues(match.XXX_unrecognized, 10), [][]byte{v3RegexMatcher("/foo/.*")})
+
+	assert.Nil(t, match.Headers[0].HeaderMatchSpecifier)
+	assert.ArrayEqual(
+		t,
+		wireValues(match.Headers[0].XXX_unrecognized, 11),
+		[][]byte{v3RegexMatcher("^(GET|PUT)$")},
+	)
+	assert.Equal(t, match.Headers[1].GetExactMatch(), "x")
+	assert.Nil(t, match.Headers[1].XXX_unrecognized)
+
+	for _, q := range match.QueryParameters {
+		assert.Equal(t, q.Value, "")
+		assert.Nil(t, q.Regex)
+	}
+	assert.ArrayEqual(
+		t,
+		wireValues(match.QueryParameters[0].XXX_unrecognized, 5),
+		[][]byte{v3ExactStringMatcher("x")},
+	)
+	assert.ArrayEqual(
+		t,
+		wireValues(match.QueryParameters[1].XXX_unrecognized, 5),
+		[][]byte{v3RegexStringMatcher("x.*")},
+	)
+	assert.ArrayEqual(t, wireValues(match.QueryParameters[2].XXX_unrecognized, 6), [][]byte{{1}})
+
+	cors := vh.Routes[0].GetRoute().Cors
+	assert.Nil(t, cors.AllowOriginRegex)
+	assert.ArrayEqual(
+		t,
+		wireValues(cors.XXX_unrecognized, 11),
+		[][]byte{v3RegexStringMatcher(".*\\.foo\\.com")},
+	)
+	assert.Equal(t, cors.GetFilterEnabled().DefaultValue.Numerator, uint32(0))
+
+	vc := vh.VirtualClusters[0]
+	assert.Equal(t, vc.Pattern, "")
+	assert.Equal(t, vc.Method, envoycore.METHOD_UNSPECIFIED)
+	path := appendBytesField(nil, 1, []byte(":path"))
+	path = appendBytesField(path, 11, v3RegexMatcher("/foo/.*"))
+	method := appendBytesField(nil, 1, []byte(":method"))
+	method = appendBytesField(method, 4, []byte("POST"))
+	assert.ArrayEqual(t, wireValues(vc.XXX_unrecognized, 4), [][]byte{path, method})
+}
+
+func TestWireFields(t *testing.T) {
+	b := appendVarintField(nil, 1, 300)
+	b = appendBytesField(b, 2, []byte("foo"))
+	b = appendVarintField(b, 1, 2)
+
+	type field struct {
+		number   int
+		wireType int
+		value    []byte
+	}
+	var fields []field
+	wireFields(b, func(number, wireType int, value []byte) {
+		fields = append(fields, field{number, wireType, value})
+	})
+
+	assert.DeepEqual(t, fields, []field{
+		{1, proto.WireVarint, proto.EncodeVarint(300)},
+		{2, proto.WireBytes, []byte("foo")},
+		{1, proto.WireVarint, []byte{2}},
+	})
+
+	// truncated
+	fields = nil
+	wireFields(b[:len(b)-4], func(number, wireType int, value []byte) {
+		fields = append(fields, field{number, wireType, value})
+	})
+	assert.DeepEqual(t, fields, []field{{1, proto.WireVarint, proto.EncodeVarint(300)}})
+}
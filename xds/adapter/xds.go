@@ -17,6 +17,7 @@ limitations under the License.
 package adapter
 
 import (
+	"errors"
 	"io"
 	"net"
 	"sync"
@@ -24,6 +25,7 @@ import (
 
 	envoyapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	accesslog "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	envoydiscovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/server"
 	"google.golang.org/grpc"
 
@@ -58,6 +60,12 @@ type XDS interface {
 type XDSOption struct {
 	mkALSReporterConfig     func() alsReporterConfig
 	staticResourcesProvider staticResourcesProvider
+	ads                     bool
+	delta                   bool
+	certFile                string
+	keyFile                 string
+	clientCAFile            string
+	authorizations          []string
 }
 
 func (x *XDSOption) merge(options []XDSOption) {
@@ -65,11 +73,26 @@ func (x *XDSOption) merge(options []XDSOption) {
 		if option.mkALSReporterConfig != nil {
 			x.mkALSReporterConfig = option.mkALSReporterConfig
 		}
-		if option.staticResourcesProvider == nil {
-			x.staticResourcesProvider = fixedStaticResourcesProvider{}
-		} else {
+		if option.staticResourcesProvider != nil {
 			x.staticResourcesProvider = option.staticResourcesProvider
 		}
+		if option.ads {
+			x.ads = true
+		}
+		if option.delta {
+			x.delta = true
+		}
+		if option.certFile != "" {
+			x.certFile = option.certFile
+			x.keyFile = option.keyFile
+			x.clientCAFile = option.clientCAFile
+		}
+		if option.authorizations != nil {
+			x.authorizations = option.authorizations
+		}
+	}
+	if x.staticResourcesProvider == nil {
+		x.staticResourcesProvider = fixedStaticResourcesProvider{}
 	}
 }
 
@@ -90,6 +113,45 @@ func WithTopResponseLog(n int, interval time.Duration) XDSOption {
 	}
 }
 
+// WithADSConfigSources causes Clusters and Listeners to reference the
+// aggregated discovery service (ADS) for their endpoints and routes, rather
+// than the individual EDS and RDS services, and holds responses until all
+// resources of a type are requested, so that updates are consistent. Envoy
+// must be bootstrapped with an ADS config.
+func WithADSConfigSources() XDSOption {
+	return XDSOption{ads: true}
+}
+
+// WithDeltaConfigSources causes Clusters and Listeners to reference the
+// incremental (delta) EDS and RDS services for their endpoints and routes,
+// so that only changed resources are sent to Envoy. It has no effect if
+// WithADSConfigSources is also given, since the incremental ADS service is
+// selected by Envoy's ADS config. The incremental services are served
+// regardless.
+func WithDeltaConfigSources() XDSOption {
+	return XDSOption{delta: true}
+}
+
+// WithTLS serves xDS and access logs over TLS, using the certificate and key
+// in the given files. If clientCAFile is not empty, clients must present a
+// certificate signed by one of the CAs it contains. The files are reloaded
+// when they change.
+func WithTLS(certFile, keyFile, clientCAFile string) XDSOption {
+	return XDSOption{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+}
+
+// WithClientAuthorization restricts the proxies and zones that clients may
+// request, according to the subject alternative names of their certificates.
+// Each authorization is of the form IDENTITY=PROXY[/ZONE], where PROXY and
+// ZONE may be "*" to allow any name, and an omitted ZONE allows any zone.
+// Requires WithTLS with a client CA file.
+func WithClientAuthorization(authorizations ...string) XDSOption {
+	if authorizations == nil {
+		authorizations = []string{}
+	}
+	return XDSOption{authorizations: authorizations}
+}
+
 // withStaticResources adds static resources to the XDS response.
 func withStaticResources(provider staticResourcesProvider) XDSOption {
 	return XDSOption{
@@ -111,16 +173,19 @@ func NewXDS(
 	xdsOption := XDSOption{}
 	xdsOption.merge(options)
 
-	snapshotCache := newSnapshotCache()
+	snapshotCache := newSnapshotCache(xdsOption.ads)
+	deltaCache := newDeltaCache()
 
 	consumer := newCachingConsumerStats(
 		newCachingConsumer(
-			snapshotCache,
+			multiSnapshotCache{snapshotCache, deltaCache},
 			registrar,
 			xdsClusterName,
 			caFile,
 			defaultTimeout,
 			resolveDNS,
+			xdsOption.ads,
+			xdsOption.delta,
 			xdsOption.staticResourcesProvider,
 		),
 		stats,
@@ -136,13 +201,50 @@ func NewXDS(
 		return nil, err
 	}
 
+	closers := []io.Closer{stats}
+	serverOptions := []grpc.ServerOption{}
+
+	if xdsOption.authorizations != nil && xdsOption.clientCAFile == "" {
+		return nil, errors.New("client authorization requires TLS with a client CA file")
+	}
+
+	if xdsOption.certFile != "" {
+		reloader, err := newCertReloader(
+			xdsOption.certFile,
+			xdsOption.keyFile,
+			xdsOption.clientCAFile,
+		)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, reloader)
+		serverOptions = append(serverOptions, grpc.Creds(reloader.credentials()))
+
+		if xdsOption.authorizations != nil {
+			authz, err := newClientAuthorizer(xdsOption.authorizations)
+			if err != nil {
+				reloader.Close()
+				return nil, err
+			}
+			serverOptions = append(serverOptions, authz.serverOptions()...)
+		}
+	}
+
+	srv := versionedServer{
+		xdsServer{
+			Server: server.NewServer(snapshotCache, consumer),
+			delta:  newDeltaServer(deltaCache, consumer),
+		},
+	}
+
 	return &xds{
 		Consumer:         consumer,
 		addr:             addr,
-		server:           server.NewServer(snapshotCache, consumer),
+		server:           srv,
 		logServer:        als,
+		serverOptions:    serverOptions,
 		resolvedAddrChan: make(chan string, 1),
-		closers:          &closeOnce{closers: []io.Closer{stats}},
+		closers:          &closeOnce{closers: closers},
 	}, nil
 }
 
@@ -150,8 +252,9 @@ type xds struct {
 	poller.Consumer
 	addr string
 
-	server           server.Server
+	server           versionedServer
 	logServer        accesslog.AccessLogServiceServer
+	serverOptions    []grpc.ServerOption
 	resolvedAddr     string
 	resolvedAddrChan chan string
 	gRPCServer       *grpc.Server
@@ -172,15 +275,20 @@ func (x *xds) Run() error {
 
 	console.Info().Printf("serving xDS on %s", resolvedAddr)
 
-	x.gRPCServer = grpc.NewServer()
+	x.gRPCServer = grpc.NewServer(x.serverOptions...)
+	envoydiscovery.RegisterAggregatedDiscoveryServiceServer(x.gRPCServer, x.server)
 	envoyapi.RegisterClusterDiscoveryServiceServer(x.gRPCServer, x.server)
 	envoyapi.RegisterEndpointDiscoveryServiceServer(x.gRPCServer, x.server)
 	envoyapi.RegisterRouteDiscoveryServiceServer(x.gRPCServer, x.server)
 	envoyapi.RegisterListenerDiscoveryServiceServer(x.gRPCServer, x.server)
+	for i := range v3DiscoveryServices {
+		x.gRPCServer.RegisterService(&v3DiscoveryServices[i], x.server)
+	}
 
 	if x.logServer != nil {
 		console.Info().Println("log streaming enabled")
 		accesslog.RegisterAccessLogServiceServer(x.gRPCServer, x.logServer)
+		x.gRPCServer.RegisterService(&v3AccessLogService, x.logServer)
 	}
 
 	defer console.Info().Println("grpc server exit")
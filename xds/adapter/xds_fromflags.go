@@ -17,6 +17,7 @@ limitations under the License.
 package adapter
 
 import (
+	"errors"
 	"time"
 
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
@@ -47,8 +48,43 @@ func NewXDSFromFlags(
 	ff := &xdsFromFlags{
 		statsFromFlags:     statsFromFlags,
 		resourcesFromFlags: newResourcesFromFlags(flags.Scope("static-resources", "static resources")),
+		authorizations:     tbnflag.NewStrings(),
 	}
 
+	tlsFlags := flags.Scope("tls", "TLS")
+
+	tlsFlags.StringVar(
+		&ff.certFile,
+		"cert-file",
+		"",
+		"Path to a PEM-encoded certificate with which to serve xDS and access log streams over TLS. "+
+			"Requires --tls.key-file. The certificate is reloaded when the file changes.",
+	)
+
+	tlsFlags.StringVar(
+		&ff.keyFile,
+		"key-file",
+		"",
+		"Path to the PEM-encoded private key for --tls.cert-file.",
+	)
+
+	tlsFlags.StringVar(
+		&ff.clientCAFile,
+		"client-ca-file",
+		"",
+		"Path to PEM-encoded CA certificates. If set, Envoy must present a client certificate "+
+			"signed by one of these CAs (mutual TLS). Requires --tls.cert-file.",
+	)
+
+	tlsFlags.Var(
+		&ff.authorizations,
+		"authorize",
+		"A comma-separated list of IDENTITY=PROXY[/ZONE] authorizations. If set, a client may "+
+			"only request the proxies and zones authorized for a DNS, URI, email or IP subject "+
+			"alternative name of its certificate. PROXY and ZONE may be \"*\" to allow any name, "+
+			"and an omitted ZONE allows any zone. Requires --tls.client-ca-file.",
+	)
+
 	flags.HostPortVar(
 		&ff.addr,
 		"addr",
@@ -94,6 +130,25 @@ func NewXDSFromFlags(
 		"If true, resolve EDS hostnames to IP addresses.",
 	)
 
+	flags.BoolVar(
+		&ff.ads,
+		"ads",
+		false,
+		"If true, clusters and listeners direct Envoy to fetch endpoints and routes from the "+
+			"aggregated discovery service (ADS), rather than separate EDS and RDS streams, and "+
+			"responses are held until consistent. Envoy must be bootstrapped with an ads_config "+
+			"referencing rotor.",
+	)
+
+	flags.BoolVar(
+		&ff.delta,
+		"delta",
+		false,
+		"If true, and --ads is false, clusters and listeners direct Envoy to fetch endpoints and "+
+			"routes with incremental (delta) xDS, so that only changed resources are sent. "+
+			"Incremental xDS is served regardless, for Envoys configured to request it.",
+	)
+
 	return ff
 }
 
@@ -105,6 +160,12 @@ type xdsFromFlags struct {
 	statsFromFlags     stats.FromFlags
 	defaultTimeout     time.Duration
 	resolveDNS         bool
+	ads                bool
+	delta              bool
+	certFile           string
+	keyFile            string
+	clientCAFile       string
+	authorizations     tbnflag.Strings
 	resourcesFromFlags resourcesFromFlags
 }
 
@@ -119,6 +180,23 @@ func (ff *xdsFromFlags) Make(registrar poller.Registrar) (XDS, error) {
 		return nil, err
 	}
 
+	options := []XDSOption{
+		WithTopResponseLog(ff.grpcLogTopN, ff.grpcLogTopInterval),
+		withStaticResources(provider),
+	}
+	if ff.ads {
+		options = append(options, WithADSConfigSources())
+	}
+	if ff.delta {
+		options = append(options, WithDeltaConfigSources())
+	}
+	if ff.certFile != "" {
+		options = append(options, WithTLS(ff.certFile, ff.keyFile, ff.clientCAFile))
+	}
+	if len(ff.authorizations.Strings) > 0 {
+		options = append(options, WithClientAuthorization(ff.authorizations.Strings...))
+	}
+
 	return NewXDS(
 		ff.addr.Addr(),
 		registrar,
@@ -126,11 +204,27 @@ func (ff *xdsFromFlags) Make(registrar poller.Registrar) (XDS, error) {
 		ff.defaultTimeout,
 		ff.resolveDNS,
 		stats,
-		WithTopResponseLog(ff.grpcLogTopN, ff.grpcLogTopInterval),
-		withStaticResources(provider),
+		options...,
 	)
 }
 
 func (ff *xdsFromFlags) Validate() error {
+	if (ff.certFile == "") != (ff.keyFile == "") {
+		return errors.New("--tls.cert-file and --tls.key-file must be specified together")
+	}
+
+	if ff.clientCAFile != "" && ff.certFile == "" {
+		return errors.New("--tls.client-ca-file requires --tls.cert-file")
+	}
+
+	if len(ff.authorizations.Strings) > 0 {
+		if ff.clientCAFile == "" {
+			return errors.New("--tls.authorize requires --tls.client-ca-file")
+		}
+		if _, err := newClientAuthorizer(ff.authorizations.Strings); err != nil {
+			return err
+		}
+	}
+
 	return ff.resourcesFromFlags.Validate()
 }
@@ -45,6 +45,58 @@ func TestNewXDSFromFlags(t *testing.T) {
 	assert.False(t, ff.resolveDNS)
 	flagset.Parse([]string{"--resolve-dns"})
 	assert.True(t, ff.resolveDNS)
+	assert.False(t, ff.ads)
+	flagset.Parse([]string{"--ads"})
+	assert.True(t, ff.ads)
+	assert.False(t, ff.delta)
+	flagset.Parse([]string{"--delta"})
+	assert.True(t, ff.delta)
+	flagset.Parse([]string{
+		"--tls.cert-file=/etc/tls/cert.pem",
+		"--tls.key-file=/etc/tls/key.pem",
+		"--tls.client-ca-file=/etc/tls/client-ca.pem",
+		"--tls.authorize=spiffe://mesh/web=web-proxy/us-east,api.example.com=api-proxy",
+	})
+	assert.Equal(t, ff.certFile, "/etc/tls/cert.pem")
+	assert.Equal(t, ff.keyFile, "/etc/tls/key.pem")
+	assert.Equal(t, ff.clientCAFile, "/etc/tls/client-ca.pem")
+	assert.ArrayEqual(
+		t,
+		ff.authorizations.Strings,
+		[]string{"spiffe://mesh/web=web-proxy/us-east", "api.example.com=api-proxy"},
+	)
+}
+
+func TestXDSFromFlagsValidateTLS(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockResourcesFromFlags := newMockResourcesFromFlags(ctrl)
+	mockResourcesFromFlags.EXPECT().Validate().Return(nil).Times(2)
+
+	ff := xdsFromFlags{
+		resourcesFromFlags: mockResourcesFromFlags,
+		authorizations:     tbnflag.NewStrings(),
+	}
+	assert.Nil(t, ff.Validate())
+
+	ff.certFile = "cert.pem"
+	assert.ErrorContains(t, ff.Validate(), "--tls.key-file")
+
+	ff.keyFile = "key.pem"
+	assert.Nil(t, ff.Validate())
+
+	ff.authorizations.Strings = []string{"id=proxy"}
+	assert.ErrorContains(t, ff.Validate(), "requires --tls.client-ca-file")
+
+	ff.clientCAFile = "ca.pem"
+	ff.authorizations.Strings = []string{"id"}
+	assert.ErrorContains(t, ff.Validate(), "malformed authorization")
+
+	ff.certFile = ""
+	ff.keyFile = ""
+	ff.authorizations.Strings = nil
+	assert.ErrorContains(t, ff.Validate(), "requires --tls.cert-file")
 }
 
 func TestXDSFromFlagsMake(t *testing.T) {
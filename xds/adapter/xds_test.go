@@ -18,6 +18,10 @@ package adapter
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -25,9 +29,14 @@ import (
 	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	envoylog "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v2"
 	envoyals "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	envoydiscovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache"
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 
 	"github.com/turbinelabs/nonstdlib/ptr"
 	tbnstrings "github.com/turbinelabs/nonstdlib/strings"
@@ -119,7 +128,236 @@ func TestXDSLifecycle(t *testing.T) {
 	<-runError
 }
 
+func TestXDSLifecycleWithTLS(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "localhost")
+	certFile, keyFile, caFile := writeTLSFiles(t, dir, ca, certPEM, keyPEM)
+
+	mockStats := stats.NewMockStats(ctrl)
+	mockStats.EXPECT().Close().Return(nil)
+
+	xds, err := NewXDS(
+		"127.0.0.1:0",
+		poller.NewNopRegistrar(),
+		"",
+		defaultDefaultTimeout,
+		false,
+		mockStats,
+		WithTLS(certFile, keyFile, caFile),
+		WithClientAuthorization("spiffe://mesh/web=web-proxy/us-east"),
+	)
+	assert.Nil(t, err)
+
+	runError := make(chan error, 1)
+	go func() {
+		defer close(runError)
+		runError <- xds.Run()
+	}()
+
+	resolvedAddr := xds.Addr()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCertPEM, clientKeyPEM := ca.issue(t, "web.example.com", "spiffe://mesh/web")
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	assert.Nil(t, err)
+
+	conn, err := grpc.Dial(
+		resolvedAddr,
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			ServerName:   "localhost",
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+		})),
+		grpc.WithBlock(),
+	)
+	assert.Nil(t, err)
+
+	client := envoyapi.NewListenerDiscoveryServiceClient(conn)
+	_, err = client.FetchListeners(
+		context.TODO(),
+		&envoyapi.DiscoveryRequest{Node: mkNode("web-proxy", "us-east")},
+	)
+	assert.NotEqual(t, status.Code(err), codes.PermissionDenied)
+
+	_, err = client.FetchListeners(
+		context.TODO(),
+		&envoyapi.DiscoveryRequest{Node: mkNode("api-proxy", "us-east")},
+	)
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	stream, err := client.StreamListeners(context.TODO())
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&envoyapi.DiscoveryRequest{Node: mkNode("api-proxy", "us-east")}))
+	_, err = stream.Recv()
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	assert.Nil(t, conn.Close())
+
+	// Clients without a certificate are rejected during the handshake.
+	_, err = grpc.Dial(
+		resolvedAddr,
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			ServerName: "localhost",
+			RootCAs:    roots,
+		})),
+		grpc.WithBlock(),
+		grpc.WithTimeout(250*time.Millisecond),
+	)
+	assert.NonNil(t, err)
+
+	xds.Stop()
+
+	// Ignore the error Serve (and therefore Run) returns on Stop.
+	<-runError
+}
+
+func TestXDSServesV3(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockStats := stats.NewMockStats(ctrl)
+	mockStats.EXPECT().Count(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockStats.EXPECT().Timing(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockStats.EXPECT().Gauge(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockStats.EXPECT().Event(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStats.EXPECT().Close().Return(nil)
+
+	xds, err := NewXDS(
+		":0",
+		poller.NewNopRegistrar(),
+		"",
+		defaultDefaultTimeout,
+		false,
+		mockStats,
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, xds.Consume(poller.MkFixtureObjects()))
+
+	runError := make(chan error, 1)
+	go func() {
+		defer close(runError)
+		runError <- xds.Run()
+	}()
+
+	conn, err := grpc.Dial(xds.Addr(), grpc.WithInsecure(), grpc.WithBlock())
+	assert.Nil(t, err)
+
+	node := mkNode("main-test-proxy", "the-zone")
+
+	// v3 transport, v3 resources by default
+	resp := &envoyapi.DiscoveryResponse{}
+	err = conn.Invoke(
+		context.TODO(),
+		"/envoy.service.cluster.v3.ClusterDiscoveryService/FetchClusters",
+		&envoyapi.DiscoveryRequest{Node: node},
+		resp,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, resp.TypeUrl, v3ClusterType)
+	assert.NotEqual(t, len(resp.Resources), 0)
+	for _, r := range resp.Resources {
+		assert.Equal(t, r.TypeUrl, v3ClusterType)
+	}
+
+	// v3 transport, v2 resources
+	resp = &envoyapi.DiscoveryResponse{}
+	err = conn.Invoke(
+		context.TODO(),
+		"/envoy.service.cluster.v3.ClusterDiscoveryService/FetchClusters",
+		&envoyapi.DiscoveryRequest{Node: node, TypeUrl: cache.ClusterType},
+		resp,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, resp.TypeUrl, cache.ClusterType)
+
+	// v2 transport, v3 and v2 resources on one ADS stream
+	client := envoydiscovery.NewAggregatedDiscoveryServiceClient(conn)
+	stream, err := client.StreamAggregatedResources(context.TODO())
+	assert.Nil(t, err)
+
+	assert.Nil(t, stream.Send(&envoyapi.DiscoveryRequest{Node: node, TypeUrl: v3ListenerType}))
+	resp, err = stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, resp.TypeUrl, v3ListenerType)
+	for _, r := range resp.Resources {
+		assert.Equal(t, r.TypeUrl, v3ListenerType)
+	}
+
+	assert.Nil(t, stream.Send(&envoyapi.DiscoveryRequest{Node: node, TypeUrl: cache.ClusterType}))
+	resp, err = stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, resp.TypeUrl, cache.ClusterType)
+	for _, r := range resp.Resources {
+		assert.Equal(t, r.TypeUrl, cache.ClusterType)
+	}
+
+	assert.Nil(t, conn.Close())
+
+	xds.Stop()
+
+	// Ignore the error Serve (and therefore Run) returns on Stop.
+	<-runError
+}
+
+func TestNewXDSClientAuthorizationWithoutClientCA(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	_, err := NewXDS(
+		":0",
+		poller.NewNopRegistrar(),
+		"",
+		defaultDefaultTimeout,
+		false,
+		stats.NewMockStats(ctrl),
+		WithClientAuthorization("spiffe://mesh/web=web-proxy"),
+	)
+	assert.ErrorContains(t, err, "client CA")
+}
+
 func TestXDSLifecycleWithStreamingLogs(t *testing.T) {
+	testXDSLifecycleWithStreamingLogs(
+		t,
+		func(conn *grpc.ClientConn, msg *envoyals.StreamAccessLogsMessage) error {
+			client := envoyals.NewAccessLogServiceClient(conn)
+			callClient, err := client.StreamAccessLogs(context.TODO())
+			if err != nil {
+				return err
+			}
+			return callClient.Send(msg)
+		},
+	)
+}
+
+func TestXDSLifecycleWithV3StreamingLogs(t *testing.T) {
+	testXDSLifecycleWithStreamingLogs(
+		t,
+		func(conn *grpc.ClientConn, msg *envoyals.StreamAccessLogsMessage) error {
+			stream, err := conn.NewStream(
+				context.TODO(),
+				&grpc.StreamDesc{ClientStreams: true},
+				"/envoy.service.accesslog.v3.AccessLogService/StreamAccessLogs",
+			)
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(msg)
+		},
+	)
+}
+
+func testXDSLifecycleWithStreamingLogs(
+	t *testing.T,
+	send func(*grpc.ClientConn, *envoyals.StreamAccessLogsMessage) error,
+) {
 	ctrl := gomock.NewController(assert.Tracing(t))
 	defer ctrl.Finish()
 
@@ -175,11 +413,8 @@ func TestXDSLifecycleWithStreamingLogs(t *testing.T) {
 	conn, err := grpc.Dial(resolvedAddr, grpc.WithInsecure(), grpc.WithBlock())
 	assert.Nil(t, err)
 
-	client := envoyals.NewAccessLogServiceClient(conn)
-	callClient, err := client.StreamAccessLogs(context.TODO())
-	assert.Nil(t, err)
-
-	err = callClient.Send(
+	err = send(
+		conn,
 		&envoyals.StreamAccessLogsMessage{
 			Identifier: &envoyals.StreamAccessLogsMessage_Identifier{
 				Node: &envoycore.Node{
@@ -238,3 +473,32 @@ func TestXDSLifecycleWithStreamingLogs(t *testing.T) {
 	// Ignore the error Serve (and therefore Run) returns on Stop.
 	<-runError
 }
+
+func TestXDSOptionMerge(t *testing.T) {
+	x := XDSOption{}
+	x.merge(nil)
+	assert.False(t, x.ads)
+	assert.False(t, x.delta)
+	assert.Equal(t, x.certFile, "")
+	assert.Nil(t, x.authorizations)
+	assert.DeepEqual(t, x.staticResourcesProvider, fixedStaticResourcesProvider{})
+
+	provider := fixedStaticResourcesProvider{res: staticResources{version: "v"}}
+	x = XDSOption{}
+	x.merge([]XDSOption{
+		withStaticResources(provider),
+		WithADSConfigSources(),
+		WithDeltaConfigSources(),
+		WithTopResponseLog(1, time.Second),
+		WithTLS("cert.pem", "key.pem", "ca.pem"),
+		WithClientAuthorization("id=proxy"),
+	})
+	assert.True(t, x.ads)
+	assert.True(t, x.delta)
+	assert.Equal(t, x.certFile, "cert.pem")
+	assert.Equal(t, x.keyFile, "key.pem")
+	assert.Equal(t, x.clientCAFile, "ca.pem")
+	assert.ArrayEqual(t, x.authorizations, []string{"id=proxy"})
+	assert.NonNil(t, x.mkALSReporterConfig)
+	assert.DeepEqual(t, x.staticResourcesProvider, provider)
+}
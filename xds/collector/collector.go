@@ -45,3 +45,13 @@ type ClusterCollector interface {
 	io.Closer
 	Collect() (api.Clusters, map[string][]error)
 }
+
+// StreamingClusterCollector receives tbn.Clusters pushed by a CDS/EDS or ADS
+// server over a long-lived stream. Run invokes the given function with the
+// complete set of clusters each time the pushed state changes, along with
+// errors keyed by cluster name, as for ClusterCollector. Run blocks until the
+// collector is closed.
+type StreamingClusterCollector interface {
+	io.Closer
+	Run(func(api.Clusters, map[string][]error)) error
+}
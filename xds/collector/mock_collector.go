@@ -56,3 +56,50 @@ func (m *MockClusterCollector) Collect() (api.Clusters, map[string][]error) {
 func (mr *MockClusterCollectorMockRecorder) Collect() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Collect", reflect.TypeOf((*MockClusterCollector)(nil).Collect))
 }
+
+// MockStreamingClusterCollector is a mock of StreamingClusterCollector interface
+type MockStreamingClusterCollector struct {
+	ctrl     *gomock.Controller
+	recorder *MockStreamingClusterCollectorMockRecorder
+}
+
+// MockStreamingClusterCollectorMockRecorder is the mock recorder for MockStreamingClusterCollector
+type MockStreamingClusterCollectorMockRecorder struct {
+	mock *MockStreamingClusterCollector
+}
+
+// NewMockStreamingClusterCollector creates a new mock instance
+func NewMockStreamingClusterCollector(ctrl *gomock.Controller) *MockStreamingClusterCollector {
+	mock := &MockStreamingClusterCollector{ctrl: ctrl}
+	mock.recorder = &MockStreamingClusterCollectorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockStreamingClusterCollector) EXPECT() *MockStreamingClusterCollectorMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method
+func (m *MockStreamingClusterCollector) Close() error {
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close
+func (mr *MockStreamingClusterCollectorMockRecorder) Close() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStreamingClusterCollector)(nil).Close))
+}
+
+// Run mocks base method
+func (m *MockStreamingClusterCollector) Run(arg0 func(api.Clusters, map[string][]error)) error {
+	ret := m.ctrl.Call(m, "Run", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Run indicates an expected call of Run
+func (mr *MockStreamingClusterCollectorMockRecorder) Run(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockStreamingClusterCollector)(nil).Run), arg0)
+}